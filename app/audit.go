@@ -0,0 +1,161 @@
+package appunlynx
+
+import (
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/audit"
+	"github.com/ldsec/unlynx/services"
+	"github.com/urfave/cli"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// BEGIN CLIENT: AUDITOR ----------
+
+// exportAuditLog writes the audit log of a server (index in the group definition file) to a file. The auditor is
+// identified by its private key (hex).
+func exportAuditLog(groupFileName string, serverIndex int, filename, privateKey string) error {
+	el, err := openGroupToml(groupFileName)
+	if err != nil {
+		return errors.New("could not open group toml: " + err.Error())
+	}
+	if serverIndex < 0 || serverIndex >= len(el.List) {
+		return errors.New("server index " + strconv.Itoa(serverIndex) + " is not in the group")
+	}
+	keys, err := readKeyPair(privateKey)
+	if err != nil {
+		return errors.New("could not read the private key of the auditor: " + err.Error())
+	}
+
+	entries, err := servicesunlynx.NewUnLynxClientWithKeys(el.List[serverIndex], "auditor", keys).SendAuditLogQuery()
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := libunlynxaudit.WriteEntries(f, entries); err != nil {
+		return err
+	}
+	log.Info("Exported ", len(entries), " entries of the audit log of ", el.List[serverIndex], " to ", filename)
+	return nil
+}
+
+// verifyAuditLog checks offline the hash chain of an exported audit log and, if a group definition file is given, the
+// signatures of its entries by the server (index in the group definition file)
+func verifyAuditLog(filename, groupFileName string, serverIndex int) error {
+	entries, err := libunlynxaudit.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := libunlynxaudit.VerifySegment(entries); err != nil {
+		return err
+	}
+	if groupFileName != "" {
+		el, err := openGroupToml(groupFileName)
+		if err != nil {
+			return errors.New("could not open group toml: " + err.Error())
+		}
+		if serverIndex < 0 || serverIndex >= len(el.List) {
+			return errors.New("server index " + strconv.Itoa(serverIndex) + " is not in the group")
+		}
+		if err := libunlynxaudit.VerifySignatures(entries, el.List[serverIndex].Public); err != nil {
+			return err
+		}
+	} else {
+		log.Warn("The signatures of the audit log are not verified (no group definition file)")
+	}
+
+	surveys := make(map[string]bool)
+	for _, e := range entries {
+		surveys[e.SurveyID] = true
+	}
+	head := ""
+	if len(entries) > 0 {
+		head = hex.EncodeToString(entries[len(entries)-1].Hash)
+	}
+	log.Info("Audit log ", filename, " is valid: ", len(entries), " entries for ", len(surveys), " survey(s), head ", head)
+	return nil
+}
+
+func runAuditExport(c *cli.Context) error {
+	filename := c.String(optionLog)
+	if filename == "" {
+		return errors.New("the log file is required")
+	}
+	return exportAuditLog(c.String(optionGroupFile), c.Int(optionServer), filename, c.String(optionKey))
+}
+
+func runAuditKeygen(c *cli.Context) error {
+	private, public, err := newHexKeyPair()
+	if err != nil {
+		return err
+	}
+	log.Info("Private key (for audit export): ", private)
+	log.Info("Public key (for the auditors file of the servers): ", public)
+	return nil
+}
+
+// newHexKeyPair generates a key pair (private and public key in hex) of a client
+func newHexKeyPair() (string, string, error) {
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+	private, err := encoding.ScalarToStringHex(libunlynx.SuiTe, keys.Private)
+	if err != nil {
+		return "", "", err
+	}
+	public, err := encoding.PointToStringHex(libunlynx.SuiTe, keys.Public)
+	if err != nil {
+		return "", "", err
+	}
+	return private, public, nil
+}
+
+// readKeyPair returns the key pair of a client from its private key (hex)
+func readKeyPair(privateKey string) (*key.Pair, error) {
+	private, err := encoding.StringHexToScalar(libunlynx.SuiTe, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &key.Pair{Private: private, Public: libunlynx.SuiTe.Point().Mul(private, nil)}, nil
+}
+
+func runAuditVerify(c *cli.Context) error {
+	filename := c.String(optionLog)
+	if filename == "" {
+		return errors.New("the log file is required")
+	}
+	return verifyAuditLog(filename, c.String(optionGroupFile), c.Int(optionServer))
+}
+
+// readPublicKeys reads the public keys (hex, one per line) of the auditors or schema admins of a server
+func readPublicKeys(filename string) ([]kyber.Point, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]kyber.Point, 0)
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		public, err := encoding.StringHexToPoint(libunlynx.SuiTe, line)
+		if err != nil {
+			return nil, errors.New("invalid public key " + line + ": " + err.Error())
+		}
+		keys = append(keys, public)
+	}
+	return keys, nil
+}
+
+// CLIENT END: AUDITOR ----------
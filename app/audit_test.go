@@ -0,0 +1,77 @@
+package appunlynx
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/audit"
+	"github.com/stretchr/testify/assert"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/onet/v3/app"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestVerifyAuditLog(t *testing.T) {
+	filename := "audit_test.log"
+	defer os.Remove(filename)
+
+	auditLog, err := libunlynxaudit.OpenLog(filename)
+	assert.NoError(t, err)
+	private, public := libunlynx.GenKey()
+	auditLog.SetSigner(private)
+	for _, kind := range []string{libunlynxaudit.KindQuery, libunlynxaudit.KindResult} {
+		_, err := auditLog.Append("survey", kind, []byte(kind))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, auditLog.Close())
+	assert.NoError(t, verifyAuditLog(filename, "", 0))
+
+	// the entries are signed by the server of the group
+	groupFile := "audit_test_group.toml"
+	defer os.Remove(groupFile)
+	assert.NoError(t, writeGroupFile(groupFile, public))
+	assert.NoError(t, verifyAuditLog(filename, groupFile, 0))
+	assert.Error(t, verifyAuditLog(filename, groupFile, 1))
+	_, otherPublic := libunlynx.GenKey()
+	assert.NoError(t, writeGroupFile(groupFile, otherPublic))
+	assert.Error(t, verifyAuditLog(filename, groupFile, 0))
+
+	// the entries are in the wrong order
+	entries, err := libunlynxaudit.ReadFile(filename)
+	assert.NoError(t, err)
+	f, err := os.Create(filename)
+	assert.NoError(t, err)
+	assert.NoError(t, libunlynxaudit.WriteEntries(f, []libunlynxaudit.Entry{entries[1], entries[0]}))
+	f.Close()
+	assert.Error(t, verifyAuditLog(filename, "", 0))
+
+	assert.Error(t, verifyAuditLog("missing_audit_test.log", "", 0))
+}
+
+func TestReadPublicKeys(t *testing.T) {
+	filename := "auditors_test.txt"
+	defer os.Remove(filename)
+
+	_, public := libunlynx.GenKey()
+	hexPublic, err := encoding.PointToStringHex(libunlynx.SuiTe, public)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(filename, []byte(hexPublic+"\n\n"), 0600))
+	auditors, err := readPublicKeys(filename)
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(auditors)) {
+		assert.True(t, auditors[0].Equal(public))
+	}
+
+	assert.NoError(t, ioutil.WriteFile(filename, []byte("not a key\n"), 0600))
+	_, err = readPublicKeys(filename)
+	assert.Error(t, err)
+}
+
+// writeGroupFile writes a group definition file with one server with the given public key
+func writeGroupFile(filename string, public kyber.Point) error {
+	server := app.NewServerToml(libunlynx.SuiTe, public, network.NewAddress(network.TLS, "127.0.0.1:7000"), "server", nil)
+	return app.NewGroupToml(server).Save(filename)
+}
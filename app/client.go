@@ -16,19 +16,28 @@ import (
 )
 
 // BEGIN CLIENT: QUERIER ----------
-func startQuery(el *onet.Roster, proofs bool, sum []string, count bool, whereQueryValues []libunlynx.WhereQueryAttribute, predicate string, groupBy []string) error {
+func startQuery(el *onet.Roster, proofs bool, sum []string, count bool, whereQueryValues []libunlynx.WhereQueryAttribute, predicate string, groupBy []string, dps int) error {
 	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
 
+	// without data providers the servers use their test data (1 DP for each server)
+	appFlag := dps == 0
+	if appFlag {
+		dps = 1
+	}
+
 	nbrDPs := make(map[string]int64)
 	//how many data providers for each server
 	for _, server := range el.List {
-		nbrDPs[server.String()] = 1 // 1 DP for each server
+		nbrDPs[server.String()] = int64(dps)
 	}
 
-	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofs, true, sum, count, whereQueryValues, predicate, groupBy)
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofs, appFlag, sum, count, whereQueryValues, predicate, groupBy)
 	if err != nil {
 		return err
 	}
+	if !appFlag {
+		log.Info("Survey ", *surveyID, " created, waiting for ", dps, " data provider(s) per server to upload their data")
+	}
 
 	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
 	if err != nil {
@@ -56,13 +65,14 @@ func runUnLynx(c *cli.Context) {
 	whereQueryValues := c.String("where")
 	predicate := c.String("predicate")
 	groupBy := c.String("groupBy")
+	dps := c.Int("dps")
 
 	el, err := openGroupToml(tomlFileName)
 	log.ErrFatal(err, "Could not open group toml.")
 
 	sumFinal, countFinal, whereFinal, predicateFinal, groupByFinal, err := parseQuery(el, sum, count, whereQueryValues, predicate, groupBy)
 
-	err = startQuery(el, proofs, sumFinal, countFinal, whereFinal, predicateFinal, groupByFinal)
+	err = startQuery(el, proofs, sumFinal, countFinal, whereFinal, predicateFinal, groupByFinal, dps)
 	log.ErrFatal(err)
 }
 
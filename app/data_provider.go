@@ -0,0 +1,181 @@
+package appunlynx
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/ldsec/unlynx/data"
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/satori/go.uuid"
+	"github.com/urfave/cli"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// uploadBatchSize is the number of responses encrypted and sent in each chunk of an upload
+const uploadBatchSize = 1000
+
+// BEGIN CLIENT: DATA PROVIDER ----------
+
+// uploadData encrypts and uploads the responses of the data provider dpID to a survey. With a key pair, the data provider
+// first registers to the survey (with this key, which the querier has to authorize) and signs its upload. Otherwise the
+// upload is anonymous, which the surveys requiring registration reject.
+func uploadData(el *onet.Roster, serverIndex int, surveyID servicesunlynx.SurveyID, responses []libunlynx.DpClearResponse, count, preAggregate bool, dpID string, keys *key.Pair) error {
+	if serverIndex < 0 || serverIndex >= len(el.List) {
+		return errors.New("server index " + strconv.Itoa(serverIndex) + " is not in the group")
+	}
+	if keys != nil && dpID == "" {
+		return errors.New("a registered data provider needs an ID")
+	}
+	if preAggregate {
+		nbrResponses := len(responses)
+		responses = libunlynx.PreAggregateDpClearResponses(responses, count)
+		// the count attribute is already set by the pre-aggregation
+		count = false
+		log.Info("Pre-aggregated ", nbrResponses, " responses into ", len(responses))
+	}
+	var client *servicesunlynx.API
+	if keys != nil {
+		client = servicesunlynx.NewUnLynxClientWithKeys(el.List[serverIndex], dpID, keys)
+		if err := client.SendDPRegistrationQuery(surveyID); err != nil {
+			return errors.New("could not register to the survey: " + err.Error())
+		}
+		log.Info("Registered as data provider ", dpID, " of survey ", surveyID)
+	} else {
+		if dpID == "" {
+			dpID = "dp-" + uuid.NewV4().String()
+		}
+		client = servicesunlynx.NewUnLynxClient(el.List[serverIndex], dpID)
+	}
+
+	// encrypts and sends the data by chunks so that the upload is not limited by the size of a message
+	log.Info("Sending ", len(responses), " responses to ", el.List[serverIndex], " for survey ", surveyID)
+	uploadID := uuid.NewV4().String()
+	nbrChunks := int64(0)
+	for i := 0; i < len(responses); i += uploadBatchSize {
+		end := i + uploadBatchSize
+		if end > len(responses) {
+			end = len(responses)
+		}
+
+		batch, err := servicesunlynx.EncryptDataToSurvey(client.String(), surveyID, responses[i:end], el.Aggregate, 1, count)
+		if err != nil {
+			return err
+		}
+		chunk := &servicesunlynx.SurveyResponseChunk{SurveyID: surveyID, UploadID: uploadID, Sequence: nbrChunks, Responses: batch.Responses}
+		if err := client.SendSurveyResponseChunk(chunk); err != nil {
+			return errors.New("could not upload the responses: " + err.Error())
+		}
+		nbrChunks++
+		log.Info("Sent ", end, "/", len(responses), " responses")
+	}
+
+	if err := client.SendSurveyResponseCommit(&servicesunlynx.SurveyResponseCommit{SurveyID: surveyID, UploadID: uploadID, NbrChunks: nbrChunks}); err != nil {
+		return errors.New("could not commit the upload: " + err.Error())
+	}
+	log.Info("Upload completed")
+	return nil
+}
+
+// readDPData reads the responses of a data file. If section is empty all the sections of the file are used.
+func readDPData(filename, section string) ([]libunlynx.DpClearResponse, error) {
+	fileData, err := dataunlynx.ReadDataFromFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if section != "" {
+		responses, ok := fileData[section]
+		if !ok {
+			return nil, errors.New("no section #" + section + " in " + filename)
+		}
+		return responses, nil
+	}
+
+	sections := make([]string, 0, len(fileData))
+	for k := range fileData {
+		sections = append(sections, k)
+	}
+	sort.Strings(sections)
+
+	responses := make([]libunlynx.DpClearResponse, 0)
+	for _, k := range sections {
+		responses = append(responses, fileData[k]...)
+	}
+	return responses, nil
+}
+
+func runUpload(c *cli.Context) error {
+	tomlFileName := c.String(optionGroupFile)
+	dataFileName := c.String(optionData)
+	surveyID := c.String(optionSurveyID)
+
+	if dataFileName == "" || surveyID == "" {
+		return errors.New("the data file and the survey ID are required")
+	}
+
+	el, err := openGroupToml(tomlFileName)
+	if err != nil {
+		return errors.New("could not open group toml: " + err.Error())
+	}
+
+	var responses []libunlynx.DpClearResponse
+	if schemaFileName := c.String(optionSchema); schemaFileName != "" {
+		schema, err := dataunlynx.ReadSchema(schemaFileName)
+		if err != nil {
+			return errors.New("could not read the schema: " + err.Error())
+		}
+		responses, err = dataunlynx.ReadCSVDataFromFile(dataFileName, schema)
+	} else {
+		responses, err = readDPData(dataFileName, c.String(optionSection))
+	}
+	if err != nil {
+		return errors.New("could not read the data file: " + err.Error())
+	}
+	log.Info("Read ", len(responses), " responses from ", dataFileName)
+
+	var keys *key.Pair
+	if privateKey := c.String(optionKey); privateKey != "" {
+		if keys, err = readKeyPair(privateKey); err != nil {
+			return errors.New("could not read the private key of the data provider: " + err.Error())
+		}
+	}
+
+	return uploadData(el, c.Int(optionServer), servicesunlynx.SurveyID(surveyID), responses, c.Bool(optionCount), c.Bool(optionPreAggregate),
+		c.String(optionDPID), keys)
+}
+
+func runDPKeygen(c *cli.Context) error {
+	private, public, err := newHexKeyPair()
+	if err != nil {
+		return err
+	}
+	log.Info("Private key (for dp upload): ", private)
+	log.Info("Public key (for the authorized data providers of a survey): ", public)
+	return nil
+}
+
+func runGenerate(c *cli.Context) error {
+	specFileName := c.String(optionSpec)
+	dataFileName := c.String(optionData)
+
+	if specFileName == "" || dataFileName == "" {
+		return errors.New("the spec file and the data file are required")
+	}
+
+	spec, err := dataunlynx.ReadGeneratorSpec(specFileName)
+	if err != nil {
+		return errors.New("could not read the spec: " + err.Error())
+	}
+	if err := dataunlynx.GenerateDataFileFromSpec(dataFileName, spec); err != nil {
+		return errors.New("could not generate the data: " + err.Error())
+	}
+	log.Info("Generated ", spec.NbrDPs*spec.Responses, " responses in ", dataFileName, " (expected result in ",
+		dataunlynx.ExpectedResultFilename(dataFileName), ")")
+	return nil
+}
+
+// CLIENT END: DATA PROVIDER ----------
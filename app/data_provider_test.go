@@ -0,0 +1,92 @@
+package appunlynx
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/ldsec/unlynx/data"
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+)
+
+func TestReadDPData(t *testing.T) {
+	filename := "dp_test_data.txt"
+	defer os.Remove(filename)
+
+	testData, err := dataunlynx.GenerateData(2, 5, 5, 0, 1, 0, 0, 0, 1, []int64{2}, true)
+	assert.NoError(t, err)
+	assert.NoError(t, dataunlynx.WriteDataToFile(filename, testData))
+
+	responses, err := readDPData(filename, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(responses))
+
+	responses, err = readDPData(filename, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, len(responses))
+
+	_, err = readDPData(filename, "2")
+	assert.Error(t, err)
+}
+
+func TestUploadData(t *testing.T) {
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	// only the second server has a data provider
+	nbrDPs := make(map[string]int64)
+	for i, server := range el.List {
+		nbrDPs[server.String()] = int64(i % 2)
+	}
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, false, false, []string{"s0"}, false, nil, "", []string{"g0"})
+	assert.NoError(t, err)
+
+	responses := make([]libunlynx.DpClearResponse, uploadBatchSize+1)
+	for i := range responses {
+		responses[i] = libunlynx.DpClearResponse{GroupByEnc: map[string]int64{"g0": int64(i % 2)}, AggregatingAttributesEnc: map[string]int64{"s0": 1}}
+	}
+	assert.Error(t, uploadData(el, 3, *surveyID, responses, false, false, "", nil))
+	assert.NoError(t, uploadData(el, 1, *surveyID, responses, false, false, "", nil))
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(*grp))
+	for i := range *grp {
+		if (*grp)[i][0] == 0 {
+			assert.Equal(t, []int64{501}, (*aggr)[i])
+		} else {
+			assert.Equal(t, []int64{500}, (*aggr)[i])
+		}
+	}
+
+	// a registered data provider uploads with its own ID and key
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+	dp := servicesunlynx.NewUnLynxClientWithKeys(el.List[1], "dp-1", keys)
+	surveyID, err = client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Sum: []string{"s0"},
+		GroupBy: []string{"g0"}, DPRegistration: true, AuthorizedDPs: []servicesunlynx.AuthorizedDP{dp.AuthorizedDP()}})
+	assert.NoError(t, err)
+
+	assert.Error(t, uploadData(el, 1, *surveyID, responses, false, false, "", nil))
+	assert.Error(t, uploadData(el, 1, *surveyID, responses, false, false, "dp-1", key.NewKeyPair(libunlynx.SuiTe)))
+	assert.NoError(t, uploadData(el, 1, *surveyID, responses, false, false, "dp-1", keys))
+	assert.Error(t, uploadData(el, 1, *surveyID, responses, false, false, "dp-1", keys))
+
+	grp, aggr, err = client.SendSurveyResultsQuery(*surveyID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(*grp))
+	for i := range *grp {
+		if (*grp)[i][0] == 0 {
+			assert.Equal(t, []int64{501}, (*aggr)[i])
+		} else {
+			assert.Equal(t, []int64{500}, (*aggr)[i])
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package appunlynx
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+
+	"github.com/ldsec/unlynx/protocols/utils"
+	"github.com/ldsec/unlynx/services"
+	"github.com/urfave/cli"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// BEGIN CLIENT: PROOFS VERIFIER ----------
+
+// exportProofs writes the proofs bundles of a survey received by a proof verifier (index in the group definition file)
+// to a file
+func exportProofs(groupFileName string, serverIndex int, surveyID string, filename string) error {
+	el, err := openGroupToml(groupFileName)
+	if err != nil {
+		return errors.New("could not open group toml: " + err.Error())
+	}
+	if serverIndex < 0 || serverIndex >= len(el.List) {
+		return errors.New("server index " + strconv.Itoa(serverIndex) + " is not in the group")
+	}
+
+	client := servicesunlynx.NewUnLynxClient(el.List[serverIndex], "proofs verifier")
+	bundles, err := client.SendProofsBundleQuery(servicesunlynx.SurveyID(surveyID))
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := protocolsunlynxutils.WriteProofsBundles(f, bundles); err != nil {
+		return err
+	}
+	log.Info("Exported the proofs of ", len(bundles), " server(s) for survey ", surveyID, " to ", filename)
+	return nil
+}
+
+// verifyProofs verifies offline exported proofs bundles of a survey against the roster of the group definition file (and
+// the digest of the results of the survey if not nil)
+func verifyProofs(groupFileName string, filename string, surveyID string, resultsDigest []byte) error {
+	el, err := openGroupToml(groupFileName)
+	if err != nil {
+		return errors.New("could not open group toml: " + err.Error())
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bundles, err := protocolsunlynxutils.ReadProofsBundles(f)
+	if err != nil {
+		return err
+	}
+
+	nbrInvalid := 0
+	for _, pb := range bundles {
+		results, err := pb.Verify(el, surveyID, resultsDigest)
+		if err != nil {
+			return err
+		}
+		valid := true
+		for _, v := range results {
+			valid = valid && v
+		}
+		if !valid {
+			nbrInvalid++
+		}
+		log.Info("Proofs of ", pb.Server, " for survey ", pb.SurveyID, ": ", results)
+	}
+	if nbrInvalid > 0 {
+		return errors.New("the proofs of " + strconv.Itoa(nbrInvalid) + " server(s) are not valid")
+	}
+	log.Info("The proofs of the ", len(bundles), " server(s) in ", filename, " are valid")
+	return nil
+}
+
+func runProofsExport(c *cli.Context) error {
+	filename := c.String(optionBundle)
+	if filename == "" {
+		return errors.New("the bundle file is required")
+	}
+	surveyID := c.String(optionSurveyID)
+	if surveyID == "" {
+		return errors.New("the survey ID is required")
+	}
+	return exportProofs(c.String(optionGroupFile), c.Int(optionServer), surveyID, filename)
+}
+
+func runProofsVerify(c *cli.Context) error {
+	filename := c.String(optionBundle)
+	if filename == "" {
+		return errors.New("the bundle file is required")
+	}
+	surveyID := c.String(optionSurveyID)
+	if surveyID == "" {
+		return errors.New("the survey ID is required")
+	}
+	var resultsDigest []byte
+	if c.String(optionDigest) != "" {
+		var err error
+		if resultsDigest, err = hex.DecodeString(c.String(optionDigest)); err != nil {
+			return errors.New("malformed results digest: " + err.Error())
+		}
+	}
+	return verifyProofs(c.String(optionGroupFile), filename, surveyID, resultsDigest)
+}
+
+// CLIENT END: PROOFS VERIFIER ----------
@@ -1,17 +1,84 @@
 package appunlynx
 
 import (
+	"errors"
+	"os"
+
+	"github.com/ldsec/unlynx/data"
+	"github.com/ldsec/unlynx/lib/audit"
+	"github.com/ldsec/unlynx/lib/shuffle"
+	"github.com/ldsec/unlynx/services"
 	"github.com/urfave/cli"
 	"go.dedis.ch/onet/v3/app"
 
 	// Empty imports to have the init-functions called which should
 	// register the protocol
 	_ "github.com/ldsec/unlynx/protocols"
+	// and the sqlite3 driver of the SQL data sources
+	_ "github.com/mattn/go-sqlite3"
 )
 
 func runServer(ctx *cli.Context) error {
 	// first check the options
 	config := ctx.String("config")
-	app.RunServer(config)
+	dataSourceFile := ctx.String(optionDataSource)
+	auditFile := ctx.String(optionAudit)
+	auditorsFile := ctx.String(optionAuditors)
+	auditMaxEntries := ctx.Int(optionAuditMaxEntries)
+	schemaAdminsFile := ctx.String(optionSchemaAdmins)
+	precomputationDir := ctx.String(optionPrecomputation)
+	if dataSourceFile == "" && auditFile == "" && auditorsFile == "" && auditMaxEntries == 0 && schemaAdminsFile == "" &&
+		precomputationDir == "" {
+		app.RunServer(config)
+		return nil
+	}
+
+	if _, err := os.Stat(config); os.IsNotExist(err) {
+		return errors.New("configuration file " + config + " does not exist")
+	}
+	_, server, err := app.ParseCothority(config)
+	if err != nil {
+		return errors.New("could not parse the configuration: " + err.Error())
+	}
+	service := server.Service(servicesunlynx.ServiceName).(*servicesunlynx.Service)
+
+	if dataSourceFile != "" {
+		dataSource, err := dataunlynx.ReadDataSource(dataSourceFile)
+		if err != nil {
+			return errors.New("could not read the data source configuration: " + err.Error())
+		}
+		service.SetDataSource(dataSource)
+	}
+	if auditFile != "" {
+		auditLog, err := libunlynxaudit.OpenLog(auditFile)
+		if err != nil {
+			return errors.New("could not open the audit log: " + err.Error())
+		}
+		defer auditLog.Close()
+		service.SetAuditLog(auditLog)
+	}
+	service.AuditLog.SetMaxEntries(auditMaxEntries)
+	if auditorsFile != "" {
+		auditors, err := readPublicKeys(auditorsFile)
+		if err != nil {
+			return errors.New("could not read the auditors: " + err.Error())
+		}
+		service.SetAuditors(auditors)
+	}
+	if schemaAdminsFile != "" {
+		admins, err := readPublicKeys(schemaAdminsFile)
+		if err != nil {
+			return errors.New("could not read the schema admins: " + err.Error())
+		}
+		service.SetSchemaAdmins(admins)
+	}
+	if precomputationDir != "" {
+		pool, err := libunlynxshuffle.NewPrecomputationPool(precomputationDir)
+		if err != nil {
+			return errors.New("could not open the precomputation directory: " + err.Error())
+		}
+		service.SetPrecomputationPool(pool)
+	}
+	server.Start()
 	return nil
 }
@@ -1,10 +1,48 @@
 package appunlynx
 
 import (
-	"go.dedis.ch/onet/v3/log"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/ldsec/unlynx/data"
+	"github.com/stretchr/testify/assert"
+	"go.dedis.ch/onet/v3/log"
 )
 
 func TestMain(m *testing.M) {
 	log.MainTest(m)
 }
+
+func TestSQLiteDataSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unlynx_sqlite")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	database := filepath.Join(dir, "responses.db")
+	db, err := sql.Open("sqlite3", database)
+	assert.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE responses (sex TEXT, income INTEGER); INSERT INTO responses VALUES ('F', 100), ('M', 20), ('M', 30)")
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	schema := "delimiter = \",\"\n[[columns]]\ncolumn = \"sex\"\nattribute = \"g1\"\nkind = \"groupBy\"\nencrypted = true\n" +
+		"[columns.dictionary]\nF = 0\nM = 1\n\n[[columns]]\ncolumn = \"income\"\nattribute = \"s1\"\nkind = \"aggregate\"\nencrypted = true\n"
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "schema.toml"), []byte(schema), 0600))
+	config := filepath.Join(dir, "sql.toml")
+	assert.NoError(t, ioutil.WriteFile(config, []byte("type = \"sql\"\ndriver = \"sqlite3\"\ndsn = \""+database+"\"\n"+
+		"query = \"SELECT sex, income FROM responses WHERE income > 25\"\nschema = \"schema.toml\"\n"), 0600))
+
+	ds, err := dataunlynx.ReadDataSource(config)
+	assert.NoError(t, err)
+	responses, err := ds.Read(0)
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(responses)) {
+		assert.Equal(t, int64(0), responses[0].GroupByEnc["g1"])
+		assert.Equal(t, int64(100), responses[0].AggregatingAttributesEnc["s1"])
+		assert.Equal(t, int64(1), responses[1].GroupByEnc["g1"])
+		assert.Equal(t, int64(30), responses[1].AggregatingAttributesEnc["s1"])
+	}
+}
@@ -45,6 +45,53 @@ const (
 
 	optionGroupBy      = "groupBy"
 	optionGroupByShort = "g"
+
+	optionDPs = "dps"
+
+	// data provider flags
+
+	optionData = "data"
+
+	optionSurveyID      = "survey"
+	optionSurveyIDShort = "id"
+
+	optionServer = "server"
+
+	optionSection = "section"
+
+	optionSchema = "schema"
+
+	optionPreAggregate = "preaggregate"
+
+	optionSpec = "spec"
+
+	optionDPID = "dpid"
+
+	// audit flags
+
+	optionLog = "log"
+
+	optionKey = "key"
+
+	// proofs flags
+
+	optionBundle = "bundle"
+
+	optionDigest = "digest"
+
+	// server flags
+
+	optionDataSource = "datasource"
+
+	optionAudit = "audit"
+
+	optionAuditors = "auditors"
+
+	optionAuditMaxEntries = "auditmax"
+
+	optionSchemaAdmins = "schemaadmins"
+
+	optionPrecomputation = "precomputation"
 )
 
 func main() {
@@ -94,6 +141,145 @@ func main() {
 			Name:  optionGroupBy + ", " + optionGroupByShort,
 			Usage: "GROUP BY g1, g2, g3 -> {g1, g2, g3}",
 		},
+		cli.IntFlag{
+			Name:  optionDPs,
+			Value: 0,
+			Usage: "Number of data providers uploading their data to each server (0 -> the servers use their test data)",
+		},
+	}
+
+	dataProviderFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  optionGroupFile + ", " + optionGroupFileShort,
+			Value: DefaultGroupFile,
+			Usage: "UnLynx group definition file",
+		},
+		cli.StringFlag{
+			Name:  optionData,
+			Usage: "Data file of the data provider",
+		},
+		cli.StringFlag{
+			Name:  optionSurveyID + ", " + optionSurveyIDShort,
+			Usage: "ID of the survey to which the data is uploaded",
+		},
+		cli.IntFlag{
+			Name:  optionServer,
+			Value: 0,
+			Usage: "Index (in the group definition file) of the server receiving the data",
+		},
+		cli.StringFlag{
+			Name:  optionSection,
+			Usage: "Section (#section) of the data file to upload (all sections if not set)",
+		},
+		cli.StringFlag{
+			Name:  optionSchema,
+			Usage: "Schema (TOML or JSON) mapping the columns of a CSV/TSV data file to attributes",
+		},
+		cli.BoolFlag{
+			Name:  optionPreAggregate,
+			Usage: "Aggregate the responses with only clear where and group by attributes before encrypting them",
+		},
+		cli.BoolFlag{
+			Name:  optionCount + ", " + optionCountShort,
+			Usage: "Add the count attribute to the responses",
+		},
+		cli.StringFlag{
+			Name:  optionDPID,
+			Usage: "ID of the data provider (random if not set)",
+		},
+		cli.StringFlag{
+			Name:  optionKey,
+			Usage: "Private key (hex) of the data provider (see dp keygen): it registers to the survey and signs its responses (anonymous upload if not set)",
+		},
+	}
+
+	generatorFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  optionSpec,
+			Usage: "Spec file (TOML) of the data to generate (distributions, correlations, selectivities and seed)",
+		},
+		cli.StringFlag{
+			Name:  optionData,
+			Usage: "Data file to generate (the expected result is written next to it)",
+		},
+	}
+
+	auditExportFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  optionGroupFile + ", " + optionGroupFileShort,
+			Value: DefaultGroupFile,
+			Usage: "UnLynx group definition file",
+		},
+		cli.IntFlag{
+			Name:  optionServer,
+			Value: 0,
+			Usage: "Index (in the group definition file) of the server whose audit log is exported",
+		},
+		cli.StringFlag{
+			Name:  optionLog,
+			Usage: "File to which the audit log is written",
+		},
+		cli.StringFlag{
+			Name:  optionKey,
+			Usage: "Private key (hex) of the auditor (see audit keygen)",
+		},
+	}
+
+	auditVerifyFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  optionLog,
+			Usage: "Audit log file to verify",
+		},
+		cli.StringFlag{
+			Name:  optionGroupFile + ", " + optionGroupFileShort,
+			Usage: "UnLynx group definition file (the signatures of the entries are verified if it is set)",
+		},
+		cli.IntFlag{
+			Name:  optionServer,
+			Value: 0,
+			Usage: "Index (in the group definition file) of the server which signed the audit log",
+		},
+	}
+
+	proofsExportFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  optionGroupFile + ", " + optionGroupFileShort,
+			Value: DefaultGroupFile,
+			Usage: "UnLynx group definition file",
+		},
+		cli.IntFlag{
+			Name:  optionServer,
+			Value: 0,
+			Usage: "Index (in the group definition file) of the proof verifier whose proofs are exported",
+		},
+		cli.StringFlag{
+			Name:  optionSurveyID + ", " + optionSurveyIDShort,
+			Usage: "ID of the survey",
+		},
+		cli.StringFlag{
+			Name:  optionBundle,
+			Usage: "File to which the proofs bundles are written",
+		},
+	}
+
+	proofsVerifyFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  optionGroupFile + ", " + optionGroupFileShort,
+			Value: DefaultGroupFile,
+			Usage: "UnLynx group definition file (the roster of the survey)",
+		},
+		cli.StringFlag{
+			Name:  optionSurveyID + ", " + optionSurveyIDShort,
+			Usage: "ID of the survey",
+		},
+		cli.StringFlag{
+			Name:  optionBundle,
+			Usage: "Proofs bundles file to verify",
+		},
+		cli.StringFlag{
+			Name:  optionDigest,
+			Usage: "Digest (hex) of the results of the survey (not checked if not set)",
+		},
 	}
 
 	serverFlags := []cli.Flag{
@@ -101,9 +287,75 @@ func main() {
 			Name:  optionConfig + ", " + optionConfigShort,
 			Usage: "Configuration file of the server",
 		},
+		cli.StringFlag{
+			Name:  optionDataSource,
+			Usage: "Configuration file (TOML) of the local data source of the server (generated test data if not set)",
+		},
+		cli.StringFlag{
+			Name:  optionAudit,
+			Usage: "File in which the server keeps its audit log (in memory if not set)",
+		},
+		cli.StringFlag{
+			Name:  optionAuditors,
+			Usage: "File with the public keys (hex, one per line) of the auditors which can export the audit log",
+		},
+		cli.IntFlag{
+			Name:  optionAuditMaxEntries,
+			Value: 0,
+			Usage: "Maximum number of entries of the audit log before it is rotated (no rotation if not set)",
+		},
+		cli.StringFlag{
+			Name:  optionSchemaAdmins,
+			Usage: "File with the public keys (hex, one per line) of the admins which can register the dataset schemas",
+		},
+		cli.StringFlag{
+			Name:  optionPrecomputation,
+			Usage: "Directory in which the server keeps its precomputed shuffle values (in memory if not set)",
+		},
 	}
 	cliApp.Commands = []cli.Command{
 		// BEGIN CLIENT: DATA PROVIDER ----------
+		{
+			Name:  "dp",
+			Usage: "Data provider commands",
+			Subcommands: []cli.Command{
+				{
+					Name:    "upload",
+					Aliases: []string{"u"},
+					Usage:   "Encrypt and upload data to a survey",
+					Action: func(c *cli.Context) error {
+						if err := runUpload(c); err != nil {
+							return errors.New("error during runUpload(): " + err.Error())
+						}
+						return nil
+					},
+					Flags: dataProviderFlags,
+				},
+				{
+					Name:    "keygen",
+					Aliases: []string{"k"},
+					Usage:   "Generate the key pair of a data provider",
+					Action: func(c *cli.Context) error {
+						if err := runDPKeygen(c); err != nil {
+							return errors.New("error during runDPKeygen(): " + err.Error())
+						}
+						return nil
+					},
+				},
+				{
+					Name:    "generate",
+					Aliases: []string{"g"},
+					Usage:   "Generate synthetic test data from a spec file",
+					Action: func(c *cli.Context) error {
+						if err := runGenerate(c); err != nil {
+							return errors.New("error during runGenerate(): " + err.Error())
+						}
+						return nil
+					},
+					Flags: generatorFlags,
+				},
+			},
+		},
 
 		// CLIENT END: DATA PROVIDER ------------
 
@@ -117,6 +369,80 @@ func main() {
 		},
 		// CLIENT END: QUERIER ----------
 
+		// BEGIN CLIENT: AUDITOR ----------
+		{
+			Name:  "audit",
+			Usage: "Audit log commands",
+			Subcommands: []cli.Command{
+				{
+					Name:    "export",
+					Aliases: []string{"e"},
+					Usage:   "Export the audit log of a server",
+					Action: func(c *cli.Context) error {
+						if err := runAuditExport(c); err != nil {
+							return errors.New("error during runAuditExport(): " + err.Error())
+						}
+						return nil
+					},
+					Flags: auditExportFlags,
+				},
+				{
+					Name:    "keygen",
+					Aliases: []string{"k"},
+					Usage:   "Generate the key pair of an auditor",
+					Action: func(c *cli.Context) error {
+						if err := runAuditKeygen(c); err != nil {
+							return errors.New("error during runAuditKeygen(): " + err.Error())
+						}
+						return nil
+					},
+				},
+				{
+					Name:    "verify",
+					Aliases: []string{"v"},
+					Usage:   "Verify offline the hash chain and the signatures of an exported audit log",
+					Action: func(c *cli.Context) error {
+						if err := runAuditVerify(c); err != nil {
+							return errors.New("error during runAuditVerify(): " + err.Error())
+						}
+						return nil
+					},
+					Flags: auditVerifyFlags,
+				},
+			},
+		},
+		{
+			Name:  "proofs",
+			Usage: "Proofs commands",
+			Subcommands: []cli.Command{
+				{
+					Name:    "export",
+					Aliases: []string{"e"},
+					Usage:   "Export the proofs of a survey received by a proof verifier",
+					Action: func(c *cli.Context) error {
+						if err := runProofsExport(c); err != nil {
+							return errors.New("error during runProofsExport(): " + err.Error())
+						}
+						return nil
+					},
+					Flags: proofsExportFlags,
+				},
+				{
+					Name:    "verify",
+					Aliases: []string{"v"},
+					Usage:   "Verify offline exported proofs bundles against the roster of the survey",
+					Action: func(c *cli.Context) error {
+						if err := runProofsVerify(c); err != nil {
+							return errors.New("error during runProofsVerify(): " + err.Error())
+						}
+						return nil
+					},
+					Flags: proofsVerifyFlags,
+				},
+			},
+		},
+		// CLIENT END: AUDITOR ----------
+
 		// BEGIN SERVER --------
 		{
 			Name:  "server",
@@ -0,0 +1,235 @@
+package dataunlynx
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ldsec/unlynx/lib"
+)
+
+// Kinds of attributes a column can be mapped to
+const (
+	// KindWhere maps a column to a where attribute
+	KindWhere = libunlynx.AttributeKindWhere
+	// KindGroupBy maps a column to a group by attribute
+	KindGroupBy = libunlynx.AttributeKindGroupBy
+	// KindAggregate maps a column to an aggregating attribute
+	KindAggregate = libunlynx.AttributeKindAggregate
+)
+
+// Schema describes how the columns of a CSV/TSV file (with a header line) are mapped to the attributes of the DP
+// responses. Columns that are not in the schema are ignored.
+//
+//	delimiter = ","
+//
+//	[[columns]]
+//	column = "sex"
+//	attribute = "g1"
+//	kind = "groupBy"
+//	encrypted = true
+//	[columns.dictionary]
+//	F = 0
+//	M = 1
+type Schema struct {
+	// Delimiter is the separator between two values (default ","), "\t" for TSV files
+	Delimiter string         `toml:"delimiter" json:"delimiter"`
+	Columns   []ColumnSchema `toml:"columns" json:"columns"`
+}
+
+// ColumnSchema maps a column to an attribute. Dictionary converts categorical values to integers, if it is not defined
+// the values of the column have to be integers.
+type ColumnSchema struct {
+	Column     string           `toml:"column" json:"column"`
+	Attribute  string           `toml:"attribute" json:"attribute"`
+	Kind       string           `toml:"kind" json:"kind"`
+	Encrypted  bool             `toml:"encrypted" json:"encrypted"`
+	Dictionary map[string]int64 `toml:"dictionary" json:"dictionary"`
+}
+
+// ReadSchema reads a schema from a TOML or JSON (.json extension) file
+func ReadSchema(filename string) (*Schema, error) {
+	schema := Schema{}
+	if strings.ToLower(filepath.Ext(filename)) == ".json" {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(content, &schema); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := toml.DecodeFile(filename, &schema); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := schema.Validate(); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// Validate checks that the schema is well defined (known kinds, no attribute defined twice)
+func (s *Schema) Validate() error {
+	if len(s.Columns) == 0 {
+		return errors.New("schema has no columns")
+	}
+	if s.Delimiter != "" && len([]rune(s.Delimiter)) != 1 && s.Delimiter != "\\t" {
+		return errors.New("delimiter must be a single character")
+	}
+
+	attributes := make(map[string]bool, len(s.Columns))
+	for _, c := range s.Columns {
+		if c.Column == "" || c.Attribute == "" {
+			return errors.New("schema column with no column or attribute name")
+		}
+		if c.Kind != KindWhere && c.Kind != KindGroupBy && c.Kind != KindAggregate {
+			return errors.New("unknown kind " + c.Kind + " for column " + c.Column)
+		}
+		if attributes[c.Attribute] {
+			return errors.New("attribute " + c.Attribute + " is defined twice")
+		}
+		attributes[c.Attribute] = true
+	}
+	return nil
+}
+
+// delimiter returns the delimiter of the schema as a rune
+func (s *Schema) delimiter() rune {
+	if s.Delimiter == "" {
+		return ','
+	}
+	if s.Delimiter == "\\t" {
+		return '\t'
+	}
+	return []rune(s.Delimiter)[0]
+}
+
+// value converts a value of the column to an integer
+func (c *ColumnSchema) value(raw string) (int64, error) {
+	raw = strings.TrimSpace(raw)
+	if c.Dictionary != nil {
+		value, ok := c.Dictionary[raw]
+		if !ok {
+			return 0, errors.New("value '" + raw + "' is not in the dictionary of column " + c.Column)
+		}
+		return value, nil
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, errors.New("value '" + raw + "' of column " + c.Column + " is not an integer")
+	}
+	return value, nil
+}
+
+// ReadCSVDataFromFile reads the DP responses of a CSV/TSV file according to a schema
+func ReadCSVDataFromFile(filename string, schema *Schema) ([]libunlynx.DpClearResponse, error) {
+	fileHandle, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fileHandle.Close()
+
+	return ReadCSVData(fileHandle, schema)
+}
+
+// ReadCSVData reads the DP responses of a CSV/TSV content according to a schema
+func ReadCSVData(r io.Reader, schema *Schema) ([]libunlynx.DpClearResponse, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = schema.delimiter()
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("could not read the header: " + err.Error())
+	}
+
+	positions, err := schema.positions(header)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]libunlynx.DpClearResponse, 0)
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := schema.response(record, positions)
+		if err != nil {
+			return nil, errors.New("line " + strconv.Itoa(line) + ": " + err.Error())
+		}
+		responses = append(responses, response)
+	}
+
+	return responses, nil
+}
+
+// positions returns the position of each column of the schema in a header (list of column names)
+func (s *Schema) positions(header []string) ([]int, error) {
+	positions := make([]int, len(s.Columns))
+	for i, c := range s.Columns {
+		positions[i] = -1
+		for j, h := range header {
+			if strings.TrimSpace(h) == c.Column {
+				positions[i] = j
+				break
+			}
+		}
+		if positions[i] < 0 {
+			return nil, errors.New("column " + c.Column + " is not in the file")
+		}
+	}
+	return positions, nil
+}
+
+// response converts a record (the values of a line) to a DP response. The maps of the attributes that are not used
+// stay nil (e.g. no encrypted where attributes).
+func (s *Schema) response(record []string, positions []int) (libunlynx.DpClearResponse, error) {
+	response := libunlynx.DpClearResponse{}
+	for i, c := range s.Columns {
+		value, err := c.value(record[positions[i]])
+		if err != nil {
+			return libunlynx.DpClearResponse{}, err
+		}
+
+		switch {
+		case c.Kind == KindWhere && c.Encrypted:
+			response.WhereEnc = setAttribute(response.WhereEnc, c.Attribute, value)
+		case c.Kind == KindWhere:
+			response.WhereClear = setAttribute(response.WhereClear, c.Attribute, value)
+		case c.Kind == KindGroupBy && c.Encrypted:
+			response.GroupByEnc = setAttribute(response.GroupByEnc, c.Attribute, value)
+		case c.Kind == KindGroupBy:
+			response.GroupByClear = setAttribute(response.GroupByClear, c.Attribute, value)
+		case c.Encrypted:
+			response.AggregatingAttributesEnc = setAttribute(response.AggregatingAttributesEnc, c.Attribute, value)
+		default:
+			response.AggregatingAttributesClear = setAttribute(response.AggregatingAttributesClear, c.Attribute, value)
+		}
+	}
+	return response, nil
+}
+
+// setAttribute sets the value of an attribute (and creates the map if needed)
+func setAttribute(attributes map[string]int64, name string, value int64) map[string]int64 {
+	if attributes == nil {
+		attributes = make(map[string]int64)
+	}
+	attributes[name] = value
+	return attributes
+}
@@ -0,0 +1,102 @@
+package dataunlynx_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ldsec/unlynx/data"
+	"github.com/ldsec/unlynx/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+const schemaTOML = `
+delimiter = ","
+
+[[columns]]
+column = "sex"
+attribute = "g1"
+kind = "groupBy"
+encrypted = true
+[columns.dictionary]
+F = 0
+M = 1
+
+[[columns]]
+column = "year"
+attribute = "w1"
+kind = "where"
+
+[[columns]]
+column = "income"
+attribute = "s1"
+kind = "aggregate"
+encrypted = true
+`
+
+const schemaJSON = `{"delimiter": "\t", "columns": [
+	{"column": "sex", "attribute": "g1", "kind": "groupBy", "encrypted": true, "dictionary": {"F": 0, "M": 1}},
+	{"column": "year", "attribute": "w1", "kind": "where"},
+	{"column": "income", "attribute": "s1", "kind": "aggregate", "encrypted": true}]}`
+
+func writeTempFile(t *testing.T, dir, name, content string) string {
+	filename := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(filename, []byte(content), 0644))
+	return filename
+}
+
+func TestReadSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unlynx_schema")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	schemaTOMLFile, err := dataunlynx.ReadSchema(writeTempFile(t, dir, "schema.toml", schemaTOML))
+	assert.NoError(t, err)
+	schemaJSONFile, err := dataunlynx.ReadSchema(writeTempFile(t, dir, "schema.json", schemaJSON))
+	assert.NoError(t, err)
+
+	assert.Equal(t, schemaTOMLFile.Columns, schemaJSONFile.Columns)
+	assert.Equal(t, dataunlynx.KindGroupBy, schemaTOMLFile.Columns[0].Kind)
+	assert.Equal(t, int64(1), schemaTOMLFile.Columns[0].Dictionary["M"])
+
+	_, err = dataunlynx.ReadSchema(writeTempFile(t, dir, "bad.toml", strings.Replace(schemaTOML, "where", "select", 1)))
+	assert.Error(t, err)
+	_, err = dataunlynx.ReadSchema(writeTempFile(t, dir, "twice.toml", strings.Replace(schemaTOML, "w1", "g1", 1)))
+	assert.Error(t, err)
+}
+
+func TestReadCSVData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unlynx_csv")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	schema, err := dataunlynx.ReadSchema(writeTempFile(t, dir, "schema.toml", schemaTOML))
+	assert.NoError(t, err)
+
+	responses, err := dataunlynx.ReadCSVDataFromFile(writeTempFile(t, dir, "data.csv", "id,sex,year,income\n1,F,2019,100\n2, M,2020,250\n"), schema)
+	assert.NoError(t, err)
+	assert.Equal(t, []libunlynx.DpClearResponse{
+		{GroupByEnc: map[string]int64{"g1": 0}, WhereClear: map[string]int64{"w1": 2019}, AggregatingAttributesEnc: map[string]int64{"s1": 100}},
+		{GroupByEnc: map[string]int64{"g1": 1}, WhereClear: map[string]int64{"w1": 2020}, AggregatingAttributesEnc: map[string]int64{"s1": 250}},
+	}, responses)
+
+	// TSV file
+	schema.Delimiter = "\t"
+	responses, err = dataunlynx.ReadCSVData(strings.NewReader("sex\tyear\tincome\nM\t2021\t7\n"), schema)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(responses))
+	assert.Equal(t, int64(7), responses[0].AggregatingAttributesEnc["s1"])
+	schema.Delimiter = ","
+
+	// unknown category
+	_, err = dataunlynx.ReadCSVData(strings.NewReader("sex,year,income\nX,2019,100\n"), schema)
+	assert.Error(t, err)
+	// not an integer
+	_, err = dataunlynx.ReadCSVData(strings.NewReader("sex,year,income\nF,2019,abc\n"), schema)
+	assert.Error(t, err)
+	// missing column
+	_, err = dataunlynx.ReadCSVData(strings.NewReader("sex,income\nF,100\n"), schema)
+	assert.Error(t, err)
+}
@@ -0,0 +1,216 @@
+package dataunlynx
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ldsec/unlynx/lib"
+)
+
+// Types of data sources (in a data source configuration file)
+const (
+	// DataSourceTest is the generated test data file (one section per server)
+	DataSourceTest = "test"
+	// DataSourceCSV is a directory of CSV/TSV files
+	DataSourceCSV = "csv"
+	// DataSourceSQL is a SQL database (e.g. a SQLite file)
+	DataSourceSQL = "sql"
+)
+
+// DataSource is the local data of a server, used to answer the surveys without a separate data provider client
+type DataSource interface {
+	// Read returns the responses of the server with the given index (position in the roster)
+	Read(serverIndex int) ([]libunlynx.DpClearResponse, error)
+}
+
+// DataSourceConfig describes a data source in a TOML file. Relative paths are relative to the configuration file.
+//
+//	type = "csv"
+//	dir = "data"
+//	schema = "schema.toml"
+type DataSourceConfig struct {
+	Type string `toml:"type"`
+	// test data source
+	File string `toml:"file"`
+	// CSV data source
+	Dir string `toml:"dir"`
+	// SQL data source
+	Driver string `toml:"driver"`
+	DSN    string `toml:"dsn"`
+	Query  string `toml:"query"`
+	// CSV and SQL data sources
+	Schema string `toml:"schema"`
+}
+
+// ReadDataSource reads a data source configuration file and creates the corresponding data source
+func ReadDataSource(filename string) (DataSource, error) {
+	config := DataSourceConfig{}
+	if _, err := toml.DecodeFile(filename, &config); err != nil {
+		return nil, err
+	}
+
+	path := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(filepath.Dir(filename), p)
+	}
+
+	var schema *Schema
+	if config.Type == DataSourceCSV || config.Type == DataSourceSQL {
+		if config.Schema == "" {
+			return nil, errors.New("data source of type " + config.Type + " needs a schema")
+		}
+		var err error
+		schema, err = ReadSchema(path(config.Schema))
+		if err != nil {
+			return nil, errors.New("could not read the schema: " + err.Error())
+		}
+	}
+
+	switch config.Type {
+	case DataSourceTest:
+		return &TestDataSource{Filename: path(config.File)}, nil
+	case DataSourceCSV:
+		return &CSVDataSource{Dir: path(config.Dir), Schema: schema}, nil
+	case DataSourceSQL:
+		ds := &SQLDataSource{Driver: config.Driver, DSN: config.DSN, Query: config.Query, Schema: schema}
+		if err := ds.checkDriver(); err != nil {
+			return nil, err
+		}
+		return ds, nil
+	}
+	return nil, errors.New("unknown data source type " + config.Type)
+}
+
+// Test data
+//______________________________________________________________________________________________________________________
+
+// TestDataSource is a file generated by GenerateData, each server uses the section corresponding to its index
+type TestDataSource struct {
+	Filename string
+}
+
+// Read returns the responses of the section of the server
+func (ds *TestDataSource) Read(serverIndex int) ([]libunlynx.DpClearResponse, error) {
+	testData, err := ReadDataFromFile(ds.Filename)
+	if err != nil {
+		return nil, err
+	}
+	return testData[strconv.Itoa(serverIndex)], nil
+}
+
+// CSV files
+//______________________________________________________________________________________________________________________
+
+// CSVDataSource is a directory of CSV/TSV files (.csv, .tsv or .txt) with the same schema
+type CSVDataSource struct {
+	Dir    string
+	Schema *Schema
+}
+
+// Read returns the responses of all the files of the directory (in alphabetical order)
+func (ds *CSVDataSource) Read(serverIndex int) ([]libunlynx.DpClearResponse, error) {
+	files, err := ioutil.ReadDir(ds.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	filenames := make([]string, 0)
+	for _, f := range files {
+		ext := strings.ToLower(filepath.Ext(f.Name()))
+		if !f.IsDir() && (ext == ".csv" || ext == ".tsv" || ext == ".txt") {
+			filenames = append(filenames, f.Name())
+		}
+	}
+	sort.Strings(filenames)
+
+	responses := make([]libunlynx.DpClearResponse, 0)
+	for _, f := range filenames {
+		fileResponses, err := ReadCSVDataFromFile(filepath.Join(ds.Dir, f), ds.Schema)
+		if err != nil {
+			return nil, errors.New(f + ": " + err.Error())
+		}
+		responses = append(responses, fileResponses...)
+	}
+	return responses, nil
+}
+
+// SQL database
+//______________________________________________________________________________________________________________________
+
+// SQLDataSource is a SQL database accessed with database/sql. No driver is imported by this package: the unlynx server
+// binary registers the sqlite3 driver (github.com/mattn/go-sqlite3), other binaries running the server have to register
+// theirs. The columns of the result of the query are mapped to attributes with the schema.
+type SQLDataSource struct {
+	Driver string
+	DSN    string
+	Query  string
+	Schema *Schema
+}
+
+// Read returns the responses corresponding to the rows of the result of the query
+func (ds *SQLDataSource) Read(serverIndex int) ([]libunlynx.DpClearResponse, error) {
+	if err := ds.checkDriver(); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(ds.Driver, ds.DSN)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(ds.Query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	positions, err := ds.Schema.positions(columns)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]libunlynx.DpClearResponse, 0)
+	values := make([]sql.NullString, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		record := make([]string, len(values))
+		for i, v := range values {
+			record[i] = v.String
+		}
+
+		response, err := ds.Schema.response(record, positions)
+		if err != nil {
+			return nil, errors.New("row " + strconv.Itoa(len(responses)+1) + ": " + err.Error())
+		}
+		responses = append(responses, response)
+	}
+	return responses, rows.Err()
+}
+
+// checkDriver checks that the driver of the data source is registered
+func (ds *SQLDataSource) checkDriver() error {
+	for _, driver := range sql.Drivers() {
+		if driver == ds.Driver {
+			return nil
+		}
+	}
+	return errors.New("SQL driver \"" + ds.Driver + "\" is not registered (registered drivers: " + strings.Join(sql.Drivers(), ", ") + ")")
+}
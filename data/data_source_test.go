@@ -0,0 +1,130 @@
+package dataunlynx_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/csv"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ldsec/unlynx/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadDataSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unlynx_data_source")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTempFile(t, dir, "schema.toml", schemaTOML)
+	assert.NoError(t, os.Mkdir(dir+"/data", 0755))
+	writeTempFile(t, dir+"/data", "a.csv", "sex,year,income\nF,2019,100\n")
+	writeTempFile(t, dir+"/data", "b.csv", "income,sex,year\n20,M,2020\n30,M,2021\n")
+	writeTempFile(t, dir+"/data", "notes.md", "not data")
+
+	// CSV directory
+	ds, err := dataunlynx.ReadDataSource(writeTempFile(t, dir, "csv.toml", "type = \"csv\"\ndir = \"data\"\nschema = \"schema.toml\"\n"))
+	assert.NoError(t, err)
+	responses, err := ds.Read(0)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(responses))
+	assert.Equal(t, int64(100), responses[0].AggregatingAttributesEnc["s1"])
+	assert.Equal(t, int64(1), responses[2].GroupByEnc["g1"])
+
+	// test data file
+	testData, err := dataunlynx.GenerateData(2, 5, 5, 0, 1, 0, 0, 0, 1, []int64{2}, true)
+	assert.NoError(t, err)
+	assert.NoError(t, dataunlynx.WriteDataToFile(dir+"/test_data.txt", testData))
+	ds, err = dataunlynx.ReadDataSource(writeTempFile(t, dir, "test.toml", "type = \"test\"\nfile = \"test_data.txt\"\n"))
+	assert.NoError(t, err)
+	responses, err = ds.Read(1)
+	assert.NoError(t, err)
+	assert.Equal(t, testData["1"], responses)
+
+	// SQL without a schema or unknown type
+	_, err = dataunlynx.ReadDataSource(writeTempFile(t, dir, "sql.toml", "type = \"sql\"\ndriver = \"sqlite3\"\n"))
+	assert.Error(t, err)
+	_, err = dataunlynx.ReadDataSource(writeTempFile(t, dir, "unknown.toml", "type = \"xls\"\n"))
+	assert.Error(t, err)
+}
+
+// testSQLDriver is a database/sql driver whose connections return the CSV content of their DSN as the result of any query
+type testSQLDriver struct{}
+
+type testSQLConn struct{ records [][]string }
+
+type testSQLStmt struct{ records [][]string }
+
+type testSQLRows struct {
+	records [][]string
+	next    int
+}
+
+func (testSQLDriver) Open(dsn string) (driver.Conn, error) {
+	records, err := csv.NewReader(strings.NewReader(dsn)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	return &testSQLConn{records: records}, nil
+}
+
+func (c *testSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &testSQLStmt{records: c.records}, nil
+}
+func (c *testSQLConn) Close() error              { return nil }
+func (c *testSQLConn) Begin() (driver.Tx, error) { return nil, errors.New("no transactions") }
+
+func (s *testSQLStmt) Close() error  { return nil }
+func (s *testSQLStmt) NumInput() int { return 0 }
+func (s *testSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("read only")
+}
+func (s *testSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &testSQLRows{records: s.records, next: 1}, nil
+}
+
+func (r *testSQLRows) Columns() []string { return r.records[0] }
+func (r *testSQLRows) Close() error      { return nil }
+func (r *testSQLRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.records) {
+		return io.EOF
+	}
+	for i, v := range r.records[r.next] {
+		dest[i] = v
+	}
+	r.next++
+	return nil
+}
+
+func TestSQLDataSource(t *testing.T) {
+	sql.Register("unlynx_test", testSQLDriver{})
+
+	dir, err := ioutil.TempDir("", "unlynx_sql_data_source")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeTempFile(t, dir, "schema.toml", schemaTOML)
+
+	ds, err := dataunlynx.ReadDataSource(writeTempFile(t, dir, "sql.toml", "type = \"sql\"\ndriver = \"unlynx_test\"\n"+
+		"dsn = \"income,sex,year\\n20,M,2020\\n30,F,2021\\n\"\nquery = \"SELECT income, sex, year FROM responses\"\nschema = \"schema.toml\"\n"))
+	assert.NoError(t, err)
+	responses, err := ds.Read(0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(responses))
+	assert.Equal(t, int64(20), responses[0].AggregatingAttributesEnc["s1"])
+	assert.Equal(t, int64(1), responses[0].GroupByEnc["g1"])
+	assert.Equal(t, int64(2021), responses[1].WhereClear["w1"])
+
+	// invalid rows and drivers which are not registered
+	sqlDS := &dataunlynx.SQLDataSource{Driver: "unlynx_test", DSN: "income,sex,year\n20,X,2020\n", Schema: ds.(*dataunlynx.SQLDataSource).Schema}
+	_, err = sqlDS.Read(0)
+	assert.Error(t, err)
+	_, err = dataunlynx.ReadDataSource(writeTempFile(t, dir, "unregistered.toml", "type = \"sql\"\ndriver = \"unregistered\"\nschema = \"schema.toml\"\n"))
+	assert.Error(t, err)
+	sqlDS.Driver = "unregistered"
+	_, err = sqlDS.Read(0)
+	assert.Error(t, err)
+}
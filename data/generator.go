@@ -0,0 +1,269 @@
+package dataunlynx
+
+import (
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/store"
+)
+
+// Distributions of the values of a generated attribute
+const (
+	// DistributionUniform draws the values uniformly in [0, values)
+	DistributionUniform = "uniform"
+	// DistributionZipf draws the values in [0, values) with a Zipf distribution (0 is the most frequent value)
+	DistributionZipf = "zipf"
+	// DistributionConstant always gives the value Constant
+	DistributionConstant = "constant"
+)
+
+// GeneratorSpec describes (in a TOML file) synthetic test data: the data providers, their number of responses and the
+// attributes of the responses. The same seed always generates the same data.
+//
+//	seed = 42
+//	dps = 3
+//	responses = 1000
+//
+//	[[attributes]]
+//	kind = "groupBy"
+//	encrypted = true
+//	values = 10
+//	distribution = "zipf"
+//	zipf = 1.5
+//
+//	[[attributes]]
+//	kind = "where"
+//	selectivity = 0.3
+//
+// The attributes are named as in the test data files (GenerateData): g, w and s followed by their index, the clear
+// attributes of a kind first and then the encrypted ones (in the order of the spec).
+type GeneratorSpec struct {
+	Seed       int64                `toml:"seed"`
+	NbrDPs     int64                `toml:"dps"`
+	Responses  int64                `toml:"responses"`
+	Attributes []GeneratedAttribute `toml:"attributes"`
+}
+
+// GeneratedAttribute describes the values of an attribute of the generated responses
+type GeneratedAttribute struct {
+	// Kind is where, groupBy or aggregate (see libunlynx.AttributeKind*)
+	Kind      string `toml:"kind"`
+	Encrypted bool   `toml:"encrypted"`
+	// Values is the number of different values ([0, values)), Distribution how they are drawn (uniform by default)
+	Values       int64   `toml:"values"`
+	Distribution string  `toml:"distribution"`
+	Zipf         float64 `toml:"zipf"`
+	Constant     int64   `toml:"constant"`
+	// Selectivity is the fraction of responses selected by a where attribute (value 1, the others have the value 0)
+	Selectivity *float64 `toml:"selectivity"`
+	// CorrelatedWith is another attribute (e.g. g0) defined before this one: with probability Correlation the value is
+	// the value of that attribute (modulo Values) instead of a new draw
+	CorrelatedWith string  `toml:"correlatedWith"`
+	Correlation    float64 `toml:"correlation"`
+
+	name string
+}
+
+// ReadGeneratorSpec reads and validates a generator spec file
+func ReadGeneratorSpec(filename string) (*GeneratorSpec, error) {
+	spec := GeneratorSpec{}
+	if _, err := toml.DecodeFile(filename, &spec); err != nil {
+		return nil, err
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Validate checks the spec and names its attributes
+func (spec *GeneratorSpec) Validate() error {
+	if spec.NbrDPs <= 0 || spec.Responses <= 0 {
+		return errors.New("the spec needs a positive number of data providers and responses")
+	}
+
+	// clear attributes first, then the encrypted ones
+	prefixes := map[string]string{libunlynx.AttributeKindWhere: "w", libunlynx.AttributeKindGroupBy: "g", libunlynx.AttributeKindAggregate: "s"}
+	indexes := make(map[string]int)
+	for _, encrypted := range []bool{false, true} {
+		for i := range spec.Attributes {
+			a := &spec.Attributes[i]
+			prefix, ok := prefixes[a.Kind]
+			if !ok {
+				return errors.New("attribute " + strconv.Itoa(i) + " has an unknown kind " + a.Kind)
+			}
+			if a.Encrypted == encrypted {
+				a.name = prefix + strconv.Itoa(indexes[a.Kind])
+				indexes[a.Kind]++
+			}
+		}
+	}
+
+	defined := make(map[string]bool)
+	for i := range spec.Attributes {
+		a := &spec.Attributes[i]
+		if a.Kind == libunlynx.AttributeKindWhere {
+			if a.Selectivity == nil || *a.Selectivity < 0 || *a.Selectivity > 1 {
+				return errors.New("where attribute " + a.name + " needs a selectivity in [0, 1]")
+			}
+		} else {
+			switch a.Distribution {
+			case "", DistributionUniform:
+			case DistributionZipf:
+				if a.Zipf <= 1 {
+					return errors.New("attribute " + a.name + " needs a zipf exponent greater than 1")
+				}
+			case DistributionConstant:
+			default:
+				return errors.New("attribute " + a.name + " has an unknown distribution " + a.Distribution)
+			}
+			if a.Distribution != DistributionConstant && a.Values <= 0 {
+				return errors.New("attribute " + a.name + " needs a positive number of values")
+			}
+		}
+		if a.CorrelatedWith != "" {
+			if !defined[a.CorrelatedWith] {
+				return errors.New("attribute " + a.name + " is correlated with " + a.CorrelatedWith + " which is not defined before it")
+			}
+			if a.Correlation < 0 || a.Correlation > 1 {
+				return errors.New("attribute " + a.name + " needs a correlation in [0, 1]")
+			}
+		}
+		defined[a.name] = true
+	}
+	return nil
+}
+
+// Name returns the name of the attribute in the generated responses (set by Validate)
+func (a *GeneratedAttribute) Name() string {
+	return a.name
+}
+
+// draw generates a value of the attribute (values contains the values already generated for the response)
+func (a *GeneratedAttribute) draw(r *rand.Rand, zipf *rand.Zipf, values map[string]int64) int64 {
+	if a.CorrelatedWith != "" && r.Float64() < a.Correlation {
+		value := values[a.CorrelatedWith]
+		if a.Kind == libunlynx.AttributeKindWhere {
+			return value % 2
+		}
+		if a.Distribution == DistributionConstant {
+			return a.Constant
+		}
+		return value % a.Values
+	}
+
+	switch {
+	case a.Kind == libunlynx.AttributeKindWhere:
+		if r.Float64() < *a.Selectivity {
+			return 1
+		}
+		return 0
+	case a.Distribution == DistributionConstant:
+		return a.Constant
+	case a.Distribution == DistributionZipf:
+		return int64(zipf.Uint64())
+	}
+	return r.Int63n(a.Values)
+}
+
+// GenerateDataFromSpec generates the responses of each data provider (with the same sections as GenerateData)
+func GenerateDataFromSpec(spec *GeneratorSpec) (map[string][]libunlynx.DpClearResponse, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := rand.New(rand.NewSource(spec.Seed))
+	zipfs := make([]*rand.Zipf, len(spec.Attributes))
+	for i, a := range spec.Attributes {
+		if a.Kind != libunlynx.AttributeKindWhere && a.Distribution == DistributionZipf {
+			zipfs[i] = rand.NewZipf(r, a.Zipf, 1, uint64(a.Values-1))
+		}
+	}
+
+	testData := make(map[string][]libunlynx.DpClearResponse)
+	for i := int64(0); i < spec.NbrDPs; i++ {
+		dpData := make([]libunlynx.DpClearResponse, spec.Responses)
+		for j := range dpData {
+			values := make(map[string]int64)
+			dcr := libunlynx.DpClearResponse{
+				WhereClear: map[string]int64{}, WhereEnc: map[string]int64{},
+				GroupByClear: map[string]int64{}, GroupByEnc: map[string]int64{},
+				AggregatingAttributesClear: map[string]int64{}, AggregatingAttributesEnc: map[string]int64{},
+			}
+			for k := range spec.Attributes {
+				a := &spec.Attributes[k]
+				values[a.name] = a.draw(r, zipfs[k], values)
+				attributes(&dcr, a.Kind, a.Encrypted)[a.name] = values[a.name]
+			}
+			dpData[j] = dcr
+		}
+		testData[strconv.FormatInt(i, 10)] = dpData
+	}
+	return testData, nil
+}
+
+// attributes returns the map of a response containing the attributes of a kind
+func attributes(dcr *libunlynx.DpClearResponse, kind string, encrypted bool) map[string]int64 {
+	switch {
+	case kind == libunlynx.AttributeKindWhere && encrypted:
+		return dcr.WhereEnc
+	case kind == libunlynx.AttributeKindWhere:
+		return dcr.WhereClear
+	case kind == libunlynx.AttributeKindGroupBy && encrypted:
+		return dcr.GroupByEnc
+	case kind == libunlynx.AttributeKindGroupBy:
+		return dcr.GroupByClear
+	case encrypted:
+		return dcr.AggregatingAttributesEnc
+	}
+	return dcr.AggregatingAttributesClear
+}
+
+// ExpectedResult computes the clear result of the query grouping by all the group by attributes, summing all the
+// aggregating attributes and selecting the responses whose where attributes are all 1
+func (spec *GeneratorSpec) ExpectedResult(testData map[string][]libunlynx.DpClearResponse) []libunlynx.DpClearResponse {
+	selected := make([]libunlynx.DpClearResponse, 0)
+	for _, v := range testData {
+		for _, dcr := range v {
+			if allOnes(dcr.WhereClear) && allOnes(dcr.WhereEnc) {
+				selected = append(selected, dcr)
+			}
+		}
+	}
+	return ClearExpectedResult(libunlynxstore.AddInClear(selected))
+}
+
+func allOnes(m map[string]int64) bool {
+	for _, v := range m {
+		if v != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// ExpectedResultFilename is the name of the file containing the expected result of the data in filename
+// (e.g. data.txt -> data_expected.txt)
+func ExpectedResultFilename(filename string) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "_expected" + ext
+}
+
+// GenerateDataFileFromSpec generates the data described by a spec, writes it to filename (see WriteDataToFile) and
+// writes the expected result next to it (see ExpectedResultFilename), in a single section
+func GenerateDataFileFromSpec(filename string, spec *GeneratorSpec) error {
+	testData, err := GenerateDataFromSpec(spec)
+	if err != nil {
+		return err
+	}
+	if err := WriteDataToFile(filename, testData); err != nil {
+		return err
+	}
+	expected := map[string][]libunlynx.DpClearResponse{"0": spec.ExpectedResult(testData)}
+	return WriteDataToFile(ExpectedResultFilename(filename), expected)
+}
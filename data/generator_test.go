@@ -0,0 +1,108 @@
+package dataunlynx_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ldsec/unlynx/data"
+	"github.com/ldsec/unlynx/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+const generatorSpecTOML = `
+seed = 42
+dps = 2
+responses = 2000
+
+[[attributes]]
+kind = "groupBy"
+encrypted = true
+values = 5
+distribution = "zipf"
+zipf = 2.0
+
+[[attributes]]
+kind = "groupBy"
+values = 3
+correlatedWith = "g1"
+correlation = 1.0
+
+[[attributes]]
+kind = "where"
+encrypted = true
+selectivity = 0.25
+
+[[attributes]]
+kind = "aggregate"
+encrypted = true
+distribution = "constant"
+constant = 1
+`
+
+func TestGenerateDataFromSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unlynx_generator")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	spec, err := dataunlynx.ReadGeneratorSpec(writeTempFile(t, dir, "spec.toml", generatorSpecTOML))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"g1", "g0", "w0", "s0"}, []string{spec.Attributes[0].Name(), spec.Attributes[1].Name(), spec.Attributes[2].Name(), spec.Attributes[3].Name()})
+
+	testData, err := dataunlynx.GenerateDataFromSpec(spec)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(testData))
+
+	// the same seed generates the same data
+	sameData, err := dataunlynx.GenerateDataFromSpec(spec)
+	assert.NoError(t, err)
+	assert.Equal(t, testData, sameData)
+
+	selected := 0
+	groupSizes := make(map[int64]int)
+	for _, dcr := range testData["0"] {
+		assert.Equal(t, dcr.GroupByEnc["g1"]%3, dcr.GroupByClear["g0"])
+		assert.Equal(t, int64(1), dcr.AggregatingAttributesEnc["s0"])
+		selected += int(dcr.WhereEnc["w0"])
+		groupSizes[dcr.GroupByEnc["g1"]]++
+	}
+	assert.InDelta(t, 500, selected, 100)
+	assert.True(t, groupSizes[0] > groupSizes[1] && groupSizes[1] > groupSizes[4])
+
+	// the expected result only contains the selected responses
+	filename := filepath.Join(dir, "data.txt")
+	assert.NoError(t, dataunlynx.GenerateDataFileFromSpec(filename, spec))
+	fileData, err := dataunlynx.ReadDataFromFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, testData, fileData)
+	expected, err := dataunlynx.ReadDataFromFile(filepath.Join(dir, "data_expected.txt"))
+	assert.NoError(t, err)
+	assert.True(t, dataunlynx.CompareClearResponses(spec.ExpectedResult(testData), expected["0"]))
+
+	total := int64(0)
+	for _, dcr := range expected["0"] {
+		total += dcr.AggregatingAttributesClear["s0"]
+	}
+	nbrSelected := int64(0)
+	for _, v := range testData {
+		for _, dcr := range v {
+			nbrSelected += dcr.WhereEnc["w0"]
+		}
+	}
+	assert.Equal(t, nbrSelected, total)
+}
+
+func TestGeneratorSpecValidate(t *testing.T) {
+	selectivity := 2.0
+	for _, spec := range []dataunlynx.GeneratorSpec{
+		{NbrDPs: 0, Responses: 1},
+		{NbrDPs: 1, Responses: 1, Attributes: []dataunlynx.GeneratedAttribute{{Kind: "unknown"}}},
+		{NbrDPs: 1, Responses: 1, Attributes: []dataunlynx.GeneratedAttribute{{Kind: libunlynx.AttributeKindWhere, Selectivity: &selectivity}}},
+		{NbrDPs: 1, Responses: 1, Attributes: []dataunlynx.GeneratedAttribute{{Kind: libunlynx.AttributeKindGroupBy, Values: 2, Distribution: dataunlynx.DistributionZipf, Zipf: 0.5}}},
+		{NbrDPs: 1, Responses: 1, Attributes: []dataunlynx.GeneratedAttribute{{Kind: libunlynx.AttributeKindGroupBy}}},
+		{NbrDPs: 1, Responses: 1, Attributes: []dataunlynx.GeneratedAttribute{{Kind: libunlynx.AttributeKindGroupBy, Values: 2, CorrelatedWith: "g1"}}},
+	} {
+		assert.Error(t, spec.Validate())
+	}
+}
@@ -23,9 +23,12 @@ func FillInt64Slice(s []int64, v int64) {
 	}
 }
 
-// random generates a random number between min and max
-func random(min, max int) int {
+func init() {
 	rand.Seed(time.Now().UTC().UnixNano())
+}
+
+// random generates a random number between min and max (use GenerateDataFromSpec for reproducible data)
+func random(min, max int) int {
 	return rand.Intn(max-min) + min
 }
 
@@ -19,6 +19,12 @@ type PublishedAddRmProof struct {
 	RB    kyber.Point
 }
 
+// PublishedAddRmProofBytes is the 'bytes' equivalent of PublishedAddRmProof
+type PublishedAddRmProofBytes struct {
+	Proof        []byte
+	CtBefCtAftRB []byte
+}
+
 // PublishedAddRmListProof contains multiple proofs for adding/removing a server
 type PublishedAddRmListProof struct {
 	List  []PublishedAddRmProof
@@ -26,6 +32,14 @@ type PublishedAddRmListProof struct {
 	ToAdd bool
 }
 
+// PublishedAddRmListProofBytes is the 'bytes' equivalent of PublishedAddRmListProof
+type PublishedAddRmListProofBytes struct {
+	Version int
+	List    []PublishedAddRmProofBytes
+	Krm     []byte
+	ToAdd   bool
+}
+
 // ADD/REMOVE proofs
 //______________________________________________________________________________________________________________________
 
@@ -150,3 +164,107 @@ func AddRmListProofVerification(parp PublishedAddRmListProof, percent float64) b
 	}
 	return finalResult
 }
+
+// Marshal
+//______________________________________________________________________________________________________________________
+
+// ToBytes converts PublishedAddRmProof to bytes
+func (parp *PublishedAddRmProof) ToBytes() (PublishedAddRmProofBytes, error) {
+	data, err := libunlynx.AbstractPointsToBytes([]kyber.Point{parp.CtBef.K, parp.CtBef.C, parp.CtAft.K, parp.CtAft.C, parp.RB})
+	if err != nil {
+		return PublishedAddRmProofBytes{}, err
+	}
+	return PublishedAddRmProofBytes{Proof: parp.Proof, CtBefCtAftRB: data}, nil
+}
+
+// FromBytes converts back bytes to PublishedAddRmProof
+func (parp *PublishedAddRmProof) FromBytes(parpb PublishedAddRmProofBytes) error {
+	data, err := libunlynx.FromBytesToNAbstractPoints(parpb.CtBefCtAftRB, 5)
+	if err != nil {
+		return err
+	}
+	parp.Proof = parpb.Proof
+	parp.CtBef = libunlynx.CipherText{K: data[0], C: data[1]}
+	parp.CtAft = libunlynx.CipherText{K: data[2], C: data[3]}
+	parp.RB = data[4]
+	return nil
+}
+
+// ToBytes converts PublishedAddRmListProof to bytes
+func (parlp *PublishedAddRmListProof) ToBytes() (PublishedAddRmListProofBytes, error) {
+	parlpb := PublishedAddRmListProofBytes{Version: libunlynx.ProofBytesVersion, ToAdd: parlp.ToAdd}
+	parlpb.List = make([]PublishedAddRmProofBytes, len(parlp.List))
+
+	// Krm is not set for an empty list
+	if parlp.Krm != nil {
+		data, err := libunlynx.AbstractPointsToBytes([]kyber.Point{parlp.Krm})
+		if err != nil {
+			return PublishedAddRmListProofBytes{}, err
+		}
+		parlpb.Krm = data
+	}
+
+	var err error
+	mutex := sync.Mutex{}
+	wg := libunlynx.StartParallelize(len(parlp.List))
+	for i, parp := range parlp.List {
+		go func(index int, parp PublishedAddRmProof) {
+			defer wg.Done()
+			var tmpErr error
+			parlpb.List[index], tmpErr = parp.ToBytes()
+			if tmpErr != nil {
+				mutex.Lock()
+				err = tmpErr
+				mutex.Unlock()
+				return
+			}
+		}(i, parp)
+	}
+	libunlynx.EndParallelize(wg)
+
+	if err != nil {
+		return PublishedAddRmListProofBytes{}, err
+	}
+	return parlpb, nil
+}
+
+// FromBytes converts bytes back to PublishedAddRmListProof
+func (parlp *PublishedAddRmListProof) FromBytes(parlpb PublishedAddRmListProofBytes) error {
+	if err := libunlynx.CheckProofBytesVersion(parlpb.Version); err != nil {
+		return err
+	}
+	var krm kyber.Point
+	if len(parlpb.Krm) > 0 || len(parlpb.List) > 0 {
+		data, err := libunlynx.FromBytesToNAbstractPoints(parlpb.Krm, 1)
+		if err != nil {
+			return err
+		}
+		krm = data[0]
+	}
+	list := make([]PublishedAddRmProof, len(parlpb.List))
+
+	var err error
+	mutex := sync.Mutex{}
+	wg := libunlynx.StartParallelize(len(parlpb.List))
+	for i, parpb := range parlpb.List {
+		go func(index int, parpb PublishedAddRmProofBytes) {
+			defer wg.Done()
+			tmp := PublishedAddRmProof{}
+			tmpErr := tmp.FromBytes(parpb)
+			if tmpErr != nil {
+				mutex.Lock()
+				err = tmpErr
+				mutex.Unlock()
+				return
+			}
+			list[index] = tmp
+		}(i, parpb)
+	}
+	libunlynx.EndParallelize(wg)
+
+	if err != nil {
+		return err
+	}
+	parlp.List, parlp.Krm, parlp.ToAdd = list, krm, parlpb.ToAdd
+	return nil
+}
@@ -113,3 +113,31 @@ func TestAddRmProof(t *testing.T) {
 	assert.False(t, libunlynxaddrm.AddRmListProofVerification(prfVectAdd, 1.0))
 	assert.False(t, libunlynxaddrm.AddRmListProofVerification(prfVectSub, 1.0))
 }
+
+func TestPublishedAddRmListProof_ToBytes(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+	secKeyNew, pubKeyNew := libunlynx.GenKey()
+
+	cv := *libunlynx.EncryptIntVector(pubKey, []int64{1, 2})
+	result := make(libunlynx.CipherVector, len(cv))
+	for i, ct := range cv {
+		result[i] = libunlynx.CipherText{K: ct.K, C: libunlynx.SuiTe.Point().Add(ct.C, libunlynx.SuiTe.Point().Mul(secKeyNew, ct.K))}
+	}
+	prfList, err := libunlynxaddrm.AddRmListProofCreation(cv, result, pubKeyNew, secKeyNew, true)
+	assert.NoError(t, err)
+
+	prfListBytes, err := prfList.ToBytes()
+	assert.NoError(t, err)
+
+	converted := libunlynxaddrm.PublishedAddRmListProof{}
+	assert.NoError(t, converted.FromBytes(prfListBytes))
+	assert.True(t, libunlynxaddrm.AddRmListProofVerification(converted, 1.0))
+	assert.True(t, converted.ToAdd)
+	assert.True(t, pubKeyNew.Equal(converted.Krm))
+	assert.True(t, prfList.List[1].CtAft.C.Equal(converted.List[1].CtAft.C))
+
+	prfListBytes.Krm = nil
+	assert.Error(t, converted.FromBytes(prfListBytes))
+	prfListBytes.Version = 0
+	assert.Error(t, converted.FromBytes(prfListBytes))
+}
@@ -27,7 +27,8 @@ type PublishedAggregationListProof struct {
 
 // PublishedAggregationListProofBytes is the 'bytes' equivalent of PublishedAggregationListProof
 type PublishedAggregationListProofBytes struct {
-	List []PublishedAggregationProofBytes
+	Version int
+	List    []PublishedAggregationProofBytes
 }
 
 // AGGREGATION proofs
@@ -125,7 +126,7 @@ func (pap *PublishedAggregationProof) FromBytes(papb PublishedAggregationProofBy
 
 // ToBytes converts PublishedAggregationListProof to bytes
 func (palp *PublishedAggregationListProof) ToBytes() (PublishedAggregationListProofBytes, error) {
-	palpb := PublishedAggregationListProofBytes{}
+	palpb := PublishedAggregationListProofBytes{Version: libunlynx.ProofBytesVersion}
 
 	palpb.List = make([]PublishedAggregationProofBytes, len(palp.List))
 
@@ -156,6 +157,9 @@ func (palp *PublishedAggregationListProof) ToBytes() (PublishedAggregationListPr
 
 // FromBytes converts bytes back to PublishedAggregationListProof
 func (palp *PublishedAggregationListProof) FromBytes(palpb PublishedAggregationListProofBytes) error {
+	if err := libunlynx.CheckProofBytesVersion(palpb.Version); err != nil {
+		return err
+	}
 	palp.List = make([]PublishedAggregationProof, len(palpb.List))
 
 	var err error
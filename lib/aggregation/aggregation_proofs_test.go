@@ -31,3 +31,24 @@ func TestAggregationProof(t *testing.T) {
 	assert.True(t, libunlynxaggr.AggregationListProofVerification(PublishedAggregationListProof, 1.0))
 
 }
+
+func TestPublishedAggregationListProof_ToBytes(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+
+	testCV1 := *libunlynx.EncryptIntVector(pubKey, []int64{1, 2, 3, 6})
+	testCV2 := *libunlynx.EncryptIntVector(pubKey, []int64{4, 5})
+	palp := libunlynxaggr.AggregationListProofCreation([]libunlynx.CipherVector{testCV1, testCV2}, libunlynx.CipherVector{testCV1.Acum(), testCV2.Acum()})
+
+	palpb, err := palp.ToBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, libunlynx.ProofBytesVersion, palpb.Version)
+
+	converted := libunlynxaggr.PublishedAggregationListProof{}
+	assert.NoError(t, converted.FromBytes(palpb))
+	assert.True(t, libunlynxaggr.AggregationListProofVerification(converted, 1.0))
+
+	palpb.List[1].DataLen++
+	assert.Error(t, converted.FromBytes(palpb))
+	palpb.Version = 0
+	assert.Error(t, converted.FromBytes(palpb))
+}
@@ -0,0 +1,293 @@
+// Package libunlynxaudit contains an append-only audit log: a hash chain in which each entry (e.g. a survey query, the
+// proofs published by a server or the digest of a result) contains the hash of the previous entry and is signed by the
+// server keeping the log. Modifying, removing or reordering entries breaks the chain, which can be checked offline on an
+// exported log with the public key of the server.
+package libunlynxaudit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+)
+
+// Kinds of entries
+const (
+	// KindQuery is a survey query
+	KindQuery = "query"
+	// KindRoster is the roster running a survey
+	KindRoster = "roster"
+	// KindProofs are proofs published by a server
+	KindProofs = "proofs"
+	// KindProofsVerification is the verification of the proofs of a server
+	KindProofsVerification = "proofsVerification"
+	// KindThresholdDecision is the decision to suppress (or not) a group below the minimum count
+	KindThresholdDecision = "thresholdDecision"
+	// KindResult is the digest of the result of a survey
+	KindResult = "result"
+)
+
+// Entry is an entry of the audit log. Hash is computed over all the other fields but the signature (see ComputeHash),
+// Previous is the hash of the previous entry (empty for the first entry) and Signature is the Schnorr signature of Hash
+// by the server keeping the log.
+type Entry struct {
+	Index     int64  `json:"index"`
+	Time      int64  `json:"time"`
+	SurveyID  string `json:"survey"`
+	Kind      string `json:"kind"`
+	Data      []byte `json:"data"`
+	Previous  []byte `json:"previous"`
+	Hash      []byte `json:"hash"`
+	Signature []byte `json:"signature"`
+}
+
+// ComputeHash computes the hash of an entry
+func (e *Entry) ComputeHash() []byte {
+	h := sha256.New()
+	dataHash := sha256.Sum256(e.Data)
+	for _, v := range []int64{e.Index, e.Time} {
+		binary.Write(h, binary.BigEndian, v)
+	}
+	for _, field := range [][]byte{[]byte(e.SurveyID), []byte(e.Kind), dataHash[:], e.Previous} {
+		binary.Write(h, binary.BigEndian, int64(len(field)))
+		h.Write(field)
+	}
+	return h.Sum(nil)
+}
+
+// Log is an append-only audit log, kept in memory and (if it is opened with OpenLog) in a file. The entries are signed
+// once a signing key is set (see SetSigner). If the log has a maximum number of entries (see SetMaxEntries), it is
+// rotated when it is full: its file is archived (renamed with the index of its first entry as suffix) and the next
+// entries, still chained to the previous ones, are kept in a new file.
+type Log struct {
+	mutex      sync.Mutex
+	entries    []Entry
+	file       *os.File
+	filename   string
+	private    kyber.Scalar
+	maxEntries int
+	// last is the last entry of the log (which can be rotated out of entries)
+	last *Entry
+}
+
+// NewLog creates an empty audit log kept in memory
+func NewLog() *Log {
+	return &Log{entries: make([]Entry, 0)}
+}
+
+// OpenLog opens an audit log kept in a file (created if it does not exist). The entries already in the file are
+// verified and the new entries are appended to it.
+func OpenLog(filename string) (*Log, error) {
+	l := NewLog()
+	if f, err := os.Open(filename); err == nil {
+		entries, err := ReadEntries(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if err := VerifySegment(entries); err != nil {
+			return nil, errors.New("audit log " + filename + " is corrupted: " + err.Error())
+		}
+		l.entries = entries
+		if len(entries) > 0 {
+			l.last = &entries[len(entries)-1]
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l.file = f
+	l.filename = filename
+	return l, nil
+}
+
+// SetSigner sets the private key signing the new entries of the log
+func (l *Log) SetSigner(private kyber.Scalar) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.private = private
+}
+
+// SetMaxEntries sets the maximum number of entries of the log before it is rotated (0 for no rotation)
+func (l *Log) SetMaxEntries(maxEntries int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.maxEntries = maxEntries
+}
+
+// Close closes the file of the log (if any)
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Append adds an entry to the log and returns it
+func (l *Log) Append(surveyID, kind string, data []byte) (Entry, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	e := Entry{Time: time.Now().UnixNano(), SurveyID: surveyID, Kind: kind, Data: data}
+	if l.last != nil {
+		e.Index = l.last.Index + 1
+		e.Previous = l.last.Hash
+	}
+	e.Hash = e.ComputeHash()
+	if l.private != nil {
+		signature, err := schnorr.Sign(libunlynx.SuiTe, l.private, e.Hash)
+		if err != nil {
+			return Entry{}, err
+		}
+		e.Signature = signature
+	}
+
+	if l.maxEntries > 0 && len(l.entries) >= l.maxEntries {
+		if err := l.rotate(); err != nil {
+			return Entry{}, err
+		}
+	}
+	if l.file != nil {
+		if err := WriteEntries(l.file, []Entry{e}); err != nil {
+			return Entry{}, err
+		}
+	}
+	l.entries = append(l.entries, e)
+	l.last = &l.entries[len(l.entries)-1]
+	return e, nil
+}
+
+// rotate archives the file of the log and drops its entries from the memory
+func (l *Log) rotate() error {
+	if l.file != nil {
+		if err := l.file.Close(); err != nil {
+			return err
+		}
+		l.file = nil
+		if err := os.Rename(l.filename, l.filename+"."+strconv.FormatInt(l.entries[0].Index, 10)); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(l.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		l.file = f
+	}
+	l.entries = make([]Entry, 0, l.maxEntries)
+	return nil
+}
+
+// Entries returns a copy of the entries of the log (since its last rotation)
+func (l *Log) Entries() []Entry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	entries := make([]Entry, len(l.entries))
+	copy(entries, l.entries)
+	return entries
+}
+
+// Verify checks that entries form a valid hash chain, starting at the first entry of a log
+func Verify(entries []Entry) error {
+	if len(entries) > 0 && entries[0].Index != 0 {
+		return errors.New("entry 0 has the index " + strconv.FormatInt(entries[0].Index, 10))
+	}
+	return VerifySegment(entries)
+}
+
+// VerifySegment checks that entries form a valid hash chain, starting at any entry of a log (e.g. the first entry
+// after a rotation)
+func VerifySegment(entries []Entry) error {
+	var previous []byte
+	for i, e := range entries {
+		index := strconv.Itoa(i)
+		if i == 0 {
+			previous = e.Previous
+			if e.Index == 0 && len(previous) > 0 {
+				return errors.New("entry 0 is chained to a previous entry")
+			}
+		} else if e.Index != entries[0].Index+int64(i) {
+			return errors.New("entry " + index + " has the index " + strconv.FormatInt(e.Index, 10))
+		}
+		if !bytes.Equal(e.Previous, previous) {
+			return errors.New("entry " + index + " is not chained to the previous entry")
+		}
+		if !bytes.Equal(e.Hash, e.ComputeHash()) {
+			return errors.New("entry " + index + " has a wrong hash")
+		}
+		previous = e.Hash
+	}
+	return nil
+}
+
+// VerifySignatures checks that all the entries are signed with the private key of public (e.g. the key of the server
+// keeping the log)
+func VerifySignatures(entries []Entry, public kyber.Point) error {
+	for i, e := range entries {
+		if err := schnorr.Verify(libunlynx.SuiTe, public, e.Hash, e.Signature); err != nil {
+			return errors.New("entry " + strconv.Itoa(i) + " has an invalid signature: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// Marshal
+//______________________________________________________________________________________________________________________
+
+// WriteEntries writes entries to w, one JSON object per line
+func WriteEntries(w io.Writer, entries []Entry) error {
+	encoder := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadEntries reads entries written by WriteEntries
+func ReadEntries(r io.Reader) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<30)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		e := Entry{}
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, errors.New("malformed entry " + strconv.Itoa(len(entries)) + ": " + err.Error())
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// ReadFile reads the entries of an audit log file
+func ReadFile(filename string) ([]Entry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadEntries(f)
+}
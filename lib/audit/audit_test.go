@@ -0,0 +1,148 @@
+package libunlynxaudit_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	l := libunlynxaudit.NewLog()
+	for _, kind := range []string{libunlynxaudit.KindQuery, libunlynxaudit.KindProofs, libunlynxaudit.KindResult} {
+		_, err := l.Append("survey", kind, []byte(kind))
+		assert.NoError(t, err)
+	}
+	entries := l.Entries()
+	assert.Equal(t, 3, len(entries))
+	assert.Empty(t, entries[0].Previous)
+	assert.Equal(t, entries[1].Hash, entries[2].Previous)
+	assert.NoError(t, libunlynxaudit.Verify(entries))
+
+	// export and import
+	buf := bytes.Buffer{}
+	assert.NoError(t, libunlynxaudit.WriteEntries(&buf, entries))
+	read, err := libunlynxaudit.ReadEntries(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, entries, read)
+
+	// modified, removed or reordered entries are detected
+	modified := l.Entries()
+	modified[1].Data = []byte("other proofs")
+	assert.Error(t, libunlynxaudit.Verify(modified))
+
+	modified = l.Entries()
+	modified[1].Data = []byte("other proofs")
+	modified[1].Hash = modified[1].ComputeHash()
+	assert.Error(t, libunlynxaudit.Verify(modified))
+
+	assert.Error(t, libunlynxaudit.Verify(append(entries[:1:1], entries[2])))
+	assert.Error(t, libunlynxaudit.Verify([]libunlynxaudit.Entry{entries[1], entries[0], entries[2]}))
+	assert.Error(t, libunlynxaudit.Verify(entries[1:]))
+}
+
+func TestOpenLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "audit.log")
+
+	l, err := libunlynxaudit.OpenLog(filename)
+	assert.NoError(t, err)
+	_, err = l.Append("survey", libunlynxaudit.KindQuery, []byte("query"))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Close())
+
+	// the log continues the chain of the file
+	l, err = libunlynxaudit.OpenLog(filename)
+	assert.NoError(t, err)
+	_, err = l.Append("survey", libunlynxaudit.KindResult, []byte("result"))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Close())
+
+	entries, err := libunlynxaudit.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.NoError(t, libunlynxaudit.Verify(entries))
+
+	// a corrupted file is not opened
+	entries[0].SurveyID = "other"
+	f, err := os.Create(filename)
+	assert.NoError(t, err)
+	assert.NoError(t, libunlynxaudit.WriteEntries(f, entries))
+	f.Close()
+	_, err = libunlynxaudit.OpenLog(filename)
+	assert.Error(t, err)
+}
+
+func TestLogSignatures(t *testing.T) {
+	private, public := libunlynx.GenKey()
+	_, otherPublic := libunlynx.GenKey()
+
+	l := libunlynxaudit.NewLog()
+	l.SetSigner(private)
+	for _, kind := range []string{libunlynxaudit.KindQuery, libunlynxaudit.KindResult} {
+		_, err := l.Append("survey", kind, []byte(kind))
+		assert.NoError(t, err)
+	}
+	entries := l.Entries()
+	assert.NoError(t, libunlynxaudit.VerifySignatures(entries, public))
+	assert.Error(t, libunlynxaudit.VerifySignatures(entries, otherPublic))
+
+	// a rewritten chain is detected without the private key of the server
+	modified := l.Entries()
+	modified[1].Data = []byte("other result")
+	modified[1].Hash = modified[1].ComputeHash()
+	assert.NoError(t, libunlynxaudit.Verify(modified))
+	assert.Error(t, libunlynxaudit.VerifySignatures(modified, public))
+
+	// unsigned entries are not valid
+	assert.Error(t, libunlynxaudit.VerifySignatures([]libunlynxaudit.Entry{{Hash: entries[0].Hash}}, public))
+}
+
+func TestLogRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "audit.log")
+
+	l, err := libunlynxaudit.OpenLog(filename)
+	assert.NoError(t, err)
+	l.SetMaxEntries(2)
+	for i := 0; i < 5; i++ {
+		_, err = l.Append("survey", libunlynxaudit.KindProofs, []byte{byte(i)})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, l.Close())
+
+	// the log only keeps the entries since its last rotation, the older ones are archived
+	entries := l.Entries()
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, int64(4), entries[0].Index)
+	archived := make([]libunlynxaudit.Entry, 0)
+	for _, suffix := range []string{".0", ".2"} {
+		part, err := libunlynxaudit.ReadFile(filename + suffix)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(part))
+		archived = append(archived, part...)
+	}
+	current, err := libunlynxaudit.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, entries, current)
+	assert.NoError(t, libunlynxaudit.Verify(append(archived, current...)))
+	assert.NoError(t, libunlynxaudit.VerifySegment(current))
+	assert.Error(t, libunlynxaudit.Verify(current))
+
+	// the log continues the chain of its (rotated) file
+	l, err = libunlynxaudit.OpenLog(filename)
+	assert.NoError(t, err)
+	e, err := l.Append("survey", libunlynxaudit.KindResult, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), e.Index)
+	assert.NoError(t, l.Close())
+}
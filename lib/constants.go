@@ -18,6 +18,9 @@ const VPARALLELIZE = 100
 // DIFFPRI enables the DRO protocol (Distributed Results Obfuscation)
 const DIFFPRI = false
 
+// ProofBytesVersion is the version of the binary encoding of the proofs (the Published...ListProofBytes structs)
+const ProofBytesVersion = 1
+
 // StartTimer starts measurement of time
 func StartTimer(name string) *monitor.TimeMeasure {
 	var timer *monitor.TimeMeasure
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -583,6 +584,9 @@ func (cv *CipherVector) ToBytes() ([]byte, int, error) {
 func (cv *CipherVector) FromBytes(data []byte, length int) error {
 	*cv = make(CipherVector, length)
 	cipherLength := 2 * SuiTe.PointLen()
+	if length < 0 || len(data) < length*cipherLength {
+		return errors.New("not enough bytes for " + strconv.Itoa(length) + " ciphertexts")
+	}
 	for i, pos := 0, 0; i < length*cipherLength; i, pos = i+cipherLength, pos+1 {
 		ct := CipherText{}
 		if err := ct.FromBytes(data[i : i+cipherLength]); err != nil {
@@ -613,6 +617,9 @@ func (c *CipherText) FromBytes(data []byte) error {
 	(*c).K = SuiTe.Point()
 	(*c).C = SuiTe.Point()
 	pointLength := SuiTe.PointLen()
+	if len(data) != 2*pointLength {
+		return errors.New("a ciphertext is " + strconv.Itoa(2*pointLength) + " bytes long, not " + strconv.Itoa(len(data)))
+	}
 	if err := (*c).K.UnmarshalBinary(data[:pointLength]); err != nil {
 		return err
 	}
@@ -717,6 +724,9 @@ func FromBytesToAbstractPoints(target []byte) ([]kyber.Point, error) {
 	var err error
 	aps := make([]kyber.Point, 0)
 	pointLength := SuiTe.PointLen()
+	if len(target)%pointLength != 0 {
+		return nil, errors.New("the length of the points (" + strconv.Itoa(len(target)) + " bytes) is not a multiple of " + strconv.Itoa(pointLength))
+	}
 	for i := 0; i < len(target); i += pointLength {
 		ap := SuiTe.Point()
 		if err = ap.UnmarshalBinary(target[i : i+pointLength]); err != nil {
@@ -728,6 +738,26 @@ func FromBytesToAbstractPoints(target []byte) ([]kyber.Point, error) {
 	return aps, nil
 }
 
+// FromBytesToNAbstractPoints converts a byte array to an array of exactly n kyber.Point
+func FromBytesToNAbstractPoints(target []byte, n int) ([]kyber.Point, error) {
+	aps, err := FromBytesToAbstractPoints(target)
+	if err != nil {
+		return nil, err
+	}
+	if len(aps) != n {
+		return nil, errors.New("expected " + strconv.Itoa(n) + " points, got " + strconv.Itoa(len(aps)))
+	}
+	return aps, nil
+}
+
+// CheckProofBytesVersion checks that proofs in bytes were encoded with the current version of the encoding
+func CheckProofBytesVersion(version int) error {
+	if version != ProofBytesVersion {
+		return errors.New("unsupported version " + strconv.Itoa(version) + " of the proof encoding (expected " + strconv.Itoa(ProofBytesVersion) + ")")
+	}
+	return nil
+}
+
 // ArrayCipherVectorToBytes converts an array of CipherVector to an array of bytes (plus an array of byte lengths)
 func ArrayCipherVectorToBytes(data []CipherVector) ([]byte, []byte, error) {
 	length := len(data)
@@ -770,10 +800,21 @@ func ArrayCipherVectorToBytes(data []CipherVector) ([]byte, []byte, error) {
 
 // FromBytesToArrayCipherVector converts bytes to an array of CipherVector
 func FromBytesToArrayCipherVector(data []byte, cvLengthsByte []byte) ([]CipherVector, error) {
+	if len(cvLengthsByte)%4 != 0 {
+		return nil, errors.New("malformed lengths of the cipher vectors")
+	}
 	cvLengths := libunlynxtools.UnsafeCastBytesToInts(cvLengthsByte)
 	dataConverted := make([]CipherVector, len(cvLengths))
 	elementSize := CipherTextByteSize()
 
+	totalSize := 0
+	for _, l := range cvLengths {
+		totalSize += l * elementSize
+	}
+	if totalSize > len(data) {
+		return nil, errors.New("not enough bytes for the cipher vectors")
+	}
+
 	var err error
 	mutex := sync.Mutex{}
 	wg := StartParallelize(len(cvLengths))
@@ -3,7 +3,6 @@ package libunlynxdetertag
 import (
 	"errors"
 	"math"
-	"reflect"
 	"sync"
 
 	"github.com/ldsec/unlynx/lib"
@@ -20,6 +19,12 @@ type PublishedDDTCreationProof struct {
 	CTaft       libunlynx.CipherText
 }
 
+// PublishedDDTCreationProofBytes is the 'bytes' equivalent of PublishedDDTCreationProof
+type PublishedDDTCreationProofBytes struct {
+	Proof                 []byte
+	Ciminus11SiCTbefCTaft []byte
+}
+
 // PublishedDDTCreationListProof contains all the info about proofs for the deterministic tagging of one sequence of ciphertexts (creation)
 type PublishedDDTCreationListProof struct {
 	List []PublishedDDTCreationProof
@@ -27,12 +32,31 @@ type PublishedDDTCreationListProof struct {
 	SB   kyber.Point
 }
 
+// PublishedDDTCreationListProofBytes is the 'bytes' equivalent of PublishedDDTCreationListProof
+type PublishedDDTCreationListProofBytes struct {
+	Version int
+	List    []PublishedDDTCreationProofBytes
+	KSB     []byte
+}
+
 // PublishedDDTAdditionProof contains all the info about proofs for the deterministic tagging (addition)
 type PublishedDDTAdditionProof struct {
 	C1    kyber.Point
 	C2    kyber.Point
 	R     kyber.Point
 	Proof []byte
+	// G is the point multiplied by the secret to get C2 (the base point if nil). SB is then the secret times the base
+	// point: the proof also shows that C2 and SB use the same secret.
+	G  kyber.Point
+	SB kyber.Point
+}
+
+// PublishedDDTAdditionProofBytes is the 'bytes' equivalent of PublishedDDTAdditionProof
+type PublishedDDTAdditionProofBytes struct {
+	C1C2R []byte
+	Proof []byte
+	// GSB is G followed by SB
+	GSB *[]byte
 }
 
 // PublishedDDTAdditionListProof contains all the info about multiple proofs for the deterministic tagging (addition)
@@ -40,6 +64,12 @@ type PublishedDDTAdditionListProof struct {
 	List []PublishedDDTAdditionProof
 }
 
+// PublishedDDTAdditionListProofBytes is the 'bytes' equivalent of PublishedDDTAdditionListProof
+type PublishedDDTAdditionListProofBytes struct {
+	Version int
+	List    []PublishedDDTAdditionProofBytes
+}
+
 // DETERMINISTIC TAG proofs
 //______________________________________________________________________________________________________________________
 
@@ -171,22 +201,41 @@ func DeterministicTagCrListProofVerification(pdclp PublishedDDTCreationListProof
 // Addition
 //______________________________________________________________________________________________________________________
 
-// createPredicateDeterministicTagAddition creates predicate for deterministic tagging addition proof
-func createPredicateDeterministicTagAddition() (predicate proof.Predicate) {
+// createPredicateDeterministicTagAddition creates predicate for deterministic tagging addition proof (with a generator
+// other than the base point if generator)
+func createPredicateDeterministicTagAddition(generator bool) (predicate proof.Predicate) {
 	// For ZKP
 	log1 := proof.Rep("c2", "s", "B")
+	if !generator {
+		predicate = proof.And(log1)
+		return
+	}
 
-	predicate = proof.And(log1)
+	// the secret of the server is the one of its contribution SB (see PublishedDDTCreationListProof)
+	log2 := proof.Rep("SB", "s", "base")
+	predicate = proof.And(log1, log2)
 
 	return
 }
 
 // DeterministicTagAdditionProofCreation creates proof for deterministic tagging addition on 1 kyber point
 func DeterministicTagAdditionProofCreation(c1 kyber.Point, s kyber.Scalar, c2 kyber.Point, r kyber.Point) (PublishedDDTAdditionProof, error) {
-	predicate := createPredicateDeterministicTagAddition()
-	B := libunlynx.SuiTe.Point().Base()
+	return DeterministicTagAdditionProofCreationGenerator(c1, s, nil, c2, r)
+}
+
+// DeterministicTagAdditionProofCreationGenerator creates proof for deterministic tagging addition on 1 kyber point when
+// the added point is the secret times g instead of the base point (g is nil for the base point)
+func DeterministicTagAdditionProofCreationGenerator(c1 kyber.Point, s kyber.Scalar, g, c2, r kyber.Point) (PublishedDDTAdditionProof, error) {
+	predicate := createPredicateDeterministicTagAddition(g != nil)
+	B := g
+	var SB kyber.Point
+	if B == nil {
+		B = libunlynx.SuiTe.Point().Base()
+	} else {
+		SB = libunlynx.SuiTe.Point().Mul(s, nil)
+	}
 	sval := map[string]kyber.Scalar{"s": s}
-	pval := map[string]kyber.Point{"B": B, "c1": c1, "c2": c2, "r": r}
+	pval := map[string]kyber.Point{"B": B, "c1": c1, "c2": c2, "r": r, "base": libunlynx.SuiTe.Point().Base(), "SB": SB}
 
 	prover := predicate.Prover(libunlynx.SuiTe, sval, pval, nil) // computes: commitment, challenge, response
 	Proof, err := proof.HashProve(libunlynx.SuiTe, "proofTest", prover)
@@ -194,7 +243,24 @@ func DeterministicTagAdditionProofCreation(c1 kyber.Point, s kyber.Scalar, c2 ky
 		return PublishedDDTAdditionProof{}, errors.New("---------Prover: " + err.Error())
 	}
 
-	return PublishedDDTAdditionProof{Proof: Proof, C1: c1, C2: c2, R: r}, nil
+	return PublishedDDTAdditionProof{Proof: Proof, C1: c1, C2: c2, R: r, G: g, SB: SB}, nil
+}
+
+// HasGenerator returns true if the proof is created for the generator g (the point multiplied by the secret)
+func (pdap *PublishedDDTAdditionProof) HasGenerator(g kyber.Point) bool {
+	if pdap.G == nil {
+		return g.Equal(libunlynx.SuiTe.Point().Base())
+	}
+	return pdap.G.Equal(g)
+}
+
+// Contribution returns the secret contribution (the secret times the base point) of the server which created the
+// proof, to be compared with the SB of its deterministic tagging creation proofs
+func (pdap *PublishedDDTAdditionProof) Contribution() kyber.Point {
+	if pdap.G == nil {
+		return pdap.C2
+	}
+	return pdap.SB
 }
 
 // DeterministicTagAdditionListProofCreation creates proof for deterministic tagging addition on multiple kyber points
@@ -235,9 +301,14 @@ func DeterministicTagAdditionListProofCreation(c1List []kyber.Point, sList []kyb
 
 // DeterministicTagAdditionProofVerification verifies a deterministic tag addition proof
 func DeterministicTagAdditionProofVerification(psap PublishedDDTAdditionProof) bool {
-	predicate := createPredicateDeterministicTagAddition()
-	B := libunlynx.SuiTe.Point().Base()
-	pval := map[string]kyber.Point{"B": B, "c1": psap.C1, "c2": psap.C2, "r": psap.R}
+	predicate := createPredicateDeterministicTagAddition(psap.G != nil)
+	B := psap.G
+	if B == nil {
+		B = libunlynx.SuiTe.Point().Base()
+	} else if psap.SB == nil {
+		return false
+	}
+	pval := map[string]kyber.Point{"B": B, "c1": psap.C1, "c2": psap.C2, "r": psap.R, "base": libunlynx.SuiTe.Point().Base(), "SB": psap.SB}
 	verifier := predicate.Verifier(libunlynx.SuiTe, pval)
 	partProof := false
 	if err := proof.HashVerify(libunlynx.SuiTe, "proofTest", verifier, psap.Proof); err != nil {
@@ -248,7 +319,7 @@ func DeterministicTagAdditionProofVerification(psap PublishedDDTAdditionProof) b
 	partProof = true
 
 	cv := libunlynx.SuiTe.Point().Add(psap.C1, psap.C2)
-	return partProof && reflect.DeepEqual(cv, psap.R)
+	return partProof && cv.Equal(psap.R)
 }
 
 // DeterministicTagAdditionListProofVerification verifies multiple deterministic tag addition proofs
@@ -274,3 +345,205 @@ func DeterministicTagAdditionListProofVerification(pdalp PublishedDDTAdditionLis
 	}
 	return finalResult
 }
+
+// Marshal
+//______________________________________________________________________________________________________________________
+
+// ToBytes converts PublishedDDTCreationProof to bytes
+func (pdcp *PublishedDDTCreationProof) ToBytes() (PublishedDDTCreationProofBytes, error) {
+	data, err := libunlynx.AbstractPointsToBytes([]kyber.Point{pdcp.Ciminus11Si, pdcp.CTbef.K, pdcp.CTbef.C, pdcp.CTaft.K, pdcp.CTaft.C})
+	if err != nil {
+		return PublishedDDTCreationProofBytes{}, err
+	}
+	return PublishedDDTCreationProofBytes{Proof: pdcp.Proof, Ciminus11SiCTbefCTaft: data}, nil
+}
+
+// FromBytes converts back bytes to PublishedDDTCreationProof
+func (pdcp *PublishedDDTCreationProof) FromBytes(pdcpb PublishedDDTCreationProofBytes) error {
+	data, err := libunlynx.FromBytesToNAbstractPoints(pdcpb.Ciminus11SiCTbefCTaft, 5)
+	if err != nil {
+		return err
+	}
+	pdcp.Proof = pdcpb.Proof
+	pdcp.Ciminus11Si = data[0]
+	pdcp.CTbef = libunlynx.CipherText{K: data[1], C: data[2]}
+	pdcp.CTaft = libunlynx.CipherText{K: data[3], C: data[4]}
+	return nil
+}
+
+// ToBytes converts PublishedDDTCreationListProof to bytes
+func (pdclp *PublishedDDTCreationListProof) ToBytes() (PublishedDDTCreationListProofBytes, error) {
+	pdclpb := PublishedDDTCreationListProofBytes{Version: libunlynx.ProofBytesVersion}
+	pdclpb.List = make([]PublishedDDTCreationProofBytes, len(pdclp.List))
+
+	// K and SB are not set for an empty list
+	if pdclp.K != nil && pdclp.SB != nil {
+		data, err := libunlynx.AbstractPointsToBytes([]kyber.Point{pdclp.K, pdclp.SB})
+		if err != nil {
+			return PublishedDDTCreationListProofBytes{}, err
+		}
+		pdclpb.KSB = data
+	}
+
+	var err error
+	mutex := sync.Mutex{}
+	wg := libunlynx.StartParallelize(len(pdclp.List))
+	for i, pdcp := range pdclp.List {
+		go func(index int, pdcp PublishedDDTCreationProof) {
+			defer wg.Done()
+			var tmpErr error
+			pdclpb.List[index], tmpErr = pdcp.ToBytes()
+			if tmpErr != nil {
+				mutex.Lock()
+				err = tmpErr
+				mutex.Unlock()
+				return
+			}
+		}(i, pdcp)
+	}
+	libunlynx.EndParallelize(wg)
+
+	if err != nil {
+		return PublishedDDTCreationListProofBytes{}, err
+	}
+	return pdclpb, nil
+}
+
+// FromBytes converts bytes back to PublishedDDTCreationListProof
+func (pdclp *PublishedDDTCreationListProof) FromBytes(pdclpb PublishedDDTCreationListProofBytes) error {
+	if err := libunlynx.CheckProofBytesVersion(pdclpb.Version); err != nil {
+		return err
+	}
+	var K, SB kyber.Point
+	if len(pdclpb.KSB) > 0 || len(pdclpb.List) > 0 {
+		data, err := libunlynx.FromBytesToNAbstractPoints(pdclpb.KSB, 2)
+		if err != nil {
+			return err
+		}
+		K, SB = data[0], data[1]
+	}
+	list := make([]PublishedDDTCreationProof, len(pdclpb.List))
+
+	var err error
+	mutex := sync.Mutex{}
+	wg := libunlynx.StartParallelize(len(pdclpb.List))
+	for i, pdcpb := range pdclpb.List {
+		go func(index int, pdcpb PublishedDDTCreationProofBytes) {
+			defer wg.Done()
+			tmp := PublishedDDTCreationProof{}
+			tmpErr := tmp.FromBytes(pdcpb)
+			if tmpErr != nil {
+				mutex.Lock()
+				err = tmpErr
+				mutex.Unlock()
+				return
+			}
+			list[index] = tmp
+		}(i, pdcpb)
+	}
+	libunlynx.EndParallelize(wg)
+
+	if err != nil {
+		return err
+	}
+	pdclp.List, pdclp.K, pdclp.SB = list, K, SB
+	return nil
+}
+
+// ToBytes converts PublishedDDTAdditionProof to bytes
+func (pdap *PublishedDDTAdditionProof) ToBytes() (PublishedDDTAdditionProofBytes, error) {
+	data, err := libunlynx.AbstractPointsToBytes([]kyber.Point{pdap.C1, pdap.C2, pdap.R})
+	if err != nil {
+		return PublishedDDTAdditionProofBytes{}, err
+	}
+	pdapb := PublishedDDTAdditionProofBytes{C1C2R: data, Proof: pdap.Proof}
+	if pdap.G != nil {
+		gsb, err := libunlynx.AbstractPointsToBytes([]kyber.Point{pdap.G, pdap.SB})
+		if err != nil {
+			return PublishedDDTAdditionProofBytes{}, err
+		}
+		pdapb.GSB = &gsb
+	}
+	return pdapb, nil
+}
+
+// FromBytes converts back bytes to PublishedDDTAdditionProof
+func (pdap *PublishedDDTAdditionProof) FromBytes(pdapb PublishedDDTAdditionProofBytes) error {
+	data, err := libunlynx.FromBytesToNAbstractPoints(pdapb.C1C2R, 3)
+	if err != nil {
+		return err
+	}
+	pdap.C1, pdap.C2, pdap.R = data[0], data[1], data[2]
+	pdap.Proof = pdapb.Proof
+	pdap.G, pdap.SB = nil, nil
+	if pdapb.GSB != nil {
+		gsb, err := libunlynx.FromBytesToNAbstractPoints(*pdapb.GSB, 2)
+		if err != nil {
+			return err
+		}
+		pdap.G, pdap.SB = gsb[0], gsb[1]
+	}
+	return nil
+}
+
+// ToBytes converts PublishedDDTAdditionListProof to bytes
+func (pdalp *PublishedDDTAdditionListProof) ToBytes() (PublishedDDTAdditionListProofBytes, error) {
+	pdalpb := PublishedDDTAdditionListProofBytes{Version: libunlynx.ProofBytesVersion}
+	pdalpb.List = make([]PublishedDDTAdditionProofBytes, len(pdalp.List))
+
+	var err error
+	mutex := sync.Mutex{}
+	wg := libunlynx.StartParallelize(len(pdalp.List))
+	for i, pdap := range pdalp.List {
+		go func(index int, pdap PublishedDDTAdditionProof) {
+			defer wg.Done()
+			var tmpErr error
+			pdalpb.List[index], tmpErr = pdap.ToBytes()
+			if tmpErr != nil {
+				mutex.Lock()
+				err = tmpErr
+				mutex.Unlock()
+				return
+			}
+		}(i, pdap)
+	}
+	libunlynx.EndParallelize(wg)
+
+	if err != nil {
+		return PublishedDDTAdditionListProofBytes{}, err
+	}
+	return pdalpb, nil
+}
+
+// FromBytes converts bytes back to PublishedDDTAdditionListProof
+func (pdalp *PublishedDDTAdditionListProof) FromBytes(pdalpb PublishedDDTAdditionListProofBytes) error {
+	if err := libunlynx.CheckProofBytesVersion(pdalpb.Version); err != nil {
+		return err
+	}
+	list := make([]PublishedDDTAdditionProof, len(pdalpb.List))
+
+	var err error
+	mutex := sync.Mutex{}
+	wg := libunlynx.StartParallelize(len(pdalpb.List))
+	for i, pdapb := range pdalpb.List {
+		go func(index int, pdapb PublishedDDTAdditionProofBytes) {
+			defer wg.Done()
+			tmp := PublishedDDTAdditionProof{}
+			tmpErr := tmp.FromBytes(pdapb)
+			if tmpErr != nil {
+				mutex.Lock()
+				err = tmpErr
+				mutex.Unlock()
+				return
+			}
+			list[index] = tmp
+		}(i, pdapb)
+	}
+	libunlynx.EndParallelize(wg)
+
+	if err != nil {
+		return err
+	}
+	pdalp.List = list
+	return nil
+}
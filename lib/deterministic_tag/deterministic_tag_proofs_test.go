@@ -99,4 +99,79 @@ func TestDeterministicTaggingAdditionProof(t *testing.T) {
 	prfList, err := libunlynxdetertag.DeterministicTagAdditionListProofCreation([]kyber.Point{cipherOne.C, cipherOne.C}, []kyber.Scalar{secKey, secKey}, []kyber.Point{toAdd, toAdd}, []kyber.Point{tmp, tmp})
 	assert.NoError(t, err)
 	assert.True(t, libunlynxdetertag.DeterministicTagAdditionListProofVerification(prfList, 1.0))
+
+	// the secret multiplies another point than the base point
+	g := libunlynx.SuiTe.Point().Mul(secretContrib, libunlynx.SuiTe.Point().Base())
+	toAdd = libunlynx.SuiTe.Point().Mul(secKey, g)
+	tmp = libunlynx.SuiTe.Point().Add(cipherOne.C, toAdd)
+	prf, err = libunlynxdetertag.DeterministicTagAdditionProofCreationGenerator(cipherOne.C, secKey, g, toAdd, tmp)
+	assert.NoError(t, err)
+	assert.True(t, libunlynxdetertag.DeterministicTagAdditionProofVerification(prf))
+
+	prfBytes, err := prf.ToBytes()
+	assert.NoError(t, err)
+	converted := libunlynxdetertag.PublishedDDTAdditionProof{}
+	assert.NoError(t, converted.FromBytes(prfBytes))
+	assert.True(t, libunlynxdetertag.DeterministicTagAdditionProofVerification(converted))
+
+	// the proof binds the secret to the contribution of the server
+	assert.True(t, converted.Contribution().Equal(libunlynx.SuiTe.Point().Mul(secKey, nil)))
+	converted.SB = libunlynx.SuiTe.Point().Mul(secretContrib, nil)
+	assert.False(t, libunlynxdetertag.DeterministicTagAdditionProofVerification(converted))
+	converted.SB = nil
+	assert.False(t, libunlynxdetertag.DeterministicTagAdditionProofVerification(converted))
+
+	prf.G = nil
+	assert.False(t, libunlynxdetertag.DeterministicTagAdditionProofVerification(prf))
+}
+
+func TestPublishedDDTListProof_ToBytes(t *testing.T) {
+	secKey, pubKey := libunlynx.GenKey()
+	secretContrib, _ := libunlynx.GenKey()
+
+	// creation
+	cv := *libunlynx.EncryptIntVector(pubKey, []int64{1, 2, 3})
+	cvDetTagged := libunlynxdetertag.DeterministicTagSequence(cv, secKey, secretContrib)
+	dtpList, err := libunlynxdetertag.DeterministicTagCrListProofCreation(cv, cvDetTagged, pubKey, secKey, secretContrib)
+	assert.NoError(t, err)
+
+	dtpListBytes, err := dtpList.ToBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, libunlynx.ProofBytesVersion, dtpListBytes.Version)
+
+	converted := libunlynxdetertag.PublishedDDTCreationListProof{}
+	assert.NoError(t, converted.FromBytes(dtpListBytes))
+	assert.True(t, libunlynxdetertag.DeterministicTagCrListProofVerification(converted, 1.0))
+	assert.True(t, dtpList.K.Equal(converted.K))
+	assert.True(t, dtpList.SB.Equal(converted.SB))
+	assert.Equal(t, len(dtpList.List), len(converted.List))
+
+	empty := libunlynxdetertag.PublishedDDTCreationListProof{}
+	emptyBytes, err := empty.ToBytes()
+	assert.NoError(t, err)
+	assert.NoError(t, converted.FromBytes(emptyBytes))
+	assert.Empty(t, converted.List)
+
+	dtpListBytes.List[0].Ciminus11SiCTbefCTaft = dtpListBytes.List[0].Ciminus11SiCTbefCTaft[1:]
+	assert.Error(t, converted.FromBytes(dtpListBytes))
+	dtpListBytes.Version = 0
+	assert.Error(t, converted.FromBytes(dtpListBytes))
+
+	// addition
+	cipherOne := *libunlynx.EncryptInt(pubKey, 10)
+	toAdd := libunlynx.SuiTe.Point().Mul(secKey, libunlynx.SuiTe.Point().Base())
+	tmp := libunlynx.SuiTe.Point().Add(cipherOne.C, toAdd)
+	prfList, err := libunlynxdetertag.DeterministicTagAdditionListProofCreation([]kyber.Point{cipherOne.C, cipherOne.C}, []kyber.Scalar{secKey, secKey}, []kyber.Point{toAdd, toAdd}, []kyber.Point{tmp, tmp})
+	assert.NoError(t, err)
+
+	prfListBytes, err := prfList.ToBytes()
+	assert.NoError(t, err)
+
+	convertedAddition := libunlynxdetertag.PublishedDDTAdditionListProof{}
+	assert.NoError(t, convertedAddition.FromBytes(prfListBytes))
+	assert.True(t, libunlynxdetertag.DeterministicTagAdditionListProofVerification(convertedAddition, 1.0))
+	assert.Equal(t, prfList.List[0].Proof, convertedAddition.List[0].Proof)
+
+	prfListBytes.Version = libunlynx.ProofBytesVersion + 1
+	assert.Error(t, convertedAddition.FromBytes(prfListBytes))
 }
@@ -0,0 +1,218 @@
+// Package libunlynxencproof contains the functions to create and verify proofs of correct encryption: a Schnorr proof
+// of knowledge of the randomness r of a ciphertext (K = rB, C = M + rX). The proof is bound to a context (e.g. the
+// survey ID and the data provider) so that a data provider cannot copy or modify the ciphertexts of another data provider
+// or of another survey. The proofs of the attributes of a DP response are also bound to their attribute.
+package libunlynxencproof
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+)
+
+// Kinds of attributes, used as prefix of the keys of the proofs of a DP response
+const (
+	whereKind     = "w:"
+	groupByKind   = "g:"
+	aggregateKind = "s:"
+)
+
+// Structs
+//______________________________________________________________________________________________________________________
+
+// PublishedEncryptionProof is a Schnorr proof of knowledge of r such that K = rB: T = wB and S = w + cr with
+// c = H(context, K, C, T)
+type PublishedEncryptionProof struct {
+	T kyber.Point
+	S kyber.Scalar
+}
+
+// ENCRYPTION proofs
+//______________________________________________________________________________________________________________________
+
+// challenge computes the challenge of the proof for a ciphertext and a context
+func challenge(context []byte, ct libunlynx.CipherText, T kyber.Point) (kyber.Scalar, error) {
+	h := libunlynx.SuiTe.Hash()
+	if _, err := h.Write(context); err != nil {
+		return nil, err
+	}
+	for _, p := range []kyber.Point{ct.K, ct.C, T} {
+		if _, err := p.MarshalTo(h); err != nil {
+			return nil, err
+		}
+	}
+	return libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.XOF(h.Sum(nil))), nil
+}
+
+// EncryptionProofCreation creates a proof of knowledge of the randomness r of a ciphertext
+func EncryptionProofCreation(ct libunlynx.CipherText, r kyber.Scalar, context []byte) (PublishedEncryptionProof, error) {
+	w := libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
+	T := libunlynx.SuiTe.Point().Mul(w, nil)
+
+	c, err := challenge(context, ct, T)
+	if err != nil {
+		return PublishedEncryptionProof{}, err
+	}
+	S := libunlynx.SuiTe.Scalar().Add(w, libunlynx.SuiTe.Scalar().Mul(c, r))
+	return PublishedEncryptionProof{T: T, S: S}, nil
+}
+
+// EncryptionProofVerification verifies a proof of knowledge of the randomness of a ciphertext (SB == T + cK)
+func EncryptionProofVerification(pep PublishedEncryptionProof, ct libunlynx.CipherText, context []byte) bool {
+	if pep.T == nil || pep.S == nil {
+		return false
+	}
+	c, err := challenge(context, ct, pep.T)
+	if err != nil {
+		return false
+	}
+	left := libunlynx.SuiTe.Point().Mul(pep.S, nil)
+	right := libunlynx.SuiTe.Point().Add(pep.T, libunlynx.SuiTe.Point().Mul(c, ct.K))
+	return left.Equal(right)
+}
+
+// attributeContext binds the context of a proof to an encrypted attribute of a DP response (identified by the key of its
+// proof) so that a ciphertext and its proof cannot be moved to another attribute
+func attributeContext(context []byte, key string) []byte {
+	length := make([]byte, 8)
+	binary.BigEndian.PutUint64(length, uint64(len(key)))
+	attrContext := make([]byte, 0, len(context)+len(key)+len(length))
+	attrContext = append(attrContext, context...)
+	attrContext = append(attrContext, key...)
+	return append(attrContext, length...)
+}
+
+// AddEncryptionProofs encrypts again (with libunlynx.EncryptIntVectorGetRs) the encrypted attributes of a DP response
+// and adds their proofs of correct encryption to the response. knownRs contains the randomness of encrypted aggregating
+// attributes that are kept as they are (e.g. the ones with a range proof). The count attribute (added by
+// libunlynx.EncryptDpClearResponse) has the value 1.
+func AddEncryptionProofs(dcr libunlynx.DpClearResponse, dr *libunlynx.DpResponseToSend, pubKey kyber.Point, context []byte, knownRs map[string]kyber.Scalar) error {
+	type encAttribute struct {
+		kind string
+		name string
+		enc  map[string][]byte
+	}
+
+	// the attributes to encrypt again and their values
+	attributes := make([]encAttribute, 0)
+	values := make([]int64, 0)
+	collect := func(kind string, clear map[string]int64, enc map[string][]byte) {
+		for attr := range enc {
+			if _, ok := knownRs[attr]; ok && kind == aggregateKind {
+				continue
+			}
+			value, ok := clear[attr]
+			if !ok && attr == "count" {
+				value = 1
+			}
+			attributes = append(attributes, encAttribute{kind: kind, name: attr, enc: enc})
+			values = append(values, value)
+		}
+	}
+	collect(whereKind, dcr.WhereEnc, dr.WhereEnc)
+	collect(groupByKind, dcr.GroupByEnc, dr.GroupByEnc)
+	collect(aggregateKind, dcr.AggregatingAttributesEnc, dr.AggregatingAttributesEnc)
+
+	cv, rs := libunlynx.EncryptIntVectorGetRs(pubKey, values)
+
+	if dr.EncryptionProofs == nil {
+		dr.EncryptionProofs = make(map[string][]byte)
+	}
+	addProof := func(key string, ct libunlynx.CipherText, r kyber.Scalar) error {
+		pep, err := EncryptionProofCreation(ct, r, attributeContext(context, key))
+		if err != nil {
+			return err
+		}
+		data, err := pep.ToBytes()
+		if err != nil {
+			return err
+		}
+		dr.EncryptionProofs[key] = data
+		return nil
+	}
+
+	for i, attr := range attributes {
+		data, err := (*cv)[i].ToBytes()
+		if err != nil {
+			return err
+		}
+		attr.enc[attr.name] = data
+		if err := addProof(attr.kind+attr.name, (*cv)[i], rs[i]); err != nil {
+			return err
+		}
+	}
+	for attr, r := range knownRs {
+		data, ok := dr.AggregatingAttributesEnc[attr]
+		if !ok {
+			continue
+		}
+		ct := libunlynx.CipherText{}
+		if err := ct.FromBytes(data); err != nil {
+			return err
+		}
+		if err := addProof(aggregateKind+attr, ct, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyEncryptionProofs checks that each encrypted attribute of a DP response has a valid proof of correct encryption
+func VerifyEncryptionProofs(dr libunlynx.DpResponse, encryptionProofs map[string][]byte, context []byte) error {
+	verify := func(kind string, enc map[string]libunlynx.CipherText) error {
+		for attr, ct := range enc {
+			data, ok := encryptionProofs[kind+attr]
+			if !ok {
+				return errors.New("attribute " + attr + " has no proof of correct encryption")
+			}
+			pep := PublishedEncryptionProof{}
+			if err := pep.FromBytes(data); err != nil {
+				return errors.New("attribute " + attr + ": " + err.Error())
+			}
+			if !EncryptionProofVerification(pep, ct, attributeContext(context, kind+attr)) {
+				return errors.New("proof of correct encryption of attribute " + attr + " is not valid")
+			}
+		}
+		return nil
+	}
+
+	if err := verify(whereKind, dr.WhereEnc); err != nil {
+		return err
+	}
+	if err := verify(groupByKind, dr.GroupByEnc); err != nil {
+		return err
+	}
+	return verify(aggregateKind, dr.AggregatingAttributesEnc)
+}
+
+// Marshal
+//______________________________________________________________________________________________________________________
+
+// ToBytes converts a PublishedEncryptionProof to bytes (T followed by S)
+func (pep *PublishedEncryptionProof) ToBytes() ([]byte, error) {
+	t, err := pep.T.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	s, err := pep.S.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(t, s...), nil
+}
+
+// FromBytes converts back bytes to a PublishedEncryptionProof
+func (pep *PublishedEncryptionProof) FromBytes(data []byte) error {
+	pointLength := libunlynx.SuiTe.PointLen()
+	if len(data) != pointLength+libunlynx.SuiTe.ScalarLen() {
+		return errors.New("proof of correct encryption is malformed")
+	}
+	pep.T = libunlynx.SuiTe.Point()
+	if err := pep.T.UnmarshalBinary(data[:pointLength]); err != nil {
+		return err
+	}
+	pep.S = libunlynx.SuiTe.Scalar()
+	return pep.S.UnmarshalBinary(data[pointLength:])
+}
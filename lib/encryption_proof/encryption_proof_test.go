@@ -0,0 +1,70 @@
+package libunlynxencproof_test
+
+import (
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/encryption_proof"
+	"github.com/ldsec/unlynx/lib/range_proof"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptionProof(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+	context := []byte("survey1")
+
+	ct, r := libunlynx.EncryptIntGetR(pubKey, 5)
+	pep, err := libunlynxencproof.EncryptionProofCreation(*ct, r, context)
+	assert.NoError(t, err)
+	assert.True(t, libunlynxencproof.EncryptionProofVerification(pep, *ct, context))
+
+	// marshal
+	data, err := pep.ToBytes()
+	assert.NoError(t, err)
+	pepFromBytes := libunlynxencproof.PublishedEncryptionProof{}
+	assert.NoError(t, pepFromBytes.FromBytes(data))
+	assert.True(t, libunlynxencproof.EncryptionProofVerification(pepFromBytes, *ct, context))
+	assert.Error(t, pepFromBytes.FromBytes(data[1:]))
+
+	// the proof is bound to the context and to the ciphertext
+	assert.False(t, libunlynxencproof.EncryptionProofVerification(pep, *ct, []byte("survey2")))
+	modified := libunlynx.CipherText{K: ct.K, C: libunlynx.SuiTe.Point().Add(ct.C, libunlynx.IntToPoint(1))}
+	assert.False(t, libunlynxencproof.EncryptionProofVerification(pep, modified, context))
+	assert.False(t, libunlynxencproof.EncryptionProofVerification(pep, *libunlynx.EncryptInt(pubKey, 5), context))
+
+	// the randomness has to be known
+	_, wrongR := libunlynx.EncryptIntGetR(pubKey, 5)
+	pep, err = libunlynxencproof.EncryptionProofCreation(*ct, wrongR, context)
+	assert.NoError(t, err)
+	assert.False(t, libunlynxencproof.EncryptionProofVerification(pep, *ct, context))
+}
+
+func TestAddEncryptionProofs(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+	context := []byte("survey1")
+
+	dcr := libunlynx.DpClearResponse{WhereEnc: map[string]int64{"w1": 1}, GroupByEnc: map[string]int64{"g1": 2}, AggregatingAttributesEnc: map[string]int64{"s1": 1, "s2": 100}}
+	drts, err := libunlynx.EncryptDpClearResponse(dcr, pubKey, true)
+	assert.NoError(t, err)
+	rangeBits := map[string]int64{"s1": 1}
+	rs, err := libunlynxrange.AddRangeProofs(dcr, &drts, pubKey, rangeBits)
+	assert.NoError(t, err)
+	assert.NoError(t, libunlynxencproof.AddEncryptionProofs(dcr, &drts, pubKey, context, rs))
+	assert.Equal(t, 5, len(drts.EncryptionProofs))
+
+	dr := libunlynx.DpResponse{}
+	assert.NoError(t, dr.FromDpResponseToSend(drts))
+	assert.NoError(t, libunlynxencproof.VerifyEncryptionProofs(dr, drts.EncryptionProofs, context))
+	// the range proofs are still valid
+	assert.NoError(t, libunlynxrange.VerifyRangeProofs(dr, drts.RangeProofs, pubKey, rangeBits))
+
+	// the proofs cannot be reused for another survey or another ciphertext
+	assert.Error(t, libunlynxencproof.VerifyEncryptionProofs(dr, drts.EncryptionProofs, []byte("survey2")))
+	assert.Error(t, libunlynxencproof.VerifyEncryptionProofs(dr, nil, context))
+	dr.GroupByEnc["g1"] = dr.WhereEnc["w1"]
+	assert.Error(t, libunlynxencproof.VerifyEncryptionProofs(dr, drts.EncryptionProofs, context))
+
+	// nor for another attribute
+	drts.EncryptionProofs["g:g1"] = drts.EncryptionProofs["w:w1"]
+	assert.Error(t, libunlynxencproof.VerifyEncryptionProofs(dr, drts.EncryptionProofs, context))
+}
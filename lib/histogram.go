@@ -0,0 +1,148 @@
+package libunlynx
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Histogram
+//______________________________________________________________________________________________________________________
+
+// Histogram describes a binned aggregation of a numeric attribute. The value of Attribute is one-hot encoded into
+// len(Bounds)-1 bins, bin i covering the half-open interval [Bounds[i], Bounds[i+1]). Each bin becomes an aggregating
+// attribute so that the result of the survey is a per-bin count vector.
+type Histogram struct {
+	Attribute string
+	Bounds    []int64
+	// DRONoise adds an independent DRO noise value to each bin before the result is sent to the querier
+	DRONoise bool
+}
+
+// Validate checks that the histogram is well defined (an attribute and at least one bin with increasing bounds).
+func (h *Histogram) Validate() error {
+	if h.Attribute == "" {
+		return errors.New("histogram has no attribute")
+	}
+	if len(h.Bounds) < 2 {
+		return errors.New("histogram on " + h.Attribute + " needs at least two bounds")
+	}
+	for i := 1; i < len(h.Bounds); i++ {
+		if h.Bounds[i] <= h.Bounds[i-1] {
+			return errors.New("histogram on " + h.Attribute + " has non-increasing bounds")
+		}
+	}
+	return nil
+}
+
+// NbrBins returns the number of bins of the histogram.
+func (h *Histogram) NbrBins() int {
+	if len(h.Bounds) < 2 {
+		return 0
+	}
+	return len(h.Bounds) - 1
+}
+
+// BinName returns the name of the aggregating attribute corresponding to bin i (e.g. age_bin2).
+func (h *Histogram) BinName(i int) string {
+	return h.Attribute + "_bin" + strconv.Itoa(i)
+}
+
+// BinNames returns the names of the aggregating attributes of all the bins (in order).
+func (h *Histogram) BinNames() []string {
+	names := make([]string, h.NbrBins())
+	for i := range names {
+		names[i] = h.BinName(i)
+	}
+	return names
+}
+
+// BinIndex returns the bin in which the value falls or -1 if it is outside of the histogram.
+func (h *Histogram) BinIndex(value int64) int {
+	for i := 0; i < h.NbrBins(); i++ {
+		if value >= h.Bounds[i] && value < h.Bounds[i+1] {
+			return i
+		}
+	}
+	return -1
+}
+
+// OneHotEncode returns the one-hot encoding of a value (a 1 in its bin and 0 everywhere else).
+func (h *Histogram) OneHotEncode(value int64) map[string]int64 {
+	bins := make(map[string]int64, h.NbrBins())
+	index := h.BinIndex(value)
+	for i := 0; i < h.NbrBins(); i++ {
+		if i == index {
+			bins[h.BinName(i)] = 1
+		} else {
+			bins[h.BinName(i)] = 0
+		}
+	}
+	return bins
+}
+
+// EncodeDpClearResponse replaces the histogram attribute of a DP (clear) response by its one-hot encoded bins.
+// This is done by the data provider before encrypting its response. Bins keep the same (clear or encrypted) status as
+// the original attribute.
+func (h *Histogram) EncodeDpClearResponse(dcr DpClearResponse) DpClearResponse {
+	if value, ok := dcr.AggregatingAttributesEnc[h.Attribute]; ok {
+		dcr.AggregatingAttributesEnc = h.replaceWithBins(dcr.AggregatingAttributesEnc, value)
+	} else if value, ok := dcr.AggregatingAttributesClear[h.Attribute]; ok {
+		dcr.AggregatingAttributesClear = h.replaceWithBins(dcr.AggregatingAttributesClear, value)
+	}
+	return dcr
+}
+
+// EncodeDpClearResponses encodes a list of DP (clear) responses
+func (h *Histogram) EncodeDpClearResponses(dcrs []DpClearResponse) []DpClearResponse {
+	result := make([]DpClearResponse, len(dcrs))
+	for i, v := range dcrs {
+		result[i] = h.EncodeDpClearResponse(v)
+	}
+	return result
+}
+
+// BinDpResponse is the server-side version of EncodeDpClearResponse. It bins the histogram attribute if it was sent in
+// clear. An encrypted attribute cannot be binned by the server and has to be encoded by the data provider.
+func (h *Histogram) BinDpResponse(dr *DpResponse) error {
+	if _, ok := dr.AggregatingAttributesEnc[h.Attribute]; ok {
+		return errors.New("attribute " + h.Attribute + " is encrypted and has to be binned by the data provider")
+	}
+	if value, ok := dr.AggregatingAttributesClear[h.Attribute]; ok {
+		dr.AggregatingAttributesClear = h.replaceWithBins(dr.AggregatingAttributesClear, value)
+	}
+	return nil
+}
+
+// AddBinNoise adds a (different) noise value to each bin of the aggregated results. sum is the list of aggregating
+// attributes of the survey, which gives the position of each bin.
+func (h *Histogram) AddBinNoise(results []FilteredResponse, sum []string, noise CipherVector) error {
+	if len(noise) < h.NbrBins() {
+		return errors.New("not enough noise values for the histogram bins")
+	}
+
+	positions := make(map[string]int, len(sum))
+	for i, v := range sum {
+		positions[v] = i
+	}
+	for _, v := range results {
+		for i, name := range h.BinNames() {
+			if pos, ok := positions[name]; ok {
+				v.AggregatingAttributes[pos].Add(v.AggregatingAttributes[pos], noise[i])
+			}
+		}
+	}
+	return nil
+}
+
+func (h *Histogram) replaceWithBins(attributes map[string]int64, value int64) map[string]int64 {
+	result := make(map[string]int64, len(attributes)+h.NbrBins())
+	for k, v := range attributes {
+		if k != h.Attribute {
+			result[k] = v
+		}
+	}
+	for k, v := range h.OneHotEncode(value) {
+		result[k] = v
+	}
+	return result
+}
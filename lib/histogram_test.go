@@ -0,0 +1,68 @@
+package libunlynx_test
+
+import (
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramValidate(t *testing.T) {
+	assert.NoError(t, (&libunlynx.Histogram{Attribute: "age", Bounds: []int64{0, 18, 65, 120}}).Validate())
+	assert.Error(t, (&libunlynx.Histogram{Attribute: "", Bounds: []int64{0, 18}}).Validate())
+	assert.Error(t, (&libunlynx.Histogram{Attribute: "age", Bounds: []int64{0}}).Validate())
+	assert.Error(t, (&libunlynx.Histogram{Attribute: "age", Bounds: []int64{0, 18, 18}}).Validate())
+}
+
+func TestHistogramOneHotEncode(t *testing.T) {
+	h := libunlynx.Histogram{Attribute: "age", Bounds: []int64{0, 18, 65, 120}}
+
+	assert.Equal(t, 3, h.NbrBins())
+	assert.Equal(t, []string{"age_bin0", "age_bin1", "age_bin2"}, h.BinNames())
+
+	assert.Equal(t, 0, h.BinIndex(0))
+	assert.Equal(t, 1, h.BinIndex(18))
+	assert.Equal(t, 2, h.BinIndex(119))
+	assert.Equal(t, -1, h.BinIndex(120))
+	assert.Equal(t, -1, h.BinIndex(-1))
+
+	assert.Equal(t, map[string]int64{"age_bin0": 0, "age_bin1": 1, "age_bin2": 0}, h.OneHotEncode(40))
+	assert.Equal(t, map[string]int64{"age_bin0": 0, "age_bin1": 0, "age_bin2": 0}, h.OneHotEncode(200))
+}
+
+func TestHistogramEncodeDpClearResponse(t *testing.T) {
+	h := libunlynx.Histogram{Attribute: "age", Bounds: []int64{0, 18, 65}}
+
+	dcr := libunlynx.DpClearResponse{AggregatingAttributesEnc: map[string]int64{"age": 70, "s1": 2}}
+	res := h.EncodeDpClearResponse(dcr)
+	assert.Equal(t, map[string]int64{"s1": 2, "age_bin0": 0, "age_bin1": 0}, res.AggregatingAttributesEnc)
+	// the original response is not modified
+	assert.Equal(t, int64(70), dcr.AggregatingAttributesEnc["age"])
+
+	dcr = libunlynx.DpClearResponse{AggregatingAttributesClear: map[string]int64{"age": 3}}
+	res = h.EncodeDpClearResponses([]libunlynx.DpClearResponse{dcr})[0]
+	assert.Equal(t, map[string]int64{"age_bin0": 1, "age_bin1": 0}, res.AggregatingAttributesClear)
+
+	// the server can only bin clear values
+	dr := libunlynx.DpResponse{AggregatingAttributesClear: map[string]int64{"age": 20}}
+	assert.NoError(t, h.BinDpResponse(&dr))
+	assert.Equal(t, map[string]int64{"age_bin0": 0, "age_bin1": 1}, dr.AggregatingAttributesClear)
+
+	_, pubKey := libunlynx.GenKey()
+	dr = libunlynx.DpResponse{AggregatingAttributesEnc: map[string]libunlynx.CipherText{"age": *libunlynx.EncryptInt(pubKey, 20)}}
+	assert.Error(t, h.BinDpResponse(&dr))
+}
+
+func TestHistogramAddBinNoise(t *testing.T) {
+	secKey, pubKey := libunlynx.GenKey()
+	h := libunlynx.Histogram{Attribute: "age", Bounds: []int64{0, 18, 65}, DRONoise: true}
+
+	sum := []string{"s1", "age_bin0", "age_bin1"}
+	results := []libunlynx.FilteredResponse{{AggregatingAttributes: *libunlynx.EncryptIntVector(pubKey, []int64{5, 10, 20})}}
+	noise := *libunlynx.EncryptIntVector(pubKey, []int64{1, 2})
+
+	assert.NoError(t, h.AddBinNoise(results, sum, noise))
+	assert.Equal(t, []int64{5, 11, 22}, libunlynx.DecryptIntVector(secKey, &results[0].AggregatingAttributes))
+
+	assert.Error(t, h.AddBinNoise(results, sum, noise[:1]))
+}
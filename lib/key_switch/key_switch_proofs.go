@@ -37,7 +37,8 @@ type PublishedKSListProof struct {
 
 // PublishedKSListProofBytes is the 'bytes' equivalent of PublishedKSListProof
 type PublishedKSListProofBytes struct {
-	List []PublishedKSProofBytes
+	Version int
+	List    []PublishedKSProofBytes
 }
 
 // KEY SWITCH proofs
@@ -179,7 +180,7 @@ func (pksp *PublishedKSProof) ToBytes() (PublishedKSProofBytes, error) {
 // FromBytes converts back bytes to PublishedKSProof
 func (pksp *PublishedKSProof) FromBytes(pkspb PublishedKSProofBytes) error {
 	pksp.Proof = pkspb.Proof
-	data, err := libunlynx.FromBytesToAbstractPoints(pkspb.KVibKs2RbNegQ)
+	data, err := libunlynx.FromBytesToNAbstractPoints(pkspb.KVibKs2RbNegQ, 5)
 	if err != nil {
 		return err
 	}
@@ -221,12 +222,17 @@ func (pkslp *PublishedKSListProof) ToBytes() (PublishedKSListProofBytes, error)
 		return PublishedKSListProofBytes{}, err
 	}
 
+	pkslpb.Version = libunlynx.ProofBytesVersion
 	pkslpb.List = prsB
 	return pkslpb, nil
 }
 
 // FromBytes converts bytes back to PublishedKSListProof
 func (pkslp *PublishedKSListProof) FromBytes(pkslpb PublishedKSListProofBytes) error {
+	if err := libunlynx.CheckProofBytesVersion(pkslpb.Version); err != nil {
+		return err
+	}
+
 	var err error
 	mutex := sync.Mutex{}
 	prs := make([]PublishedKSProof, len(pkslpb.List))
@@ -53,3 +53,27 @@ func TestKeySwitchingProof(t *testing.T) {
 	verif = libunlynxkeyswitch.KeySwitchListProofVerification(pkslp, 1.0)
 	assert.False(t, verif)
 }
+
+func TestPublishedKSListProof_ToBytes(t *testing.T) {
+	keysTarget := key.NewKeyPair(libunlynx.SuiTe)
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+
+	ct1 := libunlynx.EncryptInt(keys.Public, int64(1))
+	ct2 := libunlynx.EncryptInt(keys.Public, int64(2))
+	_, ks2s, rBNegs, vis := libunlynxkeyswitch.KeySwitchSequence(keysTarget.Public, []kyber.Point{ct1.K, ct2.K}, keys.Private)
+	pkslp, err := libunlynxkeyswitch.KeySwitchListProofCreation(keys.Public, keysTarget.Public, keys.Private, ks2s, rBNegs, vis)
+	assert.NoError(t, err)
+
+	pkslpb, err := pkslp.ToBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, libunlynx.ProofBytesVersion, pkslpb.Version)
+
+	converted := libunlynxkeyswitch.PublishedKSListProof{}
+	assert.NoError(t, converted.FromBytes(pkslpb))
+	assert.True(t, libunlynxkeyswitch.KeySwitchListProofVerification(converted, 1.0))
+
+	pkslpb.List[0].KVibKs2RbNegQ = pkslpb.List[0].KVibKs2RbNegQ[:libunlynx.SuiTe.PointLen()]
+	assert.Error(t, converted.FromBytes(pkslpb))
+	pkslpb.Version = 0
+	assert.Error(t, converted.FromBytes(pkslpb))
+}
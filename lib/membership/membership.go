@@ -0,0 +1,87 @@
+// Package libunlynxmembership contains the functions used to test collectively whether encrypted values belong to a
+// public set of values (e.g. whether an encrypted count is below a threshold).
+// For each value v and each element s of the set, the root computes r*(Enc(v)-Enc(s)), with r a random scalar, which is
+// an encryption of 0 if v == s and of a random value otherwise. These ciphertexts are organised in a matrix (one row
+// per element of the set, one column per value), with an additional column containing encryptions of 0.
+// The matrix is then collectively shuffled (to hide which element of the set matches) and deterministically tagged.
+// A value belongs to the set if one of the tags of its column is equal to the tag of the reference column.
+// The root only learns, for each value, whether it belongs to the set and which values match the same (unknown) element.
+package libunlynxmembership
+
+import (
+	"errors"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+)
+
+// ThresholdSet returns the set of values below a threshold ({0, ..., k-1}) for non-negative values (e.g. counts).
+func ThresholdSet(k int64) []int64 {
+	if k < 0 {
+		k = 0
+	}
+	set := make([]int64, k)
+	for i := range set {
+		set[i] = int64(i)
+	}
+	return set
+}
+
+// PrepareMembershipTest builds the matrix that is shuffled and tagged to test if each value belongs to the set. The
+// last column of each row contains the reference (an encryption of 0).
+func PrepareMembershipTest(values libunlynx.CipherVector, set []int64, pubKey kyber.Point) []libunlynx.CipherVector {
+	// the shuffling needs at least two rows: we add a row of random (non-zero) values
+	nbrRows := len(set)
+	if nbrRows < 2 {
+		nbrRows = 2
+	}
+
+	matrix := make([]libunlynx.CipherVector, nbrRows)
+	wg := libunlynx.StartParallelize(nbrRows)
+	for i := range matrix {
+		go func(i int) {
+			defer wg.Done()
+			row := make(libunlynx.CipherVector, len(values)+1)
+			for j, v := range values {
+				if i < len(set) {
+					diff := libunlynx.NewCipherText()
+					diff.Sub(v, libunlynx.IntToCipherText(set[i]))
+					row[j].MulCipherTextbyScalar(*diff, libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream()))
+				} else {
+					row[j] = *libunlynx.EncryptScalar(pubKey, libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream()))
+				}
+			}
+			row[len(values)] = *libunlynx.EncryptInt(pubKey, 0)
+			matrix[i] = row
+		}(i)
+	}
+	libunlynx.EndParallelize(wg)
+
+	return matrix
+}
+
+// EvaluateMembershipTest uses the tags of the (shuffled) matrix to determine which values belong to the set.
+func EvaluateMembershipTest(tags []libunlynx.DeterministCipherVector) ([]bool, error) {
+	if len(tags) == 0 || len(tags[0]) == 0 {
+		return nil, errors.New("no tags to evaluate")
+	}
+
+	nbrValues := len(tags[0]) - 1
+	reference := tags[0][nbrValues]
+
+	result := make([]bool, nbrValues)
+	for _, row := range tags {
+		if len(row) != nbrValues+1 {
+			return nil, errors.New("rows of the membership test have different sizes")
+		}
+		if !row[nbrValues].Equal(&reference) {
+			return nil, errors.New("the reference tags are not equal")
+		}
+		for j := 0; j < nbrValues; j++ {
+			if row[j].Equal(&reference) {
+				result[j] = true
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package libunlynxmembership_test
+
+import (
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/deterministic_tag"
+	"github.com/ldsec/unlynx/lib/membership"
+	"github.com/stretchr/testify/assert"
+	"go.dedis.ch/kyber/v3"
+)
+
+// tagMatrix deterministically tags (without shuffling) the matrix like the servers would do
+func tagMatrix(matrix []libunlynx.CipherVector, private []kyber.Scalar) []libunlynx.DeterministCipherVector {
+	_, secretPrivate, _ := libunlynx.GenKeys(len(private))
+
+	tags := make([]libunlynx.DeterministCipherVector, len(matrix))
+	for i, row := range matrix {
+		cv := row
+		for n := range private {
+			cv = libunlynxdetertag.DeterministicTagSequence(cv, private[n], secretPrivate[n])
+		}
+		tags[i] = make(libunlynx.DeterministCipherVector, len(cv))
+		for j, c := range cv {
+			tags[i][j] = libunlynx.DeterministCipherText{Point: c.C}
+		}
+	}
+	return tags
+}
+
+func TestThresholdSet(t *testing.T) {
+	assert.Equal(t, []int64{0, 1, 2}, libunlynxmembership.ThresholdSet(3))
+	assert.Empty(t, libunlynxmembership.ThresholdSet(0))
+	assert.Empty(t, libunlynxmembership.ThresholdSet(-1))
+}
+
+func TestMembershipTest(t *testing.T) {
+	K, private, _ := libunlynx.GenKeys(3)
+	values := *libunlynx.EncryptIntVector(K, []int64{1, 5, 3, 10})
+
+	matrix := libunlynxmembership.PrepareMembershipTest(values, libunlynxmembership.ThresholdSet(4), K)
+	assert.Equal(t, 4, len(matrix))
+	for _, row := range matrix {
+		assert.Equal(t, len(values)+1, len(row))
+	}
+
+	result, err := libunlynxmembership.EvaluateMembershipTest(tagMatrix(matrix, private))
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false, true, false}, result)
+
+	// a set with only one element is padded to two rows
+	matrix = libunlynxmembership.PrepareMembershipTest(values, []int64{10}, K)
+	assert.Equal(t, 2, len(matrix))
+	result, err = libunlynxmembership.EvaluateMembershipTest(tagMatrix(matrix, private))
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, false, false, true}, result)
+
+	_, err = libunlynxmembership.EvaluateMembershipTest(nil)
+	assert.Error(t, err)
+}
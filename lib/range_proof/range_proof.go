@@ -0,0 +1,235 @@
+// Package libunlynxrange contains the functions to create and verify range proofs, which prove that a ciphertext
+// encrypts a value in [0, 2^l) without revealing the value.
+// The value v is decomposed in l bits b_i, each bit is encrypted (with randomness r_i) and an OR proof shows that each
+// of these ciphertexts encrypts 0 or 1. The randomness is chosen such that the sum of the bit ciphertexts weighted by
+// 2^i is exactly the original ciphertext, which the verifier checks homomorphically.
+package libunlynxrange
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/proof"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// MaxBits is the maximum size (in bits) of a range
+const MaxBits = 62
+
+// Structs
+//______________________________________________________________________________________________________________________
+
+// PublishedRangeProof contains the encryptions of the bits of a value and the proofs that each of them is a bit
+type PublishedRangeProof struct {
+	Bits   libunlynx.CipherVector
+	Proofs [][]byte
+}
+
+// RANGE proofs
+//______________________________________________________________________________________________________________________
+
+// createPredicateBit creates the predicate proving that (K, C) encrypts 0 or 1 (CmB is C - B)
+func createPredicateBit() (predicate proof.Predicate) {
+	bit0 := proof.And(proof.Rep("K", "r", "B"), proof.Rep("C", "r", "X"))
+	bit1 := proof.And(proof.Rep("K", "r", "B"), proof.Rep("CmB", "r", "X"))
+	return proof.Or(bit0, bit1)
+}
+
+// RangeProofCreation creates a proof that the ciphertext encrypting value with randomness r (e.g. with
+// libunlynx.EncryptIntGetR) encrypts a value in [0, 2^nbrBits).
+func RangeProofCreation(value int64, r kyber.Scalar, pubKey kyber.Point, nbrBits int) (PublishedRangeProof, error) {
+	if nbrBits <= 0 || nbrBits > MaxBits {
+		return PublishedRangeProof{}, errors.New("range of " + strconv.Itoa(nbrBits) + " bits is not supported")
+	}
+	if value < 0 || value >= int64(1)<<uint(nbrBits) {
+		return PublishedRangeProof{}, errors.New("value " + strconv.FormatInt(value, 10) + " is not in [0, 2^" + strconv.Itoa(nbrBits) + ")")
+	}
+
+	// r = sum(2^i * r_i): the randomness of the first bit is fixed by the others
+	rs := make([]kyber.Scalar, nbrBits)
+	rs[0] = libunlynx.SuiTe.Scalar().Set(r)
+	for i := 1; i < nbrBits; i++ {
+		rs[i] = libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
+		weighted := libunlynx.SuiTe.Scalar().Mul(rs[i], libunlynx.SuiTe.Scalar().SetInt64(int64(1)<<uint(i)))
+		rs[0] = libunlynx.SuiTe.Scalar().Sub(rs[0], weighted)
+	}
+
+	B := libunlynx.SuiTe.Point().Base()
+	prp := PublishedRangeProof{Bits: make(libunlynx.CipherVector, nbrBits), Proofs: make([][]byte, nbrBits)}
+	for i := 0; i < nbrBits; i++ {
+		bit := (value >> uint(i)) & 1
+		K := libunlynx.SuiTe.Point().Mul(rs[i], B)
+		C := libunlynx.SuiTe.Point().Add(libunlynx.SuiTe.Point().Mul(rs[i], pubKey), libunlynx.IntToPoint(bit))
+		prp.Bits[i] = libunlynx.CipherText{K: K, C: C}
+
+		predicate := createPredicateBit()
+		sval := map[string]kyber.Scalar{"r": rs[i]}
+		pval := bitPoints(prp.Bits[i], pubKey)
+		prover := predicate.Prover(libunlynx.SuiTe, sval, pval, map[proof.Predicate]int{predicate: int(bit)})
+		bitProof, err := proof.HashProve(libunlynx.SuiTe, "rangeProof", prover)
+		if err != nil {
+			return PublishedRangeProof{}, errors.New("---------Prover: " + err.Error())
+		}
+		prp.Proofs[i] = bitProof
+	}
+	return prp, nil
+}
+
+// RangeProofVerification verifies that a range proof is valid for a ciphertext and a range of nbrBits bits
+func RangeProofVerification(prp PublishedRangeProof, ct libunlynx.CipherText, pubKey kyber.Point, nbrBits int) bool {
+	if len(prp.Bits) != nbrBits || len(prp.Proofs) != nbrBits {
+		log.Error("---------Verifier: the range proof has " + strconv.Itoa(len(prp.Bits)) + " bits instead of " + strconv.Itoa(nbrBits))
+		return false
+	}
+
+	// the weighted sum of the bits has to be the ciphertext
+	sum := libunlynx.CipherText{K: libunlynx.SuiTe.Point().Null(), C: libunlynx.SuiTe.Point().Null()}
+	for i, b := range prp.Bits {
+		weighted := libunlynx.NewCipherText()
+		weighted.MulCipherTextbyScalar(b, libunlynx.SuiTe.Scalar().SetInt64(int64(1)<<uint(i)))
+		sum.Add(sum, *weighted)
+	}
+	if !sum.Equal(&ct) {
+		log.Error("---------Verifier: the bits of the range proof do not sum to the ciphertext")
+		return false
+	}
+
+	for i, b := range prp.Bits {
+		predicate := createPredicateBit()
+		verifier := predicate.Verifier(libunlynx.SuiTe, bitPoints(b, pubKey))
+		if err := proof.HashVerify(libunlynx.SuiTe, "rangeProof", verifier, prp.Proofs[i]); err != nil {
+			log.Error("---------Verifier:", err.Error())
+			return false
+		}
+	}
+	return true
+}
+
+func bitPoints(bit libunlynx.CipherText, pubKey kyber.Point) map[string]kyber.Point {
+	B := libunlynx.SuiTe.Point().Base()
+	return map[string]kyber.Point{"B": B, "X": pubKey, "K": bit.K, "C": bit.C, "CmB": libunlynx.SuiTe.Point().Sub(bit.C, B)}
+}
+
+// AddRangeProofs encrypts again (with a known randomness) the encrypted aggregating attributes of a DP response that
+// have a range (number of bits) and adds their range proofs to the response. The count attribute (added by
+// libunlynx.EncryptDpClearResponse) has the value 1. It returns the randomness of the new ciphertexts.
+func AddRangeProofs(dcr libunlynx.DpClearResponse, dr *libunlynx.DpResponseToSend, pubKey kyber.Point, rangeBits map[string]int64) (map[string]kyber.Scalar, error) {
+	rs := make(map[string]kyber.Scalar)
+	for attr, nbrBits := range rangeBits {
+		if _, ok := dr.AggregatingAttributesEnc[attr]; !ok {
+			continue
+		}
+		value, ok := dcr.AggregatingAttributesEnc[attr]
+		if !ok && attr == "count" {
+			value = 1
+		}
+
+		ct, r := libunlynx.EncryptIntGetR(pubKey, value)
+		prp, err := RangeProofCreation(value, r, pubKey, int(nbrBits))
+		if err != nil {
+			return nil, errors.New("attribute " + attr + ": " + err.Error())
+		}
+		ctBytes, err := ct.ToBytes()
+		if err != nil {
+			return nil, err
+		}
+		prpBytes, err := prp.ToBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		dr.AggregatingAttributesEnc[attr] = ctBytes
+		if dr.RangeProofs == nil {
+			dr.RangeProofs = make(map[string][]byte)
+		}
+		dr.RangeProofs[attr] = prpBytes
+		rs[attr] = r
+	}
+	return rs, nil
+}
+
+// VerifyRangeProofs checks that the aggregating attributes of a DP response that have a range are in their range: the
+// encrypted ones with their range proofs and the clear ones directly.
+func VerifyRangeProofs(dr libunlynx.DpResponse, rangeProofs map[string][]byte, pubKey kyber.Point, rangeBits map[string]int64) error {
+	for attr, nbrBits := range rangeBits {
+		if value, ok := dr.AggregatingAttributesClear[attr]; ok {
+			if value < 0 || nbrBits <= 0 || nbrBits > MaxBits || value >= int64(1)<<uint(nbrBits) {
+				return errors.New("value of attribute " + attr + " is out of range")
+			}
+		}
+		ct, ok := dr.AggregatingAttributesEnc[attr]
+		if !ok {
+			continue
+		}
+
+		data, ok := rangeProofs[attr]
+		if !ok {
+			return errors.New("attribute " + attr + " has no range proof")
+		}
+		prp := PublishedRangeProof{}
+		if err := prp.FromBytes(data); err != nil {
+			return errors.New("attribute " + attr + ": " + err.Error())
+		}
+		if !RangeProofVerification(prp, ct, pubKey, int(nbrBits)) {
+			return errors.New("range proof of attribute " + attr + " is not valid")
+		}
+	}
+	return nil
+}
+
+// Marshal
+//______________________________________________________________________________________________________________________
+
+// ToBytes converts a PublishedRangeProof to bytes (the number of bits, the bit ciphertexts and the proofs with their size)
+func (prp *PublishedRangeProof) ToBytes() ([]byte, error) {
+	bits, length, err := prp.Bits.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 4, 4+len(bits))
+	binary.BigEndian.PutUint32(data, uint32(length))
+	data = append(data, bits...)
+	for _, p := range prp.Proofs {
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint32(size, uint32(len(p)))
+		data = append(data, size...)
+		data = append(data, p...)
+	}
+	return data, nil
+}
+
+// FromBytes converts back bytes to a PublishedRangeProof
+func (prp *PublishedRangeProof) FromBytes(data []byte) error {
+	if len(data) < 4 {
+		return errors.New("range proof is too short")
+	}
+	length := int(binary.BigEndian.Uint32(data))
+	if length > MaxBits || len(data) < 4+length*libunlynx.CipherTextByteSize() {
+		return errors.New("range proof is malformed")
+	}
+	data = data[4:]
+
+	prp.Bits = make(libunlynx.CipherVector, length)
+	if err := prp.Bits.FromBytes(data[:length*libunlynx.CipherTextByteSize()], length); err != nil {
+		return err
+	}
+	data = data[length*libunlynx.CipherTextByteSize():]
+
+	prp.Proofs = make([][]byte, length)
+	for i := range prp.Proofs {
+		if len(data) < 4 {
+			return errors.New("range proof is malformed")
+		}
+		size := int(binary.BigEndian.Uint32(data))
+		if len(data) < 4+size {
+			return errors.New("range proof is malformed")
+		}
+		prp.Proofs[i] = data[4 : 4+size]
+		data = data[4+size:]
+	}
+	return nil
+}
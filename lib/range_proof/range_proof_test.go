@@ -0,0 +1,73 @@
+package libunlynxrange_test
+
+import (
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/range_proof"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRangeProof(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+
+	for _, v := range []int64{0, 1, 5, 7} {
+		ct, r := libunlynx.EncryptIntGetR(pubKey, v)
+		prp, err := libunlynxrange.RangeProofCreation(v, r, pubKey, 3)
+		assert.NoError(t, err)
+		assert.True(t, libunlynxrange.RangeProofVerification(prp, *ct, pubKey, 3))
+
+		// marshal
+		data, err := prp.ToBytes()
+		assert.NoError(t, err)
+		prpFromBytes := libunlynxrange.PublishedRangeProof{}
+		assert.NoError(t, prpFromBytes.FromBytes(data))
+		assert.True(t, libunlynxrange.RangeProofVerification(prpFromBytes, *ct, pubKey, 3))
+
+		// wrong range or ciphertext
+		assert.False(t, libunlynxrange.RangeProofVerification(prp, *ct, pubKey, 4))
+		assert.False(t, libunlynxrange.RangeProofVerification(prp, *libunlynx.EncryptInt(pubKey, v), pubKey, 3))
+	}
+
+	// the value has to be in the range
+	ct, r := libunlynx.EncryptIntGetR(pubKey, 8)
+	_, err := libunlynxrange.RangeProofCreation(8, r, pubKey, 3)
+	assert.Error(t, err)
+	_, err = libunlynxrange.RangeProofCreation(-1, r, pubKey, 3)
+	assert.Error(t, err)
+
+	// a proof of a bit encrypting 2 is not valid
+	prp, err := libunlynxrange.RangeProofCreation(4, r, pubKey, 3)
+	assert.NoError(t, err)
+	prp.Bits[0].C = libunlynx.SuiTe.Point().Add(prp.Bits[0].C, libunlynx.IntToPoint(2))
+	prp.Bits[1].C = libunlynx.SuiTe.Point().Sub(prp.Bits[1].C, libunlynx.IntToPoint(1))
+	assert.False(t, libunlynxrange.RangeProofVerification(prp, *ct, pubKey, 3))
+
+	assert.Error(t, prp.FromBytes([]byte{0, 0}))
+}
+
+func TestAddRangeProofs(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+	rangeBits := map[string]int64{"s1": 1, "count": 1}
+
+	dcr := libunlynx.DpClearResponse{AggregatingAttributesEnc: map[string]int64{"s1": 1, "s2": 100}, AggregatingAttributesClear: map[string]int64{"s3": 2}}
+	drts, err := libunlynx.EncryptDpClearResponse(dcr, pubKey, true)
+	assert.NoError(t, err)
+	rs, err := libunlynxrange.AddRangeProofs(dcr, &drts, pubKey, rangeBits)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(rs))
+	assert.Equal(t, 2, len(drts.RangeProofs))
+
+	dr := libunlynx.DpResponse{}
+	assert.NoError(t, dr.FromDpResponseToSend(drts))
+	assert.NoError(t, libunlynxrange.VerifyRangeProofs(dr, drts.RangeProofs, pubKey, rangeBits))
+	assert.Error(t, libunlynxrange.VerifyRangeProofs(dr, nil, pubKey, rangeBits))
+	assert.Error(t, libunlynxrange.VerifyRangeProofs(dr, drts.RangeProofs, pubKey, map[string]int64{"s3": 1}))
+
+	// a value out of the range cannot be proven
+	dcr.AggregatingAttributesEnc["s1"] = 1000000
+	drts, err = libunlynx.EncryptDpClearResponse(dcr, pubKey, false)
+	assert.NoError(t, err)
+	_, err = libunlynxrange.AddRangeProofs(dcr, &drts, pubKey, rangeBits)
+	assert.Error(t, err)
+}
@@ -0,0 +1,238 @@
+package libunlynx
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Dataset schema
+//______________________________________________________________________________________________________________________
+
+// Kinds of attributes (how an attribute is used in a query)
+const (
+	// AttributeKindWhere is an attribute used in the where clause of a query
+	AttributeKindWhere = "where"
+	// AttributeKindGroupBy is an attribute used in the group by clause of a query
+	AttributeKindGroupBy = "groupBy"
+	// AttributeKindAggregate is an attribute that is aggregated (summed)
+	AttributeKindAggregate = "aggregate"
+)
+
+// Types of attributes (which values an attribute can take)
+const (
+	// AttributeTypeInt is an attribute that can take any integer value
+	AttributeTypeInt = "int"
+	// AttributeTypeRange is an attribute whose values are in [Min, Max]
+	AttributeTypeRange = "range"
+	// AttributeTypeCategorical is an attribute whose values are in Values
+	AttributeTypeCategorical = "categorical"
+)
+
+// countAttribute is the aggregating attribute added to the responses by the data providers when they count the
+// responses, it does not need to be declared in a schema
+const countAttribute = "count"
+
+// AttributeSchema declares an attribute of a dataset. An optional attribute can be missing in the DP responses.
+type AttributeSchema struct {
+	Name     string
+	Kind     string
+	Type     string
+	Min      int64
+	Max      int64
+	Values   []int64
+	Optional bool
+}
+
+// DatasetSchema declares the attributes of the dataset held by the data providers of a roster. It permits to reject
+// queries and DP responses that use undeclared attributes (e.g. typos) instead of silently aggregating zeros.
+type DatasetSchema struct {
+	Attributes []AttributeSchema
+}
+
+// Validate checks that the schema is well defined (known kinds and types, no attribute declared twice)
+func (s *DatasetSchema) Validate() error {
+	if len(s.Attributes) == 0 {
+		return errors.New("schema has no attributes")
+	}
+
+	declared := make(map[string]bool, len(s.Attributes))
+	for _, a := range s.Attributes {
+		if a.Name == "" {
+			return errors.New("schema attribute with no name")
+		}
+		if declared[a.Name] {
+			return errors.New("attribute " + a.Name + " is declared twice")
+		}
+		declared[a.Name] = true
+
+		if a.Kind != AttributeKindWhere && a.Kind != AttributeKindGroupBy && a.Kind != AttributeKindAggregate {
+			return errors.New("unknown kind " + a.Kind + " for attribute " + a.Name)
+		}
+		switch a.Type {
+		case AttributeTypeInt:
+		case AttributeTypeRange:
+			if a.Min > a.Max {
+				return errors.New("attribute " + a.Name + " has an empty range")
+			}
+		case AttributeTypeCategorical:
+			if len(a.Values) == 0 {
+				return errors.New("categorical attribute " + a.Name + " has no values")
+			}
+		default:
+			return errors.New("unknown type " + a.Type + " for attribute " + a.Name)
+		}
+	}
+	return nil
+}
+
+// Attribute returns the declaration of an attribute (nil if it is not declared)
+func (s *DatasetSchema) Attribute(name string) *AttributeSchema {
+	for i := range s.Attributes {
+		if s.Attributes[i].Name == name {
+			return &s.Attributes[i]
+		}
+	}
+	return nil
+}
+
+// CheckValue checks that a (clear) value is in the domain of the attribute
+func (a *AttributeSchema) CheckValue(value int64) error {
+	switch a.Type {
+	case AttributeTypeRange:
+		if value < a.Min || value > a.Max {
+			return errors.New("value " + strconv.FormatInt(value, 10) + " of attribute " + a.Name + " is not in [" +
+				strconv.FormatInt(a.Min, 10) + ", " + strconv.FormatInt(a.Max, 10) + "]")
+		}
+	case AttributeTypeCategorical:
+		for _, v := range a.Values {
+			if v == value {
+				return nil
+			}
+		}
+		return errors.New("value " + strconv.FormatInt(value, 10) + " of attribute " + a.Name + " is not one of its categories")
+	}
+	return nil
+}
+
+// checkKind checks that an attribute is declared with the given kind
+func (s *DatasetSchema) checkKind(name, kind string) error {
+	a := s.Attribute(name)
+	if a == nil {
+		return errors.New("attribute " + name + " is not declared in the schema")
+	}
+	if a.Kind != kind {
+		return errors.New("attribute " + name + " is a " + a.Kind + " attribute and cannot be used as a " + kind + " attribute")
+	}
+	return nil
+}
+
+// ValidateQuery checks that the attributes used by a query are declared with the right kind. The count attribute does
+// not need to be declared.
+func (s *DatasetSchema) ValidateQuery(where, groupBy, sum []string) error {
+	for _, v := range where {
+		if err := s.checkKind(v, AttributeKindWhere); err != nil {
+			return err
+		}
+	}
+	for _, v := range groupBy {
+		if err := s.checkKind(v, AttributeKindGroupBy); err != nil {
+			return err
+		}
+	}
+	for _, v := range sum {
+		if v == countAttribute {
+			continue
+		}
+		if err := s.checkKind(v, AttributeKindAggregate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateDpResponse checks a DP response against the schema and the attributes (where, groupBy, sum) of the query:
+//   - the declared attributes of the response have the right kind and their clear values are in their domain (encrypted
+//     values cannot be checked),
+//   - the undeclared attributes of the response are attributes derived by the query (e.g. histogram bins),
+//   - the declared (non-optional) attributes of the query are in the response.
+func (s *DatasetSchema) ValidateDpResponse(dr *DpResponse, where, groupBy, sum []string) error {
+	checkClear := func(attributes map[string]int64, kind string, query []string) error {
+		for k, v := range attributes {
+			if err := s.checkResponseAttribute(k, kind, query); err != nil {
+				return err
+			}
+			if a := s.Attribute(k); a != nil {
+				if err := a.CheckValue(v); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	checkEnc := func(attributes map[string]CipherText, kind string, query []string) error {
+		for k := range attributes {
+			if err := s.checkResponseAttribute(k, kind, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	checkMissing := func(clear map[string]int64, enc map[string]CipherText, query []string) error {
+		for _, v := range query {
+			a := s.Attribute(v)
+			if a == nil || a.Optional {
+				continue
+			}
+			_, okClear := clear[v]
+			_, okEnc := enc[v]
+			if !okClear && !okEnc {
+				return errors.New("attribute " + v + " is missing in the response")
+			}
+		}
+		return nil
+	}
+
+	if err := checkClear(dr.WhereClear, AttributeKindWhere, where); err != nil {
+		return err
+	}
+	if err := checkEnc(dr.WhereEnc, AttributeKindWhere, where); err != nil {
+		return err
+	}
+	if err := checkClear(dr.GroupByClear, AttributeKindGroupBy, groupBy); err != nil {
+		return err
+	}
+	if err := checkEnc(dr.GroupByEnc, AttributeKindGroupBy, groupBy); err != nil {
+		return err
+	}
+	if err := checkClear(dr.AggregatingAttributesClear, AttributeKindAggregate, sum); err != nil {
+		return err
+	}
+	if err := checkEnc(dr.AggregatingAttributesEnc, AttributeKindAggregate, sum); err != nil {
+		return err
+	}
+
+	if err := checkMissing(dr.WhereClear, dr.WhereEnc, where); err != nil {
+		return err
+	}
+	if err := checkMissing(dr.GroupByClear, dr.GroupByEnc, groupBy); err != nil {
+		return err
+	}
+	return checkMissing(dr.AggregatingAttributesClear, dr.AggregatingAttributesEnc, sum)
+}
+
+// checkResponseAttribute checks that an attribute of a response is either declared with the right kind or derived by
+// the query (e.g. a histogram bin)
+func (s *DatasetSchema) checkResponseAttribute(name, kind string, query []string) error {
+	if s.Attribute(name) != nil {
+		return s.checkKind(name, kind)
+	}
+	if name == countAttribute && kind == AttributeKindAggregate {
+		return nil
+	}
+	for _, v := range query {
+		if v == name {
+			return nil
+		}
+	}
+	return errors.New("attribute " + name + " is not declared in the schema")
+}
@@ -0,0 +1,67 @@
+package libunlynx_test
+
+import (
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSchema = libunlynx.DatasetSchema{Attributes: []libunlynx.AttributeSchema{
+	{Name: "w1", Kind: libunlynx.AttributeKindWhere, Type: libunlynx.AttributeTypeInt},
+	{Name: "g1", Kind: libunlynx.AttributeKindGroupBy, Type: libunlynx.AttributeTypeCategorical, Values: []int64{0, 1}},
+	{Name: "s1", Kind: libunlynx.AttributeKindAggregate, Type: libunlynx.AttributeTypeRange, Min: 0, Max: 100},
+	{Name: "s2", Kind: libunlynx.AttributeKindAggregate, Type: libunlynx.AttributeTypeInt, Optional: true},
+}}
+
+func TestDatasetSchemaValidate(t *testing.T) {
+	assert.NoError(t, testSchema.Validate())
+	assert.Error(t, (&libunlynx.DatasetSchema{}).Validate())
+	assert.Error(t, (&libunlynx.DatasetSchema{Attributes: []libunlynx.AttributeSchema{
+		{Name: "s1", Kind: libunlynx.AttributeKindAggregate, Type: libunlynx.AttributeTypeInt},
+		{Name: "s1", Kind: libunlynx.AttributeKindAggregate, Type: libunlynx.AttributeTypeInt}}}).Validate())
+	assert.Error(t, (&libunlynx.DatasetSchema{Attributes: []libunlynx.AttributeSchema{
+		{Name: "s1", Kind: "select", Type: libunlynx.AttributeTypeInt}}}).Validate())
+	assert.Error(t, (&libunlynx.DatasetSchema{Attributes: []libunlynx.AttributeSchema{
+		{Name: "s1", Kind: libunlynx.AttributeKindAggregate, Type: libunlynx.AttributeTypeRange, Min: 2, Max: 1}}}).Validate())
+	assert.Error(t, (&libunlynx.DatasetSchema{Attributes: []libunlynx.AttributeSchema{
+		{Name: "g1", Kind: libunlynx.AttributeKindGroupBy, Type: libunlynx.AttributeTypeCategorical}}}).Validate())
+}
+
+func TestDatasetSchemaValidateQuery(t *testing.T) {
+	assert.NoError(t, testSchema.ValidateQuery([]string{"w1"}, []string{"g1"}, []string{"s1", "s2", "count"}))
+	// typo
+	assert.Error(t, testSchema.ValidateQuery(nil, []string{"g1"}, []string{"s11"}))
+	// wrong kind
+	assert.Error(t, testSchema.ValidateQuery(nil, []string{"s1"}, nil))
+}
+
+func TestDatasetSchemaValidateDpResponse(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+	where, groupBy, sum := []string{"w1"}, []string{"g1"}, []string{"s1", "s2", "s1_bin0"}
+
+	dr := libunlynx.DpResponse{
+		WhereEnc:                   map[string]libunlynx.CipherText{"w1": *libunlynx.EncryptInt(pubKey, 3)},
+		GroupByClear:               map[string]int64{"g1": 1},
+		AggregatingAttributesClear: map[string]int64{"s1": 50, "count": 1},
+		AggregatingAttributesEnc:   map[string]libunlynx.CipherText{"s1_bin0": *libunlynx.EncryptInt(pubKey, 1)},
+	}
+	assert.NoError(t, testSchema.ValidateDpResponse(&dr, where, groupBy, sum))
+
+	// clear value outside of the domain
+	dr.GroupByClear["g1"] = 2
+	assert.Error(t, testSchema.ValidateDpResponse(&dr, where, groupBy, sum))
+	dr.GroupByClear["g1"] = 0
+	dr.AggregatingAttributesClear["s1"] = 101
+	assert.Error(t, testSchema.ValidateDpResponse(&dr, where, groupBy, sum))
+	dr.AggregatingAttributesClear["s1"] = 100
+
+	// undeclared attribute
+	dr.AggregatingAttributesClear["s3"] = 1
+	assert.Error(t, testSchema.ValidateDpResponse(&dr, where, groupBy, sum))
+	delete(dr.AggregatingAttributesClear, "s3")
+
+	// missing (non-optional) attribute
+	delete(dr.AggregatingAttributesClear, "s1")
+	assert.Error(t, testSchema.ValidateDpResponse(&dr, where, groupBy, sum))
+}
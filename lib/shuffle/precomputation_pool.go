@@ -0,0 +1,337 @@
+package libunlynxshuffle
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// Precomputation pool
+//______________________________________________________________________________________________________________________
+
+// DefaultPrecomputationPoolSize is the number of precomputed values kept for each collective key and line size
+const DefaultPrecomputationPoolSize = 100
+
+// DefaultPrecomputationIdleDelay is the time without any value being taken after which the pool is refilled
+const DefaultPrecomputationIdleDelay = time.Second
+
+// precomputationChunk is the number of values computed at once when refilling the pool
+const precomputationChunk = 10
+
+// PrecomputationPool keeps precomputed rerandomization values (see CreatePrecomputedRandomize) for the shuffles, per
+// collective key and line size. Each value is given out (Take) only once and the pool is refilled in the background
+// once it has not been used for IdleDelay. With a directory, each pool is saved in its own file, which is rewritten
+// (atomically) before the values taken are given out so that a restarted server never uses them again.
+type PrecomputationPool struct {
+	// Size is the number of values kept per collective key and line size
+	Size int
+	// IdleDelay is the time without any value being taken after which the pool is refilled
+	IdleDelay time.Duration
+
+	dir     string
+	mutex   sync.Mutex
+	pools   map[string]*precomputationEntries
+	lastUse time.Time
+
+	wake    chan struct{}
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// precomputationEntries are the values of a pool for a collective key and a line size
+type precomputationEntries struct {
+	collectiveKey kyber.Point
+	lineSize      int
+	entries       []CipherVectorScalar
+}
+
+// precomputationFile is the content of the file of a pool
+type precomputationFile struct {
+	CollectiveKey []byte
+	LineSize      int
+	Entries       []CipherVectorScalarBytes
+}
+
+// NewPrecomputationPool creates a pool saved in dir (only kept in memory if dir is empty)
+func NewPrecomputationPool(dir string) (*PrecomputationPool, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, errors.New("could not create the precomputation directory: " + err.Error())
+		}
+	}
+	return &PrecomputationPool{
+		Size:      DefaultPrecomputationPoolSize,
+		IdleDelay: DefaultPrecomputationIdleDelay,
+		dir:       dir,
+		pools:     make(map[string]*precomputationEntries),
+		wake:      make(chan struct{}, 1),
+	}, nil
+}
+
+// Start starts refilling the pools in the background
+func (pp *PrecomputationPool) Start() {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+	if pp.stop != nil {
+		return
+	}
+	pp.stop = make(chan struct{})
+	pp.stopped.Add(1)
+	go pp.refillLoop(pp.stop)
+	pp.signal()
+}
+
+// Stop stops refilling the pools (and waits for the current refill)
+func (pp *PrecomputationPool) Stop() {
+	pp.mutex.Lock()
+	stop := pp.stop
+	pp.stop = nil
+	pp.mutex.Unlock()
+	if stop != nil {
+		close(stop)
+		pp.stopped.Wait()
+	}
+}
+
+// Prepare registers a pool for a collective key and a line size so that it gets filled in the background (the values
+// saved by a previous run are loaded)
+func (pp *PrecomputationPool) Prepare(collectiveKey kyber.Point, lineSize int) error {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+	if _, err := pp.get(collectiveKey, lineSize); err != nil {
+		return err
+	}
+	pp.signal()
+	return nil
+}
+
+// Available returns the number of values in the pool for a collective key and a line size
+func (pp *PrecomputationPool) Available(collectiveKey kyber.Point, lineSize int) (int, error) {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+	pe, err := pp.get(collectiveKey, lineSize)
+	if err != nil {
+		return 0, err
+	}
+	return len(pe.entries), nil
+}
+
+// Take removes n values from the pool for a collective key and a line size and returns them. If the pool does not have
+// enough values, the missing ones are computed on the spot.
+func (pp *PrecomputationPool) Take(collectiveKey kyber.Point, lineSize, n int) ([]CipherVectorScalar, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	pp.mutex.Lock()
+	pe, err := pp.get(collectiveKey, lineSize)
+	if err != nil {
+		pp.mutex.Unlock()
+		return nil, err
+	}
+	nbrTaken := n
+	if nbrTaken > len(pe.entries) {
+		nbrTaken = len(pe.entries)
+	}
+	taken := pe.entries[:nbrTaken]
+	remaining := append([]CipherVectorScalar{}, pe.entries[nbrTaken:]...)
+	// the values are only given out once the pool without them is saved
+	if err := pp.save(pe.collectiveKey, lineSize, remaining); err != nil {
+		pp.mutex.Unlock()
+		return nil, err
+	}
+	pe.entries = remaining
+	pp.lastUse = time.Now()
+	pp.signal()
+	pp.mutex.Unlock()
+
+	if nbrTaken < n {
+		log.Lvl2("precomputation pool: ", n-nbrTaken, " values computed on the spot")
+		taken = append(taken, CreatePrecomputedRandomize(libunlynx.SuiTe.Point().Base(), collectiveKey, libunlynx.SuiTe.RandomStream(), lineSize, n-nbrTaken)...)
+	}
+	return taken, nil
+}
+
+// refillLoop refills the pools until stop is closed
+func (pp *PrecomputationPool) refillLoop(stop chan struct{}) {
+	defer pp.stopped.Done()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-pp.wake:
+		}
+
+		for {
+			// waits until the pool is idle
+			pp.mutex.Lock()
+			wait := pp.IdleDelay - time.Since(pp.lastUse)
+			pp.mutex.Unlock()
+			if wait > 0 {
+				select {
+				case <-stop:
+					return
+				case <-time.After(wait):
+				}
+				continue
+			}
+
+			refilled, err := pp.refillChunk()
+			if err != nil {
+				log.Error("precomputation pool: ", err)
+			}
+			if !refilled || err != nil {
+				break
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// refillChunk adds a chunk of values to a pool which is not full and returns false if all the pools are full
+func (pp *PrecomputationPool) refillChunk() (bool, error) {
+	pp.mutex.Lock()
+	var pe *precomputationEntries
+	for _, candidate := range pp.pools {
+		if len(candidate.entries) < pp.Size {
+			pe = candidate
+			break
+		}
+	}
+	if pe == nil {
+		pp.mutex.Unlock()
+		return false, nil
+	}
+	nbr := pp.Size - len(pe.entries)
+	pp.mutex.Unlock()
+
+	if nbr > precomputationChunk {
+		nbr = precomputationChunk
+	}
+	chunk := CreatePrecomputedRandomize(libunlynx.SuiTe.Point().Base(), pe.collectiveKey, libunlynx.SuiTe.RandomStream(), pe.lineSize, nbr)
+
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+	entries := append(append([]CipherVectorScalar{}, pe.entries...), chunk...)
+	if err := pp.save(pe.collectiveKey, pe.lineSize, entries); err != nil {
+		return false, err
+	}
+	pe.entries = entries
+	return true, nil
+}
+
+// get returns the pool for a collective key and a line size (loaded from its file if needed), the mutex being locked
+func (pp *PrecomputationPool) get(collectiveKey kyber.Point, lineSize int) (*precomputationEntries, error) {
+	if lineSize <= 0 {
+		return nil, errors.New("the line size of precomputed values must be positive")
+	}
+	id, err := precomputationID(collectiveKey, lineSize)
+	if err != nil {
+		return nil, err
+	}
+	if pe, ok := pp.pools[id]; ok {
+		return pe, nil
+	}
+
+	pe := &precomputationEntries{collectiveKey: collectiveKey, lineSize: lineSize}
+	if pp.dir != "" {
+		file := precomputationFile{}
+		f, err := os.Open(pp.fileName(id))
+		if err == nil {
+			err = gob.NewDecoder(f).Decode(&file)
+			f.Close()
+			if err != nil {
+				return nil, errors.New("could not read the precomputation file: " + err.Error())
+			}
+			if file.LineSize != lineSize {
+				return nil, errors.New("precomputation file for line size " + strconv.Itoa(file.LineSize) + " instead of " + strconv.Itoa(lineSize))
+			}
+			if pe.entries, err = DecodeCipherVectorScalar(file.Entries); err != nil {
+				return nil, err
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, errors.New("could not open the precomputation file: " + err.Error())
+		}
+	}
+	pp.pools[id] = pe
+	return pe, nil
+}
+
+// save writes the values of a pool to its file (through a temporary file renamed over it)
+func (pp *PrecomputationPool) save(collectiveKey kyber.Point, lineSize int, entries []CipherVectorScalar) error {
+	if pp.dir == "" {
+		return nil
+	}
+	id, err := precomputationID(collectiveKey, lineSize)
+	if err != nil {
+		return err
+	}
+	keyBytes, err := collectiveKey.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	encoded, err := EncodeCipherVectorScalar(entries)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(pp.dir, id+".tmp")
+	if err != nil {
+		return errors.New("could not write the precomputation file: " + err.Error())
+	}
+	err = gob.NewEncoder(tmp).Encode(precomputationFile{CollectiveKey: keyBytes, LineSize: lineSize, Entries: encoded})
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), pp.fileName(id))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.New("could not write the precomputation file: " + err.Error())
+	}
+	return nil
+}
+
+// fileName returns the file of a pool
+func (pp *PrecomputationPool) fileName(id string) string {
+	return filepath.Join(pp.dir, id+".gob")
+}
+
+// signal wakes the refill up (without blocking)
+func (pp *PrecomputationPool) signal() {
+	select {
+	case pp.wake <- struct{}{}:
+	default:
+	}
+}
+
+// precomputationID identifies a pool by the hash of its collective key and line size
+func precomputationID(collectiveKey kyber.Point, lineSize int) (string, error) {
+	keyBytes, err := collectiveKey.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(keyBytes)
+	h.Write([]byte(strconv.Itoa(lineSize)))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,96 @@
+package libunlynxshuffle_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/shuffle"
+	"github.com/stretchr/testify/assert"
+	"go.dedis.ch/kyber/v3"
+)
+
+func TestPrecomputationPool(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+	dir := t.TempDir()
+
+	pool, err := libunlynxshuffle.NewPrecomputationPool(dir)
+	assert.NoError(t, err)
+	pool.Size = 15
+	pool.IdleDelay = 0
+
+	// values are computed on the spot when the pool is empty
+	taken, err := pool.Take(pubKey, 4, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(taken))
+	checkPrecomputed(t, taken, pubKey, 4)
+
+	// the pool is filled in the background
+	pool.Start()
+	assert.NoError(t, pool.Prepare(pubKey, 4))
+	waitPrecomputed(t, pool, pubKey, 4, 15)
+	pool.Stop()
+
+	taken, err = pool.Take(pubKey, 4, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(taken))
+	checkPrecomputed(t, taken, pubKey, 4)
+	available, err := pool.Available(pubKey, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, available)
+
+	// the pool is saved without the values taken
+	reopened, err := libunlynxshuffle.NewPrecomputationPool(dir)
+	assert.NoError(t, err)
+	rest, err := reopened.Take(pubKey, 4, 10)
+	assert.NoError(t, err)
+	available, err = reopened.Available(pubKey, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, available)
+	for _, r := range rest {
+		for _, tk := range taken {
+			assert.False(t, r.S[0].Equal(tk.S[0]), "a precomputed value is given out twice")
+		}
+	}
+
+	// the pools of other keys and line sizes are separate
+	_, otherKey := libunlynx.GenKey()
+	available, err = reopened.Available(otherKey, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, available)
+	_, err = reopened.Available(pubKey, 0)
+	assert.Error(t, err)
+
+	// a shuffle with precomputed values (not enough for all the responses) can be proven
+	responses := make([]libunlynx.CipherVector, 4)
+	for i := range responses {
+		responses[i] = *libunlynx.EncryptIntVector(pubKey, []int64{int64(i), 1})
+	}
+	shuffled, pi, beta := libunlynxshuffle.ShuffleSequence(responses, libunlynx.SuiTe.Point().Base(), pubKey, rest[:2])
+	psp, err := libunlynxshuffle.ShuffleProofCreation(responses, shuffled, libunlynx.SuiTe.Point().Base(), pubKey, beta, pi)
+	assert.NoError(t, err)
+	assert.True(t, libunlynxshuffle.ShuffleProofVerification(psp, pubKey))
+}
+
+// checkPrecomputed checks that the precomputed values are encryptions of 0 with their scalars
+func checkPrecomputed(t *testing.T, precomputed []libunlynxshuffle.CipherVectorScalar, h kyber.Point, lineSize int) {
+	for _, p := range precomputed {
+		assert.Equal(t, lineSize, len(p.S))
+		for i, s := range p.S {
+			assert.True(t, p.CipherV[i].K.Equal(libunlynx.SuiTe.Point().Mul(s, nil)))
+			assert.True(t, p.CipherV[i].C.Equal(libunlynx.SuiTe.Point().Mul(s, h)))
+		}
+	}
+}
+
+// waitPrecomputed waits until the pool has the given number of values
+func waitPrecomputed(t *testing.T, pool *libunlynxshuffle.PrecomputationPool, h kyber.Point, lineSize, expected int) {
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		available, err := pool.Available(h, lineSize)
+		assert.NoError(t, err)
+		if available >= expected {
+			return
+		}
+	}
+	t.Fatal("the precomputation pool was not filled in time")
+}
@@ -0,0 +1,207 @@
+package libunlynxshuffle
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"strconv"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/util/random"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// Sharded shuffle
+//______________________________________________________________________________________________________________________
+
+// A sharded shuffle splits the list to shuffle in shards which are shuffled in parallel, each by all the servers in a
+// different order (one ShuffleSequence per server and shard). As a response can not leave its shard during a round, the
+// shards are redistributed between the rounds with a cross-shard permutation of all the responses (see
+// RedistributeShards). This permutation is uniformly random, so that the whole shuffle is a uniformly random permutation
+// as soon as the shuffles of a round are, and derived from the shuffled responses, so that it can be recomputed by the
+// verifiers. The proofs of each shuffle compose to a proof of the whole shuffle (see ShardedShuffleProofVerification).
+
+// SplitShards splits a list in nbrShards contiguous shards whose sizes differ by at most one. As a single response can
+// not be shuffled, there are less shards if needed so that each shard contains at least two responses.
+func SplitShards(list []libunlynx.CipherVector, nbrShards int) [][]libunlynx.CipherVector {
+	nbrShards = NbrShards(len(list), nbrShards)
+
+	shards := make([][]libunlynx.CipherVector, nbrShards)
+	start := 0
+	for i := range shards {
+		size := len(list) / nbrShards
+		if i < len(list)%nbrShards {
+			size++
+		}
+		shards[i] = list[start : start+size]
+		start += size
+	}
+	return shards
+}
+
+// NbrShards returns the number of shards in which SplitShards splits a list of nbrResponses responses
+func NbrShards(nbrResponses, nbrShards int) int {
+	if nbrShards > nbrResponses/2 {
+		nbrShards = nbrResponses / 2
+	}
+	if nbrShards < 1 {
+		nbrShards = 1
+	}
+	return nbrShards
+}
+
+// MergeShards concatenates shards
+func MergeShards(shards [][]libunlynx.CipherVector) []libunlynx.CipherVector {
+	list := make([]libunlynx.CipherVector, 0)
+	for _, shard := range shards {
+		list = append(list, shard...)
+	}
+	return list
+}
+
+// RedistributeShards is the cross-shard permutation applied between two rounds of a sharded shuffle: the responses of
+// all the shards are permuted with the permutation derived from their digest (see PermuteShards). As the responses are
+// rerandomized by each shuffle, the permutation can neither be predicted before the end of the round nor chosen by the
+// root, which only redistributes the shards.
+func RedistributeShards(shards [][]libunlynx.CipherVector) ([][]libunlynx.CipherVector, error) {
+	seed, err := shardKey(MergeShards(shards))
+	if err != nil {
+		return nil, err
+	}
+	return PermuteShards(shards, []byte(seed)), nil
+}
+
+// PermuteShards permutes the responses of all the shards with the uniformly random permutation derived from seed and
+// splits them again in shards of the same sizes
+func PermuteShards(shards [][]libunlynx.CipherVector, seed []byte) [][]libunlynx.CipherVector {
+	list := MergeShards(shards)
+	pi := seededPermutation(seed, len(list))
+	permuted := make([]libunlynx.CipherVector, len(list))
+	for i := range list {
+		permuted[i] = list[pi[i]]
+	}
+	return SplitShards(permuted, len(shards))
+}
+
+// seededPermutation returns the permutation of k elements picked (Fisher-Yates) with the random stream derived from seed
+func seededPermutation(seed []byte, k int) []int {
+	stream := libunlynx.SuiTe.XOF(seed)
+	pi := make([]int, k)
+	for i := range pi {
+		pi[i] = i
+	}
+	for i := k - 1; i > 0; i-- {
+		// random.Int picks a non-zero integer: j is uniform in [0, i]
+		j := int(random.Int(big.NewInt(int64(i+2)), stream).Int64()) - 1
+		pi[i], pi[j] = pi[j], pi[i]
+	}
+	return pi
+}
+
+// ShardedShuffle is a sharded shuffle (NbrShards shards, NbrRounds rounds) of Original to Shuffled
+type ShardedShuffle struct {
+	Original  []libunlynx.CipherVector
+	Shuffled  []libunlynx.CipherVector
+	NbrShards int
+	NbrRounds int
+}
+
+// ShardedShuffleProofVerification verifies that shuffled is a sharded shuffle (nbrShards shards, nbrRounds rounds, each
+// shard being shuffled nbrSteps times per round) of original, given the proofs of all the shuffles (in any order). Each
+// proof has to be valid and the proofs have to chain: the input of a shuffle is the output of the previous one.
+func ShardedShuffleProofVerification(original, shuffled []libunlynx.CipherVector, proofs []PublishedShufflingProof, nbrShards, nbrRounds, nbrSteps int, seed kyber.Point) bool {
+	return ShardedShufflesProofVerification([]ShardedShuffle{{Original: original, Shuffled: shuffled, NbrShards: nbrShards, NbrRounds: nbrRounds}}, proofs, nbrSteps, seed)
+}
+
+// ShardedShufflesProofVerification verifies several sharded shuffles (see ShardedShuffleProofVerification) given the
+// proofs of all their shuffles (in any order): each proof has to be used once.
+func ShardedShufflesProofVerification(shuffles []ShardedShuffle, proofs []PublishedShufflingProof, nbrSteps int, seed kyber.Point) bool {
+	// proofs indexed by their input
+	byInput := make(map[string][]PublishedShufflingProof)
+	for _, psp := range proofs {
+		key, err := shardKey(psp.OriginalList)
+		if err != nil {
+			log.Error(err)
+			return false
+		}
+		byInput[key] = append(byInput[key], psp)
+	}
+
+	used := 0
+	for _, ss := range shuffles {
+		nbrUsed, ok := verifyShardedShuffle(ss, byInput, nbrSteps, seed)
+		if !ok {
+			return false
+		}
+		used += nbrUsed
+	}
+
+	if used != len(proofs) {
+		log.Lvl1("there are " + strconv.Itoa(len(proofs)-used) + " unused shuffle proofs")
+		return false
+	}
+	return true
+}
+
+// verifyShardedShuffle verifies a sharded shuffle with the proofs indexed by their input and returns the number of
+// proofs it used (which are removed from byInput)
+func verifyShardedShuffle(ss ShardedShuffle, byInput map[string][]PublishedShufflingProof, nbrSteps int, seed kyber.Point) (int, bool) {
+	shards := SplitShards(ss.Original, ss.NbrShards)
+	used := 0
+	for round := 0; round < ss.NbrRounds; round++ {
+		if round > 0 {
+			var err error
+			if shards, err = RedistributeShards(shards); err != nil {
+				log.Error(err)
+				return used, false
+			}
+		}
+		for s := range shards {
+			for step := 0; step < nbrSteps; step++ {
+				key, err := shardKey(shards[s])
+				if err != nil {
+					log.Error(err)
+					return used, false
+				}
+				candidates := byInput[key]
+				if len(candidates) == 0 {
+					log.Lvl1("no shuffle proof for shard " + strconv.Itoa(s) + " at round " + strconv.Itoa(round) + ", step " + strconv.Itoa(step))
+					return used, false
+				}
+				psp := candidates[0]
+				byInput[key] = candidates[1:]
+				used++
+
+				if !ShuffleProofVerification(psp, seed) {
+					return used, false
+				}
+				shards[s] = psp.ShuffledList
+			}
+		}
+	}
+
+	expected, err := shardKey(MergeShards(shards))
+	if err != nil {
+		log.Error(err)
+		return used, false
+	}
+	result, err := shardKey(ss.Shuffled)
+	if err != nil {
+		log.Error(err)
+		return used, false
+	}
+	return used, expected == result
+}
+
+// shardKey identifies a list of responses by the hash of its bytes
+func shardKey(list []libunlynx.CipherVector) (string, error) {
+	data, lengths, err := libunlynx.ArrayCipherVectorToBytes(list)
+	if err != nil {
+		return "", errors.New("could not convert a shard to bytes: " + err.Error())
+	}
+	h := sha256.New()
+	h.Write(lengths)
+	h.Write(data)
+	return string(h.Sum(nil)), nil
+}
@@ -0,0 +1,83 @@
+package libunlynxshuffle_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/shuffle"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShards(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+	list := make([]libunlynx.CipherVector, 7)
+	for i := range list {
+		list[i] = *libunlynx.EncryptIntVector(pubKey, []int64{int64(i)})
+	}
+
+	shards := libunlynxshuffle.SplitShards(list, 3)
+	assert.Equal(t, 3, len(shards))
+	assert.Equal(t, []int{3, 2, 2}, []int{len(shards[0]), len(shards[1]), len(shards[2])})
+	assert.Equal(t, list, libunlynxshuffle.MergeShards(shards))
+
+	// at least two responses per shard
+	assert.Equal(t, 3, len(libunlynxshuffle.SplitShards(list, 10)))
+	assert.Equal(t, 1, len(libunlynxshuffle.SplitShards(list[:3], 2)))
+	assert.Equal(t, 1, len(libunlynxshuffle.SplitShards(list, 0)))
+
+	// the responses are permuted across the shards, which keep their sizes
+	redistributed, err := libunlynxshuffle.RedistributeShards(shards)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3, 2, 2}, []int{len(redistributed[0]), len(redistributed[1]), len(redistributed[2])})
+	assert.ElementsMatch(t, list, libunlynxshuffle.MergeShards(redistributed))
+	again, err := libunlynxshuffle.RedistributeShards(shards)
+	assert.NoError(t, err)
+	assert.Equal(t, redistributed, again)
+	assert.Equal(t, libunlynxshuffle.PermuteShards(shards, []byte("seed")), libunlynxshuffle.PermuteShards(shards, []byte("seed")))
+}
+
+// The sharded shuffle of 4 responses in 2 shards (2 rounds) is a uniformly random permutation: all the 24 permutations
+// are as likely (with uniformly random shuffles of the shards and seeds of the cross-shard permutation)
+func TestShardedShuffleDistribution(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+	list := make([]libunlynx.CipherVector, 4)
+	positions := make(map[string]int)
+	for i := range list {
+		list[i] = *libunlynx.EncryptIntVector(pubKey, []int64{int64(i)})
+		positions[list[i][0].K.String()] = i
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	nbrTrials := 24000
+	counts := make(map[[4]int]int)
+	for trial := 0; trial < nbrTrials; trial++ {
+		shards := libunlynxshuffle.SplitShards(list, 2)
+		for round := 0; round < 2; round++ {
+			if round > 0 {
+				seed := make([]byte, 32)
+				rnd.Read(seed)
+				shards = libunlynxshuffle.PermuteShards(shards, seed)
+			}
+			for s, shard := range shards {
+				shuffled := make([]libunlynx.CipherVector, len(shard))
+				for i, j := range rnd.Perm(len(shard)) {
+					shuffled[i] = shard[j]
+				}
+				shards[s] = shuffled
+			}
+		}
+
+		permutation := [4]int{}
+		for i, cv := range libunlynxshuffle.MergeShards(shards) {
+			permutation[i] = positions[cv[0].K.String()]
+		}
+		counts[permutation]++
+	}
+
+	// 1000 expected occurrences of each permutation (standard deviation ~31)
+	assert.Equal(t, 24, len(counts))
+	for permutation, count := range counts {
+		assert.True(t, count > 850 && count < 1150, "%v: %d", permutation, count)
+	}
+}
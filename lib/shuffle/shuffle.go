@@ -2,42 +2,39 @@ package libunlynxshuffle
 
 import (
 	"crypto/cipher"
-	"math/big"
+	"errors"
 	"os"
 	"sync"
 
 	"github.com/ldsec/unlynx/lib"
 	"github.com/ldsec/unlynx/lib/tools"
 	"go.dedis.ch/kyber/v3"
-	"go.dedis.ch/kyber/v3/util/random"
 	"go.dedis.ch/onet/v3/log"
 )
 
 // ShuffleSequence applies shuffling to a ciphervector
 func ShuffleSequence(inputList []libunlynx.CipherVector, g, h kyber.Point, precomputed []CipherVectorScalar) ([]libunlynx.CipherVector, []int, [][]kyber.Scalar) {
-	maxUint := ^uint(0)
-	maxInt := int(maxUint >> 1)
+	return shuffleSequence(inputList, g, repeatKey(h, len(inputList[0])), precomputed)
+}
+
+// ShuffleSequenceKeys applies shuffling to a ciphervector whose ciphertexts are not all encrypted under the same key:
+// the ciphertexts at position j are rerandomized with keys[j] (e.g. when a part of the cipher vectors is already
+// partially decrypted). No precomputed values can be used as they are computed for one key.
+func ShuffleSequenceKeys(inputList []libunlynx.CipherVector, g kyber.Point, keys []kyber.Point) ([]libunlynx.CipherVector, []int, [][]kyber.Scalar, error) {
+	if len(keys) != len(inputList[0]) {
+		return nil, nil, nil, errors.New("there must be one key per ciphertext of the cipher vectors")
+	}
+	outputList, pi, beta := shuffleSequence(inputList, g, keys, nil)
+	return outputList, pi, beta, nil
+}
 
+// shuffleSequence shuffles and rerandomizes the cipher vectors, the ciphertexts at position j with keys[j]
+func shuffleSequence(inputList []libunlynx.CipherVector, g kyber.Point, keys []kyber.Point, precomputed []CipherVectorScalar) ([]libunlynx.CipherVector, []int, [][]kyber.Scalar) {
 	// number of elgamal pairs
 	NQ := len(inputList[0])
 	k := len(inputList) // number of clients
 
-	rand := libunlynx.SuiTe.RandomStream()
-	// Pick a fresh (or precomputed) ElGamal blinding factor for each pair
-	beta := make([][]kyber.Scalar, k)
-	precomputedPoints := make([]libunlynx.CipherVector, k)
-	for i := 0; i < k; i++ {
-		if precomputed == nil {
-			beta[i] = libunlynx.RandomScalarSlice(NQ)
-		} else {
-			randInt := random.Int(big.NewInt(int64(maxInt)), rand)
-
-			indice := int(randInt.Int64() % int64(len(precomputed)))
-			beta[i] = precomputed[indice].S[0:NQ] //if beta file is bigger than query line responses
-			precomputedPoints[i] = precomputed[indice].CipherV[0:NQ]
-		}
-
-	}
+	beta, precomputedPoints := pickBlindingFactors(k, NQ, precomputed)
 
 	// Pick a random permutation
 	pi := libunlynx.RandomPermutation(k)
@@ -48,7 +45,7 @@ func ShuffleSequence(inputList []libunlynx.CipherVector, g, h kyber.Point, preco
 	for i := 0; i < k; i++ {
 		go func(outputList []libunlynx.CipherVector, i int) {
 			defer wg.Done()
-			shuffle(pi, i, inputList, outputList, NQ, beta, precomputedPoints, g, h)
+			shuffle(pi, i, inputList, outputList, NQ, beta, precomputedPoints, g, keys)
 		}(outputList, i)
 	}
 	libunlynx.EndParallelize(wg)
@@ -56,22 +53,48 @@ func ShuffleSequence(inputList []libunlynx.CipherVector, g, h kyber.Point, preco
 	return outputList, pi, beta
 }
 
+// repeatKey returns the keys of cipher vectors of size NQ all encrypted under h
+func repeatKey(h kyber.Point, NQ int) []kyber.Point {
+	keys := make([]kyber.Point, NQ)
+	for j := range keys {
+		keys[j] = h
+	}
+	return keys
+}
+
+// pickBlindingFactors picks an ElGamal blinding factor for each pair of k cipher vectors of size NQ. The precomputed
+// values are used once each, in order (e.g. taken from a PrecomputationPool): the cipher vectors without a precomputed
+// value (or with a too small one) get fresh blinding factors.
+func pickBlindingFactors(k, NQ int, precomputed []CipherVectorScalar) ([][]kyber.Scalar, []libunlynx.CipherVector) {
+	beta := make([][]kyber.Scalar, k)
+	precomputedPoints := make([]libunlynx.CipherVector, k)
+	for i := 0; i < k; i++ {
+		if i < len(precomputed) && len(precomputed[i].S) >= NQ && len(precomputed[i].CipherV) >= NQ {
+			beta[i] = precomputed[i].S[0:NQ] //if beta file is bigger than query line responses
+			precomputedPoints[i] = precomputed[i].CipherV[0:NQ]
+		} else {
+			beta[i] = libunlynx.RandomScalarSlice(NQ)
+		}
+	}
+	return beta, precomputedPoints
+}
+
 // shuffle applies shuffling and rerandomization
-func shuffle(pi []int, i int, inputList, outputList []libunlynx.CipherVector, NQ int, beta [][]kyber.Scalar, precomputedPoints []libunlynx.CipherVector, g, h kyber.Point) {
+func shuffle(pi []int, i int, inputList, outputList []libunlynx.CipherVector, NQ int, beta [][]kyber.Scalar, precomputedPoints []libunlynx.CipherVector, g kyber.Point, keys []kyber.Point) {
 	index := pi[i]
 	outputList[i] = *libunlynx.NewCipherVector(NQ)
 	wg := libunlynx.StartParallelize(NQ)
 	for j := 0; j < NQ; j++ {
 		var b kyber.Scalar
 		var tmpCipher libunlynx.CipherText
-		if len(precomputedPoints[0]) == 0 {
+		if len(precomputedPoints[index]) == 0 {
 			b = beta[index][j]
 		} else {
 			tmpCipher = precomputedPoints[index][j]
 		}
 		go func(j int) {
 			defer wg.Done()
-			outputList[i][j] = rerandomize(inputList[index], b, b, tmpCipher, g, h, j)
+			outputList[i][j] = rerandomize(inputList[index], b, b, tmpCipher, g, keys[j], j)
 		}(j)
 	}
 	libunlynx.EndParallelize(wg)
@@ -128,6 +151,9 @@ func CreatePrecomputedRandomize(g, h kyber.Point, rand cipher.Stream, lineSize,
 }
 
 // PrecomputeForShuffling precomputes data to be used in the shuffling protocol (to make it faster) and saves it in a .gob file
+//
+// Deprecated: the values are derived from the survey secret and shared by all the surveys using the file, use a
+// PrecomputationPool instead.
 func PrecomputeForShuffling(serverName, gobFile string, surveySecret kyber.Scalar, collectiveKey kyber.Point, lineSize int) ([]CipherVectorScalar, error) {
 	log.Lvl1(serverName, " precomputes for shuffling")
 	scalarBytes, err := surveySecret.MarshalBinary()
@@ -150,6 +176,8 @@ func PrecomputeForShuffling(serverName, gobFile string, surveySecret kyber.Scala
 }
 
 // PrecomputationWritingForShuffling reads the precomputation data from  .gob file if it already exists or generates a new one
+//
+// Deprecated: use a PrecomputationPool instead.
 func PrecomputationWritingForShuffling(appFlag bool, gobFile, serverName string, surveySecret kyber.Scalar, collectiveKey kyber.Point, lineSize int) ([]CipherVectorScalar, error) {
 	log.Lvl1(serverName, " precomputes for shuffling")
 	var precomputeShuffle []CipherVectorScalar
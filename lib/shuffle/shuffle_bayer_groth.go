@@ -0,0 +1,1239 @@
+package libunlynxshuffle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// Bayer-Groth shuffle argument
+//______________________________________________________________________________________________________________________
+
+// The Bayer-Groth argument (S. Bayer and J. Groth, "Efficient Zero-Knowledge Argument for Correctness of a Shuffle",
+// EUROCRYPT 2012) proves a shuffle of N ElGamal ciphertexts with O(sqrt(N)) group elements and scalars, instead of O(N)
+// for the Neff argument. The ciphertexts are arranged in a matrix of m rows of n ciphertexts (N = mn) and the argument is
+// made of a product argument (the committed values are a permutation) and a multi-exponentiation argument (the shuffled
+// ciphertexts are the rerandomized original ones in this order). It is made non-interactive with Fiat-Shamir.
+//
+// As with the Neff argument, each cipher vector is first compressed into one ciphertext with a random linear
+// combination, and the list is padded with encryptions of 0 (identity points, which are not moved by the shuffle) to get
+// a matrix. When the ciphertexts of the cipher vectors are encrypted under different keys, they are compressed per key
+// and there is one multi-exponentiation argument per key, all for the same committed permutation.
+
+// BayerGrothShuffleProofCreation creates a shuffle proof with the Bayer-Groth argument. It has the same parameters as
+// ShuffleProofCreation: shuffledList[i] is originalList[pi[i]] rerandomized with the blinding factors beta[pi[i]].
+func BayerGrothShuffleProofCreation(originalList, shuffledList []libunlynx.CipherVector, g, h kyber.Point, beta [][]kyber.Scalar, pi []int) (PublishedShufflingProof, error) {
+	return BayerGrothShuffleProofCreationKeys(originalList, shuffledList, g, h, nil, beta, pi)
+}
+
+// BayerGrothShuffleProofCreationKeys creates a Bayer-Groth shuffle proof of cipher vectors whose ciphertexts are not all
+// encrypted under h: the ciphertexts at position j are encrypted (and rerandomized, see ShuffleSequenceKeys) under
+// keys[j]. They are all encrypted under h if keys is empty.
+func BayerGrothShuffleProofCreationKeys(originalList, shuffledList []libunlynx.CipherVector, g, h kyber.Point, keys []kyber.Point, beta [][]kyber.Scalar, pi []int) (PublishedShufflingProof, error) {
+	if len(originalList) < 2 || len(originalList) != len(shuffledList) || len(pi) != len(originalList) || len(beta) != len(originalList) {
+		return PublishedShufflingProof{}, errors.New("a shuffle proof needs at least two cipher vectors, a permutation and blinding factors for each of them")
+	}
+	if len(keys) != 0 && len(keys) != len(originalList[0]) {
+		return PublishedShufflingProof{}, errors.New("there must be one key per ciphertext of the cipher vectors")
+	}
+
+	tr, e, err := bgStatementTranscript(originalList, shuffledList, g, h, keys)
+	if err != nil {
+		return PublishedShufflingProof{}, err
+	}
+
+	m, n := bgDimensions(len(originalList))
+	groupKeys, groupE := bgKeyGroups(h, keys, e)
+	C := make([][]libunlynx.CipherText, len(groupKeys))
+	Cshuffled := make([][]libunlynx.CipherText, len(groupKeys))
+	rho := make([][]kyber.Scalar, len(groupKeys))
+	for k := range groupKeys {
+		C[k], Cshuffled[k], err = bgCompressLists(originalList, shuffledList, groupE[k])
+		if err != nil {
+			return PublishedShufflingProof{}, err
+		}
+		betaCompressed := compressBeta(beta, groupE[k])
+		rho[k] = make([]kyber.Scalar, m*n)
+		for i := range rho[k] {
+			if i < len(pi) {
+				rho[k][i] = betaCompressed[pi[i]]
+			} else {
+				rho[k][i] = libunlynx.SuiTe.Scalar().Zero()
+			}
+		}
+	}
+
+	permutation := make([]int, m*n)
+	for i := range permutation {
+		if i < len(pi) {
+			permutation[i] = pi[i]
+		} else {
+			// the padding is not moved
+			permutation[i] = i
+		}
+	}
+
+	ck := newBGCommitmentKey(n)
+	prf, err := bgShuffleArgumentProve(ck, tr, g, groupKeys, C, Cshuffled, permutation, rho, m, n)
+	if err != nil {
+		return PublishedShufflingProof{}, err
+	}
+
+	hashProof, err := prf.toBytes()
+	if err != nil {
+		return PublishedShufflingProof{}, err
+	}
+	return PublishedShufflingProof{OriginalList: originalList, ShuffledList: shuffledList, G: g, H: h, Keys: keys, HashProof: hashProof, Backend: BayerGrothShuffleProof}, nil
+}
+
+// bayerGrothShuffleProofVerification verifies a shuffle proof created with the Bayer-Groth argument for the key h. The
+// keys of the positions (if any) are the ones of the proof, which the caller checks (see ShuffleProofKeys).
+func bayerGrothShuffleProofVerification(psp PublishedShufflingProof, h kyber.Point) bool {
+	if len(psp.OriginalList) < 2 || len(psp.OriginalList) != len(psp.ShuffledList) || psp.G == nil || psp.H == nil {
+		log.Lvl1("-----------verify failed (Bayer-Groth: malformed statement)")
+		return false
+	}
+	if !psp.H.Equal(h) {
+		log.Lvl1("-----------verify failed (Bayer-Groth: the proof was created for another key)")
+		return false
+	}
+	if len(psp.Keys) != 0 && len(psp.Keys) != len(psp.OriginalList[0]) {
+		log.Lvl1("-----------verify failed (Bayer-Groth: wrong number of keys)")
+		return false
+	}
+
+	tr, e, err := bgStatementTranscript(psp.OriginalList, psp.ShuffledList, psp.G, psp.H, psp.Keys)
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	groupKeys, groupE := bgKeyGroups(psp.H, psp.Keys, e)
+
+	m, n := bgDimensions(len(psp.OriginalList))
+	prf := bgShuffleArgument{}
+	if err := prf.fromBytes(psp.HashProof, m, n, len(groupKeys)); err != nil {
+		log.Error(err)
+		log.Lvl1("-----------verify failed (Bayer-Groth: malformed proof)")
+		return false
+	}
+
+	C := make([][]libunlynx.CipherText, len(groupKeys))
+	Cshuffled := make([][]libunlynx.CipherText, len(groupKeys))
+	for k := range groupKeys {
+		C[k], Cshuffled[k], err = bgCompressLists(psp.OriginalList, psp.ShuffledList, groupE[k])
+		if err != nil {
+			log.Error(err)
+			log.Lvl1("-----------verify failed (Bayer-Groth: compression)")
+			return false
+		}
+	}
+
+	ck := newBGCommitmentKey(n)
+	if err := bgShuffleArgumentVerify(ck, tr, psp.G, groupKeys, C, Cshuffled, prf, m, n); err != nil {
+		log.Lvl1("-----------verify failed (Bayer-Groth: " + err.Error() + ")")
+		return false
+	}
+	return true
+}
+
+// bgDimensions returns the number of rows m and columns n of the matrix of ciphertexts for a list of size N (N <= mn)
+func bgDimensions(N int) (int, int) {
+	n := int(math.Ceil(math.Sqrt(float64(N))))
+	if n < 2 {
+		n = 2
+	}
+	return (N + n - 1) / n, n
+}
+
+// bgStatementTranscript starts the transcript of the argument with its statement and derives the scalars used to
+// compress the cipher vectors
+func bgStatementTranscript(originalList, shuffledList []libunlynx.CipherVector, g, h kyber.Point, keys []kyber.Point) (*bgTranscript, []kyber.Scalar, error) {
+	tr := newBGTranscript("UnLynx Bayer-Groth shuffle")
+	tr.appendPoints(g, h)
+	if len(keys) != 0 {
+		tr.appendPoints(keys...)
+	}
+	for _, list := range [][]libunlynx.CipherVector{originalList, shuffledList} {
+		for _, cv := range list {
+			if len(cv) != len(originalList[0]) {
+				return nil, nil, errors.New("cipher vectors of different sizes")
+			}
+			tr.appendCipherTexts(cv...)
+		}
+	}
+
+	e := make([]kyber.Scalar, len(originalList[0]))
+	for i := range e {
+		e[i] = tr.challenge("compression")
+	}
+	if tr.err != nil {
+		return nil, nil, tr.err
+	}
+	return tr, e, nil
+}
+
+// bgKeyGroups groups the positions of the cipher vectors by key (in the order of their first position): for each key, it
+// returns the compression scalars of its positions, the others being 0
+func bgKeyGroups(h kyber.Point, keys []kyber.Point, e []kyber.Scalar) ([]kyber.Point, [][]kyber.Scalar) {
+	if len(keys) == 0 {
+		return []kyber.Point{h}, [][]kyber.Scalar{e}
+	}
+
+	var groupKeys []kyber.Point
+	var groupE [][]kyber.Scalar
+	for j, key := range keys {
+		k := 0
+		for k < len(groupKeys) && !groupKeys[k].Equal(key) {
+			k++
+		}
+		if k == len(groupKeys) {
+			groupKeys = append(groupKeys, key)
+			zeros := make([]kyber.Scalar, len(e))
+			for l := range zeros {
+				zeros[l] = libunlynx.SuiTe.Scalar().Zero()
+			}
+			groupE = append(groupE, zeros)
+		}
+		groupE[k][j] = e[j]
+	}
+	return groupKeys, groupE
+}
+
+// bgCompressLists compresses each cipher vector of the lists into one ciphertext and pads them to a matrix
+func bgCompressLists(originalList, shuffledList []libunlynx.CipherVector, e []kyber.Scalar) ([]libunlynx.CipherText, []libunlynx.CipherText, error) {
+	m, n := bgDimensions(len(originalList))
+	compressed := make([][]libunlynx.CipherText, 2)
+	for l, list := range [][]libunlynx.CipherVector{originalList, shuffledList} {
+		xK, xC, err := compressListCipherVector(list, e)
+		if err != nil {
+			return nil, nil, err
+		}
+		compressed[l] = make([]libunlynx.CipherText, m*n)
+		for i := range compressed[l] {
+			if i < len(list) {
+				compressed[l][i] = libunlynx.CipherText{K: xK[i], C: xC[i]}
+			} else {
+				compressed[l][i] = libunlynx.CipherText{K: libunlynx.SuiTe.Point().Null(), C: libunlynx.SuiTe.Point().Null()}
+			}
+		}
+	}
+	return compressed[0], compressed[1], nil
+}
+
+// Structs
+//______________________________________________________________________________________________________________________
+
+// bgShuffleArgument is a Bayer-Groth shuffle argument: the commitments to the permutation (CA) and to the powers of the
+// challenge in this order (CB), the product and the multi-exponentiation arguments (one per key)
+type bgShuffleArgument struct {
+	CA       []kyber.Point
+	CB       []kyber.Point
+	Product  bgProductArgument
+	MultiExp []bgMultiExpArgument
+}
+
+// bgProductArgument proves that the product of the values committed in a matrix is a given scalar. With more than one
+// column, it commits to the products of the rows (Cb) and proves it with a Hadamard argument.
+type bgProductArgument struct {
+	Cb          kyber.Point
+	Hadamard    *bgHadamardArgument
+	SingleValue bgSingleValueProductArgument
+}
+
+// bgHadamardArgument proves that a committed vector is the entry-wise product of the columns of a committed matrix
+type bgHadamardArgument struct {
+	CB   []kyber.Point
+	Zero bgZeroArgument
+}
+
+// bgZeroArgument proves that the sum of the bilinear maps of the columns of two committed matrices is 0
+type bgZeroArgument struct {
+	CA0  kyber.Point
+	CBm1 kyber.Point
+	CD   []kyber.Point
+	A    []kyber.Scalar
+	B    []kyber.Scalar
+	R    kyber.Scalar
+	S    kyber.Scalar
+	T    kyber.Scalar
+}
+
+// bgSingleValueProductArgument proves that the product of the values of a committed vector is a given scalar
+type bgSingleValueProductArgument struct {
+	Cd          kyber.Point
+	CLowerDelta kyber.Point
+	CUpperDelta kyber.Point
+	ATilde      []kyber.Scalar
+	BTilde      []kyber.Scalar
+	RTilde      kyber.Scalar
+	STilde      kyber.Scalar
+}
+
+// bgMultiExpArgument proves that a ciphertext is the product of rows of ciphertexts raised to committed exponents,
+// rerandomized
+type bgMultiExpArgument struct {
+	CA0 kyber.Point
+	CB  []kyber.Point
+	E   []libunlynx.CipherText
+	A   []kyber.Scalar
+	R   kyber.Scalar
+	B   kyber.Scalar
+	S   kyber.Scalar
+	Tau kyber.Scalar
+}
+
+// Shuffle argument
+//______________________________________________________________________________________________________________________
+
+// bgShuffleArgumentProve proves that Cshuffled[k][i] = C[k][permutation[i]] + Enc(0; rho[k][i]) with the key keys[k]
+// (C[k] has m*n ciphertexts)
+func bgShuffleArgumentProve(ck bgCommitmentKey, tr *bgTranscript, g kyber.Point, keys []kyber.Point, C, Cshuffled [][]libunlynx.CipherText, permutation []int, rho [][]kyber.Scalar, m, n int) (bgShuffleArgument, error) {
+	prf := bgShuffleArgument{}
+
+	// commitment to the permutation
+	a := make([]kyber.Scalar, m*n)
+	for i, p := range permutation {
+		a[i] = libunlynx.SuiTe.Scalar().SetInt64(int64(p))
+	}
+	A := bgMatrix(a, m, n)
+	r := libunlynx.RandomScalarSlice(m)
+	prf.CA = ck.commitMatrix(A, r)
+	tr.appendPoints(prf.CA...)
+	x := tr.challenge("shuffle x")
+
+	// commitment to the powers of x in the order of the permutation
+	xPowers := bgPowers(x, m*n)
+	b := make([]kyber.Scalar, m*n)
+	for i, p := range permutation {
+		b[i] = xPowers[p]
+	}
+	B := bgMatrix(b, m, n)
+	s := libunlynx.RandomScalarSlice(m)
+	prf.CB = ck.commitMatrix(B, s)
+	tr.appendPoints(prf.CB...)
+	y := tr.challenge("shuffle y")
+	z := tr.challenge("shuffle z")
+	if tr.err != nil {
+		return bgShuffleArgument{}, tr.err
+	}
+
+	// prod (y a_i + b_i - z) = prod (y i + x^i - z) as a is a permutation of (0, ..., N-1)
+	cDminusZ, bProd := bgProductStatement(ck, prf.CA, prf.CB, xPowers, y, z, m, n)
+	D := make([][]kyber.Scalar, m)
+	t := make([]kyber.Scalar, m)
+	for j := range D {
+		D[j] = make([]kyber.Scalar, n)
+		for l := range D[j] {
+			D[j][l] = libunlynx.SuiTe.Scalar().Sub(libunlynx.SuiTe.Scalar().Add(libunlynx.SuiTe.Scalar().Mul(y, A[j][l]), B[j][l]), z)
+		}
+		t[j] = libunlynx.SuiTe.Scalar().Add(libunlynx.SuiTe.Scalar().Mul(y, r[j]), s[j])
+	}
+	var err error
+	prf.Product, err = bgProductArgumentProve(ck, tr, cDminusZ, bProd, D, t)
+	if err != nil {
+		return bgShuffleArgument{}, err
+	}
+
+	// sum x^i C_i = Enc(0; rho') + sum b_i Cshuffled_i (for each key)
+	prf.MultiExp = make([]bgMultiExpArgument, len(keys))
+	for k, h := range keys {
+		rhoPrime := libunlynx.SuiTe.Scalar().Zero()
+		for i := range rho[k] {
+			rhoPrime = libunlynx.SuiTe.Scalar().Sub(rhoPrime, libunlynx.SuiTe.Scalar().Mul(rho[k][i], b[i]))
+		}
+		Cx := bgInnerProduct(C[k], xPowers)
+		prf.MultiExp[k], err = bgMultiExpArgumentProve(ck, tr, g, h, bgRows(Cshuffled[k], m, n), Cx, prf.CB, B, s, rhoPrime)
+		if err != nil {
+			return bgShuffleArgument{}, err
+		}
+	}
+	return prf, nil
+}
+
+// bgShuffleArgumentVerify verifies a shuffle argument
+func bgShuffleArgumentVerify(ck bgCommitmentKey, tr *bgTranscript, g kyber.Point, keys []kyber.Point, C, Cshuffled [][]libunlynx.CipherText, prf bgShuffleArgument, m, n int) error {
+	tr.appendPoints(prf.CA...)
+	x := tr.challenge("shuffle x")
+	tr.appendPoints(prf.CB...)
+	y := tr.challenge("shuffle y")
+	z := tr.challenge("shuffle z")
+	if tr.err != nil {
+		return tr.err
+	}
+
+	xPowers := bgPowers(x, m*n)
+	cDminusZ, bProd := bgProductStatement(ck, prf.CA, prf.CB, xPowers, y, z, m, n)
+	if err := bgProductArgumentVerify(ck, tr, cDminusZ, bProd, prf.Product, m, n); err != nil {
+		return err
+	}
+
+	if len(prf.MultiExp) != len(keys) {
+		return errors.New("one multi-exponentiation argument per key is needed")
+	}
+	for k, h := range keys {
+		Cx := bgInnerProduct(C[k], xPowers)
+		if err := bgMultiExpArgumentVerify(ck, tr, g, h, bgRows(Cshuffled[k], m, n), Cx, prf.CB, prf.MultiExp[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bgProductStatement returns the commitments to y a + b - z and prod (y i + x^i - z)
+func bgProductStatement(ck bgCommitmentKey, CA, CB []kyber.Point, xPowers []kyber.Scalar, y, z kyber.Scalar, m, n int) ([]kyber.Point, kyber.Scalar) {
+	minusZ := make([]kyber.Scalar, n)
+	for l := range minusZ {
+		minusZ[l] = libunlynx.SuiTe.Scalar().Neg(z)
+	}
+	cMinusZ := ck.commit(minusZ, libunlynx.SuiTe.Scalar().Zero())
+
+	cDminusZ := make([]kyber.Point, m)
+	for j := range cDminusZ {
+		cDminusZ[j] = libunlynx.SuiTe.Point().Add(libunlynx.SuiTe.Point().Add(libunlynx.SuiTe.Point().Mul(y, CA[j]), CB[j]), cMinusZ)
+	}
+
+	bProd := libunlynx.SuiTe.Scalar().One()
+	for i := 0; i < m*n; i++ {
+		factor := libunlynx.SuiTe.Scalar().Mul(y, libunlynx.SuiTe.Scalar().SetInt64(int64(i)))
+		factor = libunlynx.SuiTe.Scalar().Sub(libunlynx.SuiTe.Scalar().Add(factor, xPowers[i]), z)
+		bProd = libunlynx.SuiTe.Scalar().Mul(bProd, factor)
+	}
+	return cDminusZ, bProd
+}
+
+// Product argument
+//______________________________________________________________________________________________________________________
+
+// bgProductArgumentProve proves that the product of all the values of the matrix A (committed in cA with r) is b
+func bgProductArgumentProve(ck bgCommitmentKey, tr *bgTranscript, cA []kyber.Point, b kyber.Scalar, A [][]kyber.Scalar, r []kyber.Scalar) (bgProductArgument, error) {
+	prf := bgProductArgument{}
+	if len(A) == 1 {
+		var err error
+		prf.SingleValue, err = bgSingleValueProductArgumentProve(ck, tr, cA[0], b, A[0], r[0])
+		return prf, err
+	}
+
+	n := len(A[0])
+	rowProducts := make([]kyber.Scalar, n)
+	for l := range rowProducts {
+		rowProducts[l] = libunlynx.SuiTe.Scalar().One()
+		for j := range A {
+			rowProducts[l] = libunlynx.SuiTe.Scalar().Mul(rowProducts[l], A[j][l])
+		}
+	}
+	s := libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
+	prf.Cb = ck.commit(rowProducts, s)
+	tr.appendPoints(prf.Cb)
+
+	hadamard, err := bgHadamardArgumentProve(ck, tr, cA, prf.Cb, A, r, rowProducts, s)
+	if err != nil {
+		return bgProductArgument{}, err
+	}
+	prf.Hadamard = &hadamard
+	prf.SingleValue, err = bgSingleValueProductArgumentProve(ck, tr, prf.Cb, b, rowProducts, s)
+	if err != nil {
+		return bgProductArgument{}, err
+	}
+	return prf, nil
+}
+
+// bgProductArgumentVerify verifies a product argument
+func bgProductArgumentVerify(ck bgCommitmentKey, tr *bgTranscript, cA []kyber.Point, b kyber.Scalar, prf bgProductArgument, m, n int) error {
+	if m == 1 {
+		return bgSingleValueProductArgumentVerify(ck, tr, cA[0], b, prf.SingleValue, n)
+	}
+	if prf.Cb == nil || prf.Hadamard == nil {
+		return errors.New("incomplete product argument")
+	}
+	tr.appendPoints(prf.Cb)
+	if err := bgHadamardArgumentVerify(ck, tr, cA, prf.Cb, *prf.Hadamard, m, n); err != nil {
+		return err
+	}
+	return bgSingleValueProductArgumentVerify(ck, tr, prf.Cb, b, prf.SingleValue, n)
+}
+
+// bgHadamardArgumentProve proves that b (committed in cb with s) is the entry-wise product of the m >= 2 columns of A
+// (committed in cA with r)
+func bgHadamardArgumentProve(ck bgCommitmentKey, tr *bgTranscript, cA []kyber.Point, cb kyber.Point, A [][]kyber.Scalar, r []kyber.Scalar, b []kyber.Scalar, s kyber.Scalar) (bgHadamardArgument, error) {
+	m, n := len(A), len(A[0])
+
+	// partial products B_i = A_0 o ... o A_i
+	B := make([][]kyber.Scalar, m)
+	sB := make([]kyber.Scalar, m)
+	B[0], sB[0] = A[0], r[0]
+	for i := 1; i < m; i++ {
+		B[i] = make([]kyber.Scalar, n)
+		for l := range B[i] {
+			B[i][l] = libunlynx.SuiTe.Scalar().Mul(B[i-1][l], A[i][l])
+		}
+		sB[i] = libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
+	}
+	sB[m-1] = s
+
+	prf := bgHadamardArgument{CB: make([]kyber.Point, m)}
+	prf.CB[0], prf.CB[m-1] = cA[0], cb
+	for i := 1; i < m-1; i++ {
+		prf.CB[i] = ck.commit(B[i], sB[i])
+	}
+	tr.appendPoints(prf.CB...)
+	x := tr.challenge("hadamard x")
+	y := tr.challenge("hadamard y")
+	if tr.err != nil {
+		return bgHadamardArgument{}, tr.err
+	}
+
+	// sum_{i=1}^{m-1} a_i * (x^i b_{i-1}) - 1 * (sum_{i=1}^{m-1} x^i b_i) = 0
+	zA, zcA, zB, zcB := bgHadamardZeroStatement(ck, cA, prf.CB, x, m, n)
+	xPowers := bgPowers(x, m)
+	zr := make([]kyber.Scalar, m)
+	copy(zr, r[1:])
+	zr[m-1] = libunlynx.SuiTe.Scalar().Zero()
+	zs := make([]kyber.Scalar, m)
+	zs[m-1] = libunlynx.SuiTe.Scalar().Zero()
+	for i := 1; i < m; i++ {
+		zB[i-1] = bgScale(B[i-1], xPowers[i])
+		zs[i-1] = libunlynx.SuiTe.Scalar().Mul(xPowers[i], sB[i-1])
+		zB[m-1] = bgAdd(zB[m-1], bgScale(B[i], xPowers[i]))
+		zs[m-1] = libunlynx.SuiTe.Scalar().Add(zs[m-1], libunlynx.SuiTe.Scalar().Mul(xPowers[i], sB[i]))
+	}
+	copy(zA, A[1:])
+
+	var err error
+	prf.Zero, err = bgZeroArgumentProve(ck, tr, zcA, zcB, y, zA, zr, zB, zs)
+	if err != nil {
+		return bgHadamardArgument{}, err
+	}
+	return prf, nil
+}
+
+// bgHadamardArgumentVerify verifies a Hadamard argument
+func bgHadamardArgumentVerify(ck bgCommitmentKey, tr *bgTranscript, cA []kyber.Point, cb kyber.Point, prf bgHadamardArgument, m, n int) error {
+	if !prf.CB[0].Equal(cA[0]) || !prf.CB[m-1].Equal(cb) {
+		return errors.New("wrong commitments to the partial products")
+	}
+	tr.appendPoints(prf.CB...)
+	x := tr.challenge("hadamard x")
+	y := tr.challenge("hadamard y")
+	if tr.err != nil {
+		return tr.err
+	}
+
+	_, zcA, _, zcB := bgHadamardZeroStatement(ck, cA, prf.CB, x, m, n)
+	return bgZeroArgumentVerify(ck, tr, zcA, zcB, y, prf.Zero, m, n)
+}
+
+// bgHadamardZeroStatement returns the statement of the zero argument of a Hadamard argument: the commitments to
+// (a_1, ..., a_{m-1}, -1) and (x b_0, ..., x^{m-1} b_{m-2}, sum_{i=1}^{m-1} x^i b_i), and the matrices to fill in (with
+// the -1 column)
+func bgHadamardZeroStatement(ck bgCommitmentKey, cA, cB []kyber.Point, x kyber.Scalar, m, n int) ([][]kyber.Scalar, []kyber.Point, [][]kyber.Scalar, []kyber.Point) {
+	minusOne := make([]kyber.Scalar, n)
+	zero := make([]kyber.Scalar, n)
+	for l := range minusOne {
+		minusOne[l] = libunlynx.SuiTe.Scalar().Neg(libunlynx.SuiTe.Scalar().One())
+		zero[l] = libunlynx.SuiTe.Scalar().Zero()
+	}
+
+	zA := make([][]kyber.Scalar, m)
+	zA[m-1] = minusOne
+	zB := make([][]kyber.Scalar, m)
+	zB[m-1] = zero
+
+	zcA := make([]kyber.Point, m)
+	copy(zcA, cA[1:])
+	zcA[m-1] = ck.commit(minusOne, libunlynx.SuiTe.Scalar().Zero())
+
+	xPowers := bgPowers(x, m)
+	zcB := make([]kyber.Point, m)
+	zcB[m-1] = libunlynx.SuiTe.Point().Null()
+	for i := 1; i < m; i++ {
+		zcB[i-1] = libunlynx.SuiTe.Point().Mul(xPowers[i], cB[i-1])
+		zcB[m-1] = libunlynx.SuiTe.Point().Add(zcB[m-1], libunlynx.SuiTe.Point().Mul(xPowers[i], cB[i]))
+	}
+	return zA, zcA, zB, zcB
+}
+
+// bgZeroArgumentProve proves that sum_i A_i * B_i = 0 for the bilinear map * defined by y (A and B are committed in
+// cA with r and cB with s)
+func bgZeroArgumentProve(ck bgCommitmentKey, tr *bgTranscript, cA, cB []kyber.Point, y kyber.Scalar, A [][]kyber.Scalar, r []kyber.Scalar, B [][]kyber.Scalar, s []kyber.Scalar) (bgZeroArgument, error) {
+	m, n := len(A), len(A[0])
+
+	a0 := libunlynx.RandomScalarSlice(n)
+	bm1 := libunlynx.RandomScalarSlice(n)
+	r0 := libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
+	sm1 := libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
+
+	prf := bgZeroArgument{CA0: ck.commit(a0, r0), CBm1: ck.commit(bm1, sm1)}
+
+	// extended matrices (a_0, ..., a_m) and (b_1, ..., b_{m+1})
+	Aext := append([][]kyber.Scalar{a0}, A...)
+	rExt := append([]kyber.Scalar{r0}, r...)
+	Bext := append(append([][]kyber.Scalar{}, B...), bm1)
+	sExt := append(append([]kyber.Scalar{}, s...), sm1)
+
+	// d_k = sum_{i - j + m = k} a_i * b_j (b_j is Bext[j-1])
+	yPowers := bgPowers(y, n+1)
+	d := make([]kyber.Scalar, 2*m+1)
+	for k := range d {
+		d[k] = libunlynx.SuiTe.Scalar().Zero()
+	}
+	for i := 0; i <= m; i++ {
+		for j := 1; j <= m+1; j++ {
+			k := i - j + m + 1
+			d[k] = libunlynx.SuiTe.Scalar().Add(d[k], bgStar(Aext[i], Bext[j-1], yPowers))
+		}
+	}
+	t := libunlynx.RandomScalarSlice(2*m + 1)
+	t[m+1] = libunlynx.SuiTe.Scalar().Zero()
+	prf.CD = make([]kyber.Point, 2*m+1)
+	for k := range d {
+		prf.CD[k] = ck.commit([]kyber.Scalar{d[k]}, t[k])
+	}
+
+	tr.appendPoints(cA...)
+	tr.appendPoints(cB...)
+	tr.appendPoints(prf.CA0, prf.CBm1)
+	tr.appendPoints(prf.CD...)
+	x := tr.challenge("zero x")
+	if tr.err != nil {
+		return bgZeroArgument{}, tr.err
+	}
+
+	xPowers := bgPowers(x, 2*m+1)
+	prf.A = make([]kyber.Scalar, n)
+	prf.B = make([]kyber.Scalar, n)
+	for l := 0; l < n; l++ {
+		prf.A[l] = libunlynx.SuiTe.Scalar().Zero()
+		prf.B[l] = libunlynx.SuiTe.Scalar().Zero()
+	}
+	prf.R = libunlynx.SuiTe.Scalar().Zero()
+	prf.S = libunlynx.SuiTe.Scalar().Zero()
+	for i := 0; i <= m; i++ {
+		prf.A = bgAdd(prf.A, bgScale(Aext[i], xPowers[i]))
+		prf.R = libunlynx.SuiTe.Scalar().Add(prf.R, libunlynx.SuiTe.Scalar().Mul(xPowers[i], rExt[i]))
+	}
+	for j := 1; j <= m+1; j++ {
+		prf.B = bgAdd(prf.B, bgScale(Bext[j-1], xPowers[m+1-j]))
+		prf.S = libunlynx.SuiTe.Scalar().Add(prf.S, libunlynx.SuiTe.Scalar().Mul(xPowers[m+1-j], sExt[j-1]))
+	}
+	prf.T = bgInnerProductScalars(t, xPowers)
+	return prf, nil
+}
+
+// bgZeroArgumentVerify verifies a zero argument
+func bgZeroArgumentVerify(ck bgCommitmentKey, tr *bgTranscript, cA, cB []kyber.Point, y kyber.Scalar, prf bgZeroArgument, m, n int) error {
+	if !prf.CD[m+1].Equal(libunlynx.SuiTe.Point().Null()) {
+		return errors.New("zero argument: the committed value is not 0")
+	}
+
+	tr.appendPoints(cA...)
+	tr.appendPoints(cB...)
+	tr.appendPoints(prf.CA0, prf.CBm1)
+	tr.appendPoints(prf.CD...)
+	x := tr.challenge("zero x")
+	if tr.err != nil {
+		return tr.err
+	}
+	xPowers := bgPowers(x, 2*m+1)
+
+	cAext := append([]kyber.Point{prf.CA0}, cA...)
+	if !bgLinearCombination(cAext, xPowers[:m+1]).Equal(ck.commit(prf.A, prf.R)) {
+		return errors.New("zero argument: wrong opening of the first matrix")
+	}
+
+	cBext := append(append([]kyber.Point{}, cB...), prf.CBm1)
+	reversed := make([]kyber.Scalar, m+1)
+	for j := 1; j <= m+1; j++ {
+		reversed[j-1] = xPowers[m+1-j]
+	}
+	if !bgLinearCombination(cBext, reversed).Equal(ck.commit(prf.B, prf.S)) {
+		return errors.New("zero argument: wrong opening of the second matrix")
+	}
+
+	yPowers := bgPowers(y, n+1)
+	if !bgLinearCombination(prf.CD, xPowers).Equal(ck.commit([]kyber.Scalar{bgStar(prf.A, prf.B, yPowers)}, prf.T)) {
+		return errors.New("zero argument: wrong opening of the bilinear maps")
+	}
+	return nil
+}
+
+// bgSingleValueProductArgumentProve proves that the product of the values of a (committed in ca with r) is b
+func bgSingleValueProductArgumentProve(ck bgCommitmentKey, tr *bgTranscript, ca kyber.Point, b kyber.Scalar, a []kyber.Scalar, r kyber.Scalar) (bgSingleValueProductArgument, error) {
+	n := len(a)
+
+	// partial products
+	bs := make([]kyber.Scalar, n)
+	bs[0] = a[0]
+	for k := 1; k < n; k++ {
+		bs[k] = libunlynx.SuiTe.Scalar().Mul(bs[k-1], a[k])
+	}
+
+	d := libunlynx.RandomScalarSlice(n)
+	rd := libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
+	delta := libunlynx.RandomScalarSlice(n)
+	delta[0] = d[0]
+	delta[n-1] = libunlynx.SuiTe.Scalar().Zero()
+	s0 := libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
+	sx := libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
+
+	lower := make([]kyber.Scalar, n-1)
+	upper := make([]kyber.Scalar, n-1)
+	for k := 0; k < n-1; k++ {
+		lower[k] = libunlynx.SuiTe.Scalar().Neg(libunlynx.SuiTe.Scalar().Mul(delta[k], d[k+1]))
+		upper[k] = libunlynx.SuiTe.Scalar().Sub(delta[k+1], libunlynx.SuiTe.Scalar().Mul(a[k+1], delta[k]))
+		upper[k] = libunlynx.SuiTe.Scalar().Sub(upper[k], libunlynx.SuiTe.Scalar().Mul(bs[k], d[k+1]))
+	}
+
+	prf := bgSingleValueProductArgument{Cd: ck.commit(d, rd), CLowerDelta: ck.commit(lower, s0), CUpperDelta: ck.commit(upper, sx)}
+	tr.appendPoints(ca)
+	tr.appendScalars(b)
+	tr.appendPoints(prf.Cd, prf.CLowerDelta, prf.CUpperDelta)
+	x := tr.challenge("single value product x")
+	if tr.err != nil {
+		return bgSingleValueProductArgument{}, tr.err
+	}
+
+	prf.ATilde = make([]kyber.Scalar, n)
+	prf.BTilde = make([]kyber.Scalar, n)
+	for k := 0; k < n; k++ {
+		prf.ATilde[k] = libunlynx.SuiTe.Scalar().Add(libunlynx.SuiTe.Scalar().Mul(x, a[k]), d[k])
+		prf.BTilde[k] = libunlynx.SuiTe.Scalar().Add(libunlynx.SuiTe.Scalar().Mul(x, bs[k]), delta[k])
+	}
+	prf.RTilde = libunlynx.SuiTe.Scalar().Add(libunlynx.SuiTe.Scalar().Mul(x, r), rd)
+	prf.STilde = libunlynx.SuiTe.Scalar().Add(libunlynx.SuiTe.Scalar().Mul(x, sx), s0)
+	return prf, nil
+}
+
+// bgSingleValueProductArgumentVerify verifies a single value product argument
+func bgSingleValueProductArgumentVerify(ck bgCommitmentKey, tr *bgTranscript, ca kyber.Point, b kyber.Scalar, prf bgSingleValueProductArgument, n int) error {
+	tr.appendPoints(ca)
+	tr.appendScalars(b)
+	tr.appendPoints(prf.Cd, prf.CLowerDelta, prf.CUpperDelta)
+	x := tr.challenge("single value product x")
+	if tr.err != nil {
+		return tr.err
+	}
+
+	if !libunlynx.SuiTe.Point().Add(libunlynx.SuiTe.Point().Mul(x, ca), prf.Cd).Equal(ck.commit(prf.ATilde, prf.RTilde)) {
+		return errors.New("single value product argument: wrong opening of the vector")
+	}
+
+	values := make([]kyber.Scalar, n-1)
+	for k := 0; k < n-1; k++ {
+		values[k] = libunlynx.SuiTe.Scalar().Sub(libunlynx.SuiTe.Scalar().Mul(x, prf.BTilde[k+1]), libunlynx.SuiTe.Scalar().Mul(prf.BTilde[k], prf.ATilde[k+1]))
+	}
+	if !libunlynx.SuiTe.Point().Add(libunlynx.SuiTe.Point().Mul(x, prf.CUpperDelta), prf.CLowerDelta).Equal(ck.commit(values, prf.STilde)) {
+		return errors.New("single value product argument: wrong opening of the partial products")
+	}
+
+	if !prf.BTilde[0].Equal(prf.ATilde[0]) || !prf.BTilde[n-1].Equal(libunlynx.SuiTe.Scalar().Mul(x, b)) {
+		return errors.New("single value product argument: wrong product")
+	}
+	return nil
+}
+
+// Multi-exponentiation argument
+//______________________________________________________________________________________________________________________
+
+// bgMultiExpArgumentProve proves that C = Enc(0; rho) + sum_i <rows_i, A_i> where the columns A_i are committed in cA
+// with r
+func bgMultiExpArgumentProve(ck bgCommitmentKey, tr *bgTranscript, g, h kyber.Point, rows [][]libunlynx.CipherText, C libunlynx.CipherText, cA []kyber.Point, A [][]kyber.Scalar, r []kyber.Scalar, rho kyber.Scalar) (bgMultiExpArgument, error) {
+	m, n := len(A), len(A[0])
+
+	a0 := libunlynx.RandomScalarSlice(n)
+	r0 := libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
+	b := libunlynx.RandomScalarSlice(2 * m)
+	s := libunlynx.RandomScalarSlice(2 * m)
+	tau := libunlynx.RandomScalarSlice(2 * m)
+	b[m] = libunlynx.SuiTe.Scalar().Zero()
+	s[m] = libunlynx.SuiTe.Scalar().Zero()
+	tau[m] = rho
+
+	prf := bgMultiExpArgument{CA0: ck.commit(a0, r0), CB: make([]kyber.Point, 2*m), E: make([]libunlynx.CipherText, 2*m)}
+
+	// diagonal products D_k = sum_{m + j - i = k} <rows_i, a_j> (rows_i is rows[i-1], a_0 is random)
+	Aext := append([][]kyber.Scalar{a0}, A...)
+	D := make([]libunlynx.CipherText, 2*m)
+	for k := range D {
+		D[k] = libunlynx.CipherText{K: libunlynx.SuiTe.Point().Null(), C: libunlynx.SuiTe.Point().Null()}
+	}
+	products := make([][]libunlynx.CipherText, m)
+	wg := libunlynx.StartParallelize(m)
+	for i := 1; i <= m; i++ {
+		go func(i int) {
+			defer wg.Done()
+			products[i-1] = make([]libunlynx.CipherText, m+1)
+			for j := 0; j <= m; j++ {
+				products[i-1][j] = bgInnerProduct(rows[i-1], Aext[j])
+			}
+		}(i)
+	}
+	libunlynx.EndParallelize(wg)
+	for i := 1; i <= m; i++ {
+		for j := 0; j <= m; j++ {
+			k := m + j - i
+			D[k].Add(D[k], products[i-1][j])
+		}
+	}
+
+	for k := range D {
+		prf.CB[k] = ck.commit([]kyber.Scalar{b[k]}, s[k])
+		prf.E[k] = bgEncrypt(g, h, b[k], tau[k])
+		prf.E[k].Add(prf.E[k], D[k])
+	}
+
+	tr.appendCipherTexts(C)
+	tr.appendPoints(cA...)
+	tr.appendPoints(prf.CA0)
+	tr.appendPoints(prf.CB...)
+	tr.appendCipherTexts(prf.E...)
+	x := tr.challenge("multi-exponentiation x")
+	if tr.err != nil {
+		return bgMultiExpArgument{}, tr.err
+	}
+
+	xPowers := bgPowers(x, 2*m)
+	prf.A = a0
+	prf.R = r0
+	for i := 1; i <= m; i++ {
+		prf.A = bgAdd(prf.A, bgScale(A[i-1], xPowers[i]))
+		prf.R = libunlynx.SuiTe.Scalar().Add(prf.R, libunlynx.SuiTe.Scalar().Mul(xPowers[i], r[i-1]))
+	}
+	prf.B = bgInnerProductScalars(b, xPowers)
+	prf.S = bgInnerProductScalars(s, xPowers)
+	prf.Tau = bgInnerProductScalars(tau, xPowers)
+	return prf, nil
+}
+
+// bgMultiExpArgumentVerify verifies a multi-exponentiation argument
+func bgMultiExpArgumentVerify(ck bgCommitmentKey, tr *bgTranscript, g, h kyber.Point, rows [][]libunlynx.CipherText, C libunlynx.CipherText, cA []kyber.Point, prf bgMultiExpArgument) error {
+	m := len(rows)
+	if !prf.CB[m].Equal(libunlynx.SuiTe.Point().Null()) || !prf.E[m].Equal(&C) {
+		return errors.New("multi-exponentiation argument: wrong middle diagonal")
+	}
+
+	tr.appendCipherTexts(C)
+	tr.appendPoints(cA...)
+	tr.appendPoints(prf.CA0)
+	tr.appendPoints(prf.CB...)
+	tr.appendCipherTexts(prf.E...)
+	x := tr.challenge("multi-exponentiation x")
+	if tr.err != nil {
+		return tr.err
+	}
+	xPowers := bgPowers(x, 2*m)
+
+	cAext := append([]kyber.Point{prf.CA0}, cA...)
+	if !bgLinearCombination(cAext, xPowers[:m+1]).Equal(ck.commit(prf.A, prf.R)) {
+		return errors.New("multi-exponentiation argument: wrong opening of the exponents")
+	}
+	if !bgLinearCombination(prf.CB, xPowers).Equal(ck.commit([]kyber.Scalar{prf.B}, prf.S)) {
+		return errors.New("multi-exponentiation argument: wrong opening of the diagonal values")
+	}
+
+	left := libunlynx.CipherText{K: libunlynx.SuiTe.Point().Null(), C: libunlynx.SuiTe.Point().Null()}
+	for k, e := range prf.E {
+		tmp := libunlynx.CipherText{}
+		tmp.MulCipherTextbyScalar(e, xPowers[k])
+		left.Add(left, tmp)
+	}
+
+	right := bgEncrypt(g, h, prf.B, prf.Tau)
+	products := make([]libunlynx.CipherText, m)
+	wg := libunlynx.StartParallelize(m)
+	for i := 1; i <= m; i++ {
+		go func(i int) {
+			defer wg.Done()
+			products[i-1] = bgInnerProduct(rows[i-1], bgScale(prf.A, xPowers[m-i]))
+		}(i)
+	}
+	libunlynx.EndParallelize(wg)
+	for _, p := range products {
+		right.Add(right, p)
+	}
+
+	if !left.Equal(&right) {
+		return errors.New("multi-exponentiation argument: wrong ciphertexts")
+	}
+	return nil
+}
+
+// Commitments
+//______________________________________________________________________________________________________________________
+
+// bgCommitmentKey contains the generators of the Pedersen commitments to vectors of (at most) n scalars. They are
+// derived from a public seed so that nobody knows their discrete logarithms.
+type bgCommitmentKey struct {
+	H kyber.Point
+	G []kyber.Point
+}
+
+// newBGCommitmentKey creates the commitment key for vectors of n scalars
+func newBGCommitmentKey(n int) bgCommitmentKey {
+	xof := libunlynx.SuiTe.XOF([]byte("UnLynx Bayer-Groth commitment key"))
+	ck := bgCommitmentKey{H: libunlynx.SuiTe.Point().Pick(xof), G: make([]kyber.Point, n)}
+	for i := range ck.G {
+		ck.G[i] = libunlynx.SuiTe.Point().Pick(xof)
+	}
+	return ck
+}
+
+// commit commits to a vector of scalars with the randomness r
+func (ck bgCommitmentKey) commit(a []kyber.Scalar, r kyber.Scalar) kyber.Point {
+	c := libunlynx.SuiTe.Point().Mul(r, ck.H)
+	for i, v := range a {
+		c = libunlynx.SuiTe.Point().Add(c, libunlynx.SuiTe.Point().Mul(v, ck.G[i]))
+	}
+	return c
+}
+
+// commitMatrix commits to each column of a matrix
+func (ck bgCommitmentKey) commitMatrix(A [][]kyber.Scalar, r []kyber.Scalar) []kyber.Point {
+	c := make([]kyber.Point, len(A))
+	wg := libunlynx.StartParallelize(len(A))
+	for j := range A {
+		go func(j int) {
+			defer wg.Done()
+			c[j] = ck.commit(A[j], r[j])
+		}(j)
+	}
+	libunlynx.EndParallelize(wg)
+	return c
+}
+
+// Tools
+//______________________________________________________________________________________________________________________
+
+// bgMatrix splits a vector of m*n scalars in m columns of n scalars
+func bgMatrix(a []kyber.Scalar, m, n int) [][]kyber.Scalar {
+	A := make([][]kyber.Scalar, m)
+	for j := range A {
+		A[j] = a[j*n : (j+1)*n]
+	}
+	return A
+}
+
+// bgRows splits a list of m*n ciphertexts in m rows of n ciphertexts
+func bgRows(C []libunlynx.CipherText, m, n int) [][]libunlynx.CipherText {
+	rows := make([][]libunlynx.CipherText, m)
+	for i := range rows {
+		rows[i] = C[i*n : (i+1)*n]
+	}
+	return rows
+}
+
+// bgPowers returns (1, x, ..., x^(k-1))
+func bgPowers(x kyber.Scalar, k int) []kyber.Scalar {
+	powers := make([]kyber.Scalar, k)
+	current := libunlynx.SuiTe.Scalar().One()
+	for i := range powers {
+		powers[i] = current
+		current = libunlynx.SuiTe.Scalar().Mul(current, x)
+	}
+	return powers
+}
+
+// bgStar is the bilinear map a * b = sum_j a_j b_j y^(j+1) (yPowers are the powers of y)
+func bgStar(a, b, yPowers []kyber.Scalar) kyber.Scalar {
+	result := libunlynx.SuiTe.Scalar().Zero()
+	for j := range a {
+		result = libunlynx.SuiTe.Scalar().Add(result, libunlynx.SuiTe.Scalar().Mul(libunlynx.SuiTe.Scalar().Mul(a[j], b[j]), yPowers[j+1]))
+	}
+	return result
+}
+
+// bgScale multiplies a vector of scalars by x
+func bgScale(a []kyber.Scalar, x kyber.Scalar) []kyber.Scalar {
+	result := make([]kyber.Scalar, len(a))
+	for i, v := range a {
+		result[i] = libunlynx.SuiTe.Scalar().Mul(v, x)
+	}
+	return result
+}
+
+// bgAdd adds two vectors of scalars
+func bgAdd(a, b []kyber.Scalar) []kyber.Scalar {
+	result := make([]kyber.Scalar, len(a))
+	for i := range a {
+		result[i] = libunlynx.SuiTe.Scalar().Add(a[i], b[i])
+	}
+	return result
+}
+
+// bgInnerProductScalars returns sum_i a_i b_i
+func bgInnerProductScalars(a, b []kyber.Scalar) kyber.Scalar {
+	result := libunlynx.SuiTe.Scalar().Zero()
+	for i := range a {
+		result = libunlynx.SuiTe.Scalar().Add(result, libunlynx.SuiTe.Scalar().Mul(a[i], b[i]))
+	}
+	return result
+}
+
+// bgLinearCombination returns sum_i a_i P_i
+func bgLinearCombination(points []kyber.Point, a []kyber.Scalar) kyber.Point {
+	result := libunlynx.SuiTe.Point().Null()
+	for i := range points {
+		result = libunlynx.SuiTe.Point().Add(result, libunlynx.SuiTe.Point().Mul(a[i], points[i]))
+	}
+	return result
+}
+
+// bgInnerProduct returns sum_i a_i C_i for ciphertexts C
+func bgInnerProduct(C []libunlynx.CipherText, a []kyber.Scalar) libunlynx.CipherText {
+	result := libunlynx.CipherText{K: libunlynx.SuiTe.Point().Null(), C: libunlynx.SuiTe.Point().Null()}
+	for i := range C {
+		tmp := libunlynx.CipherText{}
+		tmp.MulCipherTextbyScalar(C[i], a[i])
+		result.Add(result, tmp)
+	}
+	return result
+}
+
+// bgEncrypt returns the encryption of v g with the randomness tau: (tau g, v g + tau h)
+func bgEncrypt(g, h kyber.Point, v, tau kyber.Scalar) libunlynx.CipherText {
+	return libunlynx.CipherText{
+		K: libunlynx.SuiTe.Point().Mul(tau, g),
+		C: libunlynx.SuiTe.Point().Add(libunlynx.SuiTe.Point().Mul(v, g), libunlynx.SuiTe.Point().Mul(tau, h)),
+	}
+}
+
+// Fiat-Shamir
+//______________________________________________________________________________________________________________________
+
+// bgTranscript derives the challenges of the argument from a hash of everything sent before. The first error (of a
+// marshalling) is kept and returned by the caller.
+type bgTranscript struct {
+	state []byte
+	err   error
+}
+
+// newBGTranscript starts a transcript with a label
+func newBGTranscript(label string) *bgTranscript {
+	tr := &bgTranscript{}
+	state := sha256.Sum256([]byte(label))
+	tr.state = state[:]
+	return tr
+}
+
+// append adds elements to the transcript
+func (tr *bgTranscript) append(elements ...encoding.BinaryMarshaler) {
+	h := sha256.New()
+	h.Write(tr.state)
+	for _, el := range elements {
+		data, err := el.MarshalBinary()
+		if err != nil {
+			if tr.err == nil {
+				tr.err = err
+			}
+			return
+		}
+		h.Write(data)
+	}
+	tr.state = h.Sum(nil)
+}
+
+// appendPoints adds points to the transcript
+func (tr *bgTranscript) appendPoints(points ...kyber.Point) {
+	elements := make([]encoding.BinaryMarshaler, len(points))
+	for i, p := range points {
+		elements[i] = p
+	}
+	tr.append(elements...)
+}
+
+// appendScalars adds scalars to the transcript
+func (tr *bgTranscript) appendScalars(scalars ...kyber.Scalar) {
+	elements := make([]encoding.BinaryMarshaler, len(scalars))
+	for i, s := range scalars {
+		elements[i] = s
+	}
+	tr.append(elements...)
+}
+
+// appendCipherTexts adds ciphertexts to the transcript
+func (tr *bgTranscript) appendCipherTexts(cts ...libunlynx.CipherText) {
+	elements := make([]encoding.BinaryMarshaler, 0, 2*len(cts))
+	for _, ct := range cts {
+		elements = append(elements, ct.K, ct.C)
+	}
+	tr.append(elements...)
+}
+
+// challenge derives a challenge from the transcript (which is updated)
+func (tr *bgTranscript) challenge(label string) kyber.Scalar {
+	h := sha256.New()
+	h.Write(tr.state)
+	h.Write([]byte(label))
+	tr.state = h.Sum(nil)
+	return libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.XOF(tr.state))
+}
+
+// Marshal
+//______________________________________________________________________________________________________________________
+
+// toBytes encodes the argument: the points and the scalars in a fixed order, their numbers depending only on the
+// dimensions of the matrix of ciphertexts
+func (prf *bgShuffleArgument) toBytes() ([]byte, error) {
+	w := bgWriter{}
+	w.points(prf.CA...)
+	w.points(prf.CB...)
+
+	if prf.Product.Hadamard != nil {
+		w.points(prf.Product.Cb)
+		w.points(prf.Product.Hadamard.CB...)
+		zero := prf.Product.Hadamard.Zero
+		w.points(zero.CA0, zero.CBm1)
+		w.points(zero.CD...)
+		w.scalars(zero.A...)
+		w.scalars(zero.B...)
+		w.scalars(zero.R, zero.S, zero.T)
+	}
+
+	svp := prf.Product.SingleValue
+	w.points(svp.Cd, svp.CLowerDelta, svp.CUpperDelta)
+	w.scalars(svp.ATilde...)
+	w.scalars(svp.BTilde...)
+	w.scalars(svp.RTilde, svp.STilde)
+
+	for _, me := range prf.MultiExp {
+		w.points(me.CA0)
+		w.points(me.CB...)
+		for _, e := range me.E {
+			w.points(e.K, e.C)
+		}
+		w.scalars(me.A...)
+		w.scalars(me.R, me.B, me.S, me.Tau)
+	}
+
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.Bytes(), nil
+}
+
+// fromBytes decodes an argument for a matrix of m rows and n columns with nbrKeys multi-exponentiation arguments
+func (prf *bgShuffleArgument) fromBytes(data []byte, m, n, nbrKeys int) error {
+	r := bgReader{data: data}
+	prf.CA = r.points(m)
+	prf.CB = r.points(m)
+
+	prf.Product = bgProductArgument{}
+	if m > 1 {
+		prf.Product.Cb = r.point()
+		hadamard := bgHadamardArgument{CB: r.points(m)}
+		hadamard.Zero = bgZeroArgument{CA0: r.point(), CBm1: r.point(), CD: r.points(2*m + 1), A: r.scalars(n), B: r.scalars(n)}
+		hadamard.Zero.R, hadamard.Zero.S, hadamard.Zero.T = r.scalar(), r.scalar(), r.scalar()
+		prf.Product.Hadamard = &hadamard
+	}
+
+	svp := bgSingleValueProductArgument{Cd: r.point(), CLowerDelta: r.point(), CUpperDelta: r.point(), ATilde: r.scalars(n), BTilde: r.scalars(n)}
+	svp.RTilde, svp.STilde = r.scalar(), r.scalar()
+	prf.Product.SingleValue = svp
+
+	prf.MultiExp = make([]bgMultiExpArgument, nbrKeys)
+	for i := range prf.MultiExp {
+		me := bgMultiExpArgument{CA0: r.point(), CB: r.points(2 * m), E: make([]libunlynx.CipherText, 2*m)}
+		for k := range me.E {
+			me.E[k] = libunlynx.CipherText{K: r.point(), C: r.point()}
+		}
+		me.A = r.scalars(n)
+		me.R, me.B, me.S, me.Tau = r.scalar(), r.scalar(), r.scalar(), r.scalar()
+		prf.MultiExp[i] = me
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.data) != 0 {
+		return errors.New("Bayer-Groth proof of " + strconv.Itoa(len(data)) + " bytes is too long for a " + strconv.Itoa(m) + "x" + strconv.Itoa(n) + " matrix")
+	}
+	return nil
+}
+
+// bgWriter encodes points and scalars one after the other
+type bgWriter struct {
+	bytes.Buffer
+	err error
+}
+
+func (w *bgWriter) write(elements ...encoding.BinaryMarshaler) {
+	for _, el := range elements {
+		if w.err != nil {
+			return
+		}
+		var data []byte
+		data, w.err = el.MarshalBinary()
+		w.Write(data)
+	}
+}
+
+func (w *bgWriter) points(points ...kyber.Point) {
+	for _, p := range points {
+		w.write(p)
+	}
+}
+
+func (w *bgWriter) scalars(scalars ...kyber.Scalar) {
+	for _, s := range scalars {
+		w.write(s)
+	}
+}
+
+// bgReader decodes points and scalars encoded by a bgWriter
+type bgReader struct {
+	data []byte
+	err  error
+}
+
+func (r *bgReader) next(size int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < size {
+		r.err = errors.New("Bayer-Groth proof is too short")
+		return nil
+	}
+	data := r.data[:size]
+	r.data = r.data[size:]
+	return data
+}
+
+func (r *bgReader) point() kyber.Point {
+	p := libunlynx.SuiTe.Point()
+	data := r.next(libunlynx.SuiTe.PointLen())
+	if r.err == nil {
+		r.err = p.UnmarshalBinary(data)
+	}
+	return p
+}
+
+func (r *bgReader) points(k int) []kyber.Point {
+	points := make([]kyber.Point, k)
+	for i := range points {
+		points[i] = r.point()
+	}
+	return points
+}
+
+func (r *bgReader) scalar() kyber.Scalar {
+	s := libunlynx.SuiTe.Scalar()
+	data := r.next(libunlynx.SuiTe.ScalarLen())
+	if r.err == nil {
+		r.err = s.UnmarshalBinary(data)
+	}
+	return s
+}
+
+func (r *bgReader) scalars(k int) []kyber.Scalar {
+	scalars := make([]kyber.Scalar, k)
+	for i := range scalars {
+		scalars[i] = r.scalar()
+	}
+	return scalars
+}
@@ -0,0 +1,150 @@
+package libunlynxshuffle_test
+
+import (
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/shuffle"
+	"github.com/stretchr/testify/assert"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/util/key"
+)
+
+func TestBayerGrothShufflingProof(t *testing.T) {
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+	g := libunlynx.SuiTe.Point().Base()
+
+	// a single row (2), a padded matrix (7) and a square one (9), with and without precomputation
+	for _, N := range []int{2, 7, 9} {
+		responses := make([]libunlynx.CipherVector, N)
+		for i := range responses {
+			responses[i] = *libunlynx.EncryptIntVector(keys.Public, []int64{int64(i), 1, int64(2 * i)})
+		}
+
+		for _, precomputed := range [][]libunlynxshuffle.CipherVectorScalar{nil, libunlynxshuffle.CreatePrecomputedRandomize(g, keys.Public, libunlynx.SuiTe.RandomStream(), 3, N)} {
+			shuffled, pi, beta := libunlynxshuffle.ShuffleSequence(responses, g, keys.Public, precomputed)
+			psp, err := libunlynxshuffle.BayerGrothShuffleProofCreation(responses, shuffled, g, keys.Public, beta, pi)
+			assert.NoError(t, err)
+			assert.Equal(t, libunlynxshuffle.BayerGrothShuffleProof, psp.Backend)
+			assert.True(t, libunlynxshuffle.ShuffleProofVerification(psp, keys.Public))
+
+			// the backend and the proof go through the encoding
+			pslp := libunlynxshuffle.PublishedShufflingListProof{List: []libunlynxshuffle.PublishedShufflingProof{psp}}
+			pslpb, err := pslp.ToBytes()
+			assert.NoError(t, err)
+			converted := libunlynxshuffle.PublishedShufflingListProof{}
+			assert.NoError(t, converted.FromBytes(pslpb))
+			assert.True(t, libunlynxshuffle.ShuffleListProofVerification(converted, keys.Public, 1.0))
+
+			// wrong key, wrong backend, truncated proof
+			_, otherKey := libunlynx.GenKey()
+			assert.False(t, libunlynxshuffle.ShuffleProofVerification(psp, otherKey))
+			wrong := psp
+			wrong.Backend = libunlynxshuffle.NeffShuffleProof
+			assert.False(t, libunlynxshuffle.ShuffleProofVerification(wrong, keys.Public))
+			wrong = psp
+			wrong.HashProof = psp.HashProof[:len(psp.HashProof)-1]
+			assert.False(t, libunlynxshuffle.ShuffleProofVerification(wrong, keys.Public))
+
+			// a response which is not a rerandomization of an original one
+			wrong = psp
+			wrong.ShuffledList = append([]libunlynx.CipherVector{}, shuffled...)
+			wrong.ShuffledList[0] = *libunlynx.EncryptIntVector(keys.Public, []int64{0, 1, 1})
+			assert.False(t, libunlynxshuffle.ShuffleProofVerification(wrong, keys.Public))
+		}
+
+		// the lists are not a shuffle
+		_, pi, beta := libunlynxshuffle.ShuffleSequence(responses, g, keys.Public, nil)
+		psp, err := libunlynxshuffle.BayerGrothShuffleProofCreation(responses, responses, g, keys.Public, beta, pi)
+		assert.NoError(t, err)
+		assert.False(t, libunlynxshuffle.ShuffleProofVerification(psp, keys.Public))
+	}
+
+	_, err := libunlynxshuffle.BayerGrothShuffleProofCreation(make([]libunlynx.CipherVector, 1), make([]libunlynx.CipherVector, 1), g, keys.Public, nil, []int{0})
+	assert.Error(t, err)
+}
+
+func TestBayerGrothShufflingProofKeys(t *testing.T) {
+	g := libunlynx.SuiTe.Point().Base()
+	secret1, public1 := libunlynx.GenKey()
+	secret2, public2 := libunlynx.GenKey()
+	collectiveKey := libunlynx.SuiTe.Point().Add(public1, public2)
+
+	// the first two ciphertexts are partially decrypted with secret1, the last one is encrypted under the collective key
+	keys := []kyber.Point{public2, public2, collectiveKey}
+	responses := make([]libunlynx.CipherVector, 5)
+	for i := range responses {
+		responses[i] = *libunlynx.EncryptIntVector(collectiveKey, []int64{int64(i), 1, int64(2 * i)})
+		for j := 0; j < 2; j++ {
+			responses[i][j].C = libunlynx.SuiTe.Point().Sub(responses[i][j].C, libunlynx.SuiTe.Point().Mul(secret1, responses[i][j].K))
+		}
+	}
+
+	shuffled, pi, beta, err := libunlynxshuffle.ShuffleSequenceKeys(responses, g, keys)
+	assert.NoError(t, err)
+	for i, cv := range shuffled {
+		assert.Equal(t, int64(pi[i]), libunlynx.DecryptInt(secret2, cv[0]))
+		assert.Equal(t, int64(2*pi[i]), libunlynx.DecryptInt(libunlynx.SuiTe.Scalar().Add(secret1, secret2), cv[2]))
+	}
+
+	psp, err := libunlynxshuffle.BayerGrothShuffleProofCreationKeys(responses, shuffled, g, collectiveKey, keys, beta, pi)
+	assert.NoError(t, err)
+	assert.True(t, libunlynxshuffle.ShuffleProofVerification(psp, collectiveKey))
+
+	pslp := libunlynxshuffle.PublishedShufflingListProof{List: []libunlynxshuffle.PublishedShufflingProof{psp}}
+	pslpb, err := pslp.ToBytes()
+	assert.NoError(t, err)
+	converted := libunlynxshuffle.PublishedShufflingListProof{}
+	assert.NoError(t, converted.FromBytes(pslpb))
+	assert.Equal(t, len(keys), len(converted.List[0].Keys))
+	assert.True(t, libunlynxshuffle.ShuffleListProofVerification(converted, collectiveKey, 1.0))
+
+	// wrong keys, wrong backend
+	wrong := psp
+	wrong.Keys = []kyber.Point{public2, collectiveKey, collectiveKey}
+	assert.False(t, libunlynxshuffle.ShuffleProofVerification(wrong, collectiveKey))
+	wrong.Keys = nil
+	assert.False(t, libunlynxshuffle.ShuffleProofVerification(wrong, collectiveKey))
+	wrong = psp
+	wrong.Backend = libunlynxshuffle.NeffShuffleProof
+	assert.False(t, libunlynxshuffle.ShuffleProofVerification(wrong, collectiveKey))
+
+	// the partially decrypted ciphertexts rerandomized under the collective key
+	shuffled, pi, beta = libunlynxshuffle.ShuffleSequence(responses, g, collectiveKey, nil)
+	psp, err = libunlynxshuffle.BayerGrothShuffleProofCreationKeys(responses, shuffled, g, collectiveKey, keys, beta, pi)
+	assert.NoError(t, err)
+	assert.False(t, libunlynxshuffle.ShuffleProofVerification(psp, collectiveKey))
+
+	_, _, _, err = libunlynxshuffle.ShuffleSequenceKeys(responses, g, keys[:2])
+	assert.Error(t, err)
+	_, err = libunlynxshuffle.BayerGrothShuffleProofCreationKeys(responses, shuffled, g, collectiveKey, keys[:2], beta, pi)
+	assert.Error(t, err)
+}
+
+func TestBayerGrothShufflingProofSize(t *testing.T) {
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+	g := libunlynx.SuiTe.Point().Base()
+
+	responses := make([]libunlynx.CipherVector, 64)
+	for i := range responses {
+		responses[i] = *libunlynx.EncryptIntVector(keys.Public, []int64{int64(i)})
+	}
+	shuffled, pi, beta := libunlynxshuffle.ShuffleSequence(responses, g, keys.Public, nil)
+
+	neff, err := libunlynxshuffle.ShuffleProofCreation(responses, shuffled, g, keys.Public, beta, pi)
+	assert.NoError(t, err)
+	bayerGroth, err := libunlynxshuffle.BayerGrothShuffleProofCreation(responses, shuffled, g, keys.Public, beta, pi)
+	assert.NoError(t, err)
+	assert.True(t, libunlynxshuffle.ShuffleProofVerification(bayerGroth, keys.Public))
+	assert.True(t, 2*len(bayerGroth.HashProof) < len(neff.HashProof))
+}
+
+func TestShuffleProofCreationFunction(t *testing.T) {
+	for _, backend := range []string{"", libunlynxshuffle.NeffShuffleProof, libunlynxshuffle.BayerGrothShuffleProof} {
+		f, err := libunlynxshuffle.ShuffleProofCreationFunction(backend)
+		assert.NoError(t, err)
+		assert.NotNil(t, f)
+	}
+	_, err := libunlynxshuffle.ShuffleProofCreationFunction("unknown")
+	assert.Error(t, err)
+}
@@ -12,6 +12,14 @@ import (
 	"go.dedis.ch/onet/v3/log"
 )
 
+// Shuffle proof backends: the argument used to prove a shuffle
+const (
+	// NeffShuffleProof is the Neff argument (the default), whose size grows linearly with the number of responses
+	NeffShuffleProof = "neff"
+	// BayerGrothShuffleProof is the Bayer-Groth argument, whose size grows with the square root of the number of responses
+	BayerGrothShuffleProof = "bayer-groth"
+)
+
 // Structs
 //______________________________________________________________________________________________________________________
 
@@ -22,6 +30,11 @@ type PublishedShufflingProof struct {
 	G            kyber.Point
 	H            kyber.Point
 	HashProof    []byte
+	// Backend is the argument of the proof (NeffShuffleProof if empty)
+	Backend string
+	// Keys are the keys of the ciphertexts at each position of the cipher vectors when they are not all encrypted under
+	// H (see BayerGrothShuffleProofCreationKeys)
+	Keys []kyber.Point
 }
 
 // PublishedShufflingProofBytes is the 'bytes' equivalent of PublishedShufflingProof
@@ -33,6 +46,8 @@ type PublishedShufflingProofBytes struct {
 	G                  *[]byte
 	H                  *[]byte
 	HashProof          []byte
+	Backend            string
+	Keys               *[]byte
 }
 
 // PublishedShufflingListProof contains a list of shuffling proofs
@@ -40,6 +55,12 @@ type PublishedShufflingListProof struct {
 	List []PublishedShufflingProof
 }
 
+// PublishedShufflingListProofBytes is the 'bytes' equivalent of PublishedShufflingListProof
+type PublishedShufflingListProofBytes struct {
+	Version int
+	List    []PublishedShufflingProofBytes
+}
+
 // SHUFFLE proofs
 //______________________________________________________________________________________________________________________
 
@@ -97,7 +118,7 @@ func ShuffleProofCreation(originalList, shuffledList []libunlynx.CipherVector, g
 	if err != nil {
 		return PublishedShufflingProof{}, errors.New("Shuffle proof failed: " + err.Error())
 	}
-	return PublishedShufflingProof{originalList, shuffledList, g, h, prf}, nil
+	return PublishedShufflingProof{OriginalList: originalList, ShuffledList: shuffledList, G: g, H: h, HashProof: prf, Backend: NeffShuffleProof}, nil
 }
 
 // ShuffleListProofCreation generates a list of shuffle proofs
@@ -135,8 +156,33 @@ func ShuffleListProofCreation(originalList, shuffledList [][]libunlynx.CipherVec
 	return listProofs, nil
 }
 
-// ShuffleProofVerification verifies a shuffle proof
+// ShuffleProofCreationFunction returns the function creating shuffle proofs with a backend (NeffShuffleProof if empty)
+func ShuffleProofCreationFunction(backend string) (func([]libunlynx.CipherVector, []libunlynx.CipherVector, kyber.Point, kyber.Point, [][]kyber.Scalar, []int) (PublishedShufflingProof, error), error) {
+	switch backend {
+	case "", NeffShuffleProof:
+		return ShuffleProofCreation, nil
+	case BayerGrothShuffleProof:
+		return BayerGrothShuffleProofCreation, nil
+	default:
+		return nil, errors.New("unknown shuffle proof backend " + backend)
+	}
+}
+
+// ShuffleProofVerification verifies a shuffle proof (with the argument of its backend)
 func ShuffleProofVerification(psp PublishedShufflingProof, seed kyber.Point) bool {
+	switch psp.Backend {
+	case "", NeffShuffleProof:
+		if len(psp.Keys) != 0 {
+			log.Lvl1("-----------verify failed (the Neff argument is for one key)")
+			return false
+		}
+	case BayerGrothShuffleProof:
+		return bayerGrothShuffleProofVerification(psp, seed)
+	default:
+		log.Lvl1("-----------verify failed (unknown backend " + psp.Backend + ")")
+		return false
+	}
+
 	e, err := CipherVectorComputeE(seed, psp.OriginalList[0])
 	if err != nil {
 		log.Error(err)
@@ -192,6 +238,21 @@ func ShuffleProofVerification(psp PublishedShufflingProof, seed kyber.Point) boo
 	return true
 }
 
+// ShuffleProofKeys returns true if a shuffle proof is created for the given key of each position (see
+// ShuffleSequenceKeys). The argument only proves the shuffle for the keys of the proof: a verifier has to check that
+// they are the expected ones.
+func ShuffleProofKeys(psp PublishedShufflingProof, keys []kyber.Point) bool {
+	if len(psp.Keys) != len(keys) {
+		return false
+	}
+	for i, key := range keys {
+		if psp.Keys[i] == nil || !psp.Keys[i].Equal(key) {
+			return false
+		}
+	}
+	return true
+}
+
 // ShuffleListProofVerification verifies a list of shuffle proofs
 func ShuffleListProofVerification(pslp PublishedShufflingListProof, seed kyber.Point, percent float64) bool {
 	nbrProofsToVerify := int(math.Ceil(percent * float64(len(pslp.List))))
@@ -464,6 +525,18 @@ func (psp *PublishedShufflingProof) ToBytes() (PublishedShufflingProofBytes, err
 		pspb.H = &tmpHBytes
 
 		pspb.HashProof = psp.HashProof
+		pspb.Backend = psp.Backend
+
+		if len(psp.Keys) != 0 {
+			dataKeys, tmpErr := libunlynx.AbstractPointsToBytes(psp.Keys)
+			if tmpErr != nil {
+				mutex.Lock()
+				err = tmpErr
+				mutex.Unlock()
+				return
+			}
+			pspb.Keys = &dataKeys
+		}
 	}(psp.G, psp.H, psp.HashProof)
 
 	libunlynx.EndParallelize(wg)
@@ -477,6 +550,11 @@ func (psp *PublishedShufflingProof) ToBytes() (PublishedShufflingProofBytes, err
 
 // FromBytes transforms bytes back to PublishedShufflingProof
 func (psp *PublishedShufflingProof) FromBytes(pspb PublishedShufflingProofBytes) error {
+	if pspb.OriginalList == nil || pspb.OriginalListLength == nil || pspb.ShuffledList == nil ||
+		pspb.ShuffledListLength == nil || pspb.G == nil || pspb.H == nil {
+		return errors.New("shuffling proof is incomplete")
+	}
+
 	var err error
 	psp.OriginalList, err = libunlynx.FromBytesToArrayCipherVector(*pspb.OriginalList, *pspb.OriginalListLength)
 	if err != nil {
@@ -487,18 +565,89 @@ func (psp *PublishedShufflingProof) FromBytes(pspb PublishedShufflingProofBytes)
 		return err
 	}
 
-	g, err := libunlynx.FromBytesToAbstractPoints(*pspb.G)
+	g, err := libunlynx.FromBytesToNAbstractPoints(*pspb.G, 1)
 	if err != nil {
 		return err
 	}
 	psp.G = g[0]
 
-	h, err := libunlynx.FromBytesToAbstractPoints(*pspb.H)
+	h, err := libunlynx.FromBytesToNAbstractPoints(*pspb.H, 1)
 	if err != nil {
 		return err
 	}
 	psp.H = h[0]
 	psp.HashProof = pspb.HashProof
+	psp.Backend = pspb.Backend
+
+	psp.Keys = nil
+	if pspb.Keys != nil {
+		psp.Keys, err = libunlynx.FromBytesToAbstractPoints(*pspb.Keys)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ToBytes transforms PublishedShufflingListProof to bytes
+func (pslp *PublishedShufflingListProof) ToBytes() (PublishedShufflingListProofBytes, error) {
+	pslpb := PublishedShufflingListProofBytes{Version: libunlynx.ProofBytesVersion}
+	pslpb.List = make([]PublishedShufflingProofBytes, len(pslp.List))
 
+	var err error
+	mutex := sync.Mutex{}
+	wg := libunlynx.StartParallelize(len(pslp.List))
+	for i, psp := range pslp.List {
+		go func(index int, psp PublishedShufflingProof) {
+			defer wg.Done()
+			var tmpErr error
+			pslpb.List[index], tmpErr = psp.ToBytes()
+			if tmpErr != nil {
+				mutex.Lock()
+				err = tmpErr
+				mutex.Unlock()
+				return
+			}
+		}(i, psp)
+	}
+	libunlynx.EndParallelize(wg)
+
+	if err != nil {
+		return PublishedShufflingListProofBytes{}, err
+	}
+	return pslpb, nil
+}
+
+// FromBytes transforms bytes back to PublishedShufflingListProof
+func (pslp *PublishedShufflingListProof) FromBytes(pslpb PublishedShufflingListProofBytes) error {
+	if err := libunlynx.CheckProofBytesVersion(pslpb.Version); err != nil {
+		return err
+	}
+	list := make([]PublishedShufflingProof, len(pslpb.List))
+
+	var err error
+	mutex := sync.Mutex{}
+	wg := libunlynx.StartParallelize(len(pslpb.List))
+	for i, pspb := range pslpb.List {
+		go func(index int, pspb PublishedShufflingProofBytes) {
+			defer wg.Done()
+			tmp := PublishedShufflingProof{}
+			tmpErr := tmp.FromBytes(pspb)
+			if tmpErr != nil {
+				mutex.Lock()
+				err = tmpErr
+				mutex.Unlock()
+				return
+			}
+			list[index] = tmp
+		}(i, pspb)
+	}
+	libunlynx.EndParallelize(wg)
+
+	if err != nil {
+		return err
+	}
+	pslp.List = list
 	return nil
 }
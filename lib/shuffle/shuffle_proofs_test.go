@@ -47,6 +47,29 @@ func TestPublishedShufflingProof_ToBytes(t *testing.T) {
 	assert.True(t, psp.H.Equal(converted.H))
 }
 
+func TestPublishedShufflingListProof_ToBytes(t *testing.T) {
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+
+	toShuffle := []libunlynx.CipherVector{*libunlynx.EncryptIntVector(keys.Public, []int64{1, 2}), *libunlynx.EncryptIntVector(keys.Public, []int64{3, 4})}
+	shuffled, pi, beta := libunlynxshuffle.ShuffleSequence(toShuffle, libunlynx.SuiTe.Point().Base(), keys.Public, nil)
+	psp, err := libunlynxshuffle.ShuffleProofCreation(toShuffle, shuffled, libunlynx.SuiTe.Point().Base(), keys.Public, beta, pi)
+	assert.NoError(t, err)
+	pslp := libunlynxshuffle.PublishedShufflingListProof{List: []libunlynxshuffle.PublishedShufflingProof{psp, psp}}
+
+	pslpb, err := pslp.ToBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, libunlynx.ProofBytesVersion, pslpb.Version)
+
+	converted := libunlynxshuffle.PublishedShufflingListProof{}
+	assert.NoError(t, converted.FromBytes(pslpb))
+	assert.True(t, libunlynxshuffle.ShuffleListProofVerification(converted, keys.Public, 1.0))
+
+	pslpb.List[1].G = nil
+	assert.Error(t, converted.FromBytes(pslpb))
+	pslpb.Version = 0
+	assert.Error(t, converted.FromBytes(pslpb))
+}
+
 func TestShufflingProof(t *testing.T) {
 	keys := key.NewKeyPair(libunlynx.SuiTe)
 
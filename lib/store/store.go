@@ -29,6 +29,9 @@ type Store struct {
 	lastID uint64
 }
 
+// MergedGroupingKey is the grouping key of the group that contains the merged suppressed groups
+const MergedGroupingKey = libunlynx.GroupingKey("merged")
+
 // GroupingKeyTuple contains two grouping key
 type GroupingKeyTuple struct {
 	gkt1 libunlynx.GroupingKey
@@ -102,6 +105,23 @@ func (s *Store) InsertDpResponse(cr libunlynx.DpResponse, proofsB bool, groupBy,
 	}
 }
 
+// MergeDpResponses adds the DP responses of another store (e.g. the responses staged during an upload) to the store
+func (s *Store) MergeDpResponses(other *Store) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	s.DpResponses = append(s.DpResponses, other.DpResponses...)
+	for k, v := range other.DpResponsesAggr {
+		if value, ok := s.DpResponsesAggr[k]; ok {
+			tmp := libunlynx.NewCipherVector(len(value.AggregatingAttributes))
+			tmp.Add(value.AggregatingAttributes, v.AggregatingAttributes)
+			value.AggregatingAttributes = *tmp
+			s.DpResponsesAggr[k] = value
+		} else {
+			s.DpResponsesAggr[k] = v
+		}
+	}
+}
+
 // HasNextDpResponse permits to verify if there are new DP responses to be processed.
 func (s *Store) HasNextDpResponse() bool {
 	return len(s.DpResponses) > 0
@@ -129,8 +149,9 @@ func (s *Store) PullShuffledProcessResponses() []libunlynx.ProcessResponse {
 	return result
 }
 
-// PushDeterministicFilteredResponses permits to store results of deterministic tagging
-func (s *Store) PushDeterministicFilteredResponses(detFilteredResponses []libunlynx.FilteredResponseDet, serverName string, proofsB bool) {
+// PushDeterministicFilteredResponses permits to store results of deterministic tagging. If proofsB, it returns the
+// proofs of the local aggregation.
+func (s *Store) PushDeterministicFilteredResponses(detFilteredResponses []libunlynx.FilteredResponseDet, serverName string, proofsB bool) libunlynxaggr.PublishedAggregationListProof {
 
 	round := libunlynx.StartTimer(serverName + "_ServerLocalAggregation")
 
@@ -145,13 +166,16 @@ func (s *Store) PushDeterministicFilteredResponses(detFilteredResponses []libunl
 		}
 
 	}
+	proofs := libunlynxaggr.PublishedAggregationListProof{}
 	if proofsB {
 		for k, v := range cvMap {
-			libunlynxaggr.AggregationListProofCreation(v, s.LocAggregatedProcessResponse[k].AggregatingAttributes)
+			prf := libunlynxaggr.AggregationListProofCreation(v, s.LocAggregatedProcessResponse[k].AggregatingAttributes)
+			proofs.List = append(proofs.List, prf.List...)
 		}
 	}
 
 	libunlynx.EndTimer(round)
+	return proofs
 }
 
 // HasNextAggregatedResponse verifies the presence of locally aggregated results.
@@ -253,6 +277,26 @@ func (s *Store) PushCothorityAggregatedFilteredResponses(sNew map[libunlynx.Grou
 	}
 }
 
+// SuppressCothorityAggregatedFilteredResponses removes some groups from the collectively aggregated results. If merge
+// is true, the removed groups are added together in a single group (without grouping attributes) stored with the
+// MergedGroupingKey key.
+func (s *Store) SuppressCothorityAggregatedFilteredResponses(groups []libunlynx.GroupingKey, merge bool) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	for _, key := range groups {
+		value, ok := s.GroupedDeterministicFilteredResponses[key]
+		if !ok {
+			continue
+		}
+		delete(s.GroupedDeterministicFilteredResponses, key)
+
+		if merge {
+			libunlynx.AddInMap(s.GroupedDeterministicFilteredResponses, MergedGroupingKey, libunlynx.FilteredResponse{GroupByEnc: libunlynx.CipherVector{}, AggregatingAttributes: value.AggregatingAttributes})
+		}
+	}
+}
+
 // HasNextAggregatedFilteredResponses verifies that the server has local grouping results (group attributes).
 func (s *Store) HasNextAggregatedFilteredResponses() bool {
 	return len(s.GroupedDeterministicFilteredResponses) > 0
@@ -2,6 +2,7 @@ package libunlynxstore_test
 
 import (
 	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/aggregation"
 	. "github.com/ldsec/unlynx/lib/store"
 	"github.com/ldsec/unlynx/lib/tools"
 	"github.com/ldsec/unlynx/protocols"
@@ -83,6 +84,17 @@ func TestStoring(t *testing.T) {
 	// (3) Test empty
 	storage.PullLocallyAggregatedResponses()
 
+	// (3) Test merging staged DpResponses
+	staged := NewStore()
+	staged.InsertDpResponse(libunlynx.DpResponse{GroupByEnc: testEncMap, WhereClear: testClearMap, AggregatingAttributesEnc: testAggrMap1}, true, groupBy, sum, where)
+	staged.InsertDpResponse(libunlynx.DpResponse{GroupByClear: testClearMap, WhereClear: testClearMap, AggregatingAttributesEnc: testAggrMap2}, true, groupBy, sum, where)
+	storage.MergeDpResponses(staged)
+
+	sum1.Add(*sum1, testAggr2)
+	result = storage.PullDpResponses()
+	assert.True(t, len(result) == 2)
+	assert.Equal(t, result[1].AggregatingAttributes, *sum1)
+
 	// (4) Test Insert and Pull DpResponses but with different parameters
 	storage = NewStore()
 
@@ -118,7 +130,9 @@ func TestStoring(t *testing.T) {
 	assert.NoError(t, err)
 	detResponses[2] = libunlynx.FilteredResponseDet{Fr: libunlynx.FilteredResponse{GroupByEnc: testAggr2, AggregatingAttributes: testAggr1}, DetTagGroupBy: dtgb}
 
-	storage.PushDeterministicFilteredResponses(detResponses, "ServerTest", true)
+	aggregationProofs := storage.PushDeterministicFilteredResponses(detResponses, "ServerTest", true)
+	assert.Equal(t, 2*len(testAggr1), len(aggregationProofs.List))
+	assert.True(t, libunlynxaggr.AggregationListProofVerification(aggregationProofs, 1.0))
 
 	assert.True(t, len(storage.PullLocallyAggregatedResponses()) == 2)
 	assert.Empty(t, storage.LocAggregatedProcessResponse, 0)
@@ -157,3 +171,27 @@ func TestConvertDataToMap(t *testing.T) {
 
 	assert.Equal(t, result, libunlynxtools.ConvertDataToMap(test, "g", 0), "Wrong map conversion")
 }
+
+// TestSuppressCothorityAggregatedFilteredResponses tests the removal (and merging) of aggregated groups
+func TestSuppressCothorityAggregatedFilteredResponses(t *testing.T) {
+	secKey, pubKey := libunlynx.GenKey()
+
+	groups := map[libunlynx.GroupingKey]libunlynx.FilteredResponse{
+		"a": {GroupByEnc: *libunlynx.EncryptIntVector(pubKey, []int64{0}), AggregatingAttributes: *libunlynx.EncryptIntVector(pubKey, []int64{1, 2})},
+		"b": {GroupByEnc: *libunlynx.EncryptIntVector(pubKey, []int64{1}), AggregatingAttributes: *libunlynx.EncryptIntVector(pubKey, []int64{3, 4})},
+		"c": {GroupByEnc: *libunlynx.EncryptIntVector(pubKey, []int64{2}), AggregatingAttributes: *libunlynx.EncryptIntVector(pubKey, []int64{5, 6})},
+	}
+
+	storage := NewStore()
+	storage.PushCothorityAggregatedFilteredResponses(groups)
+	storage.SuppressCothorityAggregatedFilteredResponses([]libunlynx.GroupingKey{"a"}, false)
+	assert.Equal(t, 2, len(storage.GroupedDeterministicFilteredResponses))
+	_, ok := storage.GroupedDeterministicFilteredResponses["a"]
+	assert.False(t, ok)
+
+	storage.SuppressCothorityAggregatedFilteredResponses([]libunlynx.GroupingKey{"b", "c", "d"}, true)
+	assert.Equal(t, 1, len(storage.GroupedDeterministicFilteredResponses))
+	merged := storage.GroupedDeterministicFilteredResponses[MergedGroupingKey]
+	assert.Empty(t, merged.GroupByEnc)
+	assert.Equal(t, []int64{8, 10}, libunlynx.DecryptIntVector(secKey, &merged.AggregatingAttributes))
+}
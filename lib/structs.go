@@ -2,6 +2,7 @@
 package libunlynx
 
 import (
+	"sort"
 	"strconv"
 	"strings"
 
@@ -45,6 +46,10 @@ type DpResponseToSend struct {
 	GroupByEnc                 map[string][]byte
 	AggregatingAttributesClear map[string]int64
 	AggregatingAttributesEnc   map[string][]byte
+	// RangeProofs contains the range proofs (see lib/range_proof) of encrypted aggregating attributes
+	RangeProofs map[string][]byte
+	// EncryptionProofs contains the proofs of correct encryption (see lib/encryption_proof) of encrypted attributes
+	EncryptionProofs map[string][]byte
 }
 
 // ProcessResponse is a response in the format used for shuffling and det tag
@@ -192,6 +197,65 @@ func EncryptDpClearResponse(ccr DpClearResponse, encryptionKey kyber.Point, coun
 	return cr, nil
 }
 
+// PreAggregateDpClearResponses aggregates (at the DP) the responses whose where and group by attributes are all in
+// clear, so that only one response per clear group has to be encrypted and sent. The responses with encrypted where or
+// group by attributes are kept as they are. If count is true, the count attribute (the number of aggregated responses)
+// is added to all the responses, which then have to be encrypted without adding the count (see EncryptDpClearResponse).
+func PreAggregateDpClearResponses(dcrs []DpClearResponse, count bool) []DpClearResponse {
+	result := make([]DpClearResponse, 0)
+	groups := make(map[string]int)
+	for _, v := range dcrs {
+		if len(v.WhereEnc) > 0 || len(v.GroupByEnc) > 0 {
+			if count {
+				v.AggregatingAttributesEnc = addToAttributes(nil, v.AggregatingAttributesEnc)
+				v.AggregatingAttributesEnc["count"] = 1
+			}
+			result = append(result, v)
+			continue
+		}
+
+		key := clearAttributesKey(v.WhereClear) + SEPARATOR + clearAttributesKey(v.GroupByClear)
+		index, ok := groups[key]
+		if !ok {
+			index = len(result)
+			groups[key] = index
+			result = append(result, DpClearResponse{WhereClear: v.WhereClear, GroupByClear: v.GroupByClear})
+		}
+		result[index].AggregatingAttributesClear = addToAttributes(result[index].AggregatingAttributesClear, v.AggregatingAttributesClear)
+		result[index].AggregatingAttributesEnc = addToAttributes(result[index].AggregatingAttributesEnc, v.AggregatingAttributesEnc)
+		if count {
+			result[index].AggregatingAttributesEnc["count"]++
+		}
+	}
+	return result
+}
+
+// addToAttributes adds the values of the attributes in added to the ones in attributes (in a new map if it is nil)
+func addToAttributes(attributes, added map[string]int64) map[string]int64 {
+	if attributes == nil {
+		attributes = make(map[string]int64, len(added))
+	}
+	for k, v := range added {
+		attributes[k] += v
+	}
+	return attributes
+}
+
+// clearAttributesKey returns a string identifying the values of a set of clear attributes (independently of the order)
+func clearAttributesKey(attributes map[string]int64) string {
+	names := make([]string, 0, len(attributes))
+	for k := range attributes {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var key []string
+	for _, k := range names {
+		key = append(key, k+"="+strconv.FormatInt(attributes[k], 10))
+	}
+	return strings.Join(key, ",")
+}
+
 // GroupingKey
 //______________________________________________________________________________________________________________________
 
@@ -267,3 +267,26 @@ func TestMapBytesToMapCipherText(t *testing.T) {
 		assert.Equal(t, libunlynx.DecryptInt(secKey, ctMap[strconv.Itoa(i)]), int64(i))
 	}
 }
+
+func TestPreAggregateDpClearResponses(t *testing.T) {
+	dcrs := []libunlynx.DpClearResponse{
+		{WhereClear: map[string]int64{"w1": 1}, GroupByClear: map[string]int64{"g1": 0, "g2": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 2}},
+		{WhereClear: map[string]int64{"w1": 1}, GroupByClear: map[string]int64{"g2": 1, "g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 3}, AggregatingAttributesClear: map[string]int64{"s2": 1}},
+		{WhereClear: map[string]int64{"w1": 2}, GroupByClear: map[string]int64{"g1": 0, "g2": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 4}},
+		{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 5}},
+	}
+
+	result := libunlynx.PreAggregateDpClearResponses(dcrs, true)
+	assert.Equal(t, 3, len(result))
+	assert.Equal(t, map[string]int64{"s1": 5, "count": 2}, result[0].AggregatingAttributesEnc)
+	assert.Equal(t, map[string]int64{"s2": 1}, result[0].AggregatingAttributesClear)
+	assert.Equal(t, map[string]int64{"s1": 4, "count": 1}, result[1].AggregatingAttributesEnc)
+	// responses with encrypted attributes are not aggregated
+	assert.Equal(t, map[string]int64{"s1": 5, "count": 1}, result[2].AggregatingAttributesEnc)
+	// the original responses are not modified
+	assert.Equal(t, map[string]int64{"s1": 2}, dcrs[0].AggregatingAttributesEnc)
+	assert.Equal(t, map[string]int64{"s1": 5}, dcrs[3].AggregatingAttributesEnc)
+
+	result = libunlynx.PreAggregateDpClearResponses(dcrs, false)
+	assert.Equal(t, map[string]int64{"s1": 5}, result[0].AggregatingAttributesEnc)
+}
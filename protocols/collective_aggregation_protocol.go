@@ -4,12 +4,18 @@
 // 2. the leafs respond with their local result;
 // 3. parent nodes aggregate the information from their children;
 // 4. these nodes forward the aggregation result up the tree.
+//
+// With a timeout, the nodes stop waiting for their children after a delay proportional to the height of their subtree
+// and the subtrees which did not respond in time are reported as missing with the result. The missing servers reported
+// by a child have to be whole subtrees below it, otherwise its data is dropped (and its whole subtree is missing).
 
 package protocolsunlynx
 
 import (
 	"errors"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/ldsec/unlynx/lib"
 	"github.com/ldsec/unlynx/lib/aggregation"
@@ -40,10 +46,14 @@ func init() {
 // CothorityAggregatedData is the collective aggregation result.
 type CothorityAggregatedData struct {
 	GroupedData map[libunlynx.GroupingKey]libunlynx.FilteredResponse
+	// Missing are the servers whose data is not in the result (the subtrees which did not respond in time)
+	Missing []*network.ServerIdentity
 }
 
 // DataReferenceMessage message sent to trigger an aggregation protocol.
-type DataReferenceMessage struct{}
+type DataReferenceMessage struct {
+	Timeout time.Duration
+}
 
 // ChildAggregatedDataMessage contains one node's aggregated data.
 type ChildAggregatedDataMessage struct {
@@ -53,6 +63,8 @@ type ChildAggregatedDataMessage struct {
 // ChildAggregatedDataBytesMessage is ChildAggregatedDataMessage in bytes.
 type ChildAggregatedDataBytesMessage struct {
 	Data []byte
+	// Missing are the roster indexes of the servers of the subtree whose data is not in the message
+	Missing []int64
 }
 
 // CADBLengthMessage is a message containing the lengths to read a shuffling message in bytes
@@ -95,12 +107,22 @@ type CollectiveAggregationProtocol struct {
 
 	// Protocol communication channels
 	DataReferenceChannel chan dataReferenceStruct
-	LengthNodeChannel    chan []cadmbLengthStruct
-	ChildDataChannel     chan []childAggregatedDataBytesStruct
+	LengthNodeChannel    chan cadmbLengthStruct
+	ChildDataChannel     chan childAggregatedDataBytesStruct
 
 	// Protocol state data
 	GroupedData *map[libunlynx.GroupingKey]libunlynx.FilteredResponse
 	SimpleData  *[]libunlynx.CipherText
+	// GroupedDataFunc gives the data of the node (once the announcement is forwarded) when no data is given beforehand,
+	// e.g. to wait for it without delaying the children
+	GroupedDataFunc func() map[libunlynx.GroupingKey]libunlynx.FilteredResponse
+
+	// Timeout is how long the root waits for the data of its children (0 to wait for all of them), the other nodes wait
+	// proportionally to the height of their subtree. It only has to be set at the root.
+	Timeout time.Duration
+	timeout time.Duration
+	// announced gives (at the root) the children which could not be reached by the announcement
+	announced chan []*onet.TreeNode
 
 	// Proofs
 	Proofs    bool
@@ -113,6 +135,7 @@ func NewCollectiveAggregationProtocol(n *onet.TreeNodeInstance) (onet.ProtocolIn
 	pap := &CollectiveAggregationProtocol{
 		TreeNodeInstance: n,
 		FeedbackChannel:  make(chan CothorityAggregatedData),
+		announced:        make(chan []*onet.TreeNode, 1),
 	}
 
 	err := pap.RegisterChannel(&pap.DataReferenceChannel)
@@ -135,27 +158,43 @@ func NewCollectiveAggregationProtocol(n *onet.TreeNodeInstance) (onet.ProtocolIn
 // Start is called at the root to begin the execution of the protocol.
 func (p *CollectiveAggregationProtocol) Start() error {
 	log.Lvl1(p.ServerIdentity(), " started a Colective Aggregation Protocol")
-	if err := p.SendToChildren(&DataReferenceMessage{}); err != nil {
-		return errors.New("Error sending <DataReferenceMessage>:" + err.Error())
+	p.timeout = p.Timeout
+	unreachable, err := p.sendToChildren(&DataReferenceMessage{Timeout: p.Timeout})
+	if err != nil {
+		return err
 	}
+	p.announced <- unreachable
 	return nil
 }
 
 // Dispatch is called at each node and handle incoming messages.
 func (p *CollectiveAggregationProtocol) Dispatch() error {
 	defer p.Done()
-	err := p.checkData()
-	if err != nil {
-		return err
-	}
 
 	// 1. Aggregation announcement phase
-	if !p.IsRoot() {
-		err := p.aggregationAnnouncementPhase()
+	var unreachable []*onet.TreeNode
+	if p.IsRoot() {
+		unreachable = <-p.announced
+	} else {
+		var err error
+		unreachable, err = p.aggregationAnnouncementPhase()
 		if err != nil {
 			return err
 		}
 	}
+	var deadline <-chan time.Time
+	if p.timeout > 0 && !p.IsLeaf() {
+		deadline = time.After(p.timeout * time.Duration(subtreeHeight(p.TreeNode())) / time.Duration(subtreeHeight(p.Root())))
+	}
+
+	if p.GroupedData == nil && p.SimpleData == nil && p.GroupedDataFunc != nil {
+		groupedData := p.GroupedDataFunc()
+		p.GroupedData = &groupedData
+	}
+	err := p.checkData()
+	if err != nil {
+		return err
+	}
 
 	// 3. Proof generation (a) - before local aggregation
 	cvMap := make(map[libunlynx.GroupingKey][]libunlynx.CipherVector)
@@ -169,60 +208,122 @@ func (p *CollectiveAggregationProtocol) Dispatch() error {
 	}
 
 	// 2. Ascending aggregation phase
-	aggregatedData, err := p.ascendingAggregationPhase(cvMap)
+	aggregatedData, missing, err := p.ascendingAggregationPhase(cvMap, unreachable, deadline)
 	if err != nil {
 		return err
 	}
 	log.Lvl1(p.ServerIdentity(), " completed aggregation phase (", len(*aggregatedData), "group(s) )")
 
-	// 3. Proof generation (b) - after local aggregation
-	if p.Proofs {
-		data := make([]libunlynx.CipherVector, 0)
-		dataRes := make(libunlynx.CipherVector, 0)
-		for k, v := range cvMap {
-			data = append(data, v...)
-			dataRes = append(dataRes, (*aggregatedData)[k].AggregatingAttributes...)
-		}
-		p.ProofFunc(data, dataRes)
-	}
-
 	// 3. Result reporting
 	if p.IsRoot() {
-		p.FeedbackChannel <- CothorityAggregatedData{*aggregatedData}
+		// the missing servers are checked against the subtrees of the tree (see checkMissing)
+		isMissing := make(map[int64]bool, len(missing))
+		for _, index := range missing {
+			isMissing[index] = true
+		}
+		result := CothorityAggregatedData{GroupedData: *aggregatedData}
+		for _, tn := range p.Tree().List() {
+			if isMissing[int64(tn.RosterIndex)] {
+				result.Missing = append(result.Missing, tn.ServerIdentity)
+			}
+		}
+		p.FeedbackChannel <- result
 	}
 	return nil
 }
 
 // Announce forwarding down the tree.
-func (p *CollectiveAggregationProtocol) aggregationAnnouncementPhase() error {
+func (p *CollectiveAggregationProtocol) aggregationAnnouncementPhase() ([]*onet.TreeNode, error) {
 	dataReferenceMessage := <-p.DataReferenceChannel
+	p.timeout = dataReferenceMessage.Timeout
 	if !p.IsLeaf() {
-		if err := p.SendToChildren(&dataReferenceMessage.DataReferenceMessage); err != nil {
-			return errors.New("Error sending <DataReferenceMessage>:" + err.Error())
+		return p.sendToChildren(&dataReferenceMessage.DataReferenceMessage)
+	}
+	return nil, nil
+}
+
+// sendToChildren sends the announcement to the children. Without a timeout, an error is returned if a child can not be
+// reached, otherwise the children which can not be reached are returned.
+func (p *CollectiveAggregationProtocol) sendToChildren(msg *DataReferenceMessage) ([]*onet.TreeNode, error) {
+	if p.timeout == 0 {
+		if err := p.SendToChildren(msg); err != nil {
+			return nil, errors.New("Error sending <DataReferenceMessage>:" + err.Error())
 		}
+		return nil, nil
 	}
-	return nil
+
+	var unreachable []*onet.TreeNode
+	mutex := sync.Mutex{}
+	wg := libunlynx.StartParallelize(len(p.Children()))
+	for _, child := range p.Children() {
+		go func(child *onet.TreeNode) {
+			defer wg.Done()
+			if err := p.SendTo(child, msg); err != nil {
+				log.Error("Error sending <DataReferenceMessage> to ", child.ServerIdentity, ":", err)
+				mutex.Lock()
+				unreachable = append(unreachable, child)
+				mutex.Unlock()
+			}
+		}(child)
+	}
+	libunlynx.EndParallelize(wg)
+	return unreachable, nil
+}
+
+// receiveChildren waits for the data of the children (except the unreachable ones) until the deadline (if any) and
+// returns the contributions of the children who sent all their messages
+func (p *CollectiveAggregationProtocol) receiveChildren(unreachable []*onet.TreeNode, deadline <-chan time.Time) (map[onet.TreeNodeID]cadmbLengthStruct, map[onet.TreeNodeID]childAggregatedDataBytesStruct) {
+	lengths := make(map[onet.TreeNodeID]cadmbLengthStruct)
+	datas := make(map[onet.TreeNodeID]childAggregatedDataBytesStruct)
+
+	received := 0
+	for received < len(p.Children())-len(unreachable) {
+		select {
+		case v := <-p.LengthNodeChannel:
+			lengths[v.TreeNode.ID] = v
+			if _, ok := datas[v.TreeNode.ID]; ok {
+				received++
+			}
+		case v := <-p.ChildDataChannel:
+			datas[v.TreeNode.ID] = v
+			if _, ok := lengths[v.TreeNode.ID]; ok {
+				received++
+			}
+		case <-deadline:
+			log.Warn(p.ServerIdentity(), " stopped waiting for its children in the collective aggregation")
+			return lengths, datas
+		}
+	}
+	return lengths, datas
 }
 
-// Results pushing up the tree containing aggregation results.
-func (p *CollectiveAggregationProtocol) ascendingAggregationPhase(cvMap map[libunlynx.GroupingKey][]libunlynx.CipherVector) (*map[libunlynx.GroupingKey]libunlynx.FilteredResponse, error) {
+// Results pushing up the tree containing aggregation results. Returns also the roster indexes of the servers of the
+// subtree whose data is missing.
+func (p *CollectiveAggregationProtocol) ascendingAggregationPhase(cvMap map[libunlynx.GroupingKey][]libunlynx.CipherVector, unreachable []*onet.TreeNode, deadline <-chan time.Time) (*map[libunlynx.GroupingKey]libunlynx.FilteredResponse, []int64, error) {
 	roundTotComput := libunlynx.StartTimer(p.Name() + "_CollectiveAggregation(ascendingAggregation)")
 
+	var missing []int64
 	if !p.IsLeaf() {
-		length := make([]cadmbLengthStruct, 0)
-		for _, v := range <-p.LengthNodeChannel {
-			length = append(length, v)
-		}
-		datas := make([]childAggregatedDataBytesStruct, 0)
-		for _, v := range <-p.ChildDataChannel {
-			datas = append(datas, v)
-		}
+		length, datas := p.receiveChildren(unreachable, deadline)
+
+		for _, child := range p.Children() {
+			v, okLength := length[child.ID]
+			data, okData := datas[child.ID]
+			if !okLength || !okData {
+				missing = append(missing, subtreeRosterIndexes(child)...)
+				continue
+			}
+			if err := checkMissing(child, data.Missing); err != nil {
+				log.Error(p.ServerIdentity(), " dropped the data of ", child.ServerIdentity, ": ", err)
+				missing = append(missing, subtreeRosterIndexes(child)...)
+				continue
+			}
+			missing = append(missing, data.Missing...)
 
-		for i, v := range length {
 			childrenContribution := ChildAggregatedDataMessage{}
-			err := childrenContribution.FromBytes(datas[i].Data, v.GacbLength, v.AabLength, v.DtbLength)
+			err := childrenContribution.FromBytes(data.Data, v.GacbLength, v.AabLength, v.DtbLength)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
 			roundComput := libunlynx.StartTimer(p.Name() + "_CollectiveAggregation(Aggregation)")
@@ -254,6 +355,18 @@ func (p *CollectiveAggregationProtocol) ascendingAggregationPhase(cvMap map[libu
 
 	libunlynx.EndTimer(roundTotComput)
 
+	// 3. Proof generation (b) - after local aggregation (before sending the result so that the proofs of all the nodes are
+	// created when the protocol ends)
+	if p.Proofs {
+		data := make([]libunlynx.CipherVector, 0)
+		dataRes := make(libunlynx.CipherVector, 0)
+		for k, v := range cvMap {
+			data = append(data, v...)
+			dataRes = append(dataRes, (*p.GroupedData)[k].AggregatingAttributes...)
+		}
+		p.ProofFunc(data, dataRes)
+	}
+
 	if !p.IsRoot() {
 		detAggrResponses := make([]libunlynx.FilteredResponseDet, len(*p.GroupedData))
 		count := 0
@@ -263,31 +376,92 @@ func (p *CollectiveAggregationProtocol) ascendingAggregationPhase(cvMap map[libu
 			count++
 		}
 
-		message := ChildAggregatedDataBytesMessage{}
+		message := ChildAggregatedDataBytesMessage{Missing: missing}
 
 		var gacbLength, aabLength, dtbLength int
 		var err error
 
 		message.Data, gacbLength, aabLength, dtbLength, err = (&ChildAggregatedDataMessage{detAggrResponses}).ToBytes()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		childrenContribution := ChildAggregatedDataMessage{}
 		err = childrenContribution.FromBytes(message.Data, gacbLength, aabLength, dtbLength)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if err := p.SendToParent(&CADBLengthMessage{gacbLength, aabLength, dtbLength}); err != nil {
-			return nil, errors.New("Error sending <CADBLengthMessage>:" + err.Error())
+			return nil, nil, errors.New("Error sending <CADBLengthMessage>:" + err.Error())
 		}
 		if err := p.SendToParent(&message); err != nil {
-			return nil, errors.New("Error sending <ChildAggregatedDataMessage>:" + err.Error())
+			return nil, nil, errors.New("Error sending <ChildAggregatedDataMessage>:" + err.Error())
 		}
 	}
 
-	return p.GroupedData, nil
+	return p.GroupedData, missing, nil
+}
+
+// subtreeHeight returns the height of the subtree of a tree node (0 for a leaf)
+func subtreeHeight(tn *onet.TreeNode) int {
+	height := 0
+	for _, child := range tn.Children {
+		if h := subtreeHeight(child) + 1; h > height {
+			height = h
+		}
+	}
+	return height
+}
+
+// subtreeRosterIndexes returns the roster indexes of the servers of the subtree of a tree node
+func subtreeRosterIndexes(tn *onet.TreeNode) []int64 {
+	indexes := []int64{int64(tn.RosterIndex)}
+	for _, child := range tn.Children {
+		indexes = append(indexes, subtreeRosterIndexes(child)...)
+	}
+	return indexes
+}
+
+// checkMissing checks the roster indexes of the missing servers reported by a child: they have to be servers of its
+// subtree (except the child itself, which sent the data), each one once, and the servers below a missing server are
+// missing too as their data is aggregated by it
+func checkMissing(child *onet.TreeNode, missing []int64) error {
+	reported := make(map[int64]bool, len(missing))
+	for _, index := range missing {
+		if reported[index] {
+			return errors.New("server " + strconv.FormatInt(index, 10) + " reported missing twice")
+		}
+		reported[index] = true
+	}
+	if reported[int64(child.RosterIndex)] {
+		return errors.New("the child reported itself missing")
+	}
+
+	found := 0
+	var check func(tn *onet.TreeNode, parentMissing bool) error
+	check = func(tn *onet.TreeNode, parentMissing bool) error {
+		for _, c := range tn.Children {
+			isMissing := reported[int64(c.RosterIndex)]
+			if parentMissing && !isMissing {
+				return errors.New("server " + strconv.Itoa(c.RosterIndex) + " not reported missing below a missing server")
+			}
+			if isMissing {
+				found++
+			}
+			if err := check(c, isMissing); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := check(child, false); err != nil {
+		return err
+	}
+	if found != len(reported) {
+		return errors.New("servers out of the subtree of the child reported missing")
+	}
+	return nil
 }
 
 // Setup and return the data needed in the aggregation to a usable format
@@ -182,3 +182,174 @@ func NewCollectiveAggregationTestSimple(tni *onet.TreeNodeInstance) (onet.Protoc
 
 	return protocol, err
 }
+
+// blockedAggregationNode is the tree node whose data is only given once blockedAggregationRelease is closed
+var blockedAggregationNode onet.TreeNodeID
+var blockedAggregationRelease = make(chan struct{})
+
+//TestCollectiveAggregationTimeout tests collective aggregation protocol with a subtree which does not respond in time
+func TestCollectiveAggregationTimeout(t *testing.T) {
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+
+	// You must register this protocol before creating the servers
+	_, err := onet.GlobalProtocolRegister("CollectiveAggregationTestTimeout", NewCollectiveAggregationTestTimeout)
+	assert.NoError(t, err, "Error registering <CollectiveAggregationTestTimeout>")
+
+	_, _, tree := local.GenBigTree(7, 7, 3, true)
+	defer local.CloseAll()
+
+	blocked := tree.Root.Children[0]
+	blockedAggregationNode = blocked.ID
+	defer close(blockedAggregationRelease)
+
+	expectedMissing := []*network.ServerIdentity{blocked.ServerIdentity}
+	for _, child := range blocked.Children {
+		expectedMissing = append(expectedMissing, child.ServerIdentity)
+	}
+
+	p, err := local.CreateProtocol("CollectiveAggregationTestTimeout", tree)
+	assert.NoError(t, err)
+
+	protocol := p.(*protocolsunlynx.CollectiveAggregationProtocol)
+	protocol.Timeout = 2 * time.Second
+
+	//run protocol
+	go func() {
+		err := protocol.Start()
+		assert.NoError(t, err)
+	}()
+	timeout := network.WaitRetry * time.Duration(network.MaxRetryConnect*10) * time.Millisecond
+
+	feedback := protocol.FeedbackChannel
+
+	select {
+	case encryptedResult := <-feedback:
+		assert.ElementsMatch(t, expectedMissing, encryptedResult.Missing)
+
+		v := encryptedResult.GroupedData[groupingAttrA.Key()]
+		resultData := libunlynx.DecryptIntVector(clientPrivate, &v.AggregatingAttributes)
+		assert.Equal(t, []int64{int64(tree.Size() - len(expectedMissing))}, resultData)
+	case <-time.After(timeout):
+		t.Fatal("Didn't finish in time")
+	}
+}
+
+// NewCollectiveAggregationTestTimeout is a test specific protocol instance constructor that gives the data through a
+// function, blocking for one of the nodes.
+func NewCollectiveAggregationTestTimeout(tni *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	pi, err := protocolsunlynx.NewCollectiveAggregationProtocol(tni)
+	protocol := pi.(*protocolsunlynx.CollectiveAggregationProtocol)
+
+	protocol.GroupedDataFunc = func() map[libunlynx.GroupingKey]libunlynx.FilteredResponse {
+		if tni.TreeNode().ID.Equal(blockedAggregationNode) {
+			<-blockedAggregationRelease
+		}
+		testCVMap := make(map[libunlynx.GroupingKey]libunlynx.FilteredResponse)
+		testCVMap[groupingAttrA.Key()] = libunlynx.FilteredResponse{GroupByEnc: *libunlynx.EncryptIntVector(clientPublic, []int64{1, 1}), AggregatingAttributes: *libunlynx.EncryptIntVector(clientPublic, []int64{1})}
+		return testCVMap
+	}
+
+	return protocol, err
+}
+
+// forgedAggregationMissing are the missing servers reported by the tree nodes which forge their data
+var forgedAggregationMissing map[onet.TreeNodeID][]int64
+
+//TestCollectiveAggregationForgedMissing tests collective aggregation protocol with children which report missing servers
+//out of their subtree
+func TestCollectiveAggregationForgedMissing(t *testing.T) {
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+
+	// You must register this protocol before creating the servers
+	_, err := onet.GlobalProtocolRegister("CollectiveAggregationTestForged", NewCollectiveAggregationTestForged)
+	assert.NoError(t, err, "Error registering <CollectiveAggregationTestForged>")
+
+	_, _, tree := local.GenBigTree(7, 7, 3, true)
+	defer local.CloseAll()
+
+	// a child of the root reports another subtree missing, another one a server which is not in the roster
+	forged := tree.Root.Children[1:]
+	forgedAggregationMissing = map[onet.TreeNodeID][]int64{
+		forged[0].ID: {int64(forged[1].RosterIndex)},
+		forged[1].ID: {int64(len(tree.Roster.List))},
+	}
+	var expectedMissing []*network.ServerIdentity
+	for _, child := range forged {
+		expectedMissing = append(expectedMissing, child.ServerIdentity)
+		for _, grandChild := range child.Children {
+			expectedMissing = append(expectedMissing, grandChild.ServerIdentity)
+		}
+	}
+
+	p, err := local.CreateProtocol("CollectiveAggregationTestForged", tree)
+	assert.NoError(t, err)
+
+	protocol := p.(*protocolsunlynx.CollectiveAggregationProtocol)
+
+	//run protocol
+	go func() {
+		err := protocol.Start()
+		assert.NoError(t, err)
+	}()
+	timeout := network.WaitRetry * time.Duration(network.MaxRetryConnect*10) * time.Millisecond
+
+	feedback := protocol.FeedbackChannel
+
+	select {
+	case encryptedResult := <-feedback:
+		// the data of the subtrees of the forged children is dropped
+		assert.ElementsMatch(t, expectedMissing, encryptedResult.Missing)
+
+		v := encryptedResult.GroupedData[groupingAttrA.Key()]
+		resultData := libunlynx.DecryptIntVector(clientPrivate, &v.AggregatingAttributes)
+		assert.Equal(t, []int64{int64(tree.Size() - len(expectedMissing))}, resultData)
+	case <-time.After(timeout):
+		t.Fatal("Didn't finish in time")
+	}
+}
+
+// forgedAggregationStruct is the announcement received by a forgedAggregationProtocol
+type forgedAggregationStruct struct {
+	*onet.TreeNode
+	protocolsunlynx.DataReferenceMessage
+}
+
+// forgedAggregationProtocol answers the announcement of the collective aggregation with no data and the missing
+// servers of forgedAggregationMissing
+type forgedAggregationProtocol struct {
+	*onet.TreeNodeInstance
+	DataReferenceChannel chan forgedAggregationStruct
+}
+
+// Start does nothing as the protocol is not run at the root
+func (p *forgedAggregationProtocol) Start() error {
+	return nil
+}
+
+// Dispatch answers the announcement
+func (p *forgedAggregationProtocol) Dispatch() error {
+	defer p.Done()
+	<-p.DataReferenceChannel
+	if err := p.SendToParent(&protocolsunlynx.CADBLengthMessage{}); err != nil {
+		return err
+	}
+	return p.SendToParent(&protocolsunlynx.ChildAggregatedDataBytesMessage{Missing: forgedAggregationMissing[p.TreeNode().ID]})
+}
+
+// NewCollectiveAggregationTestForged is a test specific protocol instance constructor that forges the data of the nodes
+// of forgedAggregationMissing.
+func NewCollectiveAggregationTestForged(tni *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	if _, ok := forgedAggregationMissing[tni.TreeNode().ID]; ok {
+		fap := &forgedAggregationProtocol{TreeNodeInstance: tni}
+		return fap, tni.RegisterChannel(&fap.DataReferenceChannel)
+	}
+
+	pi, err := protocolsunlynx.NewCollectiveAggregationProtocol(tni)
+	protocol := pi.(*protocolsunlynx.CollectiveAggregationProtocol)
+
+	testCVMap := make(map[libunlynx.GroupingKey]libunlynx.FilteredResponse)
+	testCVMap[groupingAttrA.Key()] = libunlynx.FilteredResponse{GroupByEnc: *libunlynx.EncryptIntVector(clientPublic, []int64{1, 1}), AggregatingAttributes: *libunlynx.EncryptIntVector(clientPublic, []int64{1})}
+	protocol.GroupedData = &testCVMap
+
+	return protocol, err
+}
@@ -8,6 +8,7 @@ package protocolsunlynx
 
 import (
 	"errors"
+	"strconv"
 	"sync"
 	"time"
 
@@ -26,6 +27,7 @@ func init() {
 	network.RegisterMessage(DeterministicTaggingMessage{})
 	network.RegisterMessage(DeterministicTaggingBytesMessage{})
 	network.RegisterMessage(DTBLengthMessage{})
+	network.RegisterMessage(DeterministicTaggingBatchMessage{})
 	network.RegisterMessage(libunlynx.ProcessResponseDet{})
 	_, err := onet.GlobalProtocolRegister(DeterministicTaggingProtocolName, NewDeterministicTaggingProtocol)
 	log.ErrFatal(err, "Failed to register the <DeterministicTagging> protocol:")
@@ -55,6 +57,17 @@ type DTBLengthMessage struct {
 	CVLengths []byte
 }
 
+// DeterministicTaggingBatchMessage is a batch of a deterministic tagging message (in bytes) when the data is streamed:
+// it contains the ciphertexts starting at position Start of the list of NbrCipherTexts ciphertexts, streamed in batches
+// of BatchSize ciphertexts, during the given round (0: addition of the secret contributions, 1: tag creation)
+type DeterministicTaggingBatchMessage struct {
+	Round          int64
+	Start          int64
+	NbrCipherTexts int64
+	BatchSize      int64
+	Data           []byte
+}
+
 // Structs
 //______________________________________________________________________________________________________________________
 
@@ -70,9 +83,19 @@ type dtmbLengthStruct struct {
 	DTBLengthMessage
 }
 
+// deterministicTaggingBatchStruct contains a batch of a deterministic tagging message
+type deterministicTaggingBatchStruct struct {
+	*onet.TreeNode
+	DeterministicTaggingBatchMessage
+}
+
 // Protocol
 //______________________________________________________________________________________________________________________
 
+// proofDeterministicTaggingFunction defines a function that does 'stuff' with the deterministic tagging proofs of a node
+// (addition proofs of the first round and creation proofs of the second round)
+type proofDeterministicTaggingFunction func(*libunlynxdetertag.PublishedDDTAdditionListProof, *libunlynxdetertag.PublishedDDTCreationListProof)
+
 // DeterministicTaggingProtocol hold the state of a deterministic tagging protocol instance.
 type DeterministicTaggingProtocol struct {
 	*onet.TreeNodeInstance
@@ -83,12 +106,17 @@ type DeterministicTaggingProtocol struct {
 	// Protocol communication channels
 	PreviousNodeInPathChannel chan deterministicTaggingBytesStruct
 	LengthNodeChannel         chan dtmbLengthStruct
+	BatchChannel              chan deterministicTaggingBatchStruct
 
 	// Protocol state data
 	nextNodeInCircuit *onet.TreeNode
 	TargetOfSwitch    *libunlynx.CipherVector
 	SurveySecretKey   *kyber.Scalar
 	Proofs            bool
+	ProofFunc         proofDeterministicTaggingFunction // proof function for when we want to do something different with the proofs (e.g. send them to a verifier)
+	// BatchSize is the number of ciphertexts per batch when the data is streamed through the circuit (0 sends the whole
+	// list in one message). It only has to be set at the root.
+	BatchSize int
 
 	ExecTime time.Duration
 }
@@ -106,6 +134,9 @@ func NewDeterministicTaggingProtocol(n *onet.TreeNodeInstance) (onet.ProtocolIns
 	if err := dsp.RegisterChannel(&dsp.LengthNodeChannel); err != nil {
 		return nil, errors.New("couldn't register data reference channel: " + err.Error())
 	}
+	if err := dsp.RegisterChannelLength(&dsp.BatchChannel, 2*MaxStreamingBatches); err != nil {
+		return nil, errors.New("couldn't register data reference channel: " + err.Error())
+	}
 
 	var i int
 	var node *onet.TreeNode
@@ -143,6 +174,10 @@ func (p *DeterministicTaggingProtocol) Start() error {
 	copy(detTarget, *p.TargetOfSwitch)
 	libunlynx.EndTimer(roundTotalStart)
 
+	if p.BatchSize > 0 {
+		return p.sendBatches(0, detTarget, p.BatchSize)
+	}
+
 	err := sendingDet(*p, DeterministicTaggingMessage{detTarget})
 	if err != nil {
 		return err
@@ -156,7 +191,13 @@ func (p *DeterministicTaggingProtocol) Dispatch() error {
 	defer p.Done()
 
 	//************ ----- first round, add value derivated from ephemeral secret to message ---- ********************
-	deterministicTaggingTargetBytesBef := <-p.PreviousNodeInPathChannel
+	// the root decides whether the data is streamed in batches
+	var deterministicTaggingTargetBytesBef deterministicTaggingBytesStruct
+	select {
+	case deterministicTaggingTargetBytesBef = <-p.PreviousNodeInPathChannel:
+	case batch := <-p.BatchChannel:
+		return p.dispatchBatches(batch)
+	}
 	deterministicTaggingTargetBef := DeterministicTaggingMessage{Data: make([]libunlynx.CipherText, 0)}
 	err := deterministicTaggingTargetBef.FromBytes(deterministicTaggingTargetBytesBef.Data)
 	if err != nil {
@@ -164,30 +205,8 @@ func (p *DeterministicTaggingProtocol) Dispatch() error {
 	}
 
 	startT := time.Now()
-	toAdd := libunlynx.SuiTe.Point().Mul(*p.SurveySecretKey, libunlynx.SuiTe.Point().Base())
-
-	mutex := sync.Mutex{}
-	wg := sync.WaitGroup{}
-	for i := 0; i < len(deterministicTaggingTargetBef.Data); i += libunlynx.VPARALLELIZE {
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			for j := 0; j < libunlynx.VPARALLELIZE && (i+j) < len(deterministicTaggingTargetBef.Data); j++ {
-				tmp := libunlynx.SuiTe.Point().Add(deterministicTaggingTargetBef.Data[i+j].C, toAdd)
-				if p.Proofs {
-					_, tmpErr := libunlynxdetertag.DeterministicTagAdditionProofCreation(deterministicTaggingTargetBef.Data[i+j].C, *p.SurveySecretKey, toAdd, tmp)
-					if tmpErr != nil {
-						mutex.Lock()
-						err = tmpErr
-						mutex.Unlock()
-						return
-					}
-				}
-				deterministicTaggingTargetBef.Data[i+j].C = tmp
-			}
-		}(i)
-	}
-	wg.Wait()
+	additionProofs := libunlynxdetertag.PublishedDDTAdditionListProof{}
+	additionProofs.List, err = p.addSecretContribution(deterministicTaggingTargetBef.Data)
 	if err != nil {
 		return err
 	}
@@ -213,31 +232,16 @@ func (p *DeterministicTaggingProtocol) Dispatch() error {
 	startT = time.Now()
 	roundTotalComputation := libunlynx.StartTimer(p.Name() + "_DetTagging(DISPATCH)")
 
-	wg = sync.WaitGroup{}
-	for i := 0; i < len(deterministicTaggingTarget.Data); i += libunlynx.VPARALLELIZE {
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			j := i + libunlynx.VPARALLELIZE
-			if j > len(deterministicTaggingTarget.Data) {
-				j = len(deterministicTaggingTarget.Data)
-			}
-			tmp := deterministicTaggingTarget.Data[i:j]
-			tmpErr := TaggingDet(&tmp, p.Private(), *p.SurveySecretKey, p.Public(), p.Proofs)
-			if tmpErr != nil {
-				mutex.Lock()
-				err = tmpErr
-				mutex.Unlock()
-				return
-			}
-			copy(deterministicTaggingTarget.Data[i:j], tmp)
-		}(i)
-	}
-	wg.Wait()
+	creationListProof, err := p.tag(deterministicTaggingTarget.Data)
 	if err != nil {
 		return err
 	}
 
+	// the proofs are handed over before the data is sent so that they are all created when the protocol ends
+	if p.Proofs && p.ProofFunc != nil {
+		p.ProofFunc(&additionProofs, &creationListProof)
+	}
+
 	var TaggedData []libunlynx.DeterministCipherText
 
 	if p.IsRoot() {
@@ -272,6 +276,212 @@ func (p *DeterministicTaggingProtocol) Dispatch() error {
 	return nil
 }
 
+// addSecretContribution adds the point derived from the survey secret of the server to each ciphertext (first round)
+// and returns the corresponding proofs (if needed)
+func (p *DeterministicTaggingProtocol) addSecretContribution(data []libunlynx.CipherText) ([]libunlynxdetertag.PublishedDDTAdditionProof, error) {
+	return addSecretContribution(data, *p.SurveySecretKey, nil, p.Proofs)
+}
+
+// addSecretContribution adds the point derived from a survey secret (times g, the base point if nil) to each ciphertext
+// and returns the corresponding proofs (if needed)
+func addSecretContribution(data []libunlynx.CipherText, surveySecret kyber.Scalar, g kyber.Point, proofs bool) ([]libunlynxdetertag.PublishedDDTAdditionProof, error) {
+	toAdd := libunlynx.SuiTe.Point().Mul(surveySecret, g)
+
+	var additionProofs []libunlynxdetertag.PublishedDDTAdditionProof
+	if proofs {
+		additionProofs = make([]libunlynxdetertag.PublishedDDTAdditionProof, len(data))
+	}
+
+	var err error
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < len(data); i += libunlynx.VPARALLELIZE {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < libunlynx.VPARALLELIZE && (i+j) < len(data); j++ {
+				tmp := libunlynx.SuiTe.Point().Add(data[i+j].C, toAdd)
+				if proofs {
+					prf, tmpErr := libunlynxdetertag.DeterministicTagAdditionProofCreationGenerator(data[i+j].C, surveySecret, g, toAdd, tmp)
+					if tmpErr != nil {
+						mutex.Lock()
+						err = tmpErr
+						mutex.Unlock()
+						return
+					}
+					additionProofs[i+j] = prf
+				}
+				data[i+j].C = tmp
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return additionProofs, nil
+}
+
+// tag performs the step of the server in the deterministic tag creation (second round) on each ciphertext and returns
+// the corresponding proofs (if needed)
+func (p *DeterministicTaggingProtocol) tag(data []libunlynx.CipherText) (libunlynxdetertag.PublishedDDTCreationListProof, error) {
+	return tagCipherTexts(data, p.Private(), *p.SurveySecretKey, p.Public(), p.Proofs)
+}
+
+// tagCipherTexts performs the step of a server (with its key pair) in the deterministic tag creation on each ciphertext
+// and returns the corresponding proofs (if needed)
+func tagCipherTexts(data []libunlynx.CipherText, private, surveySecret kyber.Scalar, public kyber.Point, proofs bool) (libunlynxdetertag.PublishedDDTCreationListProof, error) {
+	creationProofs := make([]libunlynxdetertag.PublishedDDTCreationListProof, (len(data)+libunlynx.VPARALLELIZE-1)/libunlynx.VPARALLELIZE)
+
+	var err error
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < len(data); i += libunlynx.VPARALLELIZE {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			j := i + libunlynx.VPARALLELIZE
+			if j > len(data) {
+				j = len(data)
+			}
+			tmp := libunlynx.CipherVector(data[i:j])
+			prf, tmpErr := taggingDetWithProofs(&tmp, private, surveySecret, public, proofs)
+			if tmpErr != nil {
+				mutex.Lock()
+				err = tmpErr
+				mutex.Unlock()
+				return
+			}
+			creationProofs[i/libunlynx.VPARALLELIZE] = prf
+			copy(data[i:j], tmp)
+		}(i)
+	}
+	wg.Wait()
+	if err != nil {
+		return libunlynxdetertag.PublishedDDTCreationListProof{}, err
+	}
+
+	// all the parts are created with the same keys
+	creationListProof := libunlynxdetertag.PublishedDDTCreationListProof{}
+	if proofs {
+		creationListProof.List = make([]libunlynxdetertag.PublishedDDTCreationProof, 0, len(data))
+		for _, prf := range creationProofs {
+			creationListProof.List = append(creationListProof.List, prf.List...)
+			creationListProof.K, creationListProof.SB = prf.K, prf.SB
+		}
+	}
+	return creationListProof, nil
+}
+
+// dispatchBatches handles a list streamed in batches (starting with the given batch). Each batch is processed and sent
+// to the next server as soon as it arrives, so that the servers work on different batches at the same time. The batches
+// go twice through the circuit, the root moving them from the first round to the second one.
+func (p *DeterministicTaggingProtocol) dispatchBatches(batch deterministicTaggingBatchStruct) error {
+	nbrCipherTexts := int(batch.NbrCipherTexts)
+	batchSize := int(batch.BatchSize)
+
+	additionProofs := libunlynxdetertag.PublishedDDTAdditionListProof{}
+	creationListProof := libunlynxdetertag.PublishedDDTCreationListProof{}
+	if p.Proofs {
+		additionProofs.List = make([]libunlynxdetertag.PublishedDDTAdditionProof, nbrCipherTexts)
+		creationListProof.List = make([]libunlynxdetertag.PublishedDDTCreationProof, nbrCipherTexts)
+	}
+	var taggedData libunlynx.DeterministCipherVector
+	if p.IsRoot() {
+		taggedData = make(libunlynx.DeterministCipherVector, nbrCipherTexts)
+	}
+
+	received := [2]int{}
+	for {
+		dtm := DeterministicTaggingMessage{Data: make([]libunlynx.CipherText, 0)}
+		if err := dtm.FromBytes(batch.Data); err != nil {
+			return err
+		}
+		start := int(batch.Start)
+		if batch.Round < 0 || batch.Round > 1 || start < 0 || start+len(dtm.Data) > nbrCipherTexts || int(batch.NbrCipherTexts) != nbrCipherTexts {
+			return errors.New("batch of " + strconv.Itoa(len(dtm.Data)) + " ciphertexts at position " + strconv.Itoa(start) +
+				" (round " + strconv.FormatInt(batch.Round, 10) + ") does not fit in the list of " + strconv.Itoa(nbrCipherTexts) + " ciphertexts")
+		}
+		received[batch.Round] += len(dtm.Data)
+
+		startT := time.Now()
+		round := batch.Round
+		if round == 0 {
+			prfs, err := p.addSecretContribution(dtm.Data)
+			if err != nil {
+				return err
+			}
+			copy(additionProofs.List[start:], prfs)
+			// the first round ends at the root
+			if p.IsRoot() {
+				round = 1
+			}
+		} else {
+			roundTotalComputation := libunlynx.StartTimer(p.Name() + "_DetTagging(BATCH)")
+			prf, err := p.tag(dtm.Data)
+			if err != nil {
+				return err
+			}
+			copy(creationListProof.List[start:], prf.List)
+			if len(prf.List) > 0 {
+				creationListProof.K, creationListProof.SB = prf.K, prf.SB
+			}
+			libunlynx.EndTimer(roundTotalComputation)
+
+			// the proofs are handed over before the last batch is sent so that they are all created when the protocol ends
+			if received[1] >= nbrCipherTexts && p.Proofs && p.ProofFunc != nil {
+				p.ProofFunc(&additionProofs, &creationListProof)
+			}
+		}
+		if p.IsRoot() {
+			p.ExecTime += time.Since(startT)
+		}
+
+		if p.IsRoot() && batch.Round == 1 {
+			for i, v := range dtm.Data {
+				taggedData[start+i] = libunlynx.DeterministCipherText{Point: v.C}
+			}
+		} else {
+			msg := DeterministicTaggingBatchMessage{Round: round, Start: batch.Start, NbrCipherTexts: batch.NbrCipherTexts, BatchSize: batch.BatchSize}
+			var err error
+			if msg.Data, err = dtm.ToBytes(); err != nil {
+				return err
+			}
+			if err := p.sendToNext(&msg); err != nil {
+				return err
+			}
+		}
+
+		if batch.Round == 1 && received[1] >= nbrCipherTexts {
+			break
+		}
+		batch = <-p.BatchChannel
+	}
+
+	if p.IsRoot() {
+		log.Lvl1(p.ServerIdentity(), " completed deterministic Tagging (", nbrCipherTexts, "row in batches of ", batchSize, ")")
+		p.FeedbackChannel <- taggedData
+	} else {
+		log.Lvl1(p.ServerIdentity(), " carried on deterministic Tagging (in batches).", nbrCipherTexts)
+	}
+	return nil
+}
+
+// sendBatches streams a list to the next node in the circuit in batches of batchSize ciphertexts
+func (p *DeterministicTaggingProtocol) sendBatches(round int64, data []libunlynx.CipherText, batchSize int) error {
+	for _, bounds := range streamingBatches(len(data), batchSize) {
+		msg := DeterministicTaggingBatchMessage{Round: round, Start: int64(bounds[0]), NbrCipherTexts: int64(len(data)), BatchSize: int64(batchSize)}
+		var err error
+		if msg.Data, err = (&DeterministicTaggingMessage{Data: data[bounds[0]:bounds[1]]}).ToBytes(); err != nil {
+			return err
+		}
+		if err := p.sendToNext(&msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // sendToNext sends the message msg to the next node in the circuit based on the next TreeNode in Tree.List() If not visited yet.
 // If the message already visited the next node, doesn't send and returns false. Otherwise, return true.
 func (p *DeterministicTaggingProtocol) sendToNext(msg interface{}) error {
@@ -297,15 +507,23 @@ func sendingDet(p DeterministicTaggingProtocol, detTarget DeterministicTaggingMe
 
 // TaggingDet performs one step in the distributed deterministic tagging process and creates corresponding proof
 func TaggingDet(cv *libunlynx.CipherVector, privKey, secretContrib kyber.Scalar, pubKey kyber.Point, proofs bool) error {
+	_, err := taggingDetWithProofs(cv, privKey, secretContrib, pubKey, proofs)
+	return err
+}
+
+// taggingDetWithProofs is TaggingDet returning the proofs (an empty list if proofs is false)
+func taggingDetWithProofs(cv *libunlynx.CipherVector, privKey, secretContrib kyber.Scalar, pubKey kyber.Point, proofs bool) (libunlynxdetertag.PublishedDDTCreationListProof, error) {
 	switchedVect := libunlynxdetertag.DeterministicTagSequence(*cv, privKey, secretContrib)
+	var prf libunlynxdetertag.PublishedDDTCreationListProof
 	if proofs {
-		_, err := libunlynxdetertag.DeterministicTagCrListProofCreation(*cv, switchedVect, pubKey, secretContrib, privKey)
+		var err error
+		prf, err = libunlynxdetertag.DeterministicTagCrListProofCreation(*cv, switchedVect, pubKey, privKey, secretContrib)
 		if err != nil {
-			return err
+			return libunlynxdetertag.PublishedDDTCreationListProof{}, err
 		}
 	}
 	*cv = switchedVect
-	return nil
+	return prf, nil
 }
 
 // CipherVectorToDeterministicTag creates a tag (grouping key) from a cipher vector
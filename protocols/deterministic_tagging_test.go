@@ -6,14 +6,19 @@ import (
 	"time"
 
 	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/deterministic_tag"
 	"github.com/ldsec/unlynx/protocols"
 	"github.com/stretchr/testify/assert"
+	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/util/random"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
 )
 
+// ddtProofsValid receives the result of the verification of the proofs of each node
+var ddtProofsValid = make(chan bool, 5)
+
 func TestDeterministicTagging(t *testing.T) {
 	local := onet.NewLocalTest(libunlynx.SuiTe)
 
@@ -104,6 +109,9 @@ func TestDeterministicTagging(t *testing.T) {
 		for _, v := range goodFormatResult {
 			log.Lvl1(v)
 		}
+		for i := 0; i < 5; i++ {
+			assert.True(t, <-ddtProofsValid)
+		}
 
 	case <-time.After(timeout):
 		t.Fatal("Didn't finish in time")
@@ -111,6 +119,83 @@ func TestDeterministicTagging(t *testing.T) {
 
 }
 
+// ddtBatchesSecrets are the survey secrets of the nodes of the streamed deterministic tagging test protocol
+var ddtBatchesSecrets []kyber.Scalar
+
+func TestDeterministicTaggingBatches(t *testing.T) {
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, err := onet.GlobalProtocolRegister("DeterministicTaggingBatchesTest", NewDeterministicTaggingBatchesTest)
+	assert.NoError(t, err, "Error registering <DeterministicTaggingBatchesTest>")
+
+	_, entityList, tree := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	ddtBatchesSecrets = make([]kyber.Scalar, len(entityList.List))
+	for i := range ddtBatchesSecrets {
+		ddtBatchesSecrets[i] = libunlynx.SuiTe.Scalar().Pick(random.New())
+	}
+
+	values := []int64{1, 2, 1, 3, 2, 1, 4}
+	target := make(libunlynx.CipherVector, len(values))
+	for i, v := range values {
+		target[i] = *libunlynx.EncryptInt(entityList.Aggregate, v)
+	}
+
+	// the tags are the same whether the data is sent in one message (0), in batches or in a single batch
+	var expected libunlynx.DeterministCipherVector
+	for _, batchSize := range []int{0, 1, 3, 10} {
+		rootInstance, err := local.CreateProtocol("DeterministicTaggingBatchesTest", tree)
+		assert.NoError(t, err)
+		protocol := rootInstance.(*protocolsunlynx.DeterministicTaggingProtocol)
+
+		toTag := make(libunlynx.CipherVector, len(target))
+		copy(toTag, target)
+		protocol.TargetOfSwitch = &toTag
+		protocol.BatchSize = batchSize
+
+		feedback := protocol.FeedbackChannel
+		go func() {
+			err := protocol.Start()
+			assert.NoError(t, err)
+		}()
+
+		timeout := network.WaitRetry * time.Duration(network.MaxRetryConnect*10) * time.Millisecond
+		select {
+		case result := <-feedback:
+			assert.Equal(t, len(values), len(result))
+			for i := range values {
+				for j := range values {
+					assert.Equal(t, values[i] == values[j], result[i].Point.Equal(result[j].Point))
+				}
+			}
+			if expected == nil {
+				expected = result
+			}
+			assert.True(t, reflect.DeepEqual(expected, libunlynx.DeterministCipherVector(result)))
+
+			for range entityList.List {
+				assert.True(t, <-ddtProofsValid)
+			}
+		case <-time.After(timeout):
+			t.Fatal("Didn't finish in time")
+		}
+	}
+}
+
+// NewDeterministicTaggingBatchesTest is a special purpose protocol constructor specific to tests.
+func NewDeterministicTaggingBatchesTest(tni *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	pi, err := protocolsunlynx.NewDeterministicTaggingProtocol(tni)
+	protocol := pi.(*protocolsunlynx.DeterministicTaggingProtocol)
+	protocol.Proofs = true
+	protocol.SurveySecretKey = &ddtBatchesSecrets[tni.Index()]
+	protocol.ProofFunc = func(additionProofs *libunlynxdetertag.PublishedDDTAdditionListProof, creationProofs *libunlynxdetertag.PublishedDDTCreationListProof) {
+		ddtProofsValid <- libunlynxdetertag.DeterministicTagAdditionListProofVerification(*additionProofs, 1.0) &&
+			libunlynxdetertag.DeterministicTagCrListProofVerification(*creationProofs, 1.0) && len(creationProofs.List) > 0
+	}
+
+	return protocol, err
+}
+
 // NewDeterministicTaggingTest is a special purpose protocol constructor specific to tests.
 func NewDeterministicTaggingTest(tni *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 	pi, err := protocolsunlynx.NewDeterministicTaggingProtocol(tni)
@@ -118,6 +203,10 @@ func NewDeterministicTaggingTest(tni *onet.TreeNodeInstance) (onet.ProtocolInsta
 	protocol.Proofs = true
 	clientPrivate := libunlynx.SuiTe.Scalar().Pick(random.New())
 	protocol.SurveySecretKey = &clientPrivate
+	protocol.ProofFunc = func(additionProofs *libunlynxdetertag.PublishedDDTAdditionListProof, creationProofs *libunlynxdetertag.PublishedDDTCreationListProof) {
+		ddtProofsValid <- libunlynxdetertag.DeterministicTagAdditionListProofVerification(*additionProofs, 1.0) &&
+			libunlynxdetertag.DeterministicTagCrListProofVerification(*creationProofs, 1.0) && len(creationProofs.List) > 0
+	}
 
 	return protocol, err
 }
@@ -0,0 +1,15 @@
+package protocolsunlynx
+
+import (
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// MembershipProtocolName is the registered name for the membership test protocol (a shuffling+ddt protocol run on the
+// matrix built by libunlynxmembership).
+const MembershipProtocolName = "Membership"
+
+func init() {
+	_, err := onet.GlobalProtocolRegister(MembershipProtocolName, func(tn *onet.TreeNodeInstance) (onet.ProtocolInstance, error) { return nil, nil })
+	log.ErrFatal(err, "Failed to register the <Membership> protocol:")
+}
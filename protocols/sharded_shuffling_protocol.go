@@ -0,0 +1,279 @@
+// Package protocolsunlynx implements the sharded shuffling protocol. Instead of sending the whole list of ciphertexts
+// through a single circuit, the root splits it in shards which go through the servers in parallel, each in a different
+// order (the circuit starting at a different server). The shards are redistributed between rounds with a cross-shard
+// permutation so that the responses are mixed across the shards (see libunlynxshuffle.RedistributeShards).
+package protocolsunlynx
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/shuffle"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// ShardedShufflingProtocolName is the registered name for the sharded neff shuffle protocol.
+const ShardedShufflingProtocolName = "ShardedShuffling"
+
+// DefaultShardedShufflingRounds is the number of rounds of a sharded shuffle with more than one shard
+const DefaultShardedShufflingRounds = 2
+
+// MaxShardedShufflingShards is the maximum number of shards: a server can receive each shard (and the root each
+// shuffled shard) at once during a round, which has to fit in the channel of the protocol
+const MaxShardedShufflingShards = 256
+
+func init() {
+	network.RegisterMessage(ShardedShufflingMessage{})
+	if _, err := onet.GlobalProtocolRegister(ShardedShufflingProtocolName, NewShardedShufflingProtocol); err != nil {
+		log.Fatal("Failed to register the <ShardedShuffling> protocol: ", err)
+	}
+}
+
+// Messages
+//______________________________________________________________________________________________________________________
+
+// ShardedShufflingMessage contains a shard (in bytes) and its position in the protocol: Step is the number of servers
+// which already shuffled it during the round (all the servers once it goes back to the root).
+type ShardedShufflingMessage struct {
+	Shard     int64
+	Round     int64
+	Step      int64
+	NbrShards int64
+	NbrRounds int64
+	Data      []byte
+	CVLengths []byte
+}
+
+// Structs
+//______________________________________________________________________________________________________________________
+
+// shardedShufflingStruct contains a sharded shuffling message
+type shardedShufflingStruct struct {
+	*onet.TreeNode
+	ShardedShufflingMessage
+}
+
+// Protocol
+//______________________________________________________________________________________________________________________
+
+// ShardedShufflingProtocol hold the state of a sharded shuffling protocol instance.
+type ShardedShufflingProtocol struct {
+	*onet.TreeNodeInstance
+
+	// Protocol feedback channel
+	FeedbackChannel chan []libunlynx.CipherVector
+
+	// Protocol communication channels
+	ShardChannel chan shardedShufflingStruct
+
+	// Protocol state data
+	ShuffleTarget *[]libunlynx.CipherVector
+	Precomputed   []libunlynxshuffle.CipherVectorScalar
+	// PrecomputeFunc gives fresh precomputed values for the shuffle of each shard (Precomputed is used if it is nil)
+	PrecomputeFunc precomputeShuffleFunction
+	// NbrShards is the number of shards (the number of servers by default)
+	NbrShards int
+	// NbrRounds is the number of rounds (DefaultShardedShufflingRounds by default, 1 with a single shard)
+	NbrRounds int
+
+	// state of the root
+	shards   [][]libunlynx.CipherVector
+	received int
+
+	// Proofs
+	Proofs    bool
+	ProofFunc proofShuffleFunction // called for the shuffle of each shard by each server
+
+	// Test (only use in order to test the protocol)
+	CollectiveKey kyber.Point
+	ExecTime      time.Duration
+}
+
+// NewShardedShufflingProtocol constructs sharded neff shuffle protocol instances.
+func NewShardedShufflingProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	dsp := &ShardedShufflingProtocol{
+		TreeNodeInstance: n,
+		FeedbackChannel:  make(chan []libunlynx.CipherVector),
+	}
+
+	if err := dsp.RegisterChannelLength(&dsp.ShardChannel, 2*MaxShardedShufflingShards); err != nil {
+		return nil, errors.New("couldn't register data reference channel: " + err.Error())
+	}
+	return dsp, nil
+}
+
+// Start is called at the root node and starts the execution of the protocol.
+func (p *ShardedShufflingProtocol) Start() error {
+	if p.ShuffleTarget == nil {
+		return errors.New("no map given as shuffling target")
+	}
+	if len(*p.ShuffleTarget) == 0 {
+		return errors.New("no data to shuffle")
+	}
+
+	var nbrShards int
+	nbrShards, p.NbrRounds = ShardedShufflingShape(len(*p.ShuffleTarget), len(p.Tree().List()), p.NbrShards, p.NbrRounds)
+	p.shards = libunlynxshuffle.SplitShards(*p.ShuffleTarget, nbrShards)
+
+	log.Lvl1("["+p.Name()+"]", " started a Sharded Shuffling Protocol (", len(*p.ShuffleTarget), " responses, ",
+		len(p.shards), " shards, ", p.NbrRounds, " rounds)")
+	return p.startRound(0)
+}
+
+// Dispatch is called on each tree node. It waits for incoming messages and handles them.
+func (p *ShardedShufflingProtocol) Dispatch() error {
+	defer p.Done()
+
+	// each shard goes through each server once per round
+	processed, toProcess := int64(0), int64(-1)
+	for toProcess < 0 || processed < toProcess || p.IsRoot() {
+		msg := <-p.ShardChannel
+		toProcess = msg.NbrShards * msg.NbrRounds
+
+		shard := ShufflingMessage{}
+		if err := shard.FromBytes(msg.Data, msg.CVLengths); err != nil {
+			return err
+		}
+
+		nbrNodes := int64(len(p.Tree().List()))
+		if msg.Step < nbrNodes {
+			var err error
+			shard.Data, err = p.shuffle(shard.Data)
+			if err != nil {
+				return err
+			}
+			processed++
+			msg.Step++
+		}
+
+		if msg.Step < nbrNodes {
+			if err := p.sendShard(p.shardCircuit(msg.Shard)[msg.Step], &msg.ShardedShufflingMessage, shard.Data); err != nil {
+				return err
+			}
+		} else if !p.IsRoot() {
+			if err := p.sendShard(p.Root(), &msg.ShardedShufflingMessage, shard.Data); err != nil {
+				return err
+			}
+		} else {
+			finished, err := p.shardShuffled(msg.Shard, msg.Round, shard.Data)
+			if err != nil {
+				return err
+			}
+			if finished {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// ShardedShufflingShape returns the number of shards and rounds of a sharded shuffle of nbrResponses responses by
+// nbrServers servers, given the requested number of shards and rounds (the defaults if not positive)
+func ShardedShufflingShape(nbrResponses, nbrServers, nbrShards, nbrRounds int) (int, int) {
+	if nbrShards <= 0 {
+		nbrShards = nbrServers
+	}
+	if nbrShards > MaxShardedShufflingShards {
+		nbrShards = MaxShardedShufflingShards
+	}
+	nbrShards = libunlynxshuffle.NbrShards(nbrResponses, nbrShards)
+
+	if nbrRounds <= 0 {
+		nbrRounds = DefaultShardedShufflingRounds
+	}
+	if nbrShards == 1 {
+		nbrRounds = 1
+	}
+	return nbrShards, nbrRounds
+}
+
+// shuffle shuffles a shard with the proofs (if needed)
+func (p *ShardedShufflingProtocol) shuffle(shuffleTarget []libunlynx.CipherVector) ([]libunlynx.CipherVector, error) {
+	timer := time.Now()
+	shufflingShard := libunlynx.StartTimer(p.Name() + "_ShardedShuffling(SHARD)")
+
+	collectiveKey := p.Roster().Aggregate
+	// when testing protocol
+	if p.CollectiveKey != nil {
+		collectiveKey = p.CollectiveKey
+	}
+
+	precomputed := p.Precomputed
+	if p.PrecomputeFunc != nil {
+		precomputed = p.PrecomputeFunc(collectiveKey, len(shuffleTarget))
+	}
+	shuffledData, pi, beta := libunlynxshuffle.ShuffleSequence(shuffleTarget, libunlynx.SuiTe.Point().Base(), collectiveKey, precomputed)
+	if p.Proofs {
+		if p.ProofFunc == nil {
+			return nil, errors.New("no proof function to create the shuffle proofs")
+		}
+		p.ProofFunc(shuffleTarget, shuffledData, collectiveKey, beta, pi)
+	}
+
+	libunlynx.EndTimer(shufflingShard)
+	p.ExecTime += time.Since(timer)
+	return shuffledData, nil
+}
+
+// startRound sends each shard to the first server of its circuit
+func (p *ShardedShufflingProtocol) startRound(round int) error {
+	p.received = 0
+	for i, shard := range p.shards {
+		msg := ShardedShufflingMessage{Shard: int64(i), Round: int64(round), NbrShards: int64(len(p.shards)), NbrRounds: int64(p.NbrRounds)}
+		if err := p.sendShard(p.shardCircuit(msg.Shard)[0], &msg, shard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shardShuffled handles a shard shuffled by all the servers at the root and returns true once the protocol is finished
+func (p *ShardedShufflingProtocol) shardShuffled(shard, round int64, data []libunlynx.CipherVector) (bool, error) {
+	if shard < 0 || shard >= int64(len(p.shards)) {
+		return false, errors.New("unknown shard " + strconv.FormatInt(shard, 10))
+	}
+	p.shards[shard] = data
+	p.received++
+	if p.received < len(p.shards) {
+		return false, nil
+	}
+
+	if int(round)+1 < p.NbrRounds {
+		var err error
+		if p.shards, err = libunlynxshuffle.RedistributeShards(p.shards); err != nil {
+			return false, err
+		}
+		return false, p.startRound(int(round) + 1)
+	}
+
+	result := libunlynxshuffle.MergeShards(p.shards)
+	log.Lvl1(p.ServerIdentity(), " completed sharded shuffling (", len(result), " responses)")
+	p.FeedbackChannel <- result
+	return true, nil
+}
+
+// shardCircuit returns the order in which the servers shuffle a shard: the circuit of the tree starting at a
+// different server for each shard
+func (p *ShardedShufflingProtocol) shardCircuit(shard int64) []*onet.TreeNode {
+	nodeList := p.Tree().List()
+	circuit := make([]*onet.TreeNode, len(nodeList))
+	for i := range nodeList {
+		circuit[i] = nodeList[(int(shard)+i)%len(nodeList)]
+	}
+	return circuit
+}
+
+// sendShard sends a shard to a server
+func (p *ShardedShufflingProtocol) sendShard(to *onet.TreeNode, msg *ShardedShufflingMessage, shard []libunlynx.CipherVector) error {
+	var err error
+	msg.Data, msg.CVLengths, err = (&ShufflingMessage{shard}).ToBytes()
+	if err != nil {
+		return err
+	}
+	return p.SendTo(to, msg)
+}
@@ -0,0 +1,105 @@
+package protocolsunlynx_test
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/shuffle"
+	"github.com/ldsec/unlynx/protocols"
+	"github.com/stretchr/testify/assert"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+var shardedShufflingKey kyber.Point
+var shardedShufflingProofs []libunlynxshuffle.PublishedShufflingProof
+var shardedShufflingMutex sync.Mutex
+
+func TestShardedShuffling(t *testing.T) {
+	defer log.AfterTest(t)
+
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, err := onet.GlobalProtocolRegister("ShardedShufflingTest", NewShardedShufflingTest)
+	assert.NoError(t, err, "Failed to register the <ShardedShufflingTest> protocol")
+
+	_, el, tree := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	secKey, pubKey := libunlynx.GenKey()
+	shardedShufflingKey = pubKey
+	expected := []int64{1, 2, 3, 4, 5, 6, 7}
+	data := make([]libunlynx.CipherVector, len(expected))
+	for i, v := range expected {
+		data[i] = *libunlynx.EncryptIntVector(pubKey, []int64{v, 10 * v})
+	}
+
+	for _, nbrShards := range []int{3, 1} {
+		shardedShufflingProofs = nil
+
+		rootInstance, err := local.CreateProtocol("ShardedShufflingTest", tree)
+		assert.NoError(t, err)
+		protocol := rootInstance.(*protocolsunlynx.ShardedShufflingProtocol)
+		protocol.ShuffleTarget = &data
+		protocol.NbrShards = nbrShards
+
+		feedback := protocol.FeedbackChannel
+		go func() {
+			err := protocol.Start()
+			assert.NoError(t, err)
+		}()
+
+		timeout := network.WaitRetry * time.Duration(network.MaxRetryConnect*10) * time.Millisecond
+		select {
+		case result := <-feedback:
+			// the result contains the same responses (rerandomized)
+			decrypted := make([]int64, len(result))
+			for i, cv := range result {
+				values := libunlynx.DecryptIntVector(secKey, &cv)
+				assert.Equal(t, 10*values[0], values[1])
+				decrypted[i] = values[0]
+			}
+			sort.Slice(decrypted, func(i, j int) bool { return decrypted[i] < decrypted[j] })
+			assert.Equal(t, expected, decrypted)
+
+			// the proofs of the shuffle of each shard by each server compose to a proof of the whole shuffle
+			nbrRounds := protocolsunlynx.DefaultShardedShufflingRounds
+			if nbrShards == 1 {
+				nbrRounds = 1
+			}
+			shardedShufflingMutex.Lock()
+			proofs := shardedShufflingProofs
+			shardedShufflingMutex.Unlock()
+			assert.Equal(t, nbrShards*nbrRounds*len(el.List), len(proofs))
+			assert.True(t, libunlynxshuffle.ShardedShuffleProofVerification(data, result, proofs, nbrShards, nbrRounds, len(el.List), pubKey))
+			assert.False(t, libunlynxshuffle.ShardedShuffleProofVerification(data, result, proofs[1:], nbrShards, nbrRounds, len(el.List), pubKey))
+			assert.False(t, libunlynxshuffle.ShardedShuffleProofVerification(data, data, proofs, nbrShards, nbrRounds, len(el.List), pubKey))
+		case <-time.After(timeout):
+			t.Fatal("Didn't finish in time")
+		}
+	}
+}
+
+// NewShardedShufflingTest is a special purpose protocol constructor specific to tests.
+func NewShardedShufflingTest(tni *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	pi, err := protocolsunlynx.NewShardedShufflingProtocol(tni)
+	protocol := pi.(*protocolsunlynx.ShardedShufflingProtocol)
+
+	protocol.CollectiveKey = shardedShufflingKey
+	protocol.Proofs = true
+	protocol.ProofFunc = func(shuffleTarget, shuffledData []libunlynx.CipherVector, collectiveKey kyber.Point, beta [][]kyber.Scalar, pi []int) *libunlynxshuffle.PublishedShufflingProof {
+		proof, err := libunlynxshuffle.ShuffleProofCreation(shuffleTarget, shuffledData, libunlynx.SuiTe.Point().Base(), collectiveKey, beta, pi)
+		if err != nil {
+			log.Fatal(err)
+		}
+		shardedShufflingMutex.Lock()
+		shardedShufflingProofs = append(shardedShufflingProofs, proof)
+		shardedShufflingMutex.Unlock()
+		return &proof
+	}
+	return protocol, err
+}
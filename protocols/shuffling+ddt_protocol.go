@@ -2,7 +2,6 @@ package protocolsunlynx
 
 import (
 	"errors"
-	"sync"
 
 	"github.com/ldsec/unlynx/lib"
 	"github.com/ldsec/unlynx/lib/deterministic_tag"
@@ -29,19 +28,28 @@ func init() {
 
 // ShufflingPlusDDTMessage represents a message containing data to shuffle and tag
 type ShufflingPlusDDTMessage struct {
-	Data     []libunlynx.CipherVector
-	ShuffKey kyber.Point // the key to use for shuffling
+	Data      []libunlynx.CipherVector
+	ShuffKey  kyber.Point            // the key to use for shuffling
+	TagOnly   libunlynx.CipherVector // the ciphertexts which are tagged without being shuffled
+	NbrTagged int                    // the number of tagged ciphertexts at the beginning of each cipher vector (all if 0)
+	// TagGenerator is the base point multiplied by the survey secrets of the servers which already tagged the data: each
+	// server adds its secret times this point (instead of the base point) so that the tags do not depend on the order
+	// of the servers and are the same as the ones of the DeterministicTaggingProtocol
+	TagGenerator kyber.Point
 }
 
 // ShufflingPlusDDTBytesMessage represents a ShufflingPlusDDTMessage in bytes
 type ShufflingPlusDDTBytesMessage struct {
-	Data     []byte
-	ShuffKey []byte
+	Data      []byte
+	ShuffKey  []byte // the shuffling key followed by the tag generator
+	TagOnly   []byte
+	NbrTagged int64
 }
 
 // ShufflingPlusDDTBytesLength is a message containing the lengths to read a ShufflingPlusDDTMessage in bytes
 type ShufflingPlusDDTBytesLength struct {
-	CVLengths []byte
+	CVLengths     []byte
+	TagOnlyLength int64
 }
 
 // Structs
@@ -62,7 +70,16 @@ type shufflingPlusDDTBytesLengthStruct struct {
 // Protocol
 //______________________________________________________________________________________________________________________
 
-// ShufflingPlusDDTProtocol hold the state of a shuffling+ddt protocol instance.
+// proofShufflingKeysFunction defines a function that does 'stuff' with the shuffle proofs of cipher vectors whose
+// ciphertexts are encrypted under different keys (one per position, see libunlynxshuffle.ShuffleSequenceKeys)
+type proofShufflingKeysFunction func([]libunlynx.CipherVector, []libunlynx.CipherVector, []kyber.Point, [][]kyber.Scalar, []int)
+
+// ShufflingPlusDDTProtocol hold the state of a shuffling+ddt protocol instance. Each server shuffles the data and does
+// its steps of the deterministic tagging in a single traversal of the circuit of servers.
+//
+// Only the first NbrTagged ciphertexts of each cipher vector are tagged: they are partially decrypted by each server
+// (and rerandomized under the remaining key) while the others are only shuffled and stay encrypted under the collective
+// key, so that a server proves its shuffle with a key per position.
 type ShufflingPlusDDTProtocol struct {
 	*onet.TreeNodeInstance
 
@@ -79,8 +96,20 @@ type ShufflingPlusDDTProtocol struct {
 	Precomputed       []libunlynxshuffle.CipherVectorScalar
 	nextNodeInCircuit *onet.TreeNode
 
+	// NbrTagged is the number of ciphertexts at the beginning of each cipher vector which are tagged (all of them if 0).
+	// The precomputed values are only used when all of them are tagged. It only has to be set at the root.
+	NbrTagged int
+	// TargetTagOnly are ciphertexts which are tagged but not shuffled (e.g. the values of a query), their tags come
+	// first in the result. It only has to be set at the root.
+	TargetTagOnly *libunlynx.CipherVector
+	// ShuffledData is set at the root before the result is sent: the shuffled cipher vectors, whose first NbrTagged
+	// ciphertexts have the tags as C
+	ShuffledData []libunlynx.CipherVector
+
 	// Proofs
-	Proofs bool
+	Proofs       bool
+	ProofFunc    proofShufflingKeysFunction        // function called with the shuffle proofs of each server
+	DDTProofFunc proofDeterministicTaggingFunction // function called with the deterministic tagging proofs of each server
 }
 
 // NewShufflingPlusDDTProtocol constructs neff shuffle + ddt protocol instance.
@@ -115,28 +144,29 @@ func (p *ShufflingPlusDDTProtocol) Start() error {
 	if p.TargetData == nil {
 		return errors.New("no data is given")
 	}
+	if p.SurveySecretKey == nil {
+		return errors.New("no survey secret key given")
+	}
 	nbrSqCVs := len(*p.TargetData)
 	log.Lvl1("["+p.Name()+"]", " started a Shuffling+DDT Protocol (", nbrSqCVs, " responses)")
 
 	shuffleTarget := *p.TargetData
-
-	// STEP 4: Send to next node
-
-	message := ShufflingPlusDDTBytesMessage{}
-	var cvLengthsByte []byte
-	var err error
-
-	message.Data, cvLengthsByte, err = (&ShufflingPlusDDTMessage{Data: shuffleTarget}).ToBytes()
-	if err != nil {
-		return err
+	if p.NbrTagged < 0 || (len(shuffleTarget) > 0 && p.NbrTagged > len(shuffleTarget[0])) {
+		return errors.New("wrong number of tagged ciphertexts")
+	}
+	var tagOnly libunlynx.CipherVector
+	if p.TargetTagOnly != nil {
+		tagOnly = *p.TargetTagOnly
 	}
 
-	message.ShuffKey, err = libunlynx.AbstractPointsToBytes([]kyber.Point{p.Tree().Roster.Aggregate})
+	// STEP 4: Send to next node
+	message, length, err := (&ShufflingPlusDDTMessage{Data: shuffleTarget, ShuffKey: p.Tree().Roster.Aggregate, TagOnly: tagOnly,
+		NbrTagged: p.NbrTagged, TagGenerator: libunlynx.SuiTe.Point().Base()}).ToBytes()
 	if err != nil {
 		return err
 	}
 
-	err = p.sendToNext(&ShufflingPlusDDTBytesLength{CVLengths: cvLengthsByte})
+	err = p.sendToNext(&length)
 	if err != nil {
 		return err
 	}
@@ -157,7 +187,7 @@ func (p *ShufflingPlusDDTProtocol) Dispatch() error {
 
 	readData := libunlynx.StartTimer(p.Name() + "_ShufflingPlusDDT(ReadData)")
 	sm := ShufflingPlusDDTMessage{}
-	err := sm.FromBytes(tmp.Data, tmp.ShuffKey, shufflingPlusDDTBytesMessageLength.CVLengths)
+	err := sm.FromBytes(tmp.ShufflingPlusDDTBytesMessage, shufflingPlusDDTBytesMessageLength.ShufflingPlusDDTBytesLength)
 	if err != nil {
 		return err
 	}
@@ -166,47 +196,27 @@ func (p *ShufflingPlusDDTProtocol) Dispatch() error {
 
 	// STEP 1: Shuffling of the data
 	step1 := libunlynx.StartTimer(p.Name() + "_ShufflingPlusDDT(Step1-Shuffling)")
-	if p.Precomputed != nil {
-		log.Lvl1(p.Name(), " uses pre-computation in shuffling")
+	shuffledData, err := p.shuffle(sm)
+	if err != nil {
+		return err
 	}
-	shuffledData, pi, beta := libunlynxshuffle.ShuffleSequence(sm.Data, libunlynx.SuiTe.Point().Base(), sm.ShuffKey, p.Precomputed)
 	libunlynx.EndTimer(step1)
 
-	if p.Proofs {
-		if _, err := libunlynxshuffle.ShuffleProofCreation(sm.Data, shuffledData, libunlynx.SuiTe.Point().Base(), sm.ShuffKey, beta, pi); err != nil {
-			return err
-		}
+	// the tagged ciphertexts: the ones which are not shuffled, then the first ones of each cipher vector
+	nbrTagged := sm.NbrTagged
+	if nbrTagged == 0 && len(shuffledData) > 0 {
+		nbrTagged = len(shuffledData[0])
+	}
+	toTag := make([]libunlynx.CipherText, 0, len(sm.TagOnly)+len(shuffledData)*nbrTagged)
+	toTag = append(toTag, sm.TagOnly...)
+	for _, cv := range shuffledData {
+		toTag = append(toTag, cv[:nbrTagged]...)
 	}
 
 	// STEP 2: Addition of secret (first round of DDT, add value derivated from ephemeral secret to message)
 	step2 := libunlynx.StartTimer(p.Name() + "_ShufflingPlusDDT(Step2-DDTAddition)")
-	toAdd := libunlynx.SuiTe.Point().Mul(*p.SurveySecretKey, libunlynx.SuiTe.Point().Base()) //siB (basically)
-
-	mutex := sync.Mutex{}
-	wg := sync.WaitGroup{}
-	for i := 0; i < len(shuffledData); i += libunlynx.VPARALLELIZE {
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			for j := 0; j < libunlynx.VPARALLELIZE && (i+j) < len(shuffledData); j++ {
-				for k := range shuffledData[i+j] {
-					tmp := libunlynx.SuiTe.Point().Add(shuffledData[i+j][k].C, toAdd)
-					if p.Proofs {
-						_, tmpErr := libunlynxdetertag.DeterministicTagAdditionProofCreation(shuffledData[i+j][k].C, *p.SurveySecretKey, toAdd, tmp)
-						if tmpErr != nil {
-							mutex.Lock()
-							err = tmpErr
-							mutex.Unlock()
-							return
-						}
-					}
-					shuffledData[i+j][k].C = tmp
-				}
-			}
-		}(i)
-	}
-	wg.Wait()
-
+	additionProofs := libunlynxdetertag.PublishedDDTAdditionListProof{}
+	additionProofs.List, err = addSecretContribution(toTag, *p.SurveySecretKey, sm.TagGenerator, p.Proofs)
 	if err != nil {
 		return err
 	}
@@ -216,44 +226,45 @@ func (p *ShufflingPlusDDTProtocol) Dispatch() error {
 
 	// STEP 3: Partial Decryption (second round of DDT, deterministic tag creation)
 	step3 := libunlynx.StartTimer(p.Name() + "_ShufflingPlusDDT(Step3-DDT)")
-	mutex = sync.Mutex{}
-	wg = sync.WaitGroup{}
-	for i := 0; i < len(shuffledData); i += libunlynx.VPARALLELIZE {
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			for j := 0; j < libunlynx.VPARALLELIZE && (i+j) < len(shuffledData); j++ {
-				tmp := shuffledData[i+j]
-				switchedVect := libunlynxdetertag.DeterministicTagSequence(tmp, p.Private(), *p.SurveySecretKey)
-				if p.Proofs {
-					_, tmpErr := libunlynxdetertag.DeterministicTagCrListProofCreation(tmp, switchedVect, p.Public(), *p.SurveySecretKey, p.Private())
-					if tmpErr != nil {
-						mutex.Lock()
-						err = tmpErr
-						mutex.Unlock()
-						return
-					}
-				}
-				copy(shuffledData[i+j], switchedVect)
-			}
-		}(i)
+	creationListProof, err := tagCipherTexts(toTag, p.Private(), *p.SurveySecretKey, p.Public(), p.Proofs)
+	if err != nil {
+		return err
 	}
-	wg.Wait()
 	libunlynx.EndTimer(step3)
 
+	// the proofs are handed over before the data is sent so that they are all created when the protocol ends
+	if p.Proofs && p.DDTProofFunc != nil {
+		p.DDTProofFunc(&additionProofs, &creationListProof)
+	}
+
+	// the shuffled data is not modified as it may be referenced by the proofs
+	copy(sm.TagOnly, toTag[:len(sm.TagOnly)])
+	taggedShuffledData := make([]libunlynx.CipherVector, len(shuffledData))
+	for i, cv := range shuffledData {
+		taggedShuffledData[i] = make(libunlynx.CipherVector, len(cv))
+		copy(taggedShuffledData[i], toTag[len(sm.TagOnly)+i*nbrTagged:len(sm.TagOnly)+(i+1)*nbrTagged])
+		copy(taggedShuffledData[i][nbrTagged:], cv[nbrTagged:])
+	}
+	shuffledData = taggedShuffledData
+
 	var taggedData []libunlynx.DeterministCipherVector
 
 	if p.IsRoot() {
 		prepareResult := libunlynx.StartTimer(p.Name() + "_ShufflingPlusDDT(PrepareResult)")
-		taggedData = make([]libunlynx.DeterministCipherVector, len(*p.TargetData))
+		taggedData = make([]libunlynx.DeterministCipherVector, 0, len(sm.TagOnly)+len(shuffledData))
 		size := 0
-		for i, v := range shuffledData {
-			taggedData[i] = make(libunlynx.DeterministCipherVector, len(v))
-			for j, el := range v {
-				taggedData[i][j] = libunlynx.DeterministCipherText{Point: el.C}
+		for _, ct := range sm.TagOnly {
+			taggedData = append(taggedData, libunlynx.DeterministCipherVector{libunlynx.DeterministCipherText{Point: ct.C}})
+		}
+		for _, v := range shuffledData {
+			tags := make(libunlynx.DeterministCipherVector, nbrTagged)
+			for j, el := range v[:nbrTagged] {
+				tags[j] = libunlynx.DeterministCipherText{Point: el.C}
 				size++
 			}
+			taggedData = append(taggedData, tags)
 		}
+		p.ShuffledData = shuffledData
 		libunlynx.EndTimer(prepareResult)
 		log.Lvl1(p.ServerIdentity(), " completed shuffling+DDT protocol (", size, "responses )")
 	} else {
@@ -269,21 +280,16 @@ func (p *ShufflingPlusDDTProtocol) Dispatch() error {
 		var err error
 
 		sendData := libunlynx.StartTimer(p.Name() + "_ShufflingPlusDDT(SendData)")
-		message := ShufflingPlusDDTBytesMessage{}
-		var cvBytesLengths []byte
-		message.Data, cvBytesLengths, err = (&ShufflingPlusDDTMessage{Data: shuffledData}).ToBytes()
-		if err != nil {
-			return err
-		}
-
 		// we have to subtract the key p.Public to the shuffling key (we partially decrypt during tagging)
-		message.ShuffKey, err = libunlynx.AbstractPointsToBytes([]kyber.Point{sm.ShuffKey.Sub(sm.ShuffKey, p.Public())})
+		next := ShufflingPlusDDTMessage{Data: shuffledData, ShuffKey: libunlynx.SuiTe.Point().Sub(sm.ShuffKey, p.Public()), TagOnly: sm.TagOnly,
+			NbrTagged: sm.NbrTagged, TagGenerator: libunlynx.SuiTe.Point().Mul(*p.SurveySecretKey, sm.TagGenerator)}
+		message, length, err := next.ToBytes()
 		libunlynx.EndTimer(sendData)
 		if err != nil {
 			return err
 		}
 
-		if err := p.sendToNext(&ShufflingPlusDDTBytesLength{cvBytesLengths}); err != nil {
+		if err := p.sendToNext(&length); err != nil {
 			return err
 		}
 		if err := p.sendToNext(&message); err != nil {
@@ -294,6 +300,83 @@ func (p *ShufflingPlusDDTProtocol) Dispatch() error {
 	return nil
 }
 
+// shuffle shuffles the data of a message: the tagged ciphertexts are encrypted under the shuffling key of the message
+// and the others under the collective key
+func (p *ShufflingPlusDDTProtocol) shuffle(sm ShufflingPlusDDTMessage) ([]libunlynx.CipherVector, error) {
+	if len(sm.Data) == 0 {
+		return sm.Data, nil
+	}
+
+	keys := ShufflingPlusDDTPositionKeys(sm.ShuffKey, p.Roster().Aggregate, sm.NbrTagged, len(sm.Data[0]))
+
+	var shuffledData []libunlynx.CipherVector
+	var pi []int
+	var beta [][]kyber.Scalar
+	if sm.NbrTagged == 0 || sm.NbrTagged == len(keys) {
+		if p.Precomputed != nil {
+			log.Lvl1(p.Name(), " uses pre-computation in shuffling")
+		}
+		shuffledData, pi, beta = libunlynxshuffle.ShuffleSequence(sm.Data, libunlynx.SuiTe.Point().Base(), sm.ShuffKey, p.Precomputed)
+	} else {
+		var err error
+		shuffledData, pi, beta, err = libunlynxshuffle.ShuffleSequenceKeys(sm.Data, libunlynx.SuiTe.Point().Base(), keys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.Proofs {
+		var err error
+		if p.ProofFunc != nil {
+			p.ProofFunc(sm.Data, shuffledData, keys, beta, pi)
+		} else if sm.NbrTagged == 0 || sm.NbrTagged == len(keys) {
+			_, err = libunlynxshuffle.ShuffleProofCreation(sm.Data, shuffledData, libunlynx.SuiTe.Point().Base(), sm.ShuffKey, beta, pi)
+		} else {
+			// a Neff proof binds a single key
+			_, err = libunlynxshuffle.BayerGrothShuffleProofCreationKeys(sm.Data, shuffledData, libunlynx.SuiTe.Point().Base(), p.Roster().Aggregate, keys, beta, pi)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return shuffledData, nil
+}
+
+// ShufflingPlusDDTCircuit returns the servers of a tree in the order in which they shuffle and tag the data (the root
+// last) and the shuffling key of each of them: the collective key minus the keys of the servers before it, which
+// partially decrypted the tagged ciphertexts
+func ShufflingPlusDDTCircuit(tree *onet.Tree) ([]*network.ServerIdentity, []kyber.Point) {
+	nodeList := tree.List()
+	circuit := make([]*network.ServerIdentity, 0, len(nodeList))
+	for _, node := range nodeList[1:] {
+		circuit = append(circuit, node.ServerIdentity)
+	}
+	circuit = append(circuit, nodeList[0].ServerIdentity)
+
+	keys := make([]kyber.Point, len(circuit))
+	key := tree.Roster.Aggregate
+	for i, si := range circuit {
+		keys[i] = key
+		key = libunlynx.SuiTe.Point().Sub(key, si.Public)
+	}
+	return circuit, keys
+}
+
+// ShufflingPlusDDTPositionKeys returns the key of each position of cipher vectors of size ciphertexts shuffled with the
+// shuffling key shuffKey: the first nbrTagged ones (all if 0) are encrypted under this key and the others under the
+// collective key
+func ShufflingPlusDDTPositionKeys(shuffKey, collectiveKey kyber.Point, nbrTagged, size int) []kyber.Point {
+	keys := make([]kyber.Point, size)
+	for j := range keys {
+		if nbrTagged == 0 || j < nbrTagged {
+			keys[j] = shuffKey
+		} else {
+			keys[j] = collectiveKey
+		}
+	}
+	return keys
+}
+
 // Sends the message msg to the next node in the circuit based on the next TreeNode in Tree.List().
 func (p *ShufflingPlusDDTProtocol) sendToNext(msg interface{}) error {
 	err := p.SendTo(p.nextNodeInCircuit, msg)
@@ -306,23 +389,51 @@ func (p *ShufflingPlusDDTProtocol) sendToNext(msg interface{}) error {
 // Marshal
 //______________________________________________________________________________________________________________________
 
-// ToBytes converts a ShufflingPlusDDTMessage to a byte array
-func (spddtm *ShufflingPlusDDTMessage) ToBytes() ([]byte, []byte, error) {
-	return libunlynx.ArrayCipherVectorToBytes(spddtm.Data)
+// ToBytes converts a ShufflingPlusDDTMessage to a ShufflingPlusDDTBytesMessage and the lengths to read it
+func (spddtm *ShufflingPlusDDTMessage) ToBytes() (ShufflingPlusDDTBytesMessage, ShufflingPlusDDTBytesLength, error) {
+	message := ShufflingPlusDDTBytesMessage{NbrTagged: int64(spddtm.NbrTagged)}
+	length := ShufflingPlusDDTBytesLength{}
+
+	var err error
+	message.Data, length.CVLengths, err = libunlynx.ArrayCipherVectorToBytes(spddtm.Data)
+	if err != nil {
+		return ShufflingPlusDDTBytesMessage{}, ShufflingPlusDDTBytesLength{}, err
+	}
+	message.ShuffKey, err = libunlynx.AbstractPointsToBytes([]kyber.Point{spddtm.ShuffKey, spddtm.TagGenerator})
+	if err != nil {
+		return ShufflingPlusDDTBytesMessage{}, ShufflingPlusDDTBytesLength{}, err
+	}
+
+	var tagOnlyLength int
+	message.TagOnly, tagOnlyLength, err = spddtm.TagOnly.ToBytes()
+	if err != nil {
+		return ShufflingPlusDDTBytesMessage{}, ShufflingPlusDDTBytesLength{}, err
+	}
+	length.TagOnlyLength = int64(tagOnlyLength)
+	return message, length, nil
 }
 
-// FromBytes converts a byte array to a ShufflingPlusDDTMessage. Note that you need to create the (empty) object beforehand.
-func (spddtm *ShufflingPlusDDTMessage) FromBytes(data []byte, shuffKey []byte, cvLengthsByte []byte) error {
+// FromBytes converts a ShufflingPlusDDTBytesMessage (with its lengths) to a ShufflingPlusDDTMessage. Note that you need
+// to create the (empty) object beforehand.
+func (spddtm *ShufflingPlusDDTMessage) FromBytes(message ShufflingPlusDDTBytesMessage, length ShufflingPlusDDTBytesLength) error {
 	var err error
-	(*spddtm).Data, err = libunlynx.FromBytesToArrayCipherVector(data, cvLengthsByte)
+	(*spddtm).Data, err = libunlynx.FromBytesToArrayCipherVector(message.Data, length.CVLengths)
 	if err != nil {
 		return err
 	}
 
-	dataP, err := libunlynx.FromBytesToAbstractPoints(shuffKey)
+	dataP, err := libunlynx.FromBytesToAbstractPoints(message.ShuffKey)
 	if err != nil {
 		return err
 	}
-	(*spddtm).ShuffKey = dataP[0]
+	if len(dataP) != 2 {
+		return errors.New("wrong shuffling key and tag generator")
+	}
+	(*spddtm).ShuffKey, (*spddtm).TagGenerator = dataP[0], dataP[1]
+
+	if err := (*spddtm).TagOnly.FromBytes(message.TagOnly, int(length.TagOnlyLength)); err != nil {
+		return err
+	}
+	(*spddtm).NbrTagged = int(message.NbrTagged)
 	return nil
 }
@@ -1,14 +1,17 @@
 package protocolsunlynx_test
 
 import (
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ldsec/unlynx/lib/shuffle"
 
 	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/deterministic_tag"
 	"github.com/ldsec/unlynx/protocols"
 	"github.com/stretchr/testify/assert"
+	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/util/random"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
@@ -87,3 +90,126 @@ func NewShufflingPlusDDTTest(tni *onet.TreeNodeInstance) (onet.ProtocolInstance,
 
 	return protocol, err
 }
+
+// mixedShuffleProofs are the shuffle and tagging addition proofs created by the servers running
+// ShufflingPlusDDTMixedTest (by server)
+var mixedShuffleProofs struct {
+	sync.Mutex
+	list     map[string]libunlynxshuffle.PublishedShufflingProof
+	addition map[string][]libunlynxdetertag.PublishedDDTAdditionProof
+}
+
+func TestShufflingPlusDDTProtocolPartialTagging(t *testing.T) {
+	defer log.AfterTest(t)
+
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+
+	_, err := onet.GlobalProtocolRegister("ShufflingPlusDDTMixedTest", NewShufflingPlusDDTMixedTest)
+	assert.NoError(t, err, "Failed to register the <ShufflingPlusDDTMixedTest> protocol")
+
+	_, _, tree := local.GenTree(nbrNodes, true)
+	defer local.CloseAll()
+
+	mixedShuffleProofs.Lock()
+	mixedShuffleProofs.list = make(map[string]libunlynxshuffle.PublishedShufflingProof)
+	mixedShuffleProofs.addition = make(map[string][]libunlynxdetertag.PublishedDDTAdditionProof)
+	mixedShuffleProofs.Unlock()
+
+	collectiveSecret := libunlynx.SuiTe.Scalar().Zero()
+	for _, si := range tree.Roster.List {
+		collectiveSecret.Add(collectiveSecret, si.GetPrivate())
+	}
+
+	rootInstance, err := local.CreateProtocol("ShufflingPlusDDTMixedTest", tree)
+	assert.NoError(t, err)
+	protocol := rootInstance.(*protocolsunlynx.ShufflingPlusDDTProtocol)
+
+	// the first ciphertext is tagged, the second one (e.g. an aggregate) is only shuffled
+	testData := make([]libunlynx.CipherVector, 6)
+	for i := range testData {
+		testData[i] = *libunlynx.EncryptIntVector(tree.Roster.Aggregate, []int64{int64(i%2 + 1), int64(i)})
+	}
+	tagOnly := *libunlynx.EncryptIntVector(tree.Roster.Aggregate, []int64{1, 2})
+	protocol.TargetData = &testData
+	protocol.TargetTagOnly = &tagOnly
+	protocol.NbrTagged = 1
+
+	feedback := protocol.FeedbackChannel
+	go func() {
+		err := protocol.Start()
+		assert.NoError(t, err)
+	}()
+
+	timeout := network.WaitRetry * time.Duration(network.MaxRetryConnect*10) * time.Millisecond
+
+	select {
+	case result := <-feedback:
+		assert.Equal(t, len(tagOnly)+len(testData), len(result))
+		assert.False(t, result[0][0].Equal(&result[1][0]))
+		assert.Equal(t, len(testData), len(protocol.ShuffledData))
+		for i, cv := range protocol.ShuffledData {
+			assert.Equal(t, 1, len(result[len(tagOnly)+i]))
+			value := libunlynx.DecryptInt(collectiveSecret, cv[1])
+			assert.True(t, result[value%2][0].Equal(&result[len(tagOnly)+i][0]))
+		}
+	case <-time.After(timeout):
+		t.Fatal("Didn't finish in time")
+	}
+
+	mixedShuffleProofs.Lock()
+	defer mixedShuffleProofs.Unlock()
+	assert.Equal(t, nbrNodes, len(mixedShuffleProofs.list))
+	for _, psp := range mixedShuffleProofs.list {
+		assert.True(t, libunlynxshuffle.ShuffleProofVerification(psp, tree.Roster.Aggregate))
+	}
+
+	// the keys and tag generators of the proofs are the ones of the position of each server in the circuit
+	circuit, keys := protocolsunlynx.ShufflingPlusDDTCircuit(tree)
+	assert.Equal(t, nbrNodes, len(circuit))
+	assert.True(t, circuit[len(circuit)-1].Equal(tree.Root.ServerIdentity))
+	g := libunlynx.SuiTe.Point().Base()
+	for p, si := range circuit {
+		psp := mixedShuffleProofs.list[si.String()]
+		assert.True(t, libunlynxshuffle.ShuffleProofKeys(psp, protocolsunlynx.ShufflingPlusDDTPositionKeys(keys[p], tree.Roster.Aggregate, 1, 2)))
+		if p > 0 {
+			assert.False(t, libunlynxshuffle.ShuffleProofKeys(psp, protocolsunlynx.ShufflingPlusDDTPositionKeys(tree.Roster.Aggregate, tree.Roster.Aggregate, 1, 2)))
+		}
+
+		additionProofs := mixedShuffleProofs.addition[si.String()]
+		assert.Equal(t, len(tagOnly)+len(testData), len(additionProofs))
+		for _, pdap := range additionProofs {
+			assert.True(t, pdap.HasGenerator(g))
+			assert.Equal(t, p == 0, pdap.HasGenerator(libunlynx.SuiTe.Point().Base()))
+		}
+		g = additionProofs[0].C2
+	}
+}
+
+// NewShufflingPlusDDTMixedTest is a special purpose protocol constructor specific to tests, which keeps the shuffle
+// proofs of the servers.
+func NewShufflingPlusDDTMixedTest(tni *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	pi, err := protocolsunlynx.NewShufflingPlusDDTProtocol(tni)
+	protocol := pi.(*protocolsunlynx.ShufflingPlusDDTProtocol)
+
+	clientPrivate := libunlynx.SuiTe.Scalar().Pick(random.New())
+	protocol.SurveySecretKey = &clientPrivate
+
+	protocol.Proofs = true
+	protocol.ProofFunc = func(shuffleTarget, shuffledData []libunlynx.CipherVector, keys []kyber.Point, beta [][]kyber.Scalar, pi []int) {
+		psp, err := libunlynxshuffle.BayerGrothShuffleProofCreationKeys(shuffleTarget, shuffledData, libunlynx.SuiTe.Point().Base(), tni.Roster().Aggregate, keys, beta, pi)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		mixedShuffleProofs.Lock()
+		mixedShuffleProofs.list[tni.ServerIdentity().String()] = psp
+		mixedShuffleProofs.Unlock()
+	}
+	protocol.DDTProofFunc = func(additionProofs *libunlynxdetertag.PublishedDDTAdditionListProof, creationProofs *libunlynxdetertag.PublishedDDTCreationListProof) {
+		mixedShuffleProofs.Lock()
+		mixedShuffleProofs.addition[tni.ServerIdentity().String()] = additionProofs.List
+		mixedShuffleProofs.Unlock()
+	}
+
+	return protocol, err
+}
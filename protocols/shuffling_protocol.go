@@ -1,10 +1,12 @@
 // Package protocolsunlynx implement the shuffling protocol. It rerandomizes and shuffles a list of ciphertexts.
 // This operates in a circuit between the servers: the data is sent sequentially through this circuit and each
-// server applies its transformation.
+// server applies its transformation. The list can also be streamed through the circuit in batches, which are shuffled
+// (and forwarded) one after the other by each server and mixed between rounds (see dispatchBatches).
 package protocolsunlynx
 
 import (
 	"errors"
+	"strconv"
 	"time"
 
 	"github.com/ldsec/unlynx/lib"
@@ -22,6 +24,7 @@ func init() {
 	network.RegisterMessage(ShufflingMessage{})
 	network.RegisterMessage(ShufflingBytesMessage{})
 	network.RegisterMessage(ShufflingBytesMessageLength{})
+	network.RegisterMessage(ShufflingBatchMessage{})
 	if _, err := onet.GlobalProtocolRegister(ShufflingProtocolName, NewShufflingProtocol); err != nil {
 		log.Fatal("Failed to register the <Shuffling> protocol: ", err)
 	}
@@ -45,6 +48,17 @@ type ShufflingBytesMessageLength struct {
 	CVLengths []byte
 }
 
+// ShufflingBatchMessage is a batch of a shuffling message (in bytes) when the data is streamed: the list is split in
+// NbrBatches batches which go through the circuit during each of the NbrRounds rounds
+type ShufflingBatchMessage struct {
+	Batch      int64
+	Round      int64
+	NbrBatches int64
+	NbrRounds  int64
+	Data       []byte
+	CVLengths  []byte
+}
+
 // Structs
 //______________________________________________________________________________________________________________________
 
@@ -60,9 +74,19 @@ type shufflingBytesLengthStruct struct {
 	ShufflingBytesMessageLength
 }
 
+// shufflingBatchStruct contains a batch of a shuffling message
+type shufflingBatchStruct struct {
+	*onet.TreeNode
+	ShufflingBatchMessage
+}
+
 // proofShuffleFunction defines a function that does 'stuff' with the shuffle proofs
 type proofShuffleFunction func([]libunlynx.CipherVector, []libunlynx.CipherVector, kyber.Point, [][]kyber.Scalar, []int) *libunlynxshuffle.PublishedShufflingProof
 
+// precomputeShuffleFunction gives the precomputed values for a shuffle of a number of responses with a collective key
+// (e.g. taken from a libunlynxshuffle.PrecomputationPool)
+type precomputeShuffleFunction func(kyber.Point, int) []libunlynxshuffle.CipherVectorScalar
+
 // Protocol
 //______________________________________________________________________________________________________________________
 
@@ -76,11 +100,22 @@ type ShufflingProtocol struct {
 	// Protocol communication channels
 	LengthNodeChannel         chan shufflingBytesLengthStruct
 	PreviousNodeInPathChannel chan shufflingBytesStruct
+	BatchChannel              chan shufflingBatchStruct
 
 	// Protocol state data
 	ShuffleTarget     *[]libunlynx.CipherVector
 	Precomputed       []libunlynxshuffle.CipherVectorScalar
 	nextNodeInCircuit *onet.TreeNode
+	// PrecomputeFunc gives fresh precomputed values for each shuffle (Precomputed is used if it is nil)
+	PrecomputeFunc precomputeShuffleFunction
+	// BatchSize is the number of responses per batch when the data is streamed through the circuit (0 sends the whole
+	// list in one message, see StreamedShufflingShape). It only has to be set at the root.
+	BatchSize int
+
+	// state of the root when the data is streamed
+	batches   [][]libunlynx.CipherVector
+	nbrRounds int
+	received  int
 
 	// Proofs
 	Proofs    bool
@@ -108,6 +143,10 @@ func NewShufflingProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, erro
 		return nil, errors.New("couldn't register data reference channel: " + err.Error())
 	}
 
+	if err := dsp.RegisterChannelLength(&dsp.BatchChannel, 2*MaxStreamingBatches); err != nil {
+		return nil, errors.New("couldn't register data reference channel: " + err.Error())
+	}
+
 	// choose next node in circuit
 	nodeList := n.Tree().List()
 	for i, node := range nodeList {
@@ -137,6 +176,18 @@ func (p *ShufflingProtocol) Start() error {
 
 	shuffleTarget := *p.ShuffleTarget
 
+	if p.BatchSize > 0 {
+		var nbrBatches int
+		nbrBatches, p.nbrRounds = StreamedShufflingShape(len(shuffleTarget), p.BatchSize)
+		p.batches = libunlynxshuffle.SplitShards(shuffleTarget, nbrBatches)
+		log.Lvl1("["+p.Name()+"]", " streams the responses in ", len(p.batches), " batches (", p.nbrRounds, " rounds)")
+
+		err := p.startRound(0)
+		libunlynx.EndTimer(shufflingStart)
+		p.ExecTimeStart += time.Since(timer)
+		return err
+	}
+
 	collectiveKey := p.Roster().Aggregate
 	// when testing protocol
 	if p.CollectiveKey != nil {
@@ -145,11 +196,7 @@ func (p *ShufflingProtocol) Start() error {
 
 	shufflingStartNoProof := libunlynx.StartTimer(p.Name() + "_Shuffling(START-noProof)")
 
-	if p.Precomputed != nil {
-		log.Lvl1(p.Name(), " uses pre-computation in shuffling")
-	}
-
-	shuffledData, pi, beta := libunlynxshuffle.ShuffleSequence(shuffleTarget, libunlynx.SuiTe.Point().Base(), collectiveKey, p.Precomputed)
+	shuffledData, pi, beta := libunlynxshuffle.ShuffleSequence(shuffleTarget, libunlynx.SuiTe.Point().Base(), collectiveKey, p.precomputed(collectiveKey, len(shuffleTarget)))
 
 	libunlynx.EndTimer(shufflingStartNoProof)
 
@@ -186,7 +233,13 @@ func (p *ShufflingProtocol) Start() error {
 func (p *ShufflingProtocol) Dispatch() error {
 	defer p.Done()
 
-	shufflingBytesMessageLength := <-p.LengthNodeChannel
+	// the root decides whether the data is streamed in batches
+	var shufflingBytesMessageLength shufflingBytesLengthStruct
+	select {
+	case shufflingBytesMessageLength = <-p.LengthNodeChannel:
+	case batch := <-p.BatchChannel:
+		return p.dispatchBatches(batch)
+	}
 
 	tmp := <-p.PreviousNodeInPathChannel
 	sm := ShufflingMessage{}
@@ -204,10 +257,6 @@ func (p *ShufflingProtocol) Dispatch() error {
 		collectiveKey = p.CollectiveKey
 	}
 
-	if p.Precomputed != nil {
-		log.Lvl1(p.Name(), " uses pre-computation in shuffling")
-	}
-
 	shuffledData := shuffleTarget
 	var pi []int
 	var beta [][]kyber.Scalar
@@ -215,7 +264,7 @@ func (p *ShufflingProtocol) Dispatch() error {
 	if !p.IsRoot() {
 		shufflingDispatchNoProof := libunlynx.StartTimer(p.Name() + "_Shuffling(DISPATCH-noProof)")
 
-		shuffledData, pi, beta = libunlynxshuffle.ShuffleSequence(shuffleTarget, libunlynx.SuiTe.Point().Base(), collectiveKey, p.Precomputed)
+		shuffledData, pi, beta = libunlynxshuffle.ShuffleSequence(shuffleTarget, libunlynx.SuiTe.Point().Base(), collectiveKey, p.precomputed(collectiveKey, len(shuffleTarget)))
 
 		libunlynx.EndTimer(shufflingDispatchNoProof)
 
@@ -264,6 +313,127 @@ func (p *ShufflingProtocol) Dispatch() error {
 	return nil
 }
 
+// StreamedShufflingShape returns the number of batches and rounds of a shuffle of nbrResponses responses streamed in
+// batches of batchSize responses. The batches are the shards of a sharded shuffle (see libunlynxshuffle.SplitShards):
+// there are at most MaxStreamingBatches of them, each containing at least two responses, and the responses are mixed
+// across the batches during DefaultShardedShufflingRounds rounds if there are several batches.
+func StreamedShufflingShape(nbrResponses, batchSize int) (int, int) {
+	return ShardedShufflingShape(nbrResponses, 1, len(streamingBatches(nbrResponses, batchSize)), 0)
+}
+
+// dispatchBatches handles a list streamed in batches (starting with the given batch). Each server shuffles each batch
+// on its own (one ShuffleSequence, and one proof, per batch) and forwards it as soon as it is shuffled: the next server
+// shuffles a batch while the previous one shuffles the following batch. As a response can not leave its batch during a
+// round, the root gathers the batches at the end of each round and mixes them (see libunlynxshuffle.RedistributeShards)
+// before streaming them again, which makes the whole shuffle a sharded shuffle whose proofs compose in the same way
+// (see libunlynxshuffle.ShardedShuffleProofVerification).
+func (p *ShufflingProtocol) dispatchBatches(batch shufflingBatchStruct) error {
+	for processed := int64(0); ; batch = <-p.BatchChannel {
+		sm := ShufflingMessage{}
+		if err := sm.FromBytes(batch.Data, batch.CVLengths); err != nil {
+			return err
+		}
+
+		if p.IsRoot() {
+			finished, err := p.batchShuffled(batch.Batch, batch.Round, sm.Data)
+			if err != nil || finished {
+				return err
+			}
+			continue
+		}
+
+		shuffledData, err := p.shuffleBatch(sm.Data)
+		if err != nil {
+			return err
+		}
+		if err := p.sendBatch(&batch.ShufflingBatchMessage, shuffledData); err != nil {
+			return err
+		}
+
+		// each batch goes through each server once per round
+		processed++
+		if processed >= batch.NbrBatches*batch.NbrRounds {
+			log.Lvl1(p.ServerIdentity(), " carried on shuffling (", processed, " batches).")
+			return nil
+		}
+	}
+}
+
+// startRound shuffles the batches at the root and streams them through the circuit
+func (p *ShufflingProtocol) startRound(round int) error {
+	p.received = 0
+	for i, batch := range p.batches {
+		shuffledData, err := p.shuffleBatch(batch)
+		if err != nil {
+			return err
+		}
+		msg := ShufflingBatchMessage{Batch: int64(i), Round: int64(round), NbrBatches: int64(len(p.batches)), NbrRounds: int64(p.nbrRounds)}
+		if err := p.sendBatch(&msg, shuffledData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchShuffled handles a batch shuffled by all the servers at the root and returns true once the protocol is finished
+func (p *ShufflingProtocol) batchShuffled(batch, round int64, data []libunlynx.CipherVector) (bool, error) {
+	if batch < 0 || batch >= int64(len(p.batches)) {
+		return false, errors.New("unknown batch " + strconv.FormatInt(batch, 10))
+	}
+	p.batches[batch] = data
+	p.received++
+	if p.received < len(p.batches) {
+		return false, nil
+	}
+
+	if int(round)+1 < p.nbrRounds {
+		var err error
+		if p.batches, err = libunlynxshuffle.RedistributeShards(p.batches); err != nil {
+			return false, err
+		}
+		return false, p.startRound(int(round) + 1)
+	}
+
+	result := libunlynxshuffle.MergeShards(p.batches)
+	log.Lvl1(p.ServerIdentity(), " completed shuffling (", len(result), " responses in batches)")
+	p.FeedbackChannel <- result
+	return true, nil
+}
+
+// shuffleBatch shuffles a batch with the proofs (if needed)
+func (p *ShufflingProtocol) shuffleBatch(shuffleTarget []libunlynx.CipherVector) ([]libunlynx.CipherVector, error) {
+	timer := time.Now()
+	shufflingBatch := libunlynx.StartTimer(p.Name() + "_Shuffling(BATCH)")
+
+	collectiveKey := p.Roster().Aggregate
+	// when testing protocol
+	if p.CollectiveKey != nil {
+		collectiveKey = p.CollectiveKey
+	}
+
+	shuffledData, pi, beta := libunlynxshuffle.ShuffleSequence(shuffleTarget, libunlynx.SuiTe.Point().Base(), collectiveKey, p.precomputed(collectiveKey, len(shuffleTarget)))
+	if p.Proofs {
+		if p.ProofFunc == nil {
+			return nil, errors.New("no proof function to create the shuffle proofs")
+		}
+		p.ProofFunc(shuffleTarget, shuffledData, collectiveKey, beta, pi)
+	}
+
+	libunlynx.EndTimer(shufflingBatch)
+	p.ExecTime += time.Since(timer)
+	return shuffledData, nil
+}
+
+// sendBatch sends a batch to the next node in the circuit
+func (p *ShufflingProtocol) sendBatch(msg *ShufflingBatchMessage, batch []libunlynx.CipherVector) error {
+	var err error
+	msg.Data, msg.CVLengths, err = (&ShufflingMessage{batch}).ToBytes()
+	if err != nil {
+		return err
+	}
+	return p.sendToNext(msg)
+}
+
 // Sends the message msg to the next node in the circuit based on the next TreeNode in Tree.List().
 func (p *ShufflingProtocol) sendToNext(msg interface{}) error {
 	err := p.SendTo(p.nextNodeInCircuit, msg)
@@ -273,6 +443,18 @@ func (p *ShufflingProtocol) sendToNext(msg interface{}) error {
 	return nil
 }
 
+// precomputed returns the precomputed values for a shuffle of nbrResponses responses
+func (p *ShufflingProtocol) precomputed(collectiveKey kyber.Point, nbrResponses int) []libunlynxshuffle.CipherVectorScalar {
+	precomputed := p.Precomputed
+	if p.PrecomputeFunc != nil {
+		precomputed = p.PrecomputeFunc(collectiveKey, nbrResponses)
+	}
+	if precomputed != nil {
+		log.Lvl1(p.Name(), " uses pre-computation in shuffling")
+	}
+	return precomputed
+}
+
 // Marshal
 //______________________________________________________________________________________________________________________
 
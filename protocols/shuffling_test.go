@@ -2,6 +2,8 @@ package protocolsunlynx_test
 
 import (
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -125,6 +127,98 @@ func TestShuffling(t *testing.T) {
 
 }
 
+// shufflingBatchesKey is the collective key used by the streamed shuffling test protocol
+var shufflingBatchesKey kyber.Point
+
+// shufflingBatchesProofs are the proofs of the shuffles of the streamed shuffling test protocol
+var shufflingBatchesProofs []libunlynxshuffle.PublishedShufflingProof
+var shufflingBatchesMutex sync.Mutex
+
+func TestShufflingBatches(t *testing.T) {
+	defer log.AfterTest(t)
+
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, err := onet.GlobalProtocolRegister("ShufflingBatchesTest", NewShufflingBatchesTest)
+	assert.NoError(t, err, "Failed to register the <ShufflingBatchesTest> protocol")
+
+	_, el, tree := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	secKey, pubKey := libunlynx.GenKey()
+	shufflingBatchesKey = pubKey
+	expected := []int64{1, 2, 3, 4, 5, 6, 7}
+	data := make([]libunlynx.CipherVector, len(expected))
+	for i, v := range expected {
+		data[i] = *libunlynx.EncryptIntVector(pubKey, []int64{v, 10 * v})
+	}
+
+	// the data is sent in one message (0), in batches or in a single batch
+	for _, batchSize := range []int{0, 1, 3, 10} {
+		shufflingBatchesMutex.Lock()
+		shufflingBatchesProofs = nil
+		shufflingBatchesMutex.Unlock()
+
+		rootInstance, err := local.CreateProtocol("ShufflingBatchesTest", tree)
+		assert.NoError(t, err)
+		protocol := rootInstance.(*protocolsunlynx.ShufflingProtocol)
+		protocol.ShuffleTarget = &data
+		protocol.BatchSize = batchSize
+
+		feedback := protocol.FeedbackChannel
+		go func() {
+			err := protocol.Start()
+			assert.NoError(t, err)
+		}()
+
+		timeout := network.WaitRetry * time.Duration(network.MaxRetryConnect*10) * time.Millisecond
+		select {
+		case result := <-feedback:
+			decrypted := make([]int64, len(result))
+			for i, cv := range result {
+				values := libunlynx.DecryptIntVector(secKey, &cv)
+				assert.Equal(t, 10*values[0], values[1])
+				decrypted[i] = values[0]
+			}
+			sort.Slice(decrypted, func(i, j int) bool { return decrypted[i] < decrypted[j] })
+			assert.Equal(t, expected, decrypted)
+
+			// each batch is shuffled by each server during each round: the proofs compose as the ones of a sharded shuffle
+			nbrBatches, nbrRounds := 1, 1
+			if batchSize > 0 {
+				nbrBatches, nbrRounds = protocolsunlynx.StreamedShufflingShape(len(data), batchSize)
+			}
+			shufflingBatchesMutex.Lock()
+			proofs := shufflingBatchesProofs
+			shufflingBatchesMutex.Unlock()
+			assert.Equal(t, nbrBatches*nbrRounds*len(el.List), len(proofs))
+			assert.True(t, libunlynxshuffle.ShardedShuffleProofVerification(data, result, proofs, nbrBatches, nbrRounds, len(el.List), pubKey))
+			assert.False(t, libunlynxshuffle.ShardedShuffleProofVerification(data, result, proofs[1:], nbrBatches, nbrRounds, len(el.List), pubKey))
+		case <-time.After(timeout):
+			t.Fatal("Didn't finish in time")
+		}
+	}
+}
+
+// NewShufflingBatchesTest is a special purpose protocol constructor specific to tests.
+func NewShufflingBatchesTest(tni *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	pi, err := protocolsunlynx.NewShufflingProtocol(tni)
+	protocol := pi.(*protocolsunlynx.ShufflingProtocol)
+
+	protocol.CollectiveKey = shufflingBatchesKey
+	protocol.Proofs = true
+	protocol.ProofFunc = func(shuffleTarget, shuffledData []libunlynx.CipherVector, collectiveKey kyber.Point, beta [][]kyber.Scalar, pi []int) *libunlynxshuffle.PublishedShufflingProof {
+		proof, err := libunlynxshuffle.ShuffleProofCreation(shuffleTarget, shuffledData, libunlynx.SuiTe.Point().Base(), collectiveKey, beta, pi)
+		if err != nil {
+			log.Fatal(err)
+		}
+		shufflingBatchesMutex.Lock()
+		shufflingBatchesProofs = append(shufflingBatchesProofs, proof)
+		shufflingBatchesMutex.Unlock()
+		return &proof
+	}
+	return protocol, err
+}
+
 // NewShufflingTest is a special purpose protocol constructor specific to tests.
 func NewShufflingTest(tni *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 	pi, err := protocolsunlynx.NewShufflingProtocol(tni)
@@ -143,3 +237,18 @@ func NewShufflingTest(tni *onet.TreeNodeInstance) (onet.ProtocolInstance, error)
 	}
 	return protocol, err
 }
+
+func TestStreamedShufflingShape(t *testing.T) {
+	// the batches contain at least two responses and are mixed during several rounds if there are several of them
+	for _, test := range []struct{ nbrResponses, batchSize, nbrBatches, nbrRounds int }{
+		{7, 1, 3, 2},
+		{7, 3, 3, 2},
+		{7, 10, 1, 1},
+		{1, 1, 1, 1},
+		{10 * protocolsunlynx.MaxStreamingBatches, 1, protocolsunlynx.MaxStreamingBatches, protocolsunlynx.DefaultShardedShufflingRounds},
+	} {
+		nbrBatches, nbrRounds := protocolsunlynx.StreamedShufflingShape(test.nbrResponses, test.batchSize)
+		assert.Equal(t, test.nbrBatches, nbrBatches)
+		assert.Equal(t, test.nbrRounds, nbrRounds)
+	}
+}
@@ -158,3 +158,77 @@ func AdaptCipherTextArray(cipherTexts []libunlynx.CipherText) []libunlynx.Cipher
 	}
 	return result
 }
+
+// _____________________ SHUFFLING+DDT PROTOCOL _____________________
+
+// ProcessResponseToTaggedMatrixCipherText transforms a process response to the array of CipherVector shuffled and tagged
+// by the shuffling+ddt protocol: a copy of the attributes to tag (where then group by, as in
+// ProcessResponseToCipherVector) followed by the CipherVector of ProcessResponseToMatrixCipherText, which is only
+// shuffled. Returns also the number of attributes to tag and the lengths to rebuild the process responses.
+func ProcessResponseToTaggedMatrixCipherText(pr []libunlynx.ProcessResponse) ([]libunlynx.CipherVector, int, [][]int) {
+	cv, lengths := ProcessResponseToMatrixCipherText(pr)
+	if len(cv) == 0 {
+		return cv, 0, lengths
+	}
+
+	nbrTagged := lengths[0][0] + lengths[0][1]
+	for i, l := range lengths {
+		tagged := make(libunlynx.CipherVector, 0, nbrTagged+len(cv[i]))
+		tagged = append(tagged, cv[i][l[0]:l[0]+l[1]]...)
+		tagged = append(tagged, cv[i][:l[0]]...)
+		cv[i] = append(tagged, cv[i]...)
+	}
+	return cv, nbrTagged, lengths
+}
+
+// TaggedMatrixCipherTextToProcessResponse transforms the CipherVector array shuffled by the shuffling+ddt protocol back
+// into a ProcessResponse (without the tagged copy of the attributes)
+func TaggedMatrixCipherTextToProcessResponse(cv []libunlynx.CipherVector, nbrTagged int, lengths [][]int) []libunlynx.ProcessResponse {
+	shuffled := make([]libunlynx.CipherVector, len(cv))
+	for i := range cv {
+		shuffled[i] = cv[i][nbrTagged:]
+	}
+	return MatrixCipherTextToProcessResponse(shuffled, lengths)
+}
+
+// DeterministCipherMatrixToVector concatenates the tags of the shuffling+ddt protocol in the order of
+// ProcessResponseToCipherVector
+func DeterministCipherMatrixToVector(tags []libunlynx.DeterministCipherVector) libunlynx.DeterministCipherVector {
+	result := make(libunlynx.DeterministCipherVector, 0)
+	for _, v := range tags {
+		result = append(result, v...)
+	}
+	return result
+}
+
+// _____________________ STREAMING (SHUFFLING AND DETERMINISTIC_TAGGING PROTOCOLS) _____________________
+
+// MaxStreamingBatches is the maximum number of batches in which a list is streamed through the circuit of servers: a
+// server can receive all the batches (of both rounds of the deterministic tagging) at once, which has to fit in the
+// channel of the protocol
+const MaxStreamingBatches = 256
+
+// streamingBatches returns the bounds [start, end) of the batches of batchSize elements of a list of n elements. The
+// batches are larger if needed so that there are at most MaxStreamingBatches of them (an empty list is sent in one
+// empty batch).
+func streamingBatches(n, batchSize int) [][2]int {
+	if batchSize < (n+MaxStreamingBatches-1)/MaxStreamingBatches {
+		batchSize = (n + MaxStreamingBatches - 1) / MaxStreamingBatches
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	batches := make([][2]int, 0, (n+batchSize-1)/batchSize+1)
+	for start := 0; start < n; start += batchSize {
+		end := start + batchSize
+		if end > n {
+			end = n
+		}
+		batches = append(batches, [2]int{start, end})
+	}
+	if len(batches) == 0 {
+		batches = append(batches, [2]int{0, 0})
+	}
+	return batches
+}
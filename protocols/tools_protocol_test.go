@@ -110,6 +110,28 @@ func TestProcessResponseToMatrixCipherText(t *testing.T) {
 	}
 }
 
+func TestProcessResponseToTaggedMatrixCipherText(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+
+	mapi := make([]libunlynx.ProcessResponse, 3)
+	for i := range mapi {
+		mapi[i] = libunlynx.ProcessResponse{GroupByEnc: *libunlynx.EncryptIntVector(pubKey, []int64{int64(i), 1}),
+			WhereEnc: *libunlynx.EncryptIntVector(pubKey, []int64{2}), AggregatingAttributes: *libunlynx.EncryptIntVector(pubKey, []int64{3, 4})}
+	}
+
+	cv, nbrTagged, lengths := protocolsunlynx.ProcessResponseToTaggedMatrixCipherText(mapi)
+	assert.Equal(t, 3, nbrTagged)
+	// the attributes to tag come first, in the order of the deterministic tagging
+	assert.Equal(t, protocolsunlynx.ProcessResponseToCipherVector(mapi[:1]), cv[0][:nbrTagged])
+	mapiToTest := protocolsunlynx.TaggedMatrixCipherTextToProcessResponse(cv, nbrTagged, lengths)
+	for i, v := range mapi {
+		assert.True(t, reflect.DeepEqual(mapiToTest[i], v))
+	}
+
+	tags := []libunlynx.DeterministCipherVector{{libunlynx.DeterministCipherText{Point: pubKey}}, {libunlynx.DeterministCipherText{Point: pubKey}, libunlynx.DeterministCipherText{Point: pubKey}}}
+	assert.Equal(t, 3, len(protocolsunlynx.DeterministCipherMatrixToVector(tags)))
+}
+
 func TestAdaptCipherTextArray(t *testing.T) {
 	_, pubKey := libunlynx.GenKey()
 
@@ -0,0 +1,212 @@
+package protocolsunlynxutils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/aggregation"
+	"github.com/ldsec/unlynx/lib/deterministic_tag"
+	"github.com/ldsec/unlynx/lib/key_switch"
+	"github.com/ldsec/unlynx/lib/shuffle"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// ProofsBundleVersion is the version of the proofs bundle format
+const ProofsBundleVersion = 3
+
+// ProofsBundle is the serializable form of the proofs of a server for a survey (see ProofsToVerify), which can be
+// exported and verified offline against the roster of the survey. It is signed by the proof verifier which exported it,
+// for the survey and the results it was created for.
+type ProofsBundle struct {
+	Version  int
+	SurveyID string
+	// Server is the server (ServerIdentity.String()) which created the proofs
+	Server string
+	// ResultsDigest is the digest of the results of the survey (see servicesunlynx.ResultsDigest)
+	ResultsDigest []byte
+
+	KeySwitching          libunlynxkeyswitch.PublishedKSListProofBytes
+	DetTagCreation        libunlynxdetertag.PublishedDDTCreationListProofBytes
+	DetTagAddition        libunlynxdetertag.PublishedDDTAdditionListProofBytes
+	Aggregation           libunlynxaggr.PublishedAggregationListProofBytes
+	Shuffling             libunlynxshuffle.PublishedShufflingListProofBytes
+	CollectiveAggregation libunlynxaggr.PublishedAggregationListProofBytes
+
+	// Verifier is the proof verifier (ServerIdentity.String()) which signed the bundle
+	Verifier  string
+	Signature []byte
+}
+
+// NewProofsBundle creates the (unsigned) bundle of the proofs of a server for the results of a survey
+func NewProofsBundle(surveyID, server string, resultsDigest []byte, ptv ProofsToVerify) (*ProofsBundle, error) {
+	pb := ProofsBundle{Version: ProofsBundleVersion, SurveyID: surveyID, Server: server, ResultsDigest: resultsDigest}
+
+	var err error
+	if pb.KeySwitching, err = ptv.KeySwitchingProofs.ToBytes(); err != nil {
+		return nil, err
+	}
+	if pb.DetTagCreation, err = ptv.DetTagCreationProofs.ToBytes(); err != nil {
+		return nil, err
+	}
+	if pb.DetTagAddition, err = ptv.DetTagAdditionProofs.ToBytes(); err != nil {
+		return nil, err
+	}
+	if pb.Aggregation, err = ptv.AggregationProofs.ToBytes(); err != nil {
+		return nil, err
+	}
+	if pb.Shuffling, err = ptv.ShufflingProofs.ToBytes(); err != nil {
+		return nil, err
+	}
+	if pb.CollectiveAggregation, err = ptv.CollectiveAggregationProofs.ToBytes(); err != nil {
+		return nil, err
+	}
+	return &pb, nil
+}
+
+// ProofsToVerify converts a bundle back to the proofs to verify
+func (pb *ProofsBundle) ProofsToVerify() (ProofsToVerify, error) {
+	ptv := ProofsToVerify{}
+	if pb.Version != ProofsBundleVersion {
+		return ptv, errors.New("unsupported proofs bundle version " + strconv.Itoa(pb.Version))
+	}
+
+	if err := ptv.KeySwitchingProofs.FromBytes(pb.KeySwitching); err != nil {
+		return ptv, err
+	}
+	if err := ptv.AggregationProofs.FromBytes(pb.Aggregation); err != nil {
+		return ptv, err
+	}
+	if err := ptv.DetTagCreationProofs.FromBytes(pb.DetTagCreation); err != nil {
+		return ptv, err
+	}
+	if err := ptv.DetTagAdditionProofs.FromBytes(pb.DetTagAddition); err != nil {
+		return ptv, err
+	}
+	if err := ptv.ShufflingProofs.FromBytes(pb.Shuffling); err != nil {
+		return ptv, err
+	}
+	if err := ptv.CollectiveAggregationProofs.FromBytes(pb.CollectiveAggregation); err != nil {
+		return ptv, err
+	}
+	return ptv, nil
+}
+
+// Digest returns the digest of the bundle (without its signature) signed by its proof verifier
+func (pb *ProofsBundle) Digest() ([]byte, error) {
+	unsigned := *pb
+	unsigned.Signature = nil
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(unsigned); err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(buf.Bytes())
+	return digest[:], nil
+}
+
+// Sign signs the bundle with the key of the proof verifier exporting it
+func (pb *ProofsBundle) Sign(verifier *network.ServerIdentity, private kyber.Scalar) error {
+	pb.Verifier = verifier.String()
+	digest, err := pb.Digest()
+	if err != nil {
+		return err
+	}
+	pb.Signature, err = schnorr.Sign(libunlynx.SuiTe, private, digest)
+	return err
+}
+
+// Verify verifies the proofs of a bundle against the roster of the survey: the bundle has to be signed by a server of
+// the roster for this survey (and these results if resultsDigest is not nil), the server has to be in the roster and
+// its proofs have to be created with its key (see CheckServerProofs) and the shuffling proofs with the collective key
+// of the roster. The results are in the order of the ProofsVerificationProtocol.
+func (pb *ProofsBundle) Verify(roster *onet.Roster, surveyID string, resultsDigest []byte) ([]bool, error) {
+	if pb.SurveyID != surveyID {
+		return nil, errors.New("proofs bundle of " + pb.Server + " is for survey " + pb.SurveyID + ", not " + surveyID)
+	}
+	if resultsDigest != nil && !bytes.Equal(pb.ResultsDigest, resultsDigest) {
+		return nil, errors.New("proofs bundle of " + pb.Server + " is not for these results")
+	}
+
+	var serverKey, verifierKey kyber.Point
+	for _, si := range roster.List {
+		if si.String() == pb.Server {
+			serverKey = si.Public
+		}
+		if si.String() == pb.Verifier {
+			verifierKey = si.Public
+		}
+	}
+	if serverKey == nil {
+		return nil, errors.New("server " + pb.Server + " is not in the roster")
+	}
+	if verifierKey == nil {
+		return nil, errors.New("proof verifier " + pb.Verifier + " is not in the roster")
+	}
+	digest, err := pb.Digest()
+	if err != nil {
+		return nil, err
+	}
+	if err := schnorr.Verify(libunlynx.SuiTe, verifierKey, digest, pb.Signature); err != nil {
+		return nil, errors.New("invalid signature of the proofs bundle of " + pb.Server + ": " + err.Error())
+	}
+
+	ptv, err := pb.ProofsToVerify()
+	if err != nil {
+		return nil, errors.New("malformed proofs bundle of " + pb.Server + ": " + err.Error())
+	}
+	if err := CheckServerProofs(ptv, serverKey); err != nil {
+		return nil, errors.New("proofs of " + pb.Server + ": " + err.Error())
+	}
+	return VerifyProofs(ptv, roster.Aggregate), nil
+}
+
+// CheckServerProofs checks that the proofs of a server are created with its key: its key switching and deterministic
+// tagging creation proofs with its public key, and its deterministic tagging addition proofs with the secret of its
+// creation proofs
+func CheckServerProofs(ptv ProofsToVerify, serverKey kyber.Point) error {
+	for _, pksp := range ptv.KeySwitchingProofs.List {
+		if !pksp.K.Equal(serverKey) {
+			return errors.New("key switching proofs are not created with the key of the server")
+		}
+	}
+	if ptv.DetTagCreationProofs.K != nil && !ptv.DetTagCreationProofs.K.Equal(serverKey) {
+		return errors.New("deterministic tagging proofs are not created with the key of the server")
+	}
+	if len(ptv.DetTagAdditionProofs.List) == 0 {
+		return nil
+	}
+	if ptv.DetTagCreationProofs.SB == nil {
+		return errors.New("deterministic tagging addition proofs without creation proofs")
+	}
+	for _, pdap := range ptv.DetTagAdditionProofs.List {
+		contribution := pdap.Contribution()
+		if contribution == nil || !contribution.Equal(ptv.DetTagCreationProofs.SB) {
+			return errors.New("deterministic tagging addition proofs are not created with the secret of the server")
+		}
+	}
+	return nil
+}
+
+// Marshal
+//______________________________________________________________________________________________________________________
+
+// WriteProofsBundles writes proofs bundles to w (gob encoded)
+func WriteProofsBundles(w io.Writer, bundles []ProofsBundle) error {
+	return gob.NewEncoder(w).Encode(bundles)
+}
+
+// ReadProofsBundles reads proofs bundles written by WriteProofsBundles
+func ReadProofsBundles(r io.Reader) ([]ProofsBundle, error) {
+	bundles := make([]ProofsBundle, 0)
+	if err := gob.NewDecoder(r).Decode(&bundles); err != nil {
+		return nil, errors.New("malformed proofs bundles: " + err.Error())
+	}
+	return bundles, nil
+}
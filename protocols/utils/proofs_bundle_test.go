@@ -0,0 +1,142 @@
+package protocolsunlynxutils_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/aggregation"
+	"github.com/ldsec/unlynx/lib/deterministic_tag"
+	"github.com/ldsec/unlynx/lib/key_switch"
+	"github.com/ldsec/unlynx/lib/shuffle"
+	"github.com/ldsec/unlynx/protocols/utils"
+	"github.com/stretchr/testify/assert"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestProofsBundle(t *testing.T) {
+	secKey, pubKey := libunlynx.GenKey()
+	_, pubKeyOther := libunlynx.GenKey()
+	_, pubKeyNew := libunlynx.GenKey()
+
+	server := network.NewServerIdentity(pubKey, network.NewAddress(network.Local, "localhost:2000"))
+	other := network.NewServerIdentity(pubKeyOther, network.NewAddress(network.Local, "localhost:2002"))
+	roster := onet.NewRoster([]*network.ServerIdentity{server, other})
+
+	cipherOne := *libunlynx.EncryptInt(roster.Aggregate, 10)
+	cipherVect := libunlynx.CipherVector{cipherOne, cipherOne}
+
+	// key switching
+	_, ks2s, rBNegs, vis := libunlynxkeyswitch.KeySwitchSequence(pubKeyNew, []kyber.Point{cipherOne.K, cipherOne.K}, secKey)
+	pskp, err := libunlynxkeyswitch.KeySwitchListProofCreation(pubKey, pubKeyNew, secKey, ks2s, rBNegs, vis)
+	assert.NoError(t, err)
+
+	// deterministic tagging
+	secContrib, _ := libunlynx.GenKey()
+	tagged := libunlynxdetertag.DeterministicTagSequence(cipherVect, secKey, secContrib)
+	pdclp, err := libunlynxdetertag.DeterministicTagCrListProofCreation(cipherVect, tagged, pubKey, secKey, secContrib)
+	assert.NoError(t, err)
+	toAdd := libunlynx.SuiTe.Point().Mul(secContrib, libunlynx.SuiTe.Point().Base())
+	pdap, err := libunlynxdetertag.DeterministicTagAdditionProofCreation(cipherOne.C, secContrib, toAdd, libunlynx.SuiTe.Point().Add(cipherOne.C, toAdd))
+	assert.NoError(t, err)
+
+	// aggregation
+	aggregationProofs := libunlynxaggr.PublishedAggregationListProof{}
+	aggregationProofs.List = append(aggregationProofs.List, libunlynxaggr.AggregationProofCreation(cipherVect, cipherVect.Acum()))
+
+	// shuffling (with the collective key of the roster)
+	toShuffle := []libunlynx.CipherVector{cipherVect, cipherVect, cipherVect}
+	shuffled, pi, beta := libunlynxshuffle.ShuffleSequence(toShuffle, libunlynx.SuiTe.Point().Base(), roster.Aggregate, nil)
+	psp, err := libunlynxshuffle.ShuffleProofCreation(toShuffle, shuffled, libunlynx.SuiTe.Point().Base(), roster.Aggregate, beta, pi)
+	assert.NoError(t, err)
+
+	ptv := protocolsunlynxutils.ProofsToVerify{
+		KeySwitchingProofs:          pskp,
+		DetTagCreationProofs:        pdclp,
+		DetTagAdditionProofs:        libunlynxdetertag.PublishedDDTAdditionListProof{List: []libunlynxdetertag.PublishedDDTAdditionProof{pdap}},
+		AggregationProofs:           aggregationProofs,
+		ShufflingProofs:             libunlynxshuffle.PublishedShufflingListProof{List: []libunlynxshuffle.PublishedShufflingProof{psp}},
+		CollectiveAggregationProofs: aggregationProofs,
+	}
+	digest := []byte("results")
+	pb, err := protocolsunlynxutils.NewProofsBundle("survey", server.String(), digest, ptv)
+	assert.NoError(t, err)
+	assert.NoError(t, pb.Sign(server, secKey))
+
+	// export and import
+	buf := bytes.Buffer{}
+	assert.NoError(t, protocolsunlynxutils.WriteProofsBundles(&buf, []protocolsunlynxutils.ProofsBundle{*pb}))
+	bundles, err := protocolsunlynxutils.ReadProofsBundles(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(bundles))
+
+	results, err := bundles[0].Verify(roster, "survey", digest)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, true, true, true, true, true}, results)
+
+	// the shuffling proofs are not valid for another roster
+	results, err = bundles[0].Verify(onet.NewRoster([]*network.ServerIdentity{server}), "survey", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, true, true, true, false, true}, results)
+
+	// the server has to be in the roster and to have created the key switching proofs
+	_, err = bundles[0].Verify(onet.NewRoster([]*network.ServerIdentity{other}), "survey", digest)
+	assert.Error(t, err)
+
+	// the bundle is bound to the survey and the results, and signed by a server of the roster
+	_, err = bundles[0].Verify(roster, "other survey", digest)
+	assert.Error(t, err)
+	_, err = bundles[0].Verify(roster, "survey", []byte("other results"))
+	assert.Error(t, err)
+
+	tampered := bundles[0]
+	tampered.ResultsDigest = []byte("other results")
+	_, err = tampered.Verify(roster, "survey", tampered.ResultsDigest)
+	assert.Error(t, err)
+
+	outsider := network.NewServerIdentity(pubKeyNew, network.NewAddress(network.Local, "localhost:2004"))
+	resigned := bundles[0]
+	assert.NoError(t, resigned.Sign(outsider, secKey))
+	_, err = resigned.Verify(roster, "survey", digest)
+	assert.Error(t, err)
+
+	otherBundle := bundles[0]
+	otherBundle.Server = other.String()
+	_, err = otherBundle.Verify(roster, "survey", digest)
+	assert.Error(t, err)
+
+	// incomplete or unsupported bundles are rejected
+	incomplete := bundles[0]
+	incomplete.Shuffling.List = []libunlynxshuffle.PublishedShufflingProofBytes{{}}
+	_, err = incomplete.Verify(roster, "survey", digest)
+	assert.Error(t, err)
+
+	// the deterministic tagging addition proofs have to be created with the secret of the server
+	secOther, _ := libunlynx.GenKey()
+	toAddOther := libunlynx.SuiTe.Point().Mul(secOther, libunlynx.SuiTe.Point().Base())
+	pdapOther, err := libunlynxdetertag.DeterministicTagAdditionProofCreation(cipherOne.C, secOther, toAddOther, libunlynx.SuiTe.Point().Add(cipherOne.C, toAddOther))
+	assert.NoError(t, err)
+	ptvOther := ptv
+	ptvOther.DetTagAdditionProofs = libunlynxdetertag.PublishedDDTAdditionListProof{List: []libunlynxdetertag.PublishedDDTAdditionProof{pdap, pdapOther}}
+	assert.Error(t, protocolsunlynxutils.CheckServerProofs(ptvOther, pubKey))
+	foreign, err := protocolsunlynxutils.NewProofsBundle("survey", server.String(), digest, ptvOther)
+	assert.NoError(t, err)
+	assert.NoError(t, foreign.Sign(server, secKey))
+	_, err = foreign.Verify(roster, "survey", digest)
+	assert.Error(t, err)
+
+	ptvOther.DetTagCreationProofs = libunlynxdetertag.PublishedDDTCreationListProof{}
+	ptvOther.DetTagAdditionProofs.List = ptvOther.DetTagAdditionProofs.List[:1]
+	assert.Error(t, protocolsunlynxutils.CheckServerProofs(ptvOther, pubKey))
+	assert.NoError(t, protocolsunlynxutils.CheckServerProofs(ptv, pubKey))
+
+	unsupported := bundles[0]
+	unsupported.Version = protocolsunlynxutils.ProofsBundleVersion + 1
+	_, err = unsupported.Verify(roster, "survey", digest)
+	assert.Error(t, err)
+
+	_, err = protocolsunlynxutils.ReadProofsBundles(bytes.NewBufferString("not a bundle"))
+	assert.Error(t, err)
+}
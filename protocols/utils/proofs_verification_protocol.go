@@ -10,6 +10,7 @@ import (
 	"github.com/ldsec/unlynx/lib/deterministic_tag"
 	"github.com/ldsec/unlynx/lib/key_switch"
 	"github.com/ldsec/unlynx/lib/shuffle"
+	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
 )
@@ -36,6 +37,18 @@ type ProofsToVerify struct {
 	CollectiveAggregationProofs libunlynxaggr.PublishedAggregationListProof
 }
 
+// Indexes of the verification result of each type of proofs in the results of verifyProofs
+const (
+	KeySwitchingResult = iota
+	DetTagCreationResult
+	DetTagAdditionResult
+	AggregationResult
+	ShufflingResult
+	CollectiveAggregationResult
+	// NbrResults is the number of verification results
+	NbrResults
+)
+
 // ProofsVerificationProtocol is a struct holding the state of a protocol instance.
 type ProofsVerificationProtocol struct {
 	*onet.TreeNodeInstance
@@ -45,6 +58,10 @@ type ProofsVerificationProtocol struct {
 
 	// Protocol state data
 	TargetOfVerification ProofsToVerify
+	// CollectiveKey is the key used in the shuffling proofs (the aggregate key of the roster by default)
+	CollectiveKey kyber.Point
+
+	finalResult chan []bool
 }
 
 // NewProofsVerificationProtocol is constructor of Proofs Verification protocol instances.
@@ -52,62 +69,74 @@ func NewProofsVerificationProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInsta
 	pvp := &ProofsVerificationProtocol{
 		TreeNodeInstance: n,
 		FeedbackChannel:  make(chan []bool),
+		finalResult:      make(chan []bool, 1),
 	}
 
 	return pvp, nil
 }
 
-var finalResult = make(chan []bool)
-
 // Start is called at the root to start the execution of the key switching.
 func (p *ProofsVerificationProtocol) Start() error {
+	collectiveKey := p.Roster().Aggregate
+	if p.CollectiveKey != nil {
+		collectiveKey = p.CollectiveKey
+	}
+	p.finalResult <- verifyProofs(p.Name(), p.TargetOfVerification, collectiveKey)
+	return nil
+}
 
-	// we have 6 different types of proofs (check ProofsToVerify struct)
-	result := make([]bool, 6)
+// VerifyProofs verifies proofs outside of a protocol (e.g. an exported proofs bundle). collectiveKey is the key used in
+// the shuffling proofs.
+func VerifyProofs(ptv ProofsToVerify, collectiveKey kyber.Point) []bool {
+	return verifyProofs(ProofsVerificationProtocolName, ptv, collectiveKey)
+}
+
+// verifyProofs verifies the 6 different types of proofs (check ProofsToVerify struct)
+func verifyProofs(name string, ptv ProofsToVerify, collectiveKey kyber.Point) []bool {
+	result := make([]bool, NbrResults)
 
 	// key switching ***************************************************************************************************
-	keySwitchTime := libunlynx.StartTimer(p.Name() + "_KeySwitchingVerif")
-	result[0] = libunlynxkeyswitch.KeySwitchListProofVerification(p.TargetOfVerification.KeySwitchingProofs, 1.0)
+	keySwitchTime := libunlynx.StartTimer(name + "_KeySwitchingVerif")
+	result[KeySwitchingResult] = libunlynxkeyswitch.KeySwitchListProofVerification(ptv.KeySwitchingProofs, 1.0)
 	libunlynx.EndTimer(keySwitchTime)
 
 	// deterministic tagging (creation) ********************************************************************************
-	detTagTime := libunlynx.StartTimer(p.Name() + "_DetTagVerif")
-	result[1] = libunlynxdetertag.DeterministicTagCrListProofVerification(p.TargetOfVerification.DetTagCreationProofs, 1.0)
+	detTagTime := libunlynx.StartTimer(name + "_DetTagVerif")
+	result[DetTagCreationResult] = libunlynxdetertag.DeterministicTagCrListProofVerification(ptv.DetTagCreationProofs, 1.0)
 	libunlynx.EndTimer(detTagTime)
 
 	// deterministic tagging (addition) ********************************************************************************
 
-	detTagAddTime := libunlynx.StartTimer(p.Name() + "_DetTagAddVerif")
-	result[2] = libunlynxdetertag.DeterministicTagAdditionListProofVerification(p.TargetOfVerification.DetTagAdditionProofs, 1.0)
+	detTagAddTime := libunlynx.StartTimer(name + "_DetTagAddVerif")
+	result[DetTagAdditionResult] = libunlynxdetertag.DeterministicTagAdditionListProofVerification(ptv.DetTagAdditionProofs, 1.0)
 	libunlynx.EndTimer(detTagAddTime)
 
 	// local aggregation ***********************************************************************************************
 
-	localAggrTime := libunlynx.StartTimer(p.Name() + "_LocalAggrVerif")
-	result[3] = libunlynxaggr.AggregationListProofVerification(p.TargetOfVerification.AggregationProofs, 1.0)
+	localAggrTime := libunlynx.StartTimer(name + "_LocalAggrVerif")
+	result[AggregationResult] = libunlynxaggr.AggregationListProofVerification(ptv.AggregationProofs, 1.0)
 	libunlynx.EndTimer(localAggrTime)
 
 	// shuffling *******************************************************************************************************
 
-	shufflingTime := libunlynx.StartTimer(p.Name() + "_ShufflingVerif")
-	result[4] = libunlynxshuffle.ShuffleListProofVerification(p.TargetOfVerification.ShufflingProofs, p.Roster().Aggregate, 1.0)
+	shufflingTime := libunlynx.StartTimer(name + "_ShufflingVerif")
+	result[ShufflingResult] = libunlynxshuffle.ShuffleListProofVerification(ptv.ShufflingProofs, collectiveKey, 1.0)
 	libunlynx.EndTimer(shufflingTime)
 
 	// collective aggregation ******************************************************************************************
 
-	collectiveAggrTime := libunlynx.StartTimer(p.Name() + "_CollectiveAggrVerif")
-	result[5] = libunlynxaggr.AggregationListProofVerification(p.TargetOfVerification.CollectiveAggregationProofs, 1.0)
+	collectiveAggrTime := libunlynx.StartTimer(name + "_CollectiveAggrVerif")
+	result[CollectiveAggregationResult] = libunlynxaggr.AggregationListProofVerification(ptv.CollectiveAggregationProofs, 1.0)
 	libunlynx.EndTimer(collectiveAggrTime)
 
-	finalResult <- result
-	return nil
+	return result
 }
 
 // Dispatch is called on each node. It waits for incoming messages and handle them.
 func (p *ProofsVerificationProtocol) Dispatch() error {
 	defer p.Done()
 
-	aux := <-finalResult
+	aux := <-p.finalResult
 	p.FeedbackChannel <- aux
 	return nil
 }
@@ -1,13 +1,22 @@
 package servicesunlynx
 
 import (
+	"errors"
+	"sync"
+	"time"
+
 	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/audit"
+	"github.com/ldsec/unlynx/lib/encryption_proof"
+	"github.com/ldsec/unlynx/lib/range_proof"
+	"github.com/ldsec/unlynx/protocols/utils"
+	"github.com/satori/go.uuid"
 	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
 	"go.dedis.ch/kyber/v3/util/key"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
-	"sync"
 )
 
 // API represents a client with the server to which he is connected and its public/private key pair.
@@ -17,11 +26,19 @@ type API struct {
 	entryPoint *network.ServerIdentity
 	public     kyber.Point
 	private    kyber.Scalar
+
+	// surveys to which the client is registered as a data provider (its responses are then signed)
+	registeredMutex sync.Mutex
+	registered      map[SurveyID]bool
 }
 
 // NewUnLynxClient constructor of a client.
 func NewUnLynxClient(entryPoint *network.ServerIdentity, clientID string) *API {
-	keys := key.NewKeyPair(libunlynx.SuiTe)
+	return NewUnLynxClientWithKeys(entryPoint, clientID, key.NewKeyPair(libunlynx.SuiTe))
+}
+
+// NewUnLynxClientWithKeys constructor of a client with a given key pair (e.g. the key of an auditor).
+func NewUnLynxClientWithKeys(entryPoint *network.ServerIdentity, clientID string, keys *key.Pair) *API {
 	newClient := &API{
 
 		Client:     onet.NewClient(libunlynx.SuiTe, ServiceName),
@@ -29,6 +46,7 @@ func NewUnLynxClient(entryPoint *network.ServerIdentity, clientID string) *API {
 		entryPoint: entryPoint,
 		public:     keys.Public,
 		private:    keys.Private,
+		registered: make(map[SurveyID]bool),
 	}
 	return newClient
 }
@@ -38,11 +56,7 @@ func NewUnLynxClient(entryPoint *network.ServerIdentity, clientID string) *API {
 
 // SendSurveyCreationQuery creates a survey based on a set of entities (servers) and a survey description.
 func (c *API) SendSurveyCreationQuery(entities *onet.Roster, surveyID SurveyID, clientPubKey kyber.Point, nbrDPs map[string]int64, proofs, appFlag bool, sum []string, count bool, where []libunlynx.WhereQueryAttribute, predicate string, groupBy []string) (*SurveyID, error) {
-	log.Lvl1(c, "is creating a survey with id: ", surveyID)
-
-	var newSurveyID SurveyID
-
-	scq := SurveyCreationQuery{
+	return c.SendSurveyQuery(SurveyCreationQuery{
 		SurveyID:     surveyID,
 		Roster:       *entities,
 		ClientPubKey: clientPubKey,
@@ -56,7 +70,16 @@ func (c *API) SendSurveyCreationQuery(entities *onet.Roster, surveyID SurveyID,
 		Where:     where,
 		Predicate: predicate,
 		GroupBy:   groupBy,
-	}
+	})
+}
+
+// SendSurveyQuery creates a survey from a complete survey description. It permits to use query options (e.g. histograms)
+// that are not available in SendSurveyCreationQuery.
+func (c *API) SendSurveyQuery(scq SurveyCreationQuery) (*SurveyID, error) {
+	log.Lvl1(c, "is creating a survey with id: ", scq.SurveyID)
+
+	var newSurveyID SurveyID
+
 	resp := ServiceState{}
 	err := c.SendProtobuf(c.entryPoint, &scq, &resp)
 	if err != nil {
@@ -68,6 +91,21 @@ func (c *API) SendSurveyCreationQuery(entities *onet.Roster, surveyID SurveyID,
 	return &newSurveyID, nil
 }
 
+// SendSchemaRegistrationQuery registers the schema of the dataset held by the data providers of a roster. The queries and
+// DP responses of the surveys run by the roster are then validated against this schema. The registration is signed with
+// the key of the client, which has to be an admin of the servers (see Service.SetSchemaAdmins) or the key of a server.
+func (c *API) SendSchemaRegistrationQuery(entities *onet.Roster, schema libunlynx.DatasetSchema) error {
+	log.Lvl1(c, " registers a schema with ", len(schema.Attributes), " attributes")
+	resp := ServiceState{}
+	registrationTime := time.Now().UnixNano()
+	signature, err := schnorr.Sign(libunlynx.SuiTe, c.private, SchemaRegistrationDigest(entities, &schema, registrationTime))
+	if err != nil {
+		return err
+	}
+	return c.SendProtobuf(c.entryPoint, &SchemaRegistrationQuery{Roster: *entities, Schema: schema, Registrant: c.public,
+		Time: registrationTime, Signature: signature}, &resp)
+}
+
 // SendSurveyResponseQuery handles the encryption and sending of DP responses
 func (c *API) SendSurveyResponseQuery(surveyID SurveyID, clearClientResponses []libunlynx.DpClearResponse, groupKey kyber.Point, dataRepetitions int, count bool) error {
 	log.Lvl1(c, " sends a result for survey ", surveyID)
@@ -78,28 +116,311 @@ func (c *API) SendSurveyResponseQuery(surveyID SurveyID, clearClientResponses []
 		return err
 	}
 
+	return c.SendEncryptedSurveyResponseQuery(s)
+}
+
+// SendPreAggregatedSurveyResponseQuery is SendSurveyResponseQuery with the responses pre-aggregated by the DP: only one
+// response is encrypted and sent for each group of responses whose where and group by attributes are all in clear.
+func (c *API) SendPreAggregatedSurveyResponseQuery(surveyID SurveyID, clearClientResponses []libunlynx.DpClearResponse, groupKey kyber.Point, count bool) error {
+	preAggregated := libunlynx.PreAggregateDpClearResponses(clearClientResponses, count)
+	log.Lvl1(c, " pre-aggregated ", len(clearClientResponses), " response(s) into ", len(preAggregated))
+
+	// the count attribute is already set by the pre-aggregation
+	return c.SendSurveyResponseQuery(surveyID, preAggregated, groupKey, 1, false)
+}
+
+// SendSurveyResponseQueryWithRangeProofs is SendSurveyResponseQuery with range proofs for the encrypted aggregating
+// attributes that have a range (number of bits) in rangeBits
+func (c *API) SendSurveyResponseQueryWithRangeProofs(surveyID SurveyID, clearClientResponses []libunlynx.DpClearResponse, groupKey kyber.Point, count bool, rangeBits map[string]int64) error {
+	s, err := encryptDataWithProofs(c.String(), c.dpID(surveyID), surveyID, clearClientResponses, groupKey, count, rangeBits, false)
+	if err != nil {
+		return err
+	}
+	return c.SendEncryptedSurveyResponseQuery(s)
+}
+
+// SendSurveyResponseQueryWithEncryptionProofs is SendSurveyResponseQuery with a proof of correct encryption (bound to
+// the survey) for each encrypted attribute and, if rangeBits is not empty, with range proofs
+func (c *API) SendSurveyResponseQueryWithEncryptionProofs(surveyID SurveyID, clearClientResponses []libunlynx.DpClearResponse, groupKey kyber.Point, count bool, rangeBits map[string]int64) error {
+	s, err := encryptDataWithProofs(c.String(), c.dpID(surveyID), surveyID, clearClientResponses, groupKey, count, rangeBits, true)
+	if err != nil {
+		return err
+	}
+	return c.SendEncryptedSurveyResponseQuery(s)
+}
+
+// encryptDataWithProofs encrypts the responses and adds the range proofs and (if encryptionProofs) the proofs of correct
+// encryption of the data provider dpID
+func encryptDataWithProofs(dpName, dpID string, surveyID SurveyID, clearClientResponses []libunlynx.DpClearResponse, groupKey kyber.Point, count bool, rangeBits map[string]int64, encryptionProofs bool) (*SurveyResponseQuery, error) {
+	s, err := EncryptDataToSurvey(dpName, surveyID, clearClientResponses, groupKey, 1, count)
+	if err != nil {
+		return nil, err
+	}
+	for i := range s.Responses {
+		rs, err := libunlynxrange.AddRangeProofs(clearClientResponses[i], &s.Responses[i], groupKey, rangeBits)
+		if err != nil {
+			return nil, err
+		}
+		if encryptionProofs {
+			err := libunlynxencproof.AddEncryptionProofs(clearClientResponses[i], &s.Responses[i], groupKey, EncryptionProofContext(surveyID, dpID), rs)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// SendEncryptedSurveyResponseQuery sends DP responses that were already encrypted (e.g. with EncryptDataToSurvey)
+func (c *API) SendEncryptedSurveyResponseQuery(s *SurveyResponseQuery) error {
+	var err error
+	if s.DPID, s.Signature, err = c.sign(s.SurveyID, "", s.Responses); err != nil {
+		return err
+	}
 	resp := ServiceState{}
 	return c.SendProtobuf(c.entryPoint, s, &resp)
 }
 
+// SendChunkedSurveyResponseQuery handles the encryption and sending of DP responses in chunks of (at most) chunkSize
+// responses. Only one chunk is encrypted at a time and the responses are counted by the server once all the chunks are
+// received.
+func (c *API) SendChunkedSurveyResponseQuery(surveyID SurveyID, clearClientResponses []libunlynx.DpClearResponse, groupKey kyber.Point, dataRepetitions int, count bool, chunkSize int) error {
+	if chunkSize <= 0 {
+		return errors.New("chunk size must be positive")
+	}
+
+	uploadID := uuid.NewV4().String()
+	nbrChunks := int64(0)
+	for i := 0; i < len(clearClientResponses); i += chunkSize {
+		end := i + chunkSize
+		if end > len(clearClientResponses) {
+			end = len(clearClientResponses)
+		}
+
+		s, err := EncryptDataToSurvey(c.String(), surveyID, clearClientResponses[i:end], groupKey, dataRepetitions, count)
+		if err != nil {
+			return err
+		}
+		if err := c.SendSurveyResponseChunk(&SurveyResponseChunk{SurveyID: surveyID, UploadID: uploadID, Sequence: nbrChunks, Responses: s.Responses}); err != nil {
+			return err
+		}
+		nbrChunks++
+	}
+
+	return c.SendSurveyResponseCommit(&SurveyResponseCommit{SurveyID: surveyID, UploadID: uploadID, NbrChunks: nbrChunks})
+}
+
+// SendSurveyResponseChunk sends one chunk of a chunked upload
+func (c *API) SendSurveyResponseChunk(chunk *SurveyResponseChunk) error {
+	log.Lvl2(c, " sends chunk ", chunk.Sequence, " of upload ", chunk.UploadID)
+	var err error
+	if chunk.DPID, chunk.Signature, err = c.sign(chunk.SurveyID, ChunkContext(chunk.UploadID, chunk.Sequence), chunk.Responses); err != nil {
+		return err
+	}
+	resp := ServiceState{}
+	return c.SendProtobuf(c.entryPoint, chunk, &resp)
+}
+
+// SendSurveyResponseCommit completes a chunked upload
+func (c *API) SendSurveyResponseCommit(commit *SurveyResponseCommit) error {
+	log.Lvl1(c, " commits upload ", commit.UploadID, " of ", commit.NbrChunks, " chunk(s)")
+	var err error
+	if commit.DPID, commit.Signature, err = c.sign(commit.SurveyID, CommitContext(commit.UploadID, commit.NbrChunks), nil); err != nil {
+		return err
+	}
+	resp := ServiceState{}
+	return c.SendProtobuf(c.entryPoint, commit, &resp)
+}
+
+// SendJoinResponseQuery handles the encryption and sending of DP responses for one of the sources of a join survey
+func (c *API) SendJoinResponseQuery(surveyID SurveyID, joinSource string, clearClientResponses []libunlynx.DpClearResponse, groupKey kyber.Point, dataRepetitions int) error {
+	log.Lvl1(c, " sends a result for source ", joinSource, " of survey ", surveyID)
+
+	s, err := EncryptDataToSurvey(c.String(), surveyID, clearClientResponses, groupKey, dataRepetitions, false)
+	if err != nil {
+		return err
+	}
+	s.JoinSource = joinSource
+
+	return c.SendEncryptedSurveyResponseQuery(s)
+}
+
+// SendSetResponseQuery handles the encryption and sending of the set of identifiers of a DP for a set cardinality survey.
+// Duplicated identifiers are removed as each identifier has to be counted once per set.
+func (c *API) SendSetResponseQuery(surveyID SurveyID, identifier string, ids []int64, groupKey kyber.Point) error {
+	log.Lvl1(c, " sends a set of identifiers for survey ", surveyID)
+
+	present := make(map[int64]bool, len(ids))
+	clearClientResponses := make([]libunlynx.DpClearResponse, 0, len(ids))
+	for _, v := range ids {
+		if !present[v] {
+			present[v] = true
+			clearClientResponses = append(clearClientResponses, libunlynx.DpClearResponse{GroupByEnc: map[string]int64{identifier: v}})
+		}
+	}
+
+	s, err := EncryptDataToSurvey(c.String(), surveyID, clearClientResponses, groupKey, 1, false)
+	if err != nil {
+		return err
+	}
+
+	return c.SendEncryptedSurveyResponseQuery(s)
+}
+
+// SendDPRegistrationQuery registers the client (with its ID and public key) as a data provider of a survey. The
+// responses it then sends to this survey are signed.
+func (c *API) SendDPRegistrationQuery(surveyID SurveyID) error {
+	log.Lvl1(c, " registers as a data provider of survey ", surveyID)
+	resp := ServiceState{}
+	if err := c.SendProtobuf(c.entryPoint, &DPRegistrationQuery{SurveyID: surveyID, DPID: c.clientID, PublicKey: c.public}, &resp); err != nil {
+		return err
+	}
+
+	c.registeredMutex.Lock()
+	c.registered[surveyID] = true
+	c.registeredMutex.Unlock()
+	return nil
+}
+
+// PublicKey returns the public key of the client (e.g. to make it an auditor of a server, see Service.SetAuditors)
+func (c *API) PublicKey() kyber.Point {
+	return c.public
+}
+
+// AuthorizedDP returns the authorization the querier adds to a survey (see SurveyCreationQuery.AuthorizedDPs) so that
+// the client can register as a data provider on its server
+func (c *API) AuthorizedDP() AuthorizedDP {
+	return AuthorizedDP{DPID: c.clientID, PublicKey: c.public, Server: c.entryPoint}
+}
+
+// SendSurveyStatusQuery asks the server for the status of a survey (e.g. which of its data providers have uploaded
+// their responses)
+func (c *API) SendSurveyStatusQuery(surveyID SurveyID) (*SurveyStatus, error) {
+	resp := SurveyStatus{}
+	if err := c.SendProtobuf(c.entryPoint, &SurveyStatusQuery{SurveyID: surveyID}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// dpID returns the ID of the client if it is registered as a data provider of the survey (and an empty ID otherwise)
+func (c *API) dpID(surveyID SurveyID) string {
+	c.registeredMutex.Lock()
+	defer c.registeredMutex.Unlock()
+	if c.registered[surveyID] {
+		return c.clientID
+	}
+	return ""
+}
+
+// sign signs (a part of) an upload if the client is registered as a data provider of the survey. It returns the ID of
+// the client and the signature (or an empty ID and no signature if it is not registered).
+func (c *API) sign(surveyID SurveyID, context string, responses []libunlynx.DpResponseToSend) (string, []byte, error) {
+	if c.dpID(surveyID) == "" {
+		return "", nil, nil
+	}
+
+	signature, err := schnorr.Sign(libunlynx.SuiTe, c.private, ResponsesDigest(surveyID, c.clientID, context, responses))
+	if err != nil {
+		return "", nil, err
+	}
+	return c.clientID, signature, nil
+}
+
 // SendSurveyResultsQuery to get the result from associated server and decrypt the response using its private key.
 func (c *API) SendSurveyResultsQuery(surveyID SurveyID) (*[][]int64, *[][]int64, error) {
+	grp, aggr, _, err := c.SendSurveyResultsQueryWithProofs(surveyID)
+	return grp, aggr, err
+}
+
+// SendSurveyResultsQueryWithProofs is SendSurveyResultsQuery also returning the verification of the proofs of the
+// servers (empty if the survey has no proofs)
+func (c *API) SendSurveyResultsQueryWithProofs(surveyID SurveyID) (*[][]int64, *[][]int64, []ProofsVerificationResult, error) {
+	resp, err := c.sendSurveyResultsQuery(surveyID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	grp, aggr := c.decryptServiceResult(resp)
+	return grp, aggr, resp.ProofsVerification, nil
+}
+
+// SendSurveyResultsQueryWithCoverage is SendSurveyResultsQuery also returning which servers are in the collective
+// aggregation of the results (see SurveyCreationQuery.AggregationTimeout)
+func (c *API) SendSurveyResultsQueryWithCoverage(surveyID SurveyID) (*[][]int64, *[][]int64, AggregationCoverage, error) {
+	resp, err := c.sendSurveyResultsQuery(surveyID)
+	if err != nil {
+		return nil, nil, AggregationCoverage{}, err
+	}
+	grp, aggr := c.decryptServiceResult(resp)
+	return grp, aggr, resp.Coverage, nil
+}
+
+// SendSurveyResultsQueryWithThresholdDecisions is SendSurveyResultsQuery also returning which groups were suppressed
+// because of the minimum count of the query (see SurveyCreationQuery.MinCount)
+func (c *API) SendSurveyResultsQueryWithThresholdDecisions(surveyID SurveyID) (*[][]int64, *[][]int64, []ThresholdDecision, error) {
+	resp, err := c.sendSurveyResultsQuery(surveyID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	grp, aggr := c.decryptServiceResult(resp)
+	return grp, aggr, resp.ThresholdDecisions, nil
+}
+
+// sendSurveyResultsQuery asks the entry point for the results of a survey
+func (c *API) sendSurveyResultsQuery(surveyID SurveyID) (*ServiceResult, error) {
 	log.Lvl1(c, " asks for the results of the survey ", surveyID)
 	resp := ServiceResult{}
 	err := c.SendProtobuf(c.entryPoint, &SurveyResultsQuery{false, surveyID, c.public}, &resp)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	log.Lvl1(c, " got the survey result from ", c.entryPoint)
+	return &resp, nil
+}
 
+// decryptServiceResult decrypts the groups and the aggregating attributes of the results
+func (c *API) decryptServiceResult(resp *ServiceResult) (*[][]int64, *[][]int64) {
 	grp := make([][]int64, len(resp.Results))
 	aggr := make([][]int64, len(resp.Results))
 	for i, res := range resp.Results {
 		grp[i] = libunlynx.DecryptIntVector(c.private, &res.GroupByEnc)
 		aggr[i] = libunlynx.DecryptIntVector(c.private, &res.AggregatingAttributes)
 	}
-	return &grp, &aggr, nil
+	return &grp, &aggr
+}
+
+// SendAuditLogQuery exports the audit log of the entry point (the client has to be one of its auditors). The entries are
+// checked against the public key of the entry point.
+func (c *API) SendAuditLogQuery() ([]libunlynxaudit.Entry, error) {
+	log.Lvl1(c, " asks for the audit log of ", c.entryPoint)
+	alq := AuditLogQuery{Auditor: c.public, Time: time.Now().UnixNano()}
+	var err error
+	if alq.Signature, err = schnorr.Sign(libunlynx.SuiTe, c.private, AuditLogQueryDigest(c.entryPoint, alq.Time)); err != nil {
+		return nil, err
+	}
+	resp := AuditLogReply{}
+	if err := c.SendProtobuf(c.entryPoint, &alq, &resp); err != nil {
+		return nil, err
+	}
+	if err := libunlynxaudit.VerifySegment(resp.Entries); err != nil {
+		return nil, errors.New("invalid audit log: " + err.Error())
+	}
+	if err := libunlynxaudit.VerifySignatures(resp.Entries, c.entryPoint.Public); err != nil {
+		return nil, errors.New("invalid audit log: " + err.Error())
+	}
+	return resp.Entries, nil
+}
+
+// SendProofsBundleQuery exports the bundles of the proofs of a survey received by the entry point (which has to be a
+// proof verifier of the survey)
+func (c *API) SendProofsBundleQuery(surveyID SurveyID) ([]protocolsunlynxutils.ProofsBundle, error) {
+	log.Lvl1(c, " asks for the proofs bundles of survey ", surveyID, " to ", c.entryPoint)
+	resp := ProofsBundleReply{}
+	if err := c.SendProtobuf(c.entryPoint, &ProofsBundleQuery{SurveyID: surveyID}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Bundles, nil
 }
 
 // Helper Functions
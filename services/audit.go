@@ -0,0 +1,126 @@
+package servicesunlynx
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/audit"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// auditLogQueryValidity bounds the difference between the time of an audit log query and the time of the server
+const auditLogQueryValidity = time.Minute
+
+// AuditLogQuery asks a server for its audit log. Only the auditors of the server can export it: the query is signed
+// by the auditor (see AuditLogQueryDigest) at Time (in nanoseconds since the epoch).
+type AuditLogQuery struct {
+	Auditor   kyber.Point
+	Time      int64
+	Signature []byte
+}
+
+// AuditLogReply contains the entries of the audit log of a server
+type AuditLogReply struct {
+	Entries []libunlynxaudit.Entry
+}
+
+// SetAuditLog sets the audit log of the server (an in-memory log by default). Its new entries are signed with the key of
+// the server.
+func (s *Service) SetAuditLog(auditLog *libunlynxaudit.Log) {
+	auditLog.SetSigner(s.ServerIdentity().GetPrivate())
+	s.AuditLog = auditLog
+}
+
+// SetAuditors sets the public keys of the clients which can export the audit log of the server
+func (s *Service) SetAuditors(auditors []kyber.Point) {
+	s.Auditors = auditors
+}
+
+// AuditLogQueryDigest is the message signed by an auditor to export the audit log of a server at a given time
+func AuditLogQueryDigest(server *network.ServerIdentity, queryTime int64) []byte {
+	return []byte("auditLogQuery/" + server.ID.String() + "/" + strconv.FormatInt(queryTime, 10))
+}
+
+// HandleAuditLogQuery exports the audit log of the server (the entries since its last rotation) to an auditor
+func (s *Service) HandleAuditLogQuery(alq *AuditLogQuery) (network.Message, error) {
+	authorized := false
+	for _, auditor := range s.Auditors {
+		if alq.Auditor != nil && auditor.Equal(alq.Auditor) {
+			authorized = true
+		}
+	}
+	if !authorized {
+		return nil, errors.New("the client is not an auditor of " + s.ServerIdentity().String())
+	}
+	if delay := time.Since(time.Unix(0, alq.Time)); delay > auditLogQueryValidity || delay < -auditLogQueryValidity {
+		return nil, errors.New("the audit log query has expired")
+	}
+	if err := schnorr.Verify(libunlynx.SuiTe, alq.Auditor, AuditLogQueryDigest(s.ServerIdentity(), alq.Time), alq.Signature); err != nil {
+		return nil, errors.New("invalid signature of the audit log query: " + err.Error())
+	}
+	return &AuditLogReply{Entries: s.AuditLog.Entries()}, nil
+}
+
+// audit appends an entry to the audit log of the server (the survey goes on if it fails)
+func (s *Service) audit(surveyID SurveyID, kind string, data []byte) {
+	s.auditSigner.Do(func() { s.AuditLog.SetSigner(s.ServerIdentity().GetPrivate()) })
+	if _, err := s.AuditLog.Append(string(surveyID), kind, data); err != nil {
+		log.Error(s.ServerIdentity(), " could not append to the audit log: ", err)
+	}
+}
+
+// auditMessage appends a (registered) message to the audit log of the server
+func (s *Service) auditMessage(surveyID SurveyID, kind string, msg network.Message) {
+	data, err := network.Marshal(msg)
+	if err != nil {
+		log.Error(s.ServerIdentity(), " could not marshal an audit log entry: ", err)
+		return
+	}
+	s.audit(surveyID, kind, data)
+}
+
+// RosterDescription describes a roster in the audit log: one line per server with its address and public key
+func RosterDescription(roster *onet.Roster) []byte {
+	lines := make([]string, len(roster.List))
+	for i, si := range roster.List {
+		lines[i] = si.Address.String() + " " + si.Public.String()
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// ThresholdDecisionDescription describes a threshold decision in the audit log
+func ThresholdDecisionDescription(td ThresholdDecision) []byte {
+	return []byte(string(td.Group) + " suppressed=" + strconv.FormatBool(td.Suppressed))
+}
+
+// ResultsDigest is the digest of the (key switched) results of a survey and of the threshold decisions taken on its
+// groups, recorded in the audit log. A querier can compare it with the digest of the results it received (see
+// ServiceResult).
+func ResultsDigest(results []libunlynx.FilteredResponse, decisions []ThresholdDecision) ([]byte, error) {
+	h := sha256.New()
+	for _, fr := range results {
+		for _, cv := range []libunlynx.CipherVector{fr.GroupByEnc, fr.AggregatingAttributes} {
+			data, _, err := cv.ToBytes()
+			if err != nil {
+				return nil, err
+			}
+			binary.Write(h, binary.BigEndian, int64(len(data)))
+			h.Write(data)
+		}
+	}
+	for _, td := range decisions {
+		data := ThresholdDecisionDescription(td)
+		binary.Write(h, binary.BigEndian, int64(len(data)))
+		h.Write(data)
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,345 @@
+package servicesunlynx
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// AuthorizedDP is a data provider allowed (by the querier creating the survey) to register to a survey on one server
+type AuthorizedDP struct {
+	DPID      string
+	PublicKey kyber.Point
+	Server    *network.ServerIdentity
+}
+
+// DPRegistrationQuery registers a data provider (identified by its ID and public key) to a survey on the server
+// receiving the query. The data provider must be one of the AuthorizedDPs of the survey for this server. A registered
+// data provider has to sign its responses and can only upload them once.
+type DPRegistrationQuery struct {
+	SurveyID  SurveyID
+	DPID      string
+	PublicKey kyber.Point
+}
+
+// SurveyStatusQuery asks a server for the status of a survey
+type SurveyStatusQuery struct {
+	SurveyID SurveyID
+}
+
+// SurveyStatus is the status of a survey on a server: the number of expected data providers and the status of the
+// data providers registered to this server.
+type SurveyStatus struct {
+	SurveyID      SurveyID
+	ExpectedDPs   int64
+	DataProviders []DPStatus
+}
+
+// DPStatus is the status of a registered data provider
+type DPStatus struct {
+	DPID         string
+	PublicKey    kyber.Point
+	Uploaded     bool
+	NbrResponses int64
+}
+
+// DataProviders keeps track of the data providers registered to a survey (on one server) and of their uploads
+type DataProviders struct {
+	mutex sync.Mutex
+	dps   map[string]*dataProvider
+	// authorized are the public keys of the data providers which can register and maxDPs bounds their number
+	authorized map[string]kyber.Point
+	maxDPs     int64
+	// ciphertexts are the digests of the encrypted attributes of the stored responses (see Deduplicate)
+	ciphertexts map[[sha256.Size]byte]bool
+}
+
+type dataProvider struct {
+	DPStatus
+	// uploadID is the upload in progress (a data provider can only upload its responses once)
+	uploadID string
+}
+
+// NewDataProviders creates an empty set of data providers in which only the authorized data providers (with their
+// public key) can register, at most maxDPs of them
+func NewDataProviders(authorized []AuthorizedDP, maxDPs int64) *DataProviders {
+	dps := &DataProviders{dps: make(map[string]*dataProvider), authorized: make(map[string]kyber.Point), maxDPs: maxDPs,
+		ciphertexts: make(map[[sha256.Size]byte]bool)}
+	for _, dp := range authorized {
+		dps.authorized[dp.DPID] = dp.PublicKey
+	}
+	return dps
+}
+
+// Register adds an authorized data provider. A data provider can register again with the same key.
+func (dps *DataProviders) Register(dpID string, publicKey kyber.Point) error {
+	if dpID == "" || publicKey == nil {
+		return errors.New("a data provider needs an ID and a public key")
+	}
+
+	dps.mutex.Lock()
+	defer dps.mutex.Unlock()
+	if key, ok := dps.authorized[dpID]; !ok || !key.Equal(publicKey) {
+		return errors.New("data provider " + dpID + " is not authorized with this key")
+	}
+	if _, ok := dps.dps[dpID]; ok {
+		return nil
+	}
+	if int64(len(dps.dps)) >= dps.maxDPs {
+		return errors.New("the " + strconv.FormatInt(dps.maxDPs, 10) + " expected data provider(s) are already registered")
+	}
+	dps.dps[dpID] = &dataProvider{DPStatus: DPStatus{DPID: dpID, PublicKey: publicKey}}
+	return nil
+}
+
+// Verify checks the signature of a message of a registered data provider
+func (dps *DataProviders) Verify(dpID string, msg, signature []byte) error {
+	dps.mutex.Lock()
+	dp, ok := dps.dps[dpID]
+	dps.mutex.Unlock()
+	if !ok {
+		return errors.New("data provider " + dpID + " is not registered")
+	}
+	if err := schnorr.Verify(libunlynx.SuiTe, dp.PublicKey, msg, signature); err != nil {
+		return errors.New("invalid signature of data provider " + dpID + ": " + err.Error())
+	}
+	return nil
+}
+
+// Begin starts (or continues) an upload of a data provider. It fails if the data provider has already uploaded its
+// responses or is doing another upload.
+func (dps *DataProviders) Begin(dpID, uploadID string) error {
+	dps.mutex.Lock()
+	defer dps.mutex.Unlock()
+	dp, ok := dps.dps[dpID]
+	if !ok {
+		return errors.New("data provider " + dpID + " is not registered")
+	}
+	if dp.Uploaded {
+		return errors.New("data provider " + dpID + " has already uploaded its responses")
+	}
+	if dp.uploadID != "" && dp.uploadID != uploadID {
+		return errors.New("data provider " + dpID + " is already uploading its responses")
+	}
+	dp.uploadID = uploadID
+	return nil
+}
+
+// Abort cancels an upload that did not store any response
+func (dps *DataProviders) Abort(dpID, uploadID string) {
+	dps.mutex.Lock()
+	defer dps.mutex.Unlock()
+	if dp, ok := dps.dps[dpID]; ok && dp.uploadID == uploadID && dp.NbrResponses == 0 {
+		dp.uploadID = ""
+	}
+}
+
+// Add counts stored responses of a data provider
+func (dps *DataProviders) Add(dpID string, nbrResponses int64) {
+	dps.mutex.Lock()
+	defer dps.mutex.Unlock()
+	if dp, ok := dps.dps[dpID]; ok {
+		dp.NbrResponses += nbrResponses
+	}
+}
+
+// Commit ends the upload of a data provider
+func (dps *DataProviders) Commit(dpID string) {
+	dps.mutex.Lock()
+	defer dps.mutex.Unlock()
+	if dp, ok := dps.dps[dpID]; ok {
+		dp.Uploaded = true
+		dp.uploadID = ""
+	}
+}
+
+// Deduplicate records the encrypted attributes of responses and fails (without recording any of them) if a response
+// reuses the ciphertexts of a response already recorded, e.g. an anonymous data provider replaying the upload of
+// another one. It does not prevent an anonymous data provider from encrypting and uploading its responses again: only
+// the registration of the data providers (see SurveyCreationQuery.DPRegistration) does.
+func (dps *DataProviders) Deduplicate(responses []libunlynx.DpResponseToSend) error {
+	digests := make([][sha256.Size]byte, 0, len(responses))
+	for _, v := range responses {
+		if digest, encrypted := ciphertextsDigest(v); encrypted {
+			digests = append(digests, digest)
+		}
+	}
+
+	dps.mutex.Lock()
+	defer dps.mutex.Unlock()
+	recorded := make(map[[sha256.Size]byte]bool, len(digests))
+	for _, digest := range digests {
+		if dps.ciphertexts[digest] || recorded[digest] {
+			return errors.New("a response reuses the ciphertexts of another response")
+		}
+		recorded[digest] = true
+	}
+	for digest := range recorded {
+		dps.ciphertexts[digest] = true
+	}
+	return nil
+}
+
+// ciphertextsDigest returns the digest of the encrypted attributes of a response (and false if it has none)
+func ciphertextsDigest(v libunlynx.DpResponseToSend) ([sha256.Size]byte, bool) {
+	h := sha256.New()
+	encrypted := false
+	for _, m := range []map[string][]byte{v.WhereEnc, v.GroupByEnc, v.AggregatingAttributesEnc} {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			binary.Write(h, binary.BigEndian, int64(len(k)))
+			h.Write([]byte(k))
+			binary.Write(h, binary.BigEndian, int64(len(m[k])))
+			h.Write(m[k])
+			encrypted = true
+		}
+		binary.Write(h, binary.BigEndian, int64(-1))
+	}
+	var digest [sha256.Size]byte
+	copy(digest[:], h.Sum(nil))
+	return digest, encrypted
+}
+
+// Status returns the status of the data providers (sorted by ID)
+func (dps *DataProviders) Status() []DPStatus {
+	dps.mutex.Lock()
+	defer dps.mutex.Unlock()
+	status := make([]DPStatus, 0, len(dps.dps))
+	for _, dp := range dps.dps {
+		status = append(status, dp.DPStatus)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].DPID < status[j].DPID })
+	return status
+}
+
+// validateAuthorizedDPs checks that the authorized data providers have a unique ID and a public key, that their server
+// is in the roster and that each server has at most MapDPs of them
+func (scq *SurveyCreationQuery) validateAuthorizedDPs() error {
+	if len(scq.AuthorizedDPs) == 0 {
+		return errors.New("the registration of the data providers requires the authorized data providers")
+	}
+	ids := make(map[string]bool)
+	nbrDPs := make(map[string]int64)
+	for _, dp := range scq.AuthorizedDPs {
+		if dp.DPID == "" || dp.PublicKey == nil || dp.Server == nil {
+			return errors.New("an authorized data provider needs an ID, a public key and a server")
+		}
+		if ids[dp.DPID] {
+			return errors.New("data provider " + dp.DPID + " is authorized more than once")
+		}
+		ids[dp.DPID] = true
+		if i, _ := scq.Roster.Search(dp.Server.ID); i < 0 {
+			return errors.New("the server of data provider " + dp.DPID + " is not in the roster")
+		}
+		nbrDPs[dp.Server.String()]++
+	}
+	for server, nbr := range nbrDPs {
+		if nbr > scq.MapDPs[server] {
+			return errors.New("server " + server + " has more authorized data providers than expected")
+		}
+	}
+	return nil
+}
+
+// authorizedDPs returns the data providers authorized to register on a server
+func (scq *SurveyCreationQuery) authorizedDPs(server *network.ServerIdentity) []AuthorizedDP {
+	authorized := make([]AuthorizedDP, 0)
+	for _, dp := range scq.AuthorizedDPs {
+		if dp.Server != nil && dp.Server.ID.Equal(server.ID) {
+			authorized = append(authorized, dp)
+		}
+	}
+	return authorized
+}
+
+// ChunkContext is the context of the signature of a chunk of an upload
+func ChunkContext(uploadID string, sequence int64) string {
+	return uploadID + "/" + strconv.FormatInt(sequence, 10)
+}
+
+// CommitContext is the context of the signature of the commit of an upload
+func CommitContext(uploadID string, nbrChunks int64) string {
+	return uploadID + "/commit/" + strconv.FormatInt(nbrChunks, 10)
+}
+
+// EncryptionProofContext is the context of the proofs of correct encryption of the responses of a (registered) data
+// provider to a survey: a proof cannot be reused for another survey or by another data provider
+func EncryptionProofContext(surveyID SurveyID, dpID string) []byte {
+	return []byte("encryptionProof/" + strconv.Itoa(len(surveyID)) + "/" + string(surveyID) + "/" + dpID)
+}
+
+// ResponsesDigest returns the message signed by a data provider for a list of responses. context distinguishes the
+// different messages of a survey (e.g. the chunks of an upload).
+func ResponsesDigest(surveyID SurveyID, dpID, context string, responses []libunlynx.DpResponseToSend) []byte {
+	h := sha256.New()
+	writeString := func(s string) {
+		length := make([]byte, 8)
+		binary.BigEndian.PutUint64(length, uint64(len(s)))
+		h.Write(length)
+		h.Write([]byte(s))
+	}
+	writeClear := func(m map[string]int64) {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeString(k)
+			value := make([]byte, 8)
+			binary.BigEndian.PutUint64(value, uint64(m[k]))
+			h.Write(value)
+		}
+		writeString("")
+	}
+	writeEnc := func(m map[string][]byte) {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeString(k)
+			writeString(string(m[k]))
+		}
+		writeString("")
+	}
+
+	writeString(string(surveyID))
+	writeString(dpID)
+	writeString(context)
+	for _, r := range responses {
+		writeClear(r.WhereClear)
+		writeEnc(r.WhereEnc)
+		writeClear(r.GroupByClear)
+		writeEnc(r.GroupByEnc)
+		writeClear(r.AggregatingAttributesClear)
+		writeEnc(r.AggregatingAttributesEnc)
+		writeEnc(r.RangeProofs)
+		writeEnc(r.EncryptionProofs)
+	}
+	return h.Sum(nil)
+}
+
+// SetProviderAttribute is the (encrypted) grouping attribute added by the servers to the identifiers of a set
+// cardinality survey to deduplicate them per data provider
+const SetProviderAttribute = "set_provider"
+
+// setProviderMarker identifies the data provider of a set of identifiers by its registered DP ID, so that its uploads
+// are deduplicated together
+func setProviderMarker(dpID string) int64 {
+	digest := sha256.Sum256([]byte(dpID))
+	return int64(binary.BigEndian.Uint64(digest[:8]) >> 1)
+}
@@ -0,0 +1,57 @@
+package servicesunlynx_test
+
+import (
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+)
+
+func TestDataProviders(t *testing.T) {
+	private, public := libunlynx.GenKey()
+	_, otherPublic := libunlynx.GenKey()
+
+	dps := servicesunlynx.NewDataProviders([]servicesunlynx.AuthorizedDP{{DPID: "dp", PublicKey: public}, {DPID: "other", PublicKey: otherPublic}}, 1)
+	assert.Error(t, dps.Register("", public))
+	// only the authorized key can register
+	assert.Error(t, dps.Register("dp", otherPublic))
+	assert.Error(t, dps.Register("unknown", public))
+	assert.NoError(t, dps.Register("dp", public))
+	assert.NoError(t, dps.Register("dp", public))
+	assert.Error(t, dps.Register("dp", otherPublic))
+	// at most 1 data provider
+	assert.Error(t, dps.Register("other", otherPublic))
+
+	responses := []libunlynx.DpResponseToSend{{GroupByClear: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string][]byte{"s1": {1, 2}}}}
+	digest := servicesunlynx.ResponsesDigest("survey", "dp", "", responses)
+	signature, err := schnorr.Sign(libunlynx.SuiTe, private, digest)
+	assert.NoError(t, err)
+	assert.NoError(t, dps.Verify("dp", digest, signature))
+	assert.Error(t, dps.Verify("dp", servicesunlynx.ResponsesDigest("survey", "dp", "", nil), signature))
+	assert.Error(t, dps.Verify("unknown", digest, signature))
+
+	// only one upload at a time and only once
+	assert.NoError(t, dps.Begin("dp", "u1"))
+	assert.Error(t, dps.Begin("dp", "u2"))
+	dps.Abort("dp", "u1")
+	assert.NoError(t, dps.Begin("dp", "u2"))
+	dps.Add("dp", 3)
+	dps.Commit("dp")
+	assert.Error(t, dps.Begin("dp", "u2"))
+
+	// the ciphertexts of a response can only be recorded once
+	assert.NoError(t, dps.Deduplicate(responses))
+	assert.Error(t, dps.Deduplicate(responses))
+	other := []libunlynx.DpResponseToSend{{AggregatingAttributesEnc: map[string][]byte{"s1": {3, 4}}}, {AggregatingAttributesEnc: map[string][]byte{"s1": {3, 4}}}}
+	assert.Error(t, dps.Deduplicate(other))
+	assert.NoError(t, dps.Deduplicate(other[:1]))
+	// responses without encrypted attributes are not deduplicated
+	assert.NoError(t, dps.Deduplicate([]libunlynx.DpResponseToSend{{AggregatingAttributesClear: map[string]int64{"s1": 1}}, {AggregatingAttributesClear: map[string]int64{"s1": 1}}}))
+
+	status := dps.Status()
+	assert.Equal(t, 1, len(status))
+	assert.True(t, status[0].Uploaded)
+	assert.Equal(t, int64(3), status[0].NbrResponses)
+}
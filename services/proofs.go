@@ -0,0 +1,773 @@
+package servicesunlynx
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/aggregation"
+	"github.com/ldsec/unlynx/lib/audit"
+	"github.com/ldsec/unlynx/lib/deterministic_tag"
+	"github.com/ldsec/unlynx/lib/key_switch"
+	"github.com/ldsec/unlynx/lib/shuffle"
+	"github.com/ldsec/unlynx/lib/tools"
+	"github.com/ldsec/unlynx/protocols"
+	"github.com/ldsec/unlynx/protocols/utils"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// defaultProofsTimeout is how long the root waits for the results of the proof verifiers if the survey does not set it
+// (see SurveyCreationQuery.ProofsTimeout)
+const defaultProofsTimeout = 10 * time.Minute
+
+// ProofsMessage contains proofs created by a server during a survey. Each server sends its proofs to the proof
+// verifiers of the survey as soon as they are created (one message per proof creation).
+type ProofsMessage struct {
+	SurveyID SurveyID
+	Server   string
+
+	KeySwitching          *libunlynxkeyswitch.PublishedKSListProofBytes
+	DetTagCreation        *libunlynxdetertag.PublishedDDTCreationListProofBytes
+	DetTagAddition        *libunlynxdetertag.PublishedDDTAdditionListProofBytes
+	Aggregation           *libunlynxaggr.PublishedAggregationListProofBytes
+	Shuffling             *libunlynxshuffle.PublishedShufflingListProofBytes
+	CollectiveAggregation *libunlynxaggr.PublishedAggregationListProofBytes
+
+	// ShardedShuffle is sent by the server which started a sharded (or streamed) shuffle of its responses
+	ShardedShuffle *ShardedShuffleBytes
+	// Circuit is the root of the protocolsunlynx.ShufflingPlusDDTProtocol the proofs were created in (if any): the keys
+	// and tag generators of the proofs depend on the position of the server in its circuit (see verifyCircuits)
+	Circuit string
+}
+
+// circuitProofs contains the shuffle and deterministic tagging addition proofs of a server in a circuit
+type circuitProofs struct {
+	shuffling []libunlynxshuffle.PublishedShufflingProof
+	addition  []libunlynxdetertag.PublishedDDTAdditionProof
+}
+
+// ShardedShuffleBytes contains the lists (in bytes) before and after a sharded shuffle: the proof verifiers check that
+// the shuffle proofs of all the servers compose to a shuffle of the whole list (see verifyShardedShuffle).
+type ShardedShuffleBytes struct {
+	Original        []byte
+	OriginalLengths []byte
+	Shuffled        []byte
+	ShuffledLengths []byte
+}
+
+// ProofsEnd is broadcasted by the root once the survey is processed: the servers answer with the number of proofs
+// messages they sent to the verifiers. The proof verifiers bind the proofs they export to the digest of the results.
+type ProofsEnd struct {
+	SurveyID      SurveyID
+	ResultsDigest []byte
+}
+
+// ProofsSent tells a proof verifier how many proofs messages a server sent to it for a survey. As the messages can be
+// processed in any order, the verifier waits for all of them before verifying the proofs of the server.
+type ProofsSent struct {
+	SurveyID    SurveyID
+	Server      string
+	NbrMessages int64
+}
+
+// ProofsVerificationResult is the result of the verification of the proofs of a server by a proof verifier. The results
+// are indexed by the type of proofs (protocolsunlynxutils.KeySwitchingResult, ..., CollectiveAggregationResult).
+type ProofsVerificationResult struct {
+	SurveyID SurveyID
+	Verifier string
+	Server   string
+	Results  []bool
+}
+
+// Verified returns true if all the proofs of the server are valid
+func (pvr *ProofsVerificationResult) Verified() bool {
+	if len(pvr.Results) == 0 {
+		return false
+	}
+	for _, v := range pvr.Results {
+		if !v {
+			return false
+		}
+	}
+	return true
+}
+
+// ProofsBundleQuery asks a proof verifier for the bundles of the proofs it received (and verified) for a survey
+type ProofsBundleQuery struct {
+	SurveyID SurveyID
+}
+
+// ProofsBundleReply contains one proofs bundle per server, which can be verified offline
+type ProofsBundleReply struct {
+	Bundles []protocolsunlynxutils.ProofsBundle
+}
+
+// ProofsCollection keeps track of the proofs of a survey on one server: the number of proofs messages it sent and, if
+// it is a proof verifier, the proofs it received from each server.
+type ProofsCollection struct {
+	mutex    sync.Mutex
+	sent     int64
+	proofs   map[string]*protocolsunlynxutils.ProofsToVerify
+	received map[string]int64
+	expected map[string]int64
+	verified map[string]bool
+	// malformed contains the servers which sent proofs that could not be decoded (they are not valid)
+	malformed map[string]bool
+
+	// Results receives the verification results at the root, at most one per proof verifier and server (see addResult)
+	Results chan ProofsVerificationResult
+	results map[string]bool
+
+	// resultsDigest is the digest of the results the proofs were created for (see ProofsEnd)
+	resultsDigest []byte
+
+	// shardedShuffles contains the sharded shuffle started by each server (if any), and allVerified if the proofs of all
+	// the servers were verified
+	shardedShuffles map[string]libunlynxshuffle.ShardedShuffle
+	allVerified     bool
+
+	// circuits contains the proofs of each server in each circuit of the shuffling and tagging (by root and server)
+	circuits map[string]map[string]*circuitProofs
+}
+
+// NewProofsCollection creates an empty collection, expecting at most nbrResults verification results
+func NewProofsCollection(nbrResults int) *ProofsCollection {
+	return &ProofsCollection{
+		proofs:    make(map[string]*protocolsunlynxutils.ProofsToVerify),
+		received:  make(map[string]int64),
+		expected:  make(map[string]int64),
+		verified:  make(map[string]bool),
+		malformed: make(map[string]bool),
+		Results:   make(chan ProofsVerificationResult, nbrResults),
+		results:   make(map[string]bool),
+
+		shardedShuffles: make(map[string]libunlynxshuffle.ShardedShuffle),
+		circuits:        make(map[string]map[string]*circuitProofs),
+	}
+}
+
+// addResult sends a verification result to Results unless a result of the same proof verifier for the same server
+// was already received
+func (pc *ProofsCollection) addResult(result ProofsVerificationResult) error {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	key := result.Verifier + "/" + result.Server
+	if pc.results[key] {
+		return errors.New("duplicate proofs verification result of " + result.Verifier + " for " + result.Server)
+	}
+	select {
+	case pc.Results <- result:
+	default:
+		return errors.New("unexpected proofs verification result of " + result.Verifier + " for " + result.Server)
+	}
+	pc.results[key] = true
+	return nil
+}
+
+// add adds the proofs of a message to the proofs of its server
+func (pc *ProofsCollection) add(msg *ProofsMessage) error {
+	ptv, err := decodeProofs(msg)
+	var ss libunlynxshuffle.ShardedShuffle
+	if err == nil && msg.ShardedShuffle != nil {
+		ss.Original, ss.Shuffled, err = msg.ShardedShuffle.lists()
+		pc.mutex.Lock()
+		if _, ok := pc.shardedShuffles[msg.Server]; ok {
+			err = errors.New("duplicate sharded shuffle of " + msg.Server)
+		}
+		pc.mutex.Unlock()
+	}
+	if err != nil {
+		pc.mutex.Lock()
+		pc.malformed[msg.Server] = true
+		pc.received[msg.Server]++
+		pc.mutex.Unlock()
+		return err
+	}
+
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	proofs, ok := pc.proofs[msg.Server]
+	if !ok {
+		proofs = &protocolsunlynxutils.ProofsToVerify{}
+		pc.proofs[msg.Server] = proofs
+	}
+	proofs.KeySwitchingProofs.List = append(proofs.KeySwitchingProofs.List, ptv.KeySwitchingProofs.List...)
+	proofs.AggregationProofs.List = append(proofs.AggregationProofs.List, ptv.AggregationProofs.List...)
+	proofs.CollectiveAggregationProofs.List = append(proofs.CollectiveAggregationProofs.List, ptv.CollectiveAggregationProofs.List...)
+	proofs.ShufflingProofs.List = append(proofs.ShufflingProofs.List, ptv.ShufflingProofs.List...)
+	proofs.DetTagAdditionProofs.List = append(proofs.DetTagAdditionProofs.List, ptv.DetTagAdditionProofs.List...)
+	// the creation proofs of a server are all created with the same keys
+	if len(ptv.DetTagCreationProofs.List) > 0 {
+		proofs.DetTagCreationProofs.List = append(proofs.DetTagCreationProofs.List, ptv.DetTagCreationProofs.List...)
+		proofs.DetTagCreationProofs.K, proofs.DetTagCreationProofs.SB = ptv.DetTagCreationProofs.K, ptv.DetTagCreationProofs.SB
+	}
+	if msg.ShardedShuffle != nil {
+		pc.shardedShuffles[msg.Server] = ss
+	}
+	if msg.Circuit != "" {
+		if _, ok := pc.circuits[msg.Circuit]; !ok {
+			pc.circuits[msg.Circuit] = make(map[string]*circuitProofs)
+		}
+		cp, ok := pc.circuits[msg.Circuit][msg.Server]
+		if !ok {
+			cp = &circuitProofs{}
+			pc.circuits[msg.Circuit][msg.Server] = cp
+		}
+		cp.shuffling = append(cp.shuffling, ptv.ShufflingProofs.List...)
+		cp.addition = append(cp.addition, ptv.DetTagAdditionProofs.List...)
+	}
+	pc.received[msg.Server]++
+	return nil
+}
+
+// lists converts the lists of a sharded shuffle back from bytes
+func (ssb *ShardedShuffleBytes) lists() ([]libunlynx.CipherVector, []libunlynx.CipherVector, error) {
+	original, err := libunlynx.FromBytesToArrayCipherVector(ssb.Original, ssb.OriginalLengths)
+	if err != nil {
+		return nil, nil, err
+	}
+	shuffled, err := libunlynx.FromBytesToArrayCipherVector(ssb.Shuffled, ssb.ShuffledLengths)
+	if err != nil {
+		return nil, nil, err
+	}
+	return original, shuffled, nil
+}
+
+// decodeProofs converts the proofs of a message back to the proofs to verify
+func decodeProofs(msg *ProofsMessage) (protocolsunlynxutils.ProofsToVerify, error) {
+	ptv := protocolsunlynxutils.ProofsToVerify{}
+	if msg.KeySwitching != nil {
+		if err := ptv.KeySwitchingProofs.FromBytes(*msg.KeySwitching); err != nil {
+			return ptv, err
+		}
+	}
+	if msg.Aggregation != nil {
+		if err := ptv.AggregationProofs.FromBytes(*msg.Aggregation); err != nil {
+			return ptv, err
+		}
+	}
+	if msg.CollectiveAggregation != nil {
+		if err := ptv.CollectiveAggregationProofs.FromBytes(*msg.CollectiveAggregation); err != nil {
+			return ptv, err
+		}
+	}
+	if msg.Shuffling != nil {
+		if err := ptv.ShufflingProofs.FromBytes(*msg.Shuffling); err != nil {
+			return ptv, err
+		}
+	}
+	if msg.DetTagAddition != nil {
+		if err := ptv.DetTagAdditionProofs.FromBytes(*msg.DetTagAddition); err != nil {
+			return ptv, err
+		}
+	}
+	if msg.DetTagCreation != nil {
+		if err := ptv.DetTagCreationProofs.FromBytes(*msg.DetTagCreation); err != nil {
+			return ptv, err
+		}
+	}
+	return ptv, nil
+}
+
+// complete returns the proofs of a server (and if they could all be decoded) once all its messages are received, if
+// they were not verified yet. The proofs are kept to be exported (see bundles).
+func (pc *ProofsCollection) complete(server string) (proofs protocolsunlynxutils.ProofsToVerify, wellFormed, ok bool) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	expected, known := pc.expected[server]
+	if !known || pc.received[server] != expected || pc.verified[server] {
+		return proofs, false, false
+	}
+	pc.verified[server] = true
+
+	if received, ok := pc.proofs[server]; ok {
+		proofs = *received
+	}
+	return proofs, !pc.malformed[server], true
+}
+
+// completeAll returns the proofs of all the servers (and if they could all be decoded) once the proofs of nbrServers
+// servers are complete (see complete), only the first time
+func (pc *ProofsCollection) completeAll(nbrServers int) (proofs map[string]protocolsunlynxutils.ProofsToVerify, wellFormed map[string]bool, ok bool) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	if len(pc.verified) < nbrServers || pc.allVerified {
+		return nil, nil, false
+	}
+	pc.allVerified = true
+
+	proofs = make(map[string]protocolsunlynxutils.ProofsToVerify)
+	wellFormed = make(map[string]bool)
+	for server := range pc.verified {
+		if received, ok := pc.proofs[server]; ok {
+			proofs[server] = *received
+		}
+		wellFormed[server] = !pc.malformed[server]
+	}
+	return proofs, wellFormed, true
+}
+
+// shardedShuffleList returns the sharded shuffles of the survey
+func (pc *ProofsCollection) shardedShuffleList() []libunlynxshuffle.ShardedShuffle {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	shuffles := make([]libunlynxshuffle.ShardedShuffle, 0, len(pc.shardedShuffles))
+	for _, ss := range pc.shardedShuffles {
+		shuffles = append(shuffles, ss)
+	}
+	return shuffles
+}
+
+// circuitList returns the proofs of the servers in each circuit of the survey
+func (pc *ProofsCollection) circuitList() map[string]map[string]circuitProofs {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	circuits := make(map[string]map[string]circuitProofs, len(pc.circuits))
+	for root, servers := range pc.circuits {
+		circuits[root] = make(map[string]circuitProofs, len(servers))
+		for server, cp := range servers {
+			circuits[root][server] = *cp
+		}
+	}
+	return circuits
+}
+
+// bundles returns the bundles of the well-formed proofs of the servers which were verified, signed by the proof
+// verifier
+func (pc *ProofsCollection) bundles(surveyID SurveyID, verifier *network.ServerIdentity) ([]protocolsunlynxutils.ProofsBundle, error) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	bundles := make([]protocolsunlynxutils.ProofsBundle, 0, len(pc.verified))
+	for server, proofs := range pc.proofs {
+		if !pc.verified[server] || pc.malformed[server] {
+			continue
+		}
+		pb, err := protocolsunlynxutils.NewProofsBundle(string(surveyID), server, pc.resultsDigest, *proofs)
+		if err != nil {
+			return nil, err
+		}
+		if err := pb.Sign(verifier, verifier.GetPrivate()); err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, *pb)
+	}
+	sort.Slice(bundles, func(i, j int) bool { return bundles[i].Server < bundles[j].Server })
+	return bundles, nil
+}
+
+// Proofs handlers
+//______________________________________________________________________________________________________________________
+
+// sendProofs sends proofs created by this server to the proof verifiers of a survey
+func (s *Service) sendProofs(targetSurvey SurveyID, msg *ProofsMessage) {
+	survey, err := s.getSurvey(targetSurvey)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	msg.SurveyID = targetSurvey
+	msg.Server = s.ServerIdentity().String()
+	s.auditMessage(targetSurvey, libunlynxaudit.KindProofs, msg)
+
+	survey.ProofsCollection.mutex.Lock()
+	survey.ProofsCollection.sent++
+	survey.ProofsCollection.mutex.Unlock()
+
+	for _, verifier := range survey.Query.ProofVerifiers {
+		if verifier.ID.Equal(s.ServerIdentity().ID) {
+			_, err = s.HandleProofsMessage(msg)
+		} else {
+			err = s.SendRaw(verifier, msg)
+		}
+		if err != nil {
+			log.Error("could not send proofs to ", verifier, ": ", err)
+		}
+	}
+}
+
+// sendShardedShuffle sends the lists before and after a sharded shuffle started by this server to the proof verifiers of
+// a survey
+func (s *Service) sendShardedShuffle(targetSurvey SurveyID, original, shuffled []libunlynx.CipherVector) error {
+	ssb := ShardedShuffleBytes{}
+	var err error
+	if ssb.Original, ssb.OriginalLengths, err = libunlynx.ArrayCipherVectorToBytes(original); err != nil {
+		return err
+	}
+	if ssb.Shuffled, ssb.ShuffledLengths, err = libunlynx.ArrayCipherVectorToBytes(shuffled); err != nil {
+		return err
+	}
+	s.sendProofs(targetSurvey, &ProofsMessage{ShardedShuffle: &ssb})
+	return nil
+}
+
+// HandleProofsMessage handles the proofs of a server at a proof verifier
+func (s *Service) HandleProofsMessage(msg *ProofsMessage) (network.Message, error) {
+	survey, err := s.getSurvey(msg.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+	// malformed proofs are counted too (and make the verification of the server fail)
+	err = survey.ProofsCollection.add(msg)
+	s.verifyIfComplete(survey, msg.Server)
+	if err != nil {
+		return nil, errors.New("malformed proofs from " + msg.Server + ": " + err.Error())
+	}
+	return nil, nil
+}
+
+// HandleProofsEnd handles the end of a survey: the server tells the proof verifiers how many proofs messages it sent
+func (s *Service) HandleProofsEnd(msg *ProofsEnd) (network.Message, error) {
+	survey, err := s.getSurvey(msg.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+	survey.ProofsCollection.mutex.Lock()
+	survey.ProofsCollection.resultsDigest = msg.ResultsDigest
+	sent := &ProofsSent{SurveyID: msg.SurveyID, Server: s.ServerIdentity().String(), NbrMessages: survey.ProofsCollection.sent}
+	survey.ProofsCollection.mutex.Unlock()
+
+	for _, verifier := range survey.Query.ProofVerifiers {
+		if verifier.ID.Equal(s.ServerIdentity().ID) {
+			_, err = s.HandleProofsSent(sent)
+		} else {
+			err = s.SendRaw(verifier, sent)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// HandleProofsSent handles the number of proofs messages sent by a server at a proof verifier
+func (s *Service) HandleProofsSent(msg *ProofsSent) (network.Message, error) {
+	survey, err := s.getSurvey(msg.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+	survey.ProofsCollection.mutex.Lock()
+	survey.ProofsCollection.expected[msg.Server] = msg.NbrMessages
+	survey.ProofsCollection.mutex.Unlock()
+
+	s.verifyIfComplete(survey, msg.Server)
+	return nil, nil
+}
+
+// HandleProofsBundleQuery exports the proofs received by a proof verifier for a survey
+func (s *Service) HandleProofsBundleQuery(msg *ProofsBundleQuery) (network.Message, error) {
+	survey, err := s.getSurvey(msg.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+	if !survey.isProofVerifier(s.ServerIdentity()) {
+		return nil, errors.New(s.ServerIdentity().String() + " is not a proof verifier of survey " + string(msg.SurveyID))
+	}
+	bundles, err := survey.ProofsCollection.bundles(msg.SurveyID, s.ServerIdentity())
+	if err != nil {
+		return nil, errors.New("could not create the proofs bundles: " + err.Error())
+	}
+	return &ProofsBundleReply{Bundles: bundles}, nil
+}
+
+// HandleProofsVerificationResult handles the result of a proof verifier at the root. Only one result of each proof
+// verifier for each server of the roster is expected.
+func (s *Service) HandleProofsVerificationResult(msg *ProofsVerificationResult) (network.Message, error) {
+	survey, err := s.getSurvey(msg.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+	if !survey.Query.Source.ID.Equal(s.ServerIdentity().ID) {
+		return nil, errors.New(s.ServerIdentity().String() + " is not the root of survey " + string(msg.SurveyID))
+	}
+	if !survey.hasVerifier(msg.Verifier) || !survey.hasServer(msg.Server) {
+		return nil, errors.New("unexpected proofs verification result of " + msg.Verifier + " for " + msg.Server)
+	}
+	if err := survey.ProofsCollection.addResult(*msg); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// verifyIfComplete verifies (in the background) the proofs of a server once all of them are received and sends the
+// result to the root. The shuffle proofs of a sharded (or streamed) shuffle only compose once the proofs of all the servers are
+// received: the proofs of all the servers are then verified together, the shuffles of each server being valid only if
+// the whole shuffle is. In the same way, the keys and tag generators of the proofs of a server which shuffled and tagged
+// the responses are the ones of its position in the circuit, which depend on the proofs of the other servers.
+func (s *Service) verifyIfComplete(survey Survey, server string) {
+	proofs, wellFormed, ok := survey.ProofsCollection.complete(server)
+	if !ok {
+		return
+	}
+	sharded := survey.Query.ShuffleShards > 0 || survey.Query.BatchSize > 0
+	if !sharded && !survey.Query.ShuffleAndTag {
+		go s.sendProofsVerification(survey, s.verifyServerProofs(survey, server, proofs, wellFormed))
+		return
+	}
+
+	allProofs, allWellFormed, ok := survey.ProofsCollection.completeAll(len(survey.Query.Roster.List))
+	if !ok {
+		return
+	}
+	go func() {
+		shuffleProofs := make([]libunlynxshuffle.PublishedShufflingProof, 0)
+		for _, proofs := range allProofs {
+			shuffleProofs = append(shuffleProofs, proofs.ShufflingProofs.List...)
+		}
+		composed := true
+		if sharded {
+			composed = s.verifyShardedShuffle(survey, shuffleProofs)
+		}
+		invalid := s.verifyCircuits(survey)
+
+		for _, si := range survey.Query.Roster.List {
+			proofs := allProofs[si.String()]
+			if sharded {
+				// verified with the sharded shuffle
+				proofs.ShufflingProofs = libunlynxshuffle.PublishedShufflingListProof{}
+			}
+			result := s.verifyServerProofs(survey, si.String(), proofs, allWellFormed[si.String()])
+			if len(result.Results) == protocolsunlynxutils.NbrResults {
+				shuffling := &result.Results[protocolsunlynxutils.ShufflingResult]
+				*shuffling = *shuffling && composed && !invalid[si.String()]
+				addition := &result.Results[protocolsunlynxutils.DetTagAdditionResult]
+				*addition = *addition && !invalid[si.String()]
+			}
+			s.sendProofsVerification(survey, result)
+		}
+	}()
+}
+
+// verifyShardedShuffle verifies that the shuffle proofs of all the servers compose to the sharded (or streamed) shuffles
+// of the lists sent by the servers which started them (see libunlynxshuffle.ShardedShufflesProofVerification), the shape
+// of each shuffle being recomputed from the survey
+func (s *Service) verifyShardedShuffle(survey Survey, proofs []libunlynxshuffle.PublishedShufflingProof) bool {
+	nbrServers := len(survey.Query.Roster.List)
+	shuffles := survey.ProofsCollection.shardedShuffleList()
+	for i := range shuffles {
+		if survey.Query.ShuffleShards > 0 {
+			shuffles[i].NbrShards, shuffles[i].NbrRounds = protocolsunlynx.ShardedShufflingShape(len(shuffles[i].Original), nbrServers, int(survey.Query.ShuffleShards), 0)
+		} else {
+			shuffles[i].NbrShards, shuffles[i].NbrRounds = protocolsunlynx.StreamedShufflingShape(len(shuffles[i].Original), int(survey.Query.BatchSize))
+		}
+	}
+	return libunlynxshuffle.ShardedShufflesProofVerification(shuffles, proofs, nbrServers, survey.Query.Roster.Aggregate)
+}
+
+// verifyCircuits checks the proofs of the servers in each circuit of the shuffling and tagging of the survey (see
+// protocolsunlynx.ShufflingPlusDDTProtocol) and returns the servers whose proofs are not the ones of their position: the
+// keys of their shuffle proofs have to be the collective key minus the keys of the servers before them (for the tagged
+// ciphertexts) and their tag generator the one added by the server before them.
+func (s *Service) verifyCircuits(survey Survey) map[string]bool {
+	invalid := make(map[string]bool)
+	for root, servers := range survey.ProofsCollection.circuitList() {
+		var rootIdentity *network.ServerIdentity
+		for _, si := range survey.Query.Roster.List {
+			if si.String() == root {
+				rootIdentity = si
+			}
+		}
+		if rootIdentity == nil {
+			log.Error("unknown root of circuit ", root)
+			for server := range servers {
+				invalid[server] = true
+			}
+			continue
+		}
+
+		circuit, keys := protocolsunlynx.ShufflingPlusDDTCircuit(survey.protocolTree(rootIdentity))
+		// the number of tagged ciphertexts is the same in the whole circuit
+		nbrTagged := -1
+		for p, si := range circuit {
+			cp, ok := servers[si.String()]
+			if !ok {
+				log.Error("missing proofs of ", si, " in circuit ", root)
+				invalid[si.String()] = true
+				continue
+			}
+
+			for _, psp := range cp.shuffling {
+				tagged := 0
+				for tagged < len(psp.Keys) && psp.Keys[tagged] != nil && psp.Keys[tagged].Equal(keys[p]) {
+					tagged++
+				}
+				if p > 0 {
+					if nbrTagged < 0 {
+						nbrTagged = tagged
+					} else if tagged != nbrTagged {
+						tagged = 0
+					}
+				}
+				if tagged == 0 || !libunlynxshuffle.ShuffleProofKeys(psp, protocolsunlynx.ShufflingPlusDDTPositionKeys(keys[p], survey.Query.Roster.Aggregate, tagged, len(psp.Keys))) {
+					log.Error("wrong shuffling keys of ", si, " in circuit ", root)
+					invalid[si.String()] = true
+				}
+			}
+
+			if len(cp.addition) == 0 {
+				continue
+			}
+			g := libunlynx.SuiTe.Point().Base()
+			if p > 0 {
+				previous := servers[circuit[p-1].String()]
+				if len(previous.addition) == 0 || previous.addition[0].C2 == nil {
+					log.Error("missing tag generator of ", si, " in circuit ", root)
+					invalid[si.String()] = true
+					continue
+				}
+				g = previous.addition[0].C2
+			}
+			for _, pdap := range cp.addition {
+				if !pdap.HasGenerator(g) {
+					log.Error("wrong tag generator of ", si, " in circuit ", root)
+					invalid[si.String()] = true
+					break
+				}
+			}
+		}
+	}
+	return invalid
+}
+
+// verifyServerProofs verifies the proofs of a server (if they are well-formed and created with its key)
+func (s *Service) verifyServerProofs(survey Survey, server string, proofs protocolsunlynxutils.ProofsToVerify, wellFormed bool) *ProofsVerificationResult {
+	result := &ProofsVerificationResult{SurveyID: survey.Query.SurveyID, Verifier: s.ServerIdentity().String(), Server: server}
+	var err error
+	if wellFormed {
+		err = survey.checkServerProofs(server, proofs)
+	}
+	if err != nil {
+		log.Error("the proofs of ", server, " are not its own: ", err)
+	} else if wellFormed {
+		result.Results, err = s.VerifyProofs(survey, proofs)
+		if err != nil {
+			log.Error("could not verify the proofs of ", server, ": ", err)
+		}
+	}
+	log.Lvl1(s.ServerIdentity(), " verified the proofs of ", server, ": ", result.Verified())
+	return result
+}
+
+// sendProofsVerification sends the result of the verification of the proofs of a server to the root
+func (s *Service) sendProofsVerification(survey Survey, result *ProofsVerificationResult) {
+	s.auditMessage(survey.Query.SurveyID, libunlynxaudit.KindProofsVerification, result)
+
+	var err error
+	if survey.Query.Source.ID.Equal(s.ServerIdentity().ID) {
+		_, err = s.HandleProofsVerificationResult(result)
+	} else {
+		err = s.SendRaw(survey.Query.Source, result)
+	}
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// checkServerProofs checks that the proofs of a server of the survey are created with its key (see
+// protocolsunlynxutils.CheckServerProofs)
+func (s *Survey) checkServerProofs(server string, proofs protocolsunlynxutils.ProofsToVerify) error {
+	for _, si := range s.Query.Roster.List {
+		if si.String() == server {
+			return protocolsunlynxutils.CheckServerProofs(proofs, si.Public)
+		}
+	}
+	return errors.New(server + " is not in the roster")
+}
+
+// isProofVerifier returns true if the server is a proof verifier of the survey
+func (s *Survey) isProofVerifier(si *network.ServerIdentity) bool {
+	for _, verifier := range s.Query.ProofVerifiers {
+		if verifier.ID.Equal(si.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasVerifier returns true if a proof verifier of the survey has this name (see network.ServerIdentity.String)
+func (s *Survey) hasVerifier(name string) bool {
+	for _, verifier := range s.Query.ProofVerifiers {
+		if verifier.String() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasServer returns true if a server of the roster of the survey has this name (see network.ServerIdentity.String)
+func (s *Survey) hasServer(name string) bool {
+	for _, server := range s.Query.Roster.List {
+		if server.String() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyProofs runs a ProofsVerificationProtocol on this server for proofs created during a survey
+func (s *Service) VerifyProofs(survey Survey, proofs protocolsunlynxutils.ProofsToVerify) ([]bool, error) {
+	tree := onet.NewRoster([]*network.ServerIdentity{s.ServerIdentity()}).GenerateNaryTree(1)
+	tn := s.NewTreeNodeInstance(tree, tree.Root, protocolsunlynxutils.ProofsVerificationProtocolName)
+
+	pi, err := protocolsunlynxutils.NewProofsVerificationProtocol(tn)
+	if err != nil {
+		return nil, err
+	}
+	pvp := pi.(*protocolsunlynxutils.ProofsVerificationProtocol)
+	pvp.TargetOfVerification = proofs
+	pvp.CollectiveKey = survey.Query.Roster.Aggregate
+
+	if err := s.RegisterProtocolInstance(pi); err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := pi.Dispatch(); err != nil {
+			log.Error("Error running Dispatch ->" + protocolsunlynxutils.ProofsVerificationProtocolName + " :" + err.Error())
+		}
+	}()
+	go func() {
+		if err := pi.Start(); err != nil {
+			log.Error("Error running Start ->" + protocolsunlynxutils.ProofsVerificationProtocolName + " :" + err.Error())
+		}
+	}()
+	return <-pvp.FeedbackChannel, nil
+}
+
+// ProofsPhase is run by the root once the survey is processed (with the digest of its results): it asks all the servers
+// to report their proofs to the proof verifiers and waits for the verification results (one per verifier and server).
+// After the ProofsTimeout of the survey, it returns the results received so far with an error.
+func (s *Service) ProofsPhase(targetSurvey SurveyID, resultsDigest []byte) ([]ProofsVerificationResult, error) {
+	survey, err := s.getSurvey(targetSurvey)
+	if err != nil {
+		return nil, err
+	}
+
+	end := &ProofsEnd{SurveyID: targetSurvey, ResultsDigest: resultsDigest}
+	if err := libunlynxtools.SendISMOthers(s.ServiceProcessor, &survey.Query.Roster, end); err != nil {
+		return nil, err
+	}
+	if _, err := s.HandleProofsEnd(end); err != nil {
+		return nil, err
+	}
+
+	nbrResults := len(survey.Query.ProofVerifiers) * len(survey.Query.Roster.List)
+	results := make([]ProofsVerificationResult, 0, nbrResults)
+	proofsTimeout := survey.Query.ProofsTimeout
+	if proofsTimeout == 0 {
+		proofsTimeout = defaultProofsTimeout
+	}
+	timeout := time.After(proofsTimeout)
+	for len(results) < nbrResults {
+		select {
+		case result := <-survey.ProofsCollection.Results:
+			results = append(results, result)
+		case <-timeout:
+			return results, errors.New("only " + strconv.Itoa(len(results)) + " of the " + strconv.Itoa(nbrResults) + " proofs verification results were received")
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,141 @@
+package servicesunlynx
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// schemaRegistrationValidity bounds the difference between the time of a schema registration and the time of the server
+const schemaRegistrationValidity = time.Minute
+
+// registeredSchema is the dataset schema of a roster with the key which registered it, as kept (and saved) by a server
+type registeredSchema struct {
+	Schema     libunlynx.DatasetSchema
+	Registrant kyber.Point
+	Time       int64
+}
+
+func init() {
+	network.RegisterMessage(&registeredSchema{})
+}
+
+// SetSchemaAdmins sets the public keys of the clients which can register the dataset schemas (in addition to the servers
+// of the rosters)
+func (s *Service) SetSchemaAdmins(admins []kyber.Point) {
+	s.SchemaAdmins = admins
+}
+
+// SchemaRegistrationDigest is the message signed by an admin (or a server of the roster) to register the dataset schema
+// of a roster at a given time (in nanoseconds since the epoch)
+func SchemaRegistrationDigest(roster *onet.Roster, schema *libunlynx.DatasetSchema, registrationTime int64) []byte {
+	h := sha256.New()
+	h.Write([]byte("schemaRegistration/" + roster.ID.String() + "/" + strconv.FormatInt(registrationTime, 10)))
+	for _, a := range schema.Attributes {
+		for _, field := range []string{a.Name, a.Kind, a.Type} {
+			binary.Write(h, binary.BigEndian, int64(len(field)))
+			h.Write([]byte(field))
+		}
+		binary.Write(h, binary.BigEndian, a.Min)
+		binary.Write(h, binary.BigEndian, a.Max)
+		binary.Write(h, binary.BigEndian, int64(len(a.Values)))
+		binary.Write(h, binary.BigEndian, a.Values)
+		binary.Write(h, binary.BigEndian, a.Optional)
+	}
+	return h.Sum(nil)
+}
+
+// schemaKey is the key under which the schema of a roster is saved
+func schemaKey(roster *onet.Roster) []byte {
+	return []byte("schema/" + roster.ID.String())
+}
+
+// isRosterMember tells if a public key is the key of a server of the roster
+func isRosterMember(roster *onet.Roster, public kyber.Point) bool {
+	for _, si := range roster.List {
+		if si.Public.Equal(public) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSchemaRegistration checks that a schema registration is signed by an admin of the server or by a server of the
+// roster, and that it does not replace the schema registered by another admin (only the servers of the roster can)
+func (s *Service) checkSchemaRegistration(recq *SchemaRegistrationQuery, previous *registeredSchema) error {
+	if recq.Registrant == nil {
+		return errors.New("the schema registration is not signed")
+	}
+	member := isRosterMember(&recq.Roster, recq.Registrant)
+	authorized := member
+	for _, admin := range s.SchemaAdmins {
+		if admin.Equal(recq.Registrant) {
+			authorized = true
+		}
+	}
+	if !authorized {
+		return errors.New("the client is neither an admin of " + s.ServerIdentity().String() + " nor a server of the roster")
+	}
+	if delay := time.Since(time.Unix(0, recq.Time)); delay > schemaRegistrationValidity || delay < -schemaRegistrationValidity {
+		return errors.New("the schema registration has expired")
+	}
+	if err := schnorr.Verify(libunlynx.SuiTe, recq.Registrant, SchemaRegistrationDigest(&recq.Roster, &recq.Schema, recq.Time), recq.Signature); err != nil {
+		return errors.New("invalid signature of the schema registration: " + err.Error())
+	}
+
+	if previous != nil {
+		if recq.Time <= previous.Time {
+			return errors.New("the schema registration is older than the registered schema")
+		}
+		if !member && !previous.Registrant.Equal(recq.Registrant) {
+			return errors.New("the schema of roster " + recq.Roster.ID.String() + " was registered by another client")
+		}
+	}
+	return nil
+}
+
+// getRegisteredSchema returns the dataset schema registered for a roster (loaded from the storage of the server if
+// needed, nil if there is none)
+func (s *Service) getRegisteredSchema(roster *onet.Roster) (*registeredSchema, error) {
+	schema, err := s.Schemas.Get(roster.ID.String())
+	if err != nil {
+		return nil, errors.New("Error" + err.Error() + "while getting the schema of roster" + roster.ID.String())
+	}
+	if schema != nil {
+		result := schema.(registeredSchema)
+		return &result, nil
+	}
+
+	saved, err := s.Load(schemaKey(roster))
+	if err != nil {
+		return nil, errors.New("could not load the schema of roster " + roster.ID.String() + ": " + err.Error())
+	}
+	if saved == nil {
+		return nil, nil
+	}
+	result, ok := saved.(*registeredSchema)
+	if !ok {
+		return nil, errors.New("the saved schema of roster " + roster.ID.String() + " is corrupted")
+	}
+	if _, err := s.Schemas.Put(roster.ID.String(), *result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// putRegisteredSchema saves the dataset schema of a roster
+func (s *Service) putRegisteredSchema(roster *onet.Roster, schema registeredSchema) error {
+	if err := s.Save(schemaKey(roster), &schema); err != nil {
+		return errors.New("could not save the schema of roster " + roster.ID.String() + ": " + err.Error())
+	}
+	_, err := s.Schemas.Put(roster.ID.String(), schema)
+	return err
+}
@@ -3,14 +3,22 @@ package servicesunlynx
 import (
 	"errors"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Knetic/govaluate"
 	"github.com/fanliao/go-concurrentMap"
 	"github.com/ldsec/unlynx/data"
 	"github.com/ldsec/unlynx/lib"
 	"github.com/ldsec/unlynx/lib/aggregation"
+	"github.com/ldsec/unlynx/lib/audit"
+	"github.com/ldsec/unlynx/lib/deterministic_tag"
 	"github.com/ldsec/unlynx/lib/differential_privacy"
 	"github.com/ldsec/unlynx/lib/key_switch"
+	"github.com/ldsec/unlynx/lib/membership"
+	"github.com/ldsec/unlynx/lib/encryption_proof"
+	"github.com/ldsec/unlynx/lib/range_proof"
 	"github.com/ldsec/unlynx/lib/shuffle"
 	"github.com/ldsec/unlynx/lib/store"
 	"github.com/ldsec/unlynx/lib/tools"
@@ -20,12 +28,25 @@ import (
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/onet/v3/simul/monitor"
 )
 
 // ServiceName is the registered name for the unlynx service.
 const ServiceName = "UnLynx"
 
-const gobFile = "pre_compute_multiplications.gob"
+// testDataFile is the default data source of the servers
+const testDataFile = "unlynx_test_data.txt"
+
+// MaxTopKBound is the largest count compared by a top-k selection (each comparison with a threshold t is a membership
+// test in a set of t values for all the groups). A selection depending on the order of counts above the bound fails.
+const MaxTopKBound = 1024
+
+// droNbrNoiseValues is the (minimum) number of noise values shuffled in the DRO phase
+const droNbrNoiseValues = 1000
+
+// uploadTimeout is the time after which a chunked upload without any new chunk is abandoned (and its staged responses
+// are dropped)
+const uploadTimeout = 10 * time.Minute
 
 // SurveyID unique ID for each survey.
 type SurveyID string
@@ -37,7 +58,10 @@ type SurveyCreationQuery struct {
 	ClientPubKey kyber.Point
 	MapDPs       map[string]int64
 	Proofs       bool
-	AppFlag      bool
+	// ProofVerifiers are the servers (of the roster) verifying the proofs of all the servers when Proofs is set (the
+	// server receiving the query by default)
+	ProofVerifiers []*network.ServerIdentity
+	AppFlag        bool
 	IntraMessage bool
 	Source       *network.ServerIdentity
 
@@ -47,31 +71,165 @@ type SurveyCreationQuery struct {
 	Where     []libunlynx.WhereQueryAttribute
 	Predicate string
 	GroupBy   []string
+	Histogram *libunlynx.Histogram
+
+	// groups whose count is below MinCount are not sent to the querier (they are merged together if MergeBelowMinCount)
+	MinCount           int64
+	MergeBelowMinCount bool
+	// only the TopK groups with the largest counts are sent to the querier (ties between equal counts are broken
+	// arbitrarily). The counts are only compared up to TopKBound (MaxTopKBound by default): the survey fails if more
+	// than TopK groups have a count >= TopKBound, as the selection would depend on counts which are not compared.
+	// The selection is a search over thresholds: the root learns, for each tested threshold (at most 2*log2(TopKBound)
+	// of them), which groups have a count above it, i.e. a coarse ranking of all the groups. The querier only gets the
+	// selected groups.
+	TopK      int64
+	TopKBound int64
+
+	Join           *JoinQuery
+	SetCardinality *SetCardinalityQuery
+
+	// only the data providers registered to the survey (see DPRegistrationQuery) can upload (signed) responses. Only the
+	// AuthorizedDPs can register, on their server and at most MapDPs of them on each server. Without registration, the
+	// responses are anonymous: a response replaying the ciphertexts of another one is rejected but nothing prevents a data
+	// provider from uploading (newly encrypted) responses several times.
+	DPRegistration bool
+	AuthorizedDPs  []AuthorizedDP
+	// RangeBits gives the range [0, 2^bits) of aggregating attributes: their encrypted values need a range proof
+	RangeBits map[string]int64
+	// each encrypted attribute of a response needs a proof of correct encryption bound to the survey and to the data
+	// provider (which has to be registered, see DPRegistration)
+	EncryptionProofs bool
+
+	// the responses are shuffled in ShuffleShards shards in parallel (see protocolsunlynx.ShardedShufflingProtocol)
+	// instead of going through a single circuit
+	ShuffleShards int64
+	// the responses are streamed through the circuit of servers in batches of BatchSize responses (ciphertexts for the
+	// deterministic tagging) during the shuffling and the tagging instead of being sent in one message. The batches are
+	// pipelined: each server forwards a batch once it is shuffled (or tagged). The batches of the shuffling are mixed
+	// between rounds as the shards of a sharded shuffle (see protocolsunlynx.StreamedShufflingShape).
+	BatchSize int64
+	// ShuffleProof is the argument of the shuffle proofs: libunlynxshuffle.NeffShuffleProof (by default) or
+	// libunlynxshuffle.BayerGrothShuffleProof, whose proofs grow with the square root of the number of responses
+	ShuffleProof string
+	// ShuffleAndTag shuffles and tags the responses in a single traversal of the circuit of servers (see
+	// protocolsunlynx.ShufflingPlusDDTProtocol) instead of a shuffling phase followed by a tagging phase. The tagged
+	// attributes are partially decrypted during the shuffles so that, with proofs, ShuffleProof must be
+	// libunlynxshuffle.BayerGrothShuffleProof.
+	ShuffleAndTag bool
+
+	// BranchingFactor is the number of children of each server in the tree of the collective aggregation (2 by
+	// default)
+	BranchingFactor int64
+	// AggregationTimeout bounds the time the collective aggregation waits for the servers (by default it waits for all
+	// of them). The servers which do not send their data in time are left out of the results and reported in their
+	// AggregationCoverage so that the querier can decide if the results are acceptable. All the servers are still
+	// needed to decrypt the results.
+	AggregationTimeout time.Duration
+	// ProofsTimeout bounds the time the root waits for the results of the proof verifiers (10 minutes by default): the
+	// results of the survey are then returned with the verification results received so far.
+	ProofsTimeout time.Duration
+}
+
+// SetCardinalityQuery asks for the cardinality of the intersection (or the union) of the sets of identifiers held by
+// the data providers. Each data provider registers to the survey (see SurveyCreationQuery.DPRegistration), sends its set
+// once (see SendSetResponseQuery) and the querier only gets the cardinality. The servers count each identifier once per
+// data provider (see DeduplicateSetResponses).
+type SetCardinalityQuery struct {
+	Identifier string
+	Union      bool
+}
+
+// JoinQuery describes a one-to-one inner join of two data sources on an encrypted key attribute (e.g. a patient
+// identifier). Each data provider responds for one of the two sources. The keys present in both sources are matched on
+// their deterministic tags and the querier only gets the number of joined rows (matched keys) and the aggregates over
+// the joined rows (counts and sums of each source), in this order: JoinCountAttribute, the count of each source, the
+// sum attributes of each source. A matched key must be unique in each source: the survey fails otherwise (the products
+// of a one-to-many or many-to-many join can not be computed on the encrypted counts and sums). The join defines the
+// grouping and the aggregating attributes of the survey so that it can not be combined with Sum, Count, GroupBy,
+// Histogram, SetCardinality, MinCount or TopK.
+type JoinQuery struct {
+	Key   string
+	Left  JoinSource
+	Right JoinSource
+}
+
+// JoinSource is one of the two data sources of a join with the attributes that it aggregates.
+type JoinSource struct {
+	Name string
+	Sum  []string
+}
+
+// JoinCountAttribute is the name of the attribute containing the number of matched keys in a join
+const JoinCountAttribute = "join_count"
+
+// CountAttribute returns the name of the attribute counting the responses of the source
+func (js *JoinSource) CountAttribute() string {
+	return JoinCountAttribute + "_" + js.Name
+}
+
+// Validate checks that the join is well defined
+func (jq *JoinQuery) Validate() error {
+	if jq.Key == "" {
+		return errors.New("join has no key attribute")
+	}
+	if jq.Left.Name == "" || jq.Right.Name == "" || jq.Left.Name == jq.Right.Name {
+		return errors.New("join sources must have different non-empty names")
+	}
+	return nil
+}
+
+// Attributes returns the list of aggregating attributes of a join survey
+func (jq *JoinQuery) Attributes() []string {
+	sum := []string{JoinCountAttribute, jq.Left.CountAttribute(), jq.Right.CountAttribute()}
+	sum = append(sum, jq.Left.Sum...)
+	return append(sum, jq.Right.Sum...)
 }
 
 // Survey represents a survey with the corresponding params
 type Survey struct {
 	*libunlynxstore.Store
-	Query             SurveyCreationQuery
-	SurveySecretKey   kyber.Scalar
-	ShufflePrecompute []libunlynxshuffle.CipherVectorScalar
-	Lengths           [][]int
-	TargetOfSwitch    []libunlynx.ProcessResponse
+	Query           SurveyCreationQuery
+	SurveySecretKey kyber.Scalar
+	ShuffleLineSize int // size of the precomputed values of the shuffles (see Service.Precomputation)
+	Lengths         [][]int
+	TargetOfSwitch  []libunlynx.ProcessResponse
 
 	// channels
-	SurveyChannel chan int // To wait for the survey to be created before loading data
-	DpChannel     chan int // To wait for all data to be read before starting unlynx service protocol
-	DDTChannel    chan int // To wait for all nodes to finish the tagging before continuing
+	SurveyChannel  chan int // To wait for the survey to be created before loading data
+	DpChannel      chan int // To wait for all data to be read before starting unlynx service protocol
+	DDTChannel     chan int // To wait for all nodes to finish the tagging before continuing
+	TaggingChannel chan int // To wait for the local tagging to finish before aggregating (with an aggregation timeout)
+
+	Noise    libunlynx.CipherText
+	BinNoise libunlynx.CipherVector
+
+	MembershipTarget   []libunlynx.CipherVector
+	ThresholdDecisions []ThresholdDecision
+
+	DataProviders    *DataProviders
+	ProofsCollection *ProofsCollection
+
+	Coverage AggregationCoverage
+}
 
-	Noise libunlynx.CipherText
+// ThresholdDecision records if a (collectively aggregated) group was suppressed because its count was below the
+// minimum count of the query.
+type ThresholdDecision struct {
+	Group      libunlynx.GroupingKey
+	Suppressed bool
 }
 
 // MsgTypes defines the Message Type ID for all the service's intra-messages.
 type MsgTypes struct {
-	msgSurveyCreationQuery    network.MessageTypeID
-	msgSurveyResultsQuery     network.MessageTypeID
-	msgDDTfinished            network.MessageTypeID
-	msgQueryBroadcastFinished network.MessageTypeID
+	msgSurveyCreationQuery     network.MessageTypeID
+	msgSurveyResultsQuery      network.MessageTypeID
+	msgDDTfinished             network.MessageTypeID
+	msgQueryBroadcastFinished  network.MessageTypeID
+	msgSchemaRegistrationQuery network.MessageTypeID
+	msgProofsMessage           network.MessageTypeID
+	msgProofsEnd               network.MessageTypeID
+	msgProofsSent              network.MessageTypeID
+	msgProofsResult            network.MessageTypeID
 }
 
 var msgTypes = MsgTypes{}
@@ -84,10 +242,24 @@ func init() {
 	msgTypes.msgSurveyResultsQuery = network.RegisterMessage(&SurveyResultsQuery{})
 	msgTypes.msgDDTfinished = network.RegisterMessage(&DDTfinished{})
 	msgTypes.msgQueryBroadcastFinished = network.RegisterMessage(&QueryBroadcastFinished{})
+	msgTypes.msgSchemaRegistrationQuery = network.RegisterMessage(&SchemaRegistrationQuery{})
+	msgTypes.msgProofsMessage = network.RegisterMessage(&ProofsMessage{})
+	msgTypes.msgProofsEnd = network.RegisterMessage(&ProofsEnd{})
+	msgTypes.msgProofsSent = network.RegisterMessage(&ProofsSent{})
+	msgTypes.msgProofsResult = network.RegisterMessage(&ProofsVerificationResult{})
 
 	network.RegisterMessage(&SurveyResponseQuery{})
+	network.RegisterMessage(&SurveyResponseChunk{})
+	network.RegisterMessage(&SurveyResponseCommit{})
+	network.RegisterMessage(&DPRegistrationQuery{})
+	network.RegisterMessage(&SurveyStatusQuery{})
+	network.RegisterMessage(&SurveyStatus{})
 	network.RegisterMessage(&ServiceState{})
 	network.RegisterMessage(&ServiceResult{})
+	network.RegisterMessage(&AuditLogQuery{})
+	network.RegisterMessage(&AuditLogReply{})
+	network.RegisterMessage(&ProofsBundleQuery{})
+	network.RegisterMessage(&ProofsBundleReply{})
 }
 
 // QueryBroadcastFinished is used to ensure that all servers have received the query/survey
@@ -104,6 +276,47 @@ type DDTfinished struct {
 type SurveyResponseQuery struct {
 	SurveyID  SurveyID
 	Responses []libunlynx.DpResponseToSend
+	// JoinSource is the name of the source of the responses in a join survey
+	JoinSource string
+	// DPID and Signature identify a registered data provider (the signature is computed with ResponsesDigest)
+	DPID      string
+	Signature []byte
+}
+
+// SurveyResponseChunk is a part of a chunked upload of DP responses, used when the responses do not fit in one
+// SurveyResponseQuery. The chunks of an upload are numbered from 0 and have to be sent in order. The first chunk opens
+// the upload for its data provider (the only one which can then send the next chunks and commit it). An upload with an
+// invalid chunk, or without any chunk for 10 minutes, is closed.
+type SurveyResponseChunk struct {
+	SurveyID   SurveyID
+	UploadID   string
+	Sequence   int64
+	Responses  []libunlynx.DpResponseToSend
+	JoinSource string
+	DPID       string
+	Signature  []byte
+}
+
+// SurveyResponseCommit completes a chunked upload. The data provider is only counted once all its chunks are received.
+type SurveyResponseCommit struct {
+	SurveyID  SurveyID
+	UploadID  string
+	NbrChunks int64
+	DPID      string
+	Signature []byte
+}
+
+// SchemaRegistrationQuery is used to register the schema of the dataset held by the data providers of a roster. Once
+// registered, the queries and DP responses of the surveys run by the roster are validated against the schema. The
+// registration is signed (see SchemaRegistrationDigest) at Time (in nanoseconds since the epoch) by the Registrant, an
+// admin of the servers (see Service.SetSchemaAdmins) or a server of the roster.
+type SchemaRegistrationQuery struct {
+	IntraMessage bool
+	Roster       onet.Roster
+	Schema       libunlynx.DatasetSchema
+	Registrant   kyber.Point
+	Time         int64
+	Signature    []byte
 }
 
 // SurveyResultsQuery is used by querier to ask for the response of the survey.
@@ -121,6 +334,26 @@ type ServiceState struct {
 // ServiceResult will contain final results of a survey and be sent to querier.
 type ServiceResult struct {
 	Results []libunlynx.FilteredResponse
+	// ProofsVerification contains the verification of the proofs of each server by each proof verifier (if the survey
+	// has proofs)
+	ProofsVerification []ProofsVerificationResult
+	// Coverage tells which servers are in the collective aggregation of the results
+	Coverage AggregationCoverage
+	// ThresholdDecisions tells which groups were suppressed because of the minimum count of the query (the groups are
+	// identified by their deterministic tags). They are part of the digest of the results in the audit log.
+	ThresholdDecisions []ThresholdDecision
+}
+
+// AggregationCoverage reports the servers whose data is missing from the collective aggregation (the ones which did not
+// respond before the aggregation timeout).
+type AggregationCoverage struct {
+	NbrServers int64
+	Missing    []*network.ServerIdentity
+}
+
+// Complete tells if the data of all the servers is aggregated
+func (ac *AggregationCoverage) Complete() bool {
+	return len(ac.Missing) == 0
 }
 
 // Service defines a service in unlynx with a survey.
@@ -128,6 +361,26 @@ type Service struct {
 	*onet.ServiceProcessor
 
 	Survey *concurrent.ConcurrentMap
+	// Schemas contains the dataset schema of each roster (by roster ID), saved in the storage of the server
+	Schemas *concurrent.ConcurrentMap
+	// SchemaAdmins are the public keys of the clients which can register the dataset schemas (none by default)
+	SchemaAdmins []kyber.Point
+	// schemaMutex serializes the registrations of the schemas
+	schemaMutex sync.Mutex
+	// Uploads contains the state of each chunked upload (see chunkedUpload)
+	Uploads *concurrent.ConcurrentMap
+	// DataSource is the local data used to answer the surveys with the AppFlag (the generated test data by default)
+	DataSource dataunlynx.DataSource
+	// AuditLog records the queries, proofs, threshold decisions and results of the surveys run by the server
+	AuditLog *libunlynxaudit.Log
+	// Auditors are the public keys of the clients which can export the audit log (none by default)
+	Auditors []kyber.Point
+	// auditSigner sets the key of the server as signer of the default audit log (the key is only known once the server
+	// is created)
+	auditSigner sync.Once
+	// Precomputation keeps the precomputed rerandomization values of the shuffles (computed when needed by default, see
+	// SetPrecomputationPool)
+	Precomputation *libunlynxshuffle.PrecomputationPool
 }
 
 func (s *Service) getSurvey(sid SurveyID) (Survey, error) {
@@ -146,19 +399,151 @@ func (s *Service) putSurvey(sid SurveyID, surv Survey) error {
 	return err
 }
 
+// SetDataSource sets the local data source of the server
+func (s *Service) SetDataSource(ds dataunlynx.DataSource) {
+	s.DataSource = ds
+}
+
+// SetPrecomputationPool replaces the precomputation pool of the server and starts refilling it in the background
+func (s *Service) SetPrecomputationPool(pool *libunlynxshuffle.PrecomputationPool) {
+	s.Precomputation.Stop()
+	s.Precomputation = pool
+	s.Precomputation.Start()
+}
+
+// chunkedUpload is the state of a chunked upload: its chunks are validated and written to a staging store when they
+// arrive, and the staged responses are merged in the store of the survey on commit. The mutex serializes the chunks and
+// the commit of the upload.
+type chunkedUpload struct {
+	mutex    sync.Mutex
+	SurveyID SurveyID
+	UploadID string
+	// DPID is the data provider which opened the upload (the only one which can send its chunks and commit it)
+	DPID string
+	// Received is the number of chunks received (-1 once the upload is closed: committed, failed or expired)
+	Received     int64
+	NbrResponses int64
+	Staged       *libunlynxstore.Store
+	// lastChunk is the time (in nanoseconds since the epoch) of the last chunk, to expire the abandoned uploads
+	lastChunk int64
+}
+
+func uploadKey(sid SurveyID, uploadID string) string {
+	return string(sid) + "/" + uploadID
+}
+
+// getUpload returns the state of a chunked upload (opened by the data provider dpID if the upload is unknown and open
+// is set). The abandoned uploads are expired when an upload is opened.
+func (s *Service) getUpload(sid SurveyID, uploadID, dpID string, open bool) (*chunkedUpload, error) {
+	var upload interface{}
+	var err error
+	if open {
+		s.expireUploads()
+		opened := &chunkedUpload{SurveyID: sid, UploadID: uploadID, DPID: dpID, Staged: libunlynxstore.NewStore(), lastChunk: time.Now().UnixNano()}
+		if upload, err = s.Uploads.PutIfAbsent(uploadKey(sid, uploadID), opened); err == nil && upload == nil {
+			upload = opened
+		}
+	} else {
+		upload, err = s.Uploads.Get(uploadKey(sid, uploadID))
+	}
+	if err != nil {
+		return nil, errors.New("Error" + err.Error() + "while getting upload" + uploadID)
+	}
+	if upload == nil {
+		return nil, errors.New("upload " + uploadID + " is unknown")
+	}
+
+	result := upload.(*chunkedUpload)
+	if result.DPID != dpID {
+		return nil, errors.New("upload " + uploadID + " was opened by another data provider")
+	}
+	return result, nil
+}
+
+// closeUpload forgets a chunked upload and its staged responses, and cancels the upload of its data provider if it was
+// not committed (the caller holds the mutex of the upload)
+func (s *Service) closeUpload(upload *chunkedUpload) {
+	upload.Received = -1
+	upload.Staged = nil
+	if _, err := s.Uploads.Remove(uploadKey(upload.SurveyID, upload.UploadID)); err != nil {
+		log.Error(s.ServerIdentity(), " could not remove upload ", upload.UploadID, ": ", err)
+	}
+	if survey, err := s.getSurvey(upload.SurveyID); err == nil {
+		survey.DataProviders.Abort(upload.DPID, upload.UploadID)
+	}
+}
+
+// expireUploads closes the chunked uploads without any chunk since uploadTimeout
+func (s *Service) expireUploads() {
+	deadline := time.Now().Add(-uploadTimeout).UnixNano()
+	for _, entry := range s.Uploads.ToSlice() {
+		upload := entry.Value().(*chunkedUpload)
+		if atomic.LoadInt64(&upload.lastChunk) < deadline {
+			upload.mutex.Lock()
+			if upload.Received >= 0 && atomic.LoadInt64(&upload.lastChunk) < deadline {
+				log.Lvl2(s.ServerIdentity(), " expires the abandoned upload ", upload.UploadID)
+				s.closeUpload(upload)
+			}
+			upload.mutex.Unlock()
+		}
+	}
+}
+
+// closeSurveyUploads closes the chunked uploads of a survey (e.g. once its results are computed)
+func (s *Service) closeSurveyUploads(sid SurveyID) {
+	for _, entry := range s.Uploads.ToSlice() {
+		upload := entry.Value().(*chunkedUpload)
+		if upload.SurveyID == sid {
+			upload.mutex.Lock()
+			if upload.Received >= 0 {
+				s.closeUpload(upload)
+			}
+			upload.mutex.Unlock()
+		}
+	}
+}
+
+// getSchema returns the dataset schema registered for a roster (nil if there is none)
+func (s *Service) getSchema(roster *onet.Roster) (*libunlynx.DatasetSchema, error) {
+	schema, err := s.getRegisteredSchema(roster)
+	if err != nil || schema == nil {
+		return nil, err
+	}
+	return &schema.Schema, nil
+}
+
 // NewService constructor which registers the needed messages.
 func NewService(c *onet.Context) (onet.Service, error) {
 	newUnLynxInstance := &Service{
 		ServiceProcessor: onet.NewServiceProcessor(c),
 		Survey:           concurrent.NewConcurrentMap(),
+		Schemas:          concurrent.NewConcurrentMap(),
+		Uploads:          concurrent.NewConcurrentMap(),
+		DataSource:       &dataunlynx.TestDataSource{Filename: testDataFile},
+		AuditLog:         libunlynxaudit.NewLog(),
 	}
 	var cerr error
+	if newUnLynxInstance.Precomputation, cerr = libunlynxshuffle.NewPrecomputationPool(""); cerr != nil {
+		return nil, cerr
+	}
 	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleSurveyCreationQuery); cerr != nil {
 		return nil, errors.New("Wrong Handler." + cerr.Error())
 	}
 	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleSurveyResponseQuery); cerr != nil {
 		return nil, errors.New("Wrong Handler." + cerr.Error())
 	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleSurveyResponseChunk); cerr != nil {
+		return nil, errors.New("Wrong Handler." + cerr.Error())
+	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleSurveyResponseCommit); cerr != nil {
+		return nil, errors.New("Wrong Handler." + cerr.Error())
+	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleDPRegistrationQuery); cerr != nil {
+		return nil, errors.New("Wrong Handler." + cerr.Error())
+	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleSurveyStatusQuery); cerr != nil {
+		return nil, errors.New("Wrong Handler." + cerr.Error())
+	}
 	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleSurveyResultsQuery); cerr != nil {
 		return nil, errors.New("Wrong Handler." + cerr.Error())
 	}
@@ -168,16 +553,35 @@ func NewService(c *onet.Context) (onet.Service, error) {
 	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleQueryBroadcastFinished); cerr != nil {
 		return nil, errors.New("Wrong Handler." + cerr.Error())
 	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleSchemaRegistrationQuery); cerr != nil {
+		return nil, errors.New("Wrong Handler." + cerr.Error())
+	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleProofsBundleQuery); cerr != nil {
+		return nil, errors.New("Wrong Handler." + cerr.Error())
+	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleAuditLogQuery); cerr != nil {
+		return nil, errors.New("Wrong Handler." + cerr.Error())
+	}
 
 	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgSurveyCreationQuery)
 	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgSurveyResultsQuery)
 	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgDDTfinished)
 	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgQueryBroadcastFinished)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgSchemaRegistrationQuery)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgProofsMessage)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgProofsEnd)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgProofsSent)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgProofsResult)
 	return newUnLynxInstance, cerr
 }
 
 // Process implements the processor interface and is used to recognize messages broadcasted between servers
 func (s *Service) Process(msg *network.Envelope) {
+	if err := s.checkSender(msg); err != nil {
+		log.Error(s.ServerIdentity(), " ignores a message: ", err)
+		return
+	}
+
 	if msg.MsgType.Equal(msgTypes.msgSurveyCreationQuery) {
 		tmp := (msg.Msg).(*SurveyCreationQuery)
 		_, err := s.HandleSurveyCreationQuery(tmp)
@@ -202,29 +606,227 @@ func (s *Service) Process(msg *network.Envelope) {
 		if err != nil {
 			log.Error(err)
 		}
+	} else if msg.MsgType.Equal(msgTypes.msgSchemaRegistrationQuery) {
+		tmp := (msg.Msg).(*SchemaRegistrationQuery)
+		_, err := s.HandleSchemaRegistrationQuery(tmp)
+		if err != nil {
+			log.Error(err)
+		}
+	} else if msg.MsgType.Equal(msgTypes.msgProofsMessage) {
+		tmp := (msg.Msg).(*ProofsMessage)
+		_, err := s.HandleProofsMessage(tmp)
+		if err != nil {
+			log.Error(err)
+		}
+	} else if msg.MsgType.Equal(msgTypes.msgProofsEnd) {
+		tmp := (msg.Msg).(*ProofsEnd)
+		_, err := s.HandleProofsEnd(tmp)
+		if err != nil {
+			log.Error(err)
+		}
+	} else if msg.MsgType.Equal(msgTypes.msgProofsSent) {
+		tmp := (msg.Msg).(*ProofsSent)
+		_, err := s.HandleProofsSent(tmp)
+		if err != nil {
+			log.Error(err)
+		}
+	} else if msg.MsgType.Equal(msgTypes.msgProofsResult) {
+		tmp := (msg.Msg).(*ProofsVerificationResult)
+		_, err := s.HandleProofsVerificationResult(tmp)
+		if err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// checkSender checks that a message broadcasted between servers comes from a server of the roster of its survey and,
+// for the proofs messages, that the sender is the server (or proof verifier) it claims to be
+func (s *Service) checkSender(msg *network.Envelope) error {
+	sender := msg.ServerIdentity
+	if sender == nil {
+		return errors.New("the message has no sender")
+	}
+
+	var surveyID SurveyID
+	switch tmp := msg.Msg.(type) {
+	case *SurveyCreationQuery:
+		return checkInRoster(&tmp.Roster, sender)
+	case *SchemaRegistrationQuery:
+		return checkInRoster(&tmp.Roster, sender)
+	case *SurveyResultsQuery:
+		surveyID = tmp.SurveyID
+	case *QueryBroadcastFinished:
+		surveyID = tmp.SurveyID
+	case *DDTfinished:
+		surveyID = tmp.SurveyID
+	case *ProofsEnd:
+		surveyID = tmp.SurveyID
+	case *ProofsMessage:
+		if tmp.Server != sender.String() {
+			return errors.New(sender.String() + " sent the proofs of " + tmp.Server)
+		}
+		surveyID = tmp.SurveyID
+	case *ProofsSent:
+		if tmp.Server != sender.String() {
+			return errors.New(sender.String() + " sent the number of proofs messages of " + tmp.Server)
+		}
+		surveyID = tmp.SurveyID
+	case *ProofsVerificationResult:
+		if tmp.Verifier != sender.String() {
+			return errors.New(sender.String() + " sent the proofs verification result of " + tmp.Verifier)
+		}
+		surveyID = tmp.SurveyID
+	default:
+		return nil
+	}
+
+	survey, err := s.getSurvey(surveyID)
+	if err != nil {
+		return err
+	}
+	if err := checkInRoster(&survey.Query.Roster, sender); err != nil {
+		return err
+	}
+	switch msg.Msg.(type) {
+	case *ProofsEnd:
+		if !survey.Query.Source.ID.Equal(sender.ID) {
+			return errors.New(sender.String() + " is not the root of survey " + string(surveyID))
+		}
+	case *ProofsMessage, *ProofsSent:
+		if !survey.isProofVerifier(s.ServerIdentity()) {
+			return errors.New(s.ServerIdentity().String() + " is not a proof verifier of survey " + string(surveyID))
+		}
+	case *ProofsVerificationResult:
+		if !survey.isProofVerifier(sender) {
+			return errors.New(sender.String() + " is not a proof verifier of survey " + string(surveyID))
+		}
+	}
+	return nil
+}
+
+// checkInRoster checks that a server is in a roster
+func checkInRoster(roster *onet.Roster, si *network.ServerIdentity) error {
+	if i, _ := roster.Search(si.ID); i < 0 {
+		return errors.New(si.String() + " is not in the roster")
 	}
+	return nil
 }
 
 // PushData is used to store incoming data by servers
 func (s *Service) PushData(resp *SurveyResponseQuery, proofs bool) error {
-	survey, err := s.getSurvey(resp.SurveyID)
+	responses, err := s.prepareData(resp)
 	if err != nil {
 		return err
 	}
+	return s.storeData(resp.SurveyID, responses, proofs)
+}
+
+// prepareData validates incoming data and converts it to the responses to store. The identifiers of a set are
+// deduplicated per (registered) DPID.
+func (s *Service) prepareData(resp *SurveyResponseQuery) ([]libunlynx.DpResponse, error) {
+	survey, err := s.getSurvey(resp.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var joinSource *JoinSource
+	if survey.Query.Join != nil {
+		if resp.JoinSource == survey.Query.Join.Left.Name {
+			joinSource = &survey.Query.Join.Left
+		} else if resp.JoinSource == survey.Query.Join.Right.Name {
+			joinSource = &survey.Query.Join.Right
+		} else {
+			return nil, errors.New("unknown join source " + resp.JoinSource)
+		}
+	}
+
+	schema, err := s.getSchema(&survey.Query.Roster)
+	if err != nil {
+		return nil, err
+	}
+	where, groupBy, sum := survey.Query.responseAttributes(joinSource)
+
+	// the identifiers of a set are deduplicated per data provider (see filterTaggedResponses)
+	var setMarker libunlynx.CipherText
+	if survey.Query.SetCardinality != nil {
+		if resp.DPID == "" {
+			return nil, errors.New("the sets of identifiers are only accepted from registered data providers")
+		}
+		setMarker = *libunlynx.EncryptInt(survey.Query.Roster.Aggregate, setProviderMarker(resp.DPID))
+	}
 
+	// the responses are only stored if they are all valid
+	responses := make([]libunlynx.DpResponse, 0, len(resp.Responses))
 	for _, v := range resp.Responses {
 		dr := libunlynx.DpResponse{}
 		if err := dr.FromDpResponseToSend(v); err != nil {
-			return err
+			return nil, err
+		}
+		if schema != nil {
+			if err := schema.ValidateDpResponse(&dr, where, groupBy, sum); err != nil {
+				return nil, errors.New("invalid response: " + err.Error())
+			}
+		}
+		if len(survey.Query.RangeBits) > 0 {
+			if err := libunlynxrange.VerifyRangeProofs(dr, v.RangeProofs, survey.Query.Roster.Aggregate, survey.Query.RangeBits); err != nil {
+				return nil, errors.New("invalid response: " + err.Error())
+			}
+		}
+		if survey.Query.EncryptionProofs {
+			if err := libunlynxencproof.VerifyEncryptionProofs(dr, v.EncryptionProofs, EncryptionProofContext(resp.SurveyID, resp.DPID)); err != nil {
+				return nil, errors.New("invalid response: " + err.Error())
+			}
+		}
+		if survey.Query.Histogram != nil {
+			if err := survey.Query.Histogram.BinDpResponse(&dr); err != nil {
+				return nil, err
+			}
+		}
+		if survey.Query.SetCardinality != nil {
+			// each response counts as one data provider holding the identifier
+			dr.AggregatingAttributesClear = map[string]int64{"count": 1}
+			dr.AggregatingAttributesEnc = nil
+			groupByEnc := make(map[string]libunlynx.CipherText, len(dr.GroupByEnc)+1)
+			for k, value := range dr.GroupByEnc {
+				groupByEnc[k] = value
+			}
+			groupByEnc[SetProviderAttribute] = setMarker
+			dr.GroupByEnc = groupByEnc
+		}
+		if joinSource != nil {
+			// each response counts for its source
+			clear := make(map[string]int64, len(dr.AggregatingAttributesClear)+1)
+			for k, value := range dr.AggregatingAttributesClear {
+				clear[k] = value
+			}
+			clear[joinSource.CountAttribute()] = 1
+			dr.AggregatingAttributesClear = clear
 		}
+		responses = append(responses, dr)
+	}
+
+	// the ciphertexts of a response can only be uploaded once
+	if err := survey.DataProviders.Deduplicate(resp.Responses); err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
+
+// storeData stores validated responses (see prepareData) in the survey
+func (s *Service) storeData(sid SurveyID, responses []libunlynx.DpResponse, proofs bool) error {
+	survey, err := s.getSurvey(sid)
+	if err != nil {
+		return err
+	}
+	for _, dr := range responses {
 		survey.InsertDpResponse(dr, proofs, survey.Query.GroupBy, survey.Query.Sum, survey.Query.Where)
 	}
-	err = s.putSurvey(resp.SurveyID, survey)
+	err = s.putSurvey(sid, survey)
 	if err != nil {
 		return err
 	}
 
-	log.Lvl1(s.ServerIdentity(), " uploaded response data for survey ", resp.SurveyID)
+	log.Lvl1(s.ServerIdentity(), " uploaded response data for survey ", sid)
 	return nil
 }
 
@@ -242,6 +844,105 @@ func (s *Service) HandleSurveyCreationQuery(recq *SurveyCreationQuery) (network.
 		recq.SurveyID = newID
 		log.Lvl1(s.ServerIdentity().String(), " handles this new survey ", recq.SurveyID)
 
+		schema, err := s.getSchema(&recq.Roster)
+		if err != nil {
+			return nil, err
+		}
+		if schema != nil {
+			if err := schema.ValidateQuery(recq.queryAttributes()); err != nil {
+				return nil, errors.New("invalid query: " + err.Error())
+			}
+		}
+
+		// the bins of a histogram are aggregated as any other aggregating attribute
+		if recq.Histogram != nil {
+			if err := recq.Histogram.Validate(); err != nil {
+				return nil, err
+			}
+			recq.Sum = AddHistogramBins(recq.Sum, recq.Histogram)
+		}
+		// a join is grouped by its key and the aggregating attributes are the ones of the two sources
+		if recq.Join != nil {
+			if err := recq.Join.Validate(); err != nil {
+				return nil, err
+			}
+			if len(recq.Sum) > 0 || recq.Count || len(recq.GroupBy) > 0 || recq.Histogram != nil || recq.SetCardinality != nil || recq.MinCount > 0 || recq.TopK > 0 {
+				return nil, errors.New("a join can not be combined with other aggregating or grouping attributes, a set cardinality, a minimum count or a top-k")
+			}
+			recq.GroupBy = []string{recq.Join.Key}
+			recq.Sum = recq.Join.Attributes()
+		}
+		// a set is grouped by its identifiers, the count of each group is the number of sets holding the identifier. Each
+		// data provider has to be registered so that its set is counted once (see setProviderMarker).
+		if recq.SetCardinality != nil {
+			if recq.SetCardinality.Identifier == "" {
+				return nil, errors.New("set cardinality query has no identifier attribute")
+			}
+			if !recq.DPRegistration {
+				return nil, errors.New("a set cardinality query requires the registration of the data providers")
+			}
+			recq.GroupBy = []string{recq.SetCardinality.Identifier, SetProviderAttribute}
+			recq.Sum = []string{"count"}
+			recq.Count = true
+		}
+		for attr, bits := range recq.RangeBits {
+			if bits <= 0 || bits > libunlynxrange.MaxBits {
+				return nil, errors.New("range of attribute " + attr + " has an unsupported number of bits")
+			}
+		}
+		if (recq.MinCount > 0 || recq.TopK > 0) && (!recq.Count || attributePosition(recq.Sum, "count") < 0) {
+			return nil, errors.New("a minimum count or a top-k requires the count attribute to be aggregated")
+		}
+		if recq.TopKBound < 0 || recq.TopKBound > MaxTopKBound {
+			return nil, errors.New("the top-k bound must be between 0 and " + strconv.Itoa(MaxTopKBound))
+		}
+		if recq.ShuffleShards < 0 || recq.ShuffleShards > protocolsunlynx.MaxShardedShufflingShards {
+			return nil, errors.New("the number of shuffle shards must be between 0 and " + strconv.Itoa(protocolsunlynx.MaxShardedShufflingShards))
+		}
+		if recq.BatchSize < 0 {
+			return nil, errors.New("the batch size can not be negative")
+		}
+		if _, err := libunlynxshuffle.ShuffleProofCreationFunction(recq.ShuffleProof); err != nil {
+			return nil, err
+		}
+		if recq.BranchingFactor < 0 {
+			return nil, errors.New("the branching factor can not be negative")
+		}
+		if recq.AggregationTimeout < 0 {
+			return nil, errors.New("the aggregation timeout can not be negative")
+		}
+		if recq.ProofsTimeout < 0 {
+			return nil, errors.New("the proofs timeout can not be negative")
+		}
+		if recq.DPRegistration {
+			if err := recq.validateAuthorizedDPs(); err != nil {
+				return nil, err
+			}
+		}
+		// the proofs of anonymous data providers would share the same context (they could replay each other's proofs)
+		if recq.EncryptionProofs && !recq.DPRegistration {
+			return nil, errors.New("the proofs of correct encryption require the registration of the data providers")
+		}
+		if recq.ShuffleAndTag {
+			if recq.ShuffleShards > 0 || recq.BatchSize > 0 {
+				return nil, errors.New("the responses can not be sharded or streamed when they are shuffled and tagged together")
+			}
+			// a Neff proof binds a single key while the tagged ciphertexts are partially decrypted during the shuffle
+			if recq.Proofs && recq.ShuffleProof != libunlynxshuffle.BayerGrothShuffleProof {
+				return nil, errors.New("the proofs of the responses shuffled and tagged together require the " + libunlynxshuffle.BayerGrothShuffleProof +
+					" shuffle proofs (the " + libunlynxshuffle.NeffShuffleProof + " proofs are not supported)")
+			}
+		}
+		// the proofs are verified by the root unless other verifiers are given
+		if recq.Proofs && len(recq.ProofVerifiers) == 0 {
+			recq.ProofVerifiers = []*network.ServerIdentity{s.ServerIdentity()}
+		}
+		for _, verifier := range recq.ProofVerifiers {
+			if i, _ := recq.Roster.Search(verifier.ID); i < 0 {
+				return nil, errors.New("proof verifier " + verifier.String() + " is not in the roster")
+			}
+		}
+		recq.Source = s.ServerIdentity()
 	}
 
 	// chooses an ephemeral secret for this survey
@@ -249,30 +950,34 @@ func (s *Service) HandleSurveyCreationQuery(recq *SurveyCreationQuery) (network.
 
 	// prepares the precomputation for shuffling
 	lineSize := int(len(recq.Sum)) + int(len(recq.Where)) + int(len(recq.GroupBy)) + 1 // + 1 is for the possible count attribute
-	precomputeShuffle, err := libunlynxshuffle.PrecomputationWritingForShuffling(recq.AppFlag, gobFile, s.ServerIdentity().String(), surveySecret, recq.Roster.Aggregate, lineSize)
+	err := s.Precomputation.Prepare(recq.Roster.Aggregate, lineSize*2)
 	if err != nil {
 		return nil, err
 	}
 
 	// survey instantiation
 	_, err = s.Survey.Put((string)(recq.SurveyID), Survey{
-		Store:             libunlynxstore.NewStore(),
-		Query:             *recq,
-		SurveySecretKey:   surveySecret,
-		ShufflePrecompute: precomputeShuffle,
-
-		SurveyChannel: make(chan int, 100),
-		DpChannel:     make(chan int, 100),
-		DDTChannel:    make(chan int, 100),
+		Store:            libunlynxstore.NewStore(),
+		Query:            *recq,
+		SurveySecretKey:  surveySecret,
+		ShuffleLineSize:  lineSize * 2,
+		DataProviders:    NewDataProviders(recq.authorizedDPs(s.ServerIdentity()), recq.MapDPs[s.ServerIdentity().String()]),
+		ProofsCollection: NewProofsCollection(len(recq.ProofVerifiers) * len(recq.Roster.List)),
+
+		SurveyChannel:  make(chan int, 100),
+		DpChannel:      make(chan int, 100),
+		DDTChannel:     make(chan int, 100),
+		TaggingChannel: make(chan int, 1),
 	})
 	if err != nil {
 		return nil, err
 	}
 	log.Lvl1(s.ServerIdentity(), " initiated the survey ", recq.SurveyID)
+	s.auditMessage(recq.SurveyID, libunlynxaudit.KindQuery, recq)
+	s.audit(recq.SurveyID, libunlynxaudit.KindRoster, RosterDescription(&recq.Roster))
 
 	if recq.IntraMessage == false {
 		recq.IntraMessage = true
-		recq.Source = s.ServerIdentity()
 		// broadcasts the query
 		err := libunlynxtools.SendISMOthers(s.ServiceProcessor, &recq.Roster, recq)
 		if err != nil {
@@ -287,7 +992,7 @@ func (s *Service) HandleSurveyCreationQuery(recq *SurveyCreationQuery) (network.
 		}
 	}
 
-	// if it is a app download the data from the test file
+	// if it is a app the server answers the survey with its local data source
 	if recq.AppFlag {
 		index := 0
 		for index = 0; index < len(recq.Roster.List); index++ {
@@ -295,12 +1000,12 @@ func (s *Service) HandleSurveyCreationQuery(recq *SurveyCreationQuery) (network.
 				break
 			}
 		}
-		testData, err := dataunlynx.ReadDataFromFile("unlynx_test_data.txt")
+		localData, err := s.DataSource.Read(index)
 		if err != nil {
-			return nil, err
+			return nil, errors.New("could not read the data source: " + err.Error())
 		}
 
-		resp, err := EncryptDataToSurvey(s.ServerIdentity().String(), recq.SurveyID, testData[strconv.Itoa(index)], recq.Roster.Aggregate, 1, recq.Count)
+		resp, err := EncryptDataToSurvey(s.ServerIdentity().String(), recq.SurveyID, localData, recq.Roster.Aggregate, 1, recq.Count)
 		if err != nil {
 			return nil, err
 		}
@@ -337,68 +1042,217 @@ func (s *Service) HandleSurveyResponseQuery(resp *SurveyResponseQuery) (network.
 	if err != nil {
 		return nil, err
 	}
+	uploadID := uuid.NewV4().String()
+	digest := ResponsesDigest(resp.SurveyID, resp.DPID, "", resp.Responses)
+	if err = s.beginUpload(survey, resp.DPID, uploadID, digest, resp.Signature); err != nil {
+		return nil, err
+	}
 	if err = s.PushData(resp, survey.Query.Proofs); err != nil {
+		survey.DataProviders.Abort(resp.DPID, uploadID)
 		return nil, err
 	}
+	survey.DataProviders.Add(resp.DPID, int64(len(resp.Responses)))
+	survey.DataProviders.Commit(resp.DPID)
 
 	//number of data providers who have already pushed the data
 	survey.DpChannel <- 1
 	return &ServiceState{"1"}, nil
 }
 
-// HandleSurveyResultsQuery handles the survey result query by the surveyor.
-func (s *Service) HandleSurveyResultsQuery(resq *SurveyResultsQuery) (network.Message, error) {
-	log.Lvl1(s.ServerIdentity(), " received a survey result query")
-
-	survey, err := s.getSurvey(resq.SurveyID)
+// HandleSurveyResponseChunk handles a chunk of a chunked upload. The responses are validated and staged as soon as they
+// arrive but only stored in the survey once the upload is committed. An upload with an invalid chunk is closed.
+func (s *Service) HandleSurveyResponseChunk(chunk *SurveyResponseChunk) (network.Message, error) {
+	survey, err := s.getSurvey(chunk.SurveyID)
 	if err != nil {
 		return nil, err
 	}
 
-	survey.Query.ClientPubKey = resq.ClientPublic
-	err = s.putSurvey(resq.SurveyID, survey)
+	upload, err := s.getUpload(chunk.SurveyID, chunk.UploadID, chunk.DPID, chunk.Sequence == 0)
 	if err != nil {
 		return nil, err
 	}
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+	if upload.Received < 0 {
+		return nil, errors.New("upload " + chunk.UploadID + " is closed")
+	}
+	if chunk.Sequence != upload.Received {
+		return nil, errors.New("expected chunk " + strconv.FormatInt(upload.Received, 10) + " of upload " + chunk.UploadID + " but got chunk " +
+			strconv.FormatInt(chunk.Sequence, 10))
+	}
 
-	if resq.IntraMessage == false {
-		resq.IntraMessage = true
-
-		err := libunlynxtools.SendISMOthers(s.ServiceProcessor, &survey.Query.Roster, resq)
-		if err != nil {
-			return nil, err
-		}
-		err = s.StartService(resq.SurveyID, true)
-		if err != nil {
-			return nil, err
-		}
-
-		log.Lvl1(s.ServerIdentity(), " completed the query processing...")
-
-		survey, err := s.getSurvey(resq.SurveyID)
-		if err != nil {
-			return nil, err
+	digest := ResponsesDigest(chunk.SurveyID, chunk.DPID, ChunkContext(chunk.UploadID, chunk.Sequence), chunk.Responses)
+	if err = s.beginUpload(survey, chunk.DPID, chunk.UploadID, digest, chunk.Signature); err != nil {
+		// the chunks of an opened upload can not be rejected by someone else than its data provider
+		if upload.Received == 0 {
+			s.closeUpload(upload)
 		}
-		results := survey.PullDeliverableResults(false, libunlynx.CipherText{})
-		err = s.putSurvey(resq.SurveyID, survey)
-		if err != nil {
-			return nil, err
-		}
-
-		return &ServiceResult{Results: results}, nil
+		return nil, err
 	}
+	atomic.StoreInt64(&upload.lastChunk, time.Now().UnixNano())
 
-	return nil, s.StartService(resq.SurveyID, false)
-}
-
-// HandleDDTfinished handles the message DDTfinished: one of the nodes is ready to perform a collective aggregation
-func (s *Service) HandleDDTfinished(recq *DDTfinished) (network.Message, error) {
-	survey, err := s.getSurvey(recq.SurveyID)
+	resp := &SurveyResponseQuery{SurveyID: chunk.SurveyID, Responses: chunk.Responses, JoinSource: chunk.JoinSource, DPID: chunk.DPID}
+	responses, err := s.prepareData(resp)
 	if err != nil {
+		s.closeUpload(upload)
 		return nil, err
 	}
-	survey.DDTChannel <- 1
-	return nil, nil
+	for _, dr := range responses {
+		upload.Staged.InsertDpResponse(dr, survey.Query.Proofs, survey.Query.GroupBy, survey.Query.Sum, survey.Query.Where)
+	}
+	upload.NbrResponses += int64(len(responses))
+	upload.Received++
+	return &ServiceState{chunk.SurveyID}, nil
+}
+
+// HandleSurveyResponseCommit handles the end of a chunked upload by checking that all chunks were received
+func (s *Service) HandleSurveyResponseCommit(commit *SurveyResponseCommit) (network.Message, error) {
+	survey, err := s.getSurvey(commit.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+
+	upload, err := s.getUpload(commit.SurveyID, commit.UploadID, commit.DPID, false)
+	if err != nil {
+		return nil, err
+	}
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+	received := upload.Received
+	if received < 0 {
+		return nil, errors.New("upload " + commit.UploadID + " is closed")
+	}
+	digest := ResponsesDigest(commit.SurveyID, commit.DPID, CommitContext(commit.UploadID, commit.NbrChunks), nil)
+	if err = s.beginUpload(survey, commit.DPID, commit.UploadID, digest, commit.Signature); err != nil {
+		return nil, err
+	}
+	if received != commit.NbrChunks {
+		return nil, errors.New("upload " + commit.UploadID + " has " + strconv.FormatInt(received, 10) + " chunks instead of " +
+			strconv.FormatInt(commit.NbrChunks, 10))
+	}
+
+	// the staged responses are only stored in the survey now
+	survey.MergeDpResponses(upload.Staged)
+	survey.DataProviders.Add(commit.DPID, upload.NbrResponses)
+	survey.DataProviders.Commit(commit.DPID)
+	s.closeUpload(upload)
+	log.Lvl1(s.ServerIdentity(), " committed upload ", commit.UploadID, " (", received, " chunks) for survey ", commit.SurveyID)
+
+	//number of data providers who have already pushed the data
+	survey.DpChannel <- 1
+	return &ServiceState{commit.SurveyID}, nil
+}
+
+// HandleDPRegistrationQuery handles the registration of a data provider to a survey
+func (s *Service) HandleDPRegistrationQuery(reg *DPRegistrationQuery) (network.Message, error) {
+	survey, err := s.getSurvey(reg.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := survey.DataProviders.Register(reg.DPID, reg.PublicKey); err != nil {
+		return nil, err
+	}
+	log.Lvl1(s.ServerIdentity(), " registered data provider ", reg.DPID, " for survey ", reg.SurveyID)
+	return &ServiceState{reg.SurveyID}, nil
+}
+
+// HandleSurveyStatusQuery handles the request of the status of a survey (the data providers of this server)
+func (s *Service) HandleSurveyStatusQuery(sq *SurveyStatusQuery) (network.Message, error) {
+	survey, err := s.getSurvey(sq.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+	return &SurveyStatus{
+		SurveyID:      sq.SurveyID,
+		ExpectedDPs:   survey.Query.MapDPs[s.ServerIdentity().String()],
+		DataProviders: survey.DataProviders.Status(),
+	}, nil
+}
+
+// beginUpload checks the identity (signature) of the data provider sending (a part of) an upload and that it does not
+// upload its responses twice. Anonymous uploads are only accepted if the survey does not require registration.
+func (s *Service) beginUpload(survey Survey, dpID, uploadID string, digest, signature []byte) error {
+	if dpID == "" {
+		if survey.Query.DPRegistration {
+			return errors.New("survey " + string(survey.Query.SurveyID) + " only accepts responses of registered data providers")
+		}
+		return nil
+	}
+	if err := survey.DataProviders.Verify(dpID, digest, signature); err != nil {
+		return err
+	}
+	return survey.DataProviders.Begin(dpID, uploadID)
+}
+
+// HandleSurveyResultsQuery handles the survey result query by the surveyor.
+func (s *Service) HandleSurveyResultsQuery(resq *SurveyResultsQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), " received a survey result query")
+
+	survey, err := s.getSurvey(resq.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+	// the uploads which are not committed yet are not part of the results
+	s.closeSurveyUploads(resq.SurveyID)
+
+	survey.Query.ClientPubKey = resq.ClientPublic
+	err = s.putSurvey(resq.SurveyID, survey)
+	if err != nil {
+		return nil, err
+	}
+
+	if resq.IntraMessage == false {
+		resq.IntraMessage = true
+
+		err := libunlynxtools.SendISMOthers(s.ServiceProcessor, &survey.Query.Roster, resq)
+		if err != nil {
+			return nil, err
+		}
+		err = s.StartService(resq.SurveyID, true)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Lvl1(s.ServerIdentity(), " completed the query processing...")
+
+		survey, err := s.getSurvey(resq.SurveyID)
+		if err != nil {
+			return nil, err
+		}
+		results := survey.PullDeliverableResults(false, libunlynx.CipherText{})
+		err = s.putSurvey(resq.SurveyID, survey)
+		if err != nil {
+			return nil, err
+		}
+		digest, err := ResultsDigest(results, survey.ThresholdDecisions)
+		if err != nil {
+			return nil, err
+		}
+		s.audit(resq.SurveyID, libunlynxaudit.KindResult, digest)
+
+		// the verification of the proofs is attached to the results (missing verification results are logged)
+		var proofsVerification []ProofsVerificationResult
+		if survey.Query.Proofs {
+			proofsVerification, err = s.ProofsPhase(resq.SurveyID, digest)
+			if err != nil {
+				log.Error(err)
+			}
+		}
+
+		return &ServiceResult{Results: results, ProofsVerification: proofsVerification, Coverage: survey.Coverage, ThresholdDecisions: survey.ThresholdDecisions}, nil
+	}
+
+	return nil, s.StartService(resq.SurveyID, false)
+}
+
+// HandleDDTfinished handles the message DDTfinished: one of the nodes is ready to perform a collective aggregation
+func (s *Service) HandleDDTfinished(recq *DDTfinished) (network.Message, error) {
+	survey, err := s.getSurvey(recq.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+	survey.DDTChannel <- 1
+	return nil, nil
 }
 
 // HandleQueryBroadcastFinished handles the message QueryBroadcastFinished: one of the nodes has already received the query
@@ -411,6 +1265,39 @@ func (s *Service) HandleQueryBroadcastFinished(recq *QueryBroadcastFinished) (ne
 	return nil, nil
 }
 
+// HandleSchemaRegistrationQuery handles the registration of the dataset schema of a roster. The schema is broadcasted to
+// the other servers of the roster and replaces the previously registered schema (if it was registered by the same
+// admin or if a server of the roster registers it).
+func (s *Service) HandleSchemaRegistrationQuery(recq *SchemaRegistrationQuery) (network.Message, error) {
+	if err := recq.Schema.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.schemaMutex.Lock()
+	previous, err := s.getRegisteredSchema(&recq.Roster)
+	if err == nil {
+		err = s.checkSchemaRegistration(recq, previous)
+	}
+	if err == nil {
+		err = s.putRegisteredSchema(&recq.Roster, registeredSchema{Schema: recq.Schema, Registrant: recq.Registrant, Time: recq.Time})
+	}
+	s.schemaMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	log.Lvl1(s.ServerIdentity(), " registered a schema with ", len(recq.Schema.Attributes), " attributes for roster ", recq.Roster.ID)
+
+	if recq.IntraMessage == false {
+		recq.IntraMessage = true
+		err := libunlynxtools.SendISMOthers(s.ServiceProcessor, &recq.Roster, recq)
+		recq.IntraMessage = false
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ServiceState{}, nil
+}
+
 // Protocol Handlers
 //______________________________________________________________________________________________________________________
 
@@ -438,15 +1325,33 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 		shuffle := pi.(*protocolsunlynx.ShufflingProtocol)
 
 		shuffle.Proofs = survey.Query.Proofs
-		shuffle.ProofFunc = func(shuffleTarget, shuffledData []libunlynx.CipherVector, collectiveKey kyber.Point, beta [][]kyber.Scalar, pi []int) *libunlynxshuffle.PublishedShufflingProof {
-			proof, err := libunlynxshuffle.ShuffleProofCreation(shuffleTarget, shuffledData, libunlynx.SuiTe.Point().Base(), collectiveKey, beta, pi)
+		shuffle.ProofFunc = s.shufflingProofFunc(target, survey.Query.ShuffleProof)
+		shuffle.PrecomputeFunc = s.shufflingPrecomputeFunc(survey.ShuffleLineSize)
+		if tn.IsRoot() {
+			shuffle.BatchSize = int(survey.Query.BatchSize)
+			dpResponses := survey.PullDpResponses()
+			var toShuffleCV []libunlynx.CipherVector
+			toShuffleCV, survey.Lengths = protocolsunlynx.ProcessResponseToMatrixCipherText(dpResponses)
+			shuffle.ShuffleTarget = &toShuffleCV
+
+			err = s.putSurvey(target, survey)
 			if err != nil {
-				log.Fatal(err)
+				return nil, err
 			}
-			return &proof
 		}
-		shuffle.Precomputed = survey.ShufflePrecompute
+
+	case protocolsunlynx.ShardedShufflingProtocolName:
+		pi, err = protocolsunlynx.NewShardedShufflingProtocol(tn)
+		if err != nil {
+			return nil, err
+		}
+		shuffle := pi.(*protocolsunlynx.ShardedShufflingProtocol)
+
+		shuffle.Proofs = survey.Query.Proofs
+		shuffle.ProofFunc = s.shufflingProofFunc(target, survey.Query.ShuffleProof)
+		shuffle.PrecomputeFunc = s.shufflingPrecomputeFunc(survey.ShuffleLineSize)
 		if tn.IsRoot() {
+			shuffle.NbrShards = int(survey.Query.ShuffleShards)
 			dpResponses := survey.PullDpResponses()
 			var toShuffleCV []libunlynx.CipherVector
 			toShuffleCV, survey.Lengths = protocolsunlynx.ProcessResponseToMatrixCipherText(dpResponses)
@@ -468,15 +1373,12 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 		aux := survey.SurveySecretKey
 		hashCreation.SurveySecretKey = &aux
 		hashCreation.Proofs = survey.Query.Proofs
+		hashCreation.ProofFunc = s.deterministicTaggingProofFunc(target, "")
 		if tn.IsRoot() {
+			hashCreation.BatchSize = int(survey.Query.BatchSize)
 			shuffledClientResponses := survey.PullShuffledProcessResponses()
 
-			var queryWhereToTag []libunlynx.ProcessResponse
-			for _, v := range survey.Query.Where {
-				tmp := libunlynx.CipherVector{v.Value}
-				queryWhereToTag = append(queryWhereToTag, libunlynx.ProcessResponse{WhereEnc: tmp, GroupByEnc: nil, AggregatingAttributes: nil})
-			}
-			shuffledClientResponses = append(queryWhereToTag, shuffledClientResponses...)
+			shuffledClientResponses = append(queryWhereProcessResponses(survey.Query), shuffledClientResponses...)
 			tmpDeterministicTOS := protocolsunlynx.ProcessResponseToCipherVector(shuffledClientResponses)
 			survey.TargetOfSwitch = shuffledClientResponses
 			err = s.putSurvey(target, survey)
@@ -487,30 +1389,97 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 			hashCreation.TargetOfSwitch = &tmpDeterministicTOS
 		}
 
-	case protocolsunlynx.CollectiveAggregationProtocolName:
-		pi, err = protocolsunlynx.NewCollectiveAggregationProtocol(tn)
+	case protocolsunlynx.ShufflingPlusDDTProtocolName:
+		pi, err = protocolsunlynx.NewShufflingPlusDDTProtocol(tn)
 		if err != nil {
 			return nil, err
 		}
+		shuffleAndTag := pi.(*protocolsunlynx.ShufflingPlusDDTProtocol)
 
-		// waits for all other nodes to finish the tagging phase
-		groupedData := survey.PullLocallyAggregatedResponses()
-		err = s.putSurvey(target, survey)
+		aux := survey.SurveySecretKey
+		shuffleAndTag.SurveySecretKey = &aux
+		shuffleAndTag.Proofs = survey.Query.Proofs
+		shuffleAndTag.ProofFunc = s.shufflingKeysProofFunc(target, tn.Root().ServerIdentity.String())
+		shuffleAndTag.DDTProofFunc = s.deterministicTaggingProofFunc(target, tn.Root().ServerIdentity.String())
+		if tn.IsRoot() {
+			dpResponses := survey.PullDpResponses()
+			var toShuffleCV []libunlynx.CipherVector
+			toShuffleCV, shuffleAndTag.NbrTagged, survey.Lengths = protocolsunlynx.ProcessResponseToTaggedMatrixCipherText(dpResponses)
+			if shuffleAndTag.NbrTagged == 0 {
+				return nil, errors.New("the responses have no attribute to tag")
+			}
+			shuffleAndTag.TargetData = &toShuffleCV
+			// the values of the query are tagged as in the tagging phase
+			queryWhereCV := protocolsunlynx.ProcessResponseToCipherVector(queryWhereProcessResponses(survey.Query))
+			shuffleAndTag.TargetTagOnly = &queryWhereCV
+
+			err = s.putSurvey(target, survey)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+	case protocolsunlynx.CollectiveAggregationProtocolName:
+		pi, err = protocolsunlynx.NewCollectiveAggregationProtocol(tn)
 		if err != nil {
 			return nil, err
 		}
 
 		collectiveAggr := pi.(*protocolsunlynx.CollectiveAggregationProtocol)
-		collectiveAggr.GroupedData = &groupedData
+		timeout := survey.Query.AggregationTimeout
+		if timeout > 0 && !tn.IsRoot() {
+			// the data is given once the local tagging is finished, the servers which are late are left out by their
+			// parent
+			collectiveAggr.GroupedDataFunc = func() map[libunlynx.GroupingKey]libunlynx.FilteredResponse {
+				<-survey.TaggingChannel
+				survey, err := s.getSurvey(target)
+				if err != nil {
+					log.Error(err)
+					return nil
+				}
+				groupedData := survey.PullLocallyAggregatedResponses()
+				if err := s.putSurvey(target, survey); err != nil {
+					log.Error(err)
+				}
+				return groupedData
+			}
+		} else {
+			groupedData := survey.PullLocallyAggregatedResponses()
+			err = s.putSurvey(target, survey)
+			if err != nil {
+				return nil, err
+			}
+			collectiveAggr.GroupedData = &groupedData
+		}
+		collectiveAggr.Timeout = timeout
 		collectiveAggr.Proofs = survey.Query.Proofs
 		collectiveAggr.ProofFunc = func(data []libunlynx.CipherVector, res libunlynx.CipherVector) *libunlynxaggr.PublishedAggregationListProof {
 			proof := libunlynxaggr.AggregationListProofCreation(data, res)
+			palpb, err := proof.ToBytes()
+			if err != nil {
+				log.Fatal(err)
+			}
+			s.sendProofs(target, &ProofsMessage{CollectiveAggregation: &palpb})
 			return &proof
 		}
 
-		counter := len(tn.Roster().List) - 1
-		for counter > 0 {
-			counter = counter - (<-survey.DDTChannel)
+		// waits for all other nodes to finish the tagging phase (at most the aggregation timeout)
+		if timeout == 0 {
+			counter := len(tn.Roster().List) - 1
+			for counter > 0 {
+				counter = counter - (<-survey.DDTChannel)
+			}
+		} else if tn.IsRoot() {
+			deadline := time.After(timeout)
+			for counter := len(tn.Roster().List) - 1; counter > 0; {
+				select {
+				case n := <-survey.DDTChannel:
+					counter = counter - n
+				case <-deadline:
+					log.Warn(s.ServerIdentity(), " starts the aggregation without ", counter, " server(s)")
+					counter = 0
+				}
+			}
 		}
 
 	case protocolsunlynx.DROProtocolName:
@@ -521,18 +1490,17 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 
 		shuffle := pi.(*protocolsunlynx.ShufflingProtocol)
 		shuffle.Proofs = survey.Query.Proofs
-		shuffle.ProofFunc = func(shuffleTarget, shuffledData []libunlynx.CipherVector, collectiveKey kyber.Point, beta [][]kyber.Scalar, pi []int) *libunlynxshuffle.PublishedShufflingProof {
-			proof, err := libunlynxshuffle.ShuffleProofCreation(shuffleTarget, shuffledData, libunlynx.SuiTe.Point().Base(), collectiveKey, beta, pi)
-			if err != nil {
-				log.Fatal(err)
-			}
-			return &proof
-		}
+		shuffle.ProofFunc = s.shufflingProofFunc(target, survey.Query.ShuffleProof)
 		shuffle.Precomputed = nil
 
 		if tn.IsRoot() {
 			clientResponses := make([]libunlynx.ProcessResponse, 0)
-			noiseArray := libunlynxdiffprivacy.GenerateNoiseValues(1000, 0, 1, 0.1, 0)
+			// each bin of a histogram needs its own noise value
+			nbrNoiseValues := droNbrNoiseValues
+			if survey.Query.Histogram != nil && survey.Query.Histogram.NbrBins() > nbrNoiseValues {
+				nbrNoiseValues = survey.Query.Histogram.NbrBins()
+			}
+			noiseArray := libunlynxdiffprivacy.GenerateNoiseValues(int64(nbrNoiseValues), 0, 1, 0.1, 0)
 			for _, v := range noiseArray {
 				clientResponses = append(clientResponses, libunlynx.ProcessResponse{GroupByEnc: nil, AggregatingAttributes: libunlynx.IntArrayToCipherVector([]int64{int64(v)})})
 			}
@@ -542,6 +1510,22 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 		}
 		return pi, nil
 
+	case protocolsunlynx.MembershipProtocolName:
+		pi, err = protocolsunlynx.NewShufflingPlusDDTProtocol(tn)
+		if err != nil {
+			return nil, err
+		}
+		membership := pi.(*protocolsunlynx.ShufflingPlusDDTProtocol)
+
+		// a fresh secret is used so that these tags cannot be linked to the ones of the survey
+		secret := libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
+		membership.SurveySecretKey = &secret
+		membership.Proofs = survey.Query.Proofs
+		if tn.IsRoot() {
+			target := survey.MembershipTarget
+			membership.TargetData = &target
+		}
+
 	case protocolsunlynx.KeySwitchingProtocolName:
 		pi, err = protocolsunlynx.NewKeySwitchingProtocol(tn)
 		if err != nil {
@@ -555,6 +1539,11 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 			if err != nil {
 				log.Fatal(err)
 			}
+			pkslpb, err := proof.ToBytes()
+			if err != nil {
+				log.Fatal(err)
+			}
+			s.sendProofs(target, &ProofsMessage{KeySwitching: &pkslpb})
 			return &proof
 		}
 
@@ -566,6 +1555,12 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 			} else {
 				coaggr = survey.PullCothorityAggregatedFilteredResponses(false, libunlynx.CipherText{})
 			}
+			if survey.Query.Histogram != nil && survey.Query.Histogram.DRONoise {
+				err = survey.Query.Histogram.AddBinNoise(coaggr, survey.Query.Sum, survey.BinNoise)
+				if err != nil {
+					return nil, err
+				}
+			}
 			var tmpKeySwitchingCV libunlynx.CipherVector
 			tmpKeySwitchingCV, survey.Lengths = protocolsunlynx.FilteredResponseToCipherVector(coaggr)
 			keySwitch.TargetOfSwitch = &tmpKeySwitchingCV
@@ -584,13 +1579,104 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 	return pi, nil
 }
 
+// shufflingPrecomputeFunc takes the precomputed values of a shuffle from the precomputation pool of the server
+func (s *Service) shufflingPrecomputeFunc(lineSize int) func(kyber.Point, int) []libunlynxshuffle.CipherVectorScalar {
+	return func(collectiveKey kyber.Point, nbrResponses int) []libunlynxshuffle.CipherVectorScalar {
+		precomputed, err := s.Precomputation.Take(collectiveKey, lineSize, nbrResponses)
+		if err != nil {
+			// the shuffle picks fresh blinding factors instead
+			log.Error(err)
+			return nil
+		}
+		return precomputed
+	}
+}
+
+// shufflingProofFunc creates the proofs of a shuffle (with the backend of the survey) and sends them to the proof
+// verifiers of the survey
+func (s *Service) shufflingProofFunc(target SurveyID, backend string) func([]libunlynx.CipherVector, []libunlynx.CipherVector, kyber.Point, [][]kyber.Scalar, []int) *libunlynxshuffle.PublishedShufflingProof {
+	return func(shuffleTarget, shuffledData []libunlynx.CipherVector, collectiveKey kyber.Point, beta [][]kyber.Scalar, pi []int) *libunlynxshuffle.PublishedShufflingProof {
+		createProof, err := libunlynxshuffle.ShuffleProofCreationFunction(backend)
+		if err != nil {
+			log.Fatal(err)
+		}
+		proof, err := createProof(shuffleTarget, shuffledData, libunlynx.SuiTe.Point().Base(), collectiveKey, beta, pi)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pslpb, err := (&libunlynxshuffle.PublishedShufflingListProof{List: []libunlynxshuffle.PublishedShufflingProof{proof}}).ToBytes()
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.sendProofs(target, &ProofsMessage{Shuffling: &pslpb})
+		return &proof
+	}
+}
+
+// shufflingKeysProofFunc creates the proofs of a shuffle whose ciphertexts are partially decrypted, i.e. encrypted under
+// different keys (see protocolsunlynx.ShufflingPlusDDTProtocol), and sends them to the proof verifiers of the survey.
+// They are verified with the collective key as the other shuffle proofs, and their keys with the position of the server
+// in the circuit (the root of the protocol, see verifyCircuits).
+func (s *Service) shufflingKeysProofFunc(target SurveyID, circuit string) func([]libunlynx.CipherVector, []libunlynx.CipherVector, []kyber.Point, [][]kyber.Scalar, []int) {
+	return func(shuffleTarget, shuffledData []libunlynx.CipherVector, keys []kyber.Point, beta [][]kyber.Scalar, pi []int) {
+		survey, err := s.getSurvey(target)
+		if err != nil {
+			log.Fatal(err)
+		}
+		proof, err := libunlynxshuffle.BayerGrothShuffleProofCreationKeys(shuffleTarget, shuffledData, libunlynx.SuiTe.Point().Base(), survey.Query.Roster.Aggregate, keys, beta, pi)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pslpb, err := (&libunlynxshuffle.PublishedShufflingListProof{List: []libunlynxshuffle.PublishedShufflingProof{proof}}).ToBytes()
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.sendProofs(target, &ProofsMessage{Shuffling: &pslpb, Circuit: circuit})
+	}
+}
+
+// deterministicTaggingProofFunc sends the proofs of a deterministic tagging to the proof verifiers of the survey (with
+// the root of the protocol if it is a protocolsunlynx.ShufflingPlusDDTProtocol, see shufflingKeysProofFunc)
+func (s *Service) deterministicTaggingProofFunc(target SurveyID, circuit string) func(*libunlynxdetertag.PublishedDDTAdditionListProof, *libunlynxdetertag.PublishedDDTCreationListProof) {
+	return func(additionProofs *libunlynxdetertag.PublishedDDTAdditionListProof, creationProofs *libunlynxdetertag.PublishedDDTCreationListProof) {
+		pdalpb, err := additionProofs.ToBytes()
+		if err != nil {
+			log.Fatal(err)
+		}
+		pdclpb, err := creationProofs.ToBytes()
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.sendProofs(target, &ProofsMessage{DetTagAddition: &pdalpb, DetTagCreation: &pdclpb, Circuit: circuit})
+	}
+}
+
+// queryWhereProcessResponses returns the values of the where attributes of a query, to be tagged with the responses
+func queryWhereProcessResponses(query SurveyCreationQuery) []libunlynx.ProcessResponse {
+	var queryWhereToTag []libunlynx.ProcessResponse
+	for _, v := range query.Where {
+		tmp := libunlynx.CipherVector{v.Value}
+		queryWhereToTag = append(queryWhereToTag, libunlynx.ProcessResponse{WhereEnc: tmp, GroupByEnc: nil, AggregatingAttributes: nil})
+	}
+	return queryWhereToTag
+}
+
+// protocolTree returns the tree of the protocols started by a server for the survey
+func (s *Survey) protocolTree(root *network.ServerIdentity) *onet.Tree {
+	branchingFactor := 2
+	if s.Query.BranchingFactor > 0 {
+		branchingFactor = int(s.Query.BranchingFactor)
+	}
+	return s.Query.Roster.GenerateNaryTreeWithRoot(branchingFactor, root)
+}
+
 // StartProtocol starts a specific protocol (Pipeline, Shuffling, etc.)
 func (s *Service) StartProtocol(name string, targetSurvey SurveyID) (onet.ProtocolInstance, error) {
 	tmp, err := s.getSurvey(targetSurvey)
 	if err != nil {
 		return nil, err
 	}
-	tree := tmp.Query.Roster.GenerateNaryTreeWithRoot(2, s.ServerIdentity())
+	tree := tmp.protocolTree(s.ServerIdentity())
 
 	var tn *onet.TreeNodeInstance
 	tn = s.NewTreeNodeInstance(tree, tree.Root, name)
@@ -647,23 +1733,36 @@ func (s *Service) StartService(targetSurvey SurveyID, root bool) error {
 		return err
 	}
 
-	// Shuffling Phase
-	start := libunlynx.StartTimer(s.ServerIdentity().String() + "_ShufflingPhase")
+	var start *monitor.TimeMeasure
+	if target.Query.ShuffleAndTag && len(target.Query.Where)+len(target.Query.GroupBy) > 0 {
+		// Shuffling and Tagging Phase
+		start = libunlynx.StartTimer(s.ServerIdentity().String() + "_ShufflingAndTaggingPhase")
 
-	err = s.ShufflingPhase(survey.Query.SurveyID)
-	if err != nil {
-		return errors.New("Error in the Shuffling Phase: " + err.Error())
-	}
+		err = s.ShufflingAndTaggingPhase(target.Query.SurveyID)
+		if err != nil {
+			return errors.New("Error in the Shuffling and Tagging Phase: " + err.Error())
+		}
+	} else {
+		// Shuffling Phase
+		start = libunlynx.StartTimer(s.ServerIdentity().String() + "_ShufflingPhase")
 
-	libunlynx.EndTimer(start)
-	// Tagging Phase
-	start = libunlynx.StartTimer(s.ServerIdentity().String() + "_TaggingPhase")
+		err = s.ShufflingPhase(survey.Query.SurveyID)
+		if err != nil {
+			return errors.New("Error in the Shuffling Phase: " + err.Error())
+		}
 
-	err = s.TaggingPhase(target.Query.SurveyID)
-	if err != nil {
-		return errors.New("Error in the Tagging Phase: " + err.Error())
+		libunlynx.EndTimer(start)
+		// Tagging Phase
+		start = libunlynx.StartTimer(s.ServerIdentity().String() + "_TaggingPhase")
+
+		err = s.TaggingPhase(target.Query.SurveyID)
+		if err != nil {
+			return errors.New("Error in the Tagging Phase: " + err.Error())
+		}
 	}
 
+	target.TaggingChannel <- 1
+
 	// broadcasts the query to unlock waiting channel
 	aux := target.Query.Roster
 	err = libunlynxtools.SendISMOthers(s.ServiceProcessor, &aux, &DDTfinished{SurveyID: targetSurvey})
@@ -685,8 +1784,56 @@ func (s *Service) StartService(targetSurvey SurveyID, root bool) error {
 		libunlynx.EndTimer(start)
 	}
 
+	// Join Phase
+	if root == true && target.Query.Join != nil {
+		start := libunlynx.StartTimer(s.ServerIdentity().String() + "_JoinPhase")
+
+		err := s.JoinPhase(target.Query.SurveyID)
+		if err != nil {
+			return errors.New("Error in the Join Phase: " + err.Error())
+		}
+
+		libunlynx.EndTimer(start)
+	}
+
+	// Set Cardinality Phase
+	if root == true && target.Query.SetCardinality != nil {
+		start := libunlynx.StartTimer(s.ServerIdentity().String() + "_SetCardinalityPhase")
+
+		err := s.SetCardinalityPhase(target.Query.SurveyID)
+		if err != nil {
+			return errors.New("Error in the Set Cardinality Phase: " + err.Error())
+		}
+
+		libunlynx.EndTimer(start)
+	}
+
+	// Threshold Phase
+	if root == true && target.Query.MinCount > 0 {
+		start := libunlynx.StartTimer(s.ServerIdentity().String() + "_ThresholdPhase")
+
+		err := s.ThresholdPhase(target.Query.SurveyID)
+		if err != nil {
+			return errors.New("Error in the Threshold Phase: " + err.Error())
+		}
+
+		libunlynx.EndTimer(start)
+	}
+
+	// Top-k Phase
+	if root == true && target.Query.TopK > 0 {
+		start := libunlynx.StartTimer(s.ServerIdentity().String() + "_TopKPhase")
+
+		err := s.TopKPhase(target.Query.SurveyID)
+		if err != nil {
+			return errors.New("Error in the Top-k Phase: " + err.Error())
+		}
+
+		libunlynx.EndTimer(start)
+	}
+
 	// DRO Phase
-	if root == true && libunlynx.DIFFPRI == true {
+	if root == true && (libunlynx.DIFFPRI == true || (target.Query.Histogram != nil && target.Query.Histogram.DRONoise)) {
 		start := libunlynx.StartTimer(s.ServerIdentity().String() + "_DROPhase")
 
 		err := s.DROPhase(target.Query.SurveyID)
@@ -724,11 +1871,32 @@ func (s *Service) ShufflingPhase(targetSurvey SurveyID) error {
 		return nil
 	}
 
-	pi, err := s.StartProtocol(protocolsunlynx.ShufflingProtocolName, targetSurvey)
-	if err != nil {
-		return err
+	var tmpShufflingResult []libunlynx.CipherVector
+	if survey.Query.ShuffleShards > 0 {
+		pi, err := s.StartProtocol(protocolsunlynx.ShardedShufflingProtocolName, targetSurvey)
+		if err != nil {
+			return err
+		}
+		shuffle := pi.(*protocolsunlynx.ShardedShufflingProtocol)
+		tmpShufflingResult = <-shuffle.FeedbackChannel
+		if survey.Query.Proofs {
+			if err := s.sendShardedShuffle(targetSurvey, *shuffle.ShuffleTarget, tmpShufflingResult); err != nil {
+				return err
+			}
+		}
+	} else {
+		pi, err := s.StartProtocol(protocolsunlynx.ShufflingProtocolName, targetSurvey)
+		if err != nil {
+			return err
+		}
+		shuffle := pi.(*protocolsunlynx.ShufflingProtocol)
+		tmpShufflingResult = <-shuffle.FeedbackChannel
+		if survey.Query.Proofs && survey.Query.BatchSize > 0 {
+			if err := s.sendShardedShuffle(targetSurvey, *shuffle.ShuffleTarget, tmpShufflingResult); err != nil {
+				return err
+			}
+		}
 	}
-	tmpShufflingResult := <-pi.(*protocolsunlynx.ShufflingProtocol).FeedbackChannel
 
 	survey, err = s.getSurvey(targetSurvey)
 	if err != nil {
@@ -760,11 +1928,51 @@ func (s *Service) TaggingPhase(targetSurvey SurveyID) error {
 
 	tmpDeterministicTaggingResult := <-pi.(*protocolsunlynx.DeterministicTaggingProtocol).FeedbackChannel
 
+	return s.filterTaggedResponses(targetSurvey, tmpDeterministicTaggingResult)
+}
+
+// ShufflingAndTaggingPhase shuffles and tags the ClientResponses in a single traversal of the circuit of servers, with
+// the same results as the ShufflingPhase followed by the TaggingPhase.
+func (s *Service) ShufflingAndTaggingPhase(targetSurvey SurveyID) error {
+	survey, err := s.getSurvey(targetSurvey)
+	if err != nil {
+		return err
+	}
+
+	if len(survey.DpResponses) == 0 && len(survey.DpResponsesAggr) == 0 {
+		log.Lvl1(s.ServerIdentity(), " no data to shuffle and tag")
+		return nil
+	}
+
+	pi, err := s.StartProtocol(protocolsunlynx.ShufflingPlusDDTProtocolName, targetSurvey)
+	if err != nil {
+		return err
+	}
+	shuffleAndTag := pi.(*protocolsunlynx.ShufflingPlusDDTProtocol)
+	tmpShufflingAndTaggingResult := <-shuffleAndTag.FeedbackChannel
+
 	survey, err = s.getSurvey(targetSurvey)
 	if err != nil {
 		return err
 	}
-	deterministicTaggingResult := protocolsunlynx.DeterCipherVectorToProcessResponseDet(tmpDeterministicTaggingResult, survey.TargetOfSwitch)
+	shufflingResult := protocolsunlynx.TaggedMatrixCipherTextToProcessResponse(shuffleAndTag.ShuffledData, shuffleAndTag.NbrTagged, survey.Lengths)
+	survey.TargetOfSwitch = append(queryWhereProcessResponses(survey.Query), shufflingResult...)
+	err = s.putSurvey(targetSurvey, survey)
+	if err != nil {
+		return err
+	}
+
+	return s.filterTaggedResponses(targetSurvey, protocolsunlynx.DeterministCipherMatrixToVector(tmpShufflingAndTaggingResult))
+}
+
+// filterTaggedResponses filters the tagged responses (survey.TargetOfSwitch, after the values of the query) with the
+// tagged values of the query and stores them
+func (s *Service) filterTaggedResponses(targetSurvey SurveyID, tags libunlynx.DeterministCipherVector) error {
+	survey, err := s.getSurvey(targetSurvey)
+	if err != nil {
+		return err
+	}
+	deterministicTaggingResult := protocolsunlynx.DeterCipherVectorToProcessResponseDet(tags, survey.TargetOfSwitch)
 
 	var queryWhereTag []libunlynx.WhereQueryAttributeTagged
 	for i, v := range deterministicTaggingResult[:len(survey.Query.Where)] {
@@ -779,10 +1987,23 @@ func (s *Service) TaggingPhase(targetSurvey SurveyID) error {
 	} else {
 		filteredResponses = FilterResponses(survey.Query.Predicate, queryWhereTag, deterministicTaggingResult)
 	}
+	if survey.Query.SetCardinality != nil {
+		filteredResponses = DeduplicateSetResponses(filteredResponses, tags[len(survey.Query.Where):], survey.TargetOfSwitch[len(survey.Query.Where):])
+	}
 
-	survey.PushDeterministicFilteredResponses(filteredResponses, s.ServerIdentity().String(), survey.Query.Proofs)
+	aggregationProofs := survey.PushDeterministicFilteredResponses(filteredResponses, s.ServerIdentity().String(), survey.Query.Proofs)
 	err = s.putSurvey(targetSurvey, survey)
-	return err
+	if err != nil {
+		return err
+	}
+	if survey.Query.Proofs {
+		palpb, err := aggregationProofs.ToBytes()
+		if err != nil {
+			return err
+		}
+		s.sendProofs(targetSurvey, &ProofsMessage{Aggregation: &palpb})
+	}
+	return nil
 }
 
 // AggregationPhase performs the per-group aggregation on the currently grouped data.
@@ -799,10 +2020,331 @@ func (s *Service) AggregationPhase(targetSurvey SurveyID) error {
 	}
 
 	survey.PushCothorityAggregatedFilteredResponses(cothorityAggregatedData.GroupedData)
+	survey.Coverage = AggregationCoverage{NbrServers: int64(len(survey.Query.Roster.List)), Missing: cothorityAggregatedData.Missing}
+	if !survey.Coverage.Complete() {
+		log.Warn(s.ServerIdentity(), " aggregated the data of survey ", targetSurvey, " without ", len(survey.Coverage.Missing), " server(s)")
+	}
 	err = s.putSurvey(targetSurvey, survey)
 	return err
 }
 
+// JoinPhase matches the keys (groups) present in both sources of a join: a key is matched if the counts of both sources
+// are not 0. The unmatched keys are dropped and the matched ones are aggregated in a single result. The join fails if
+// the counts of a matched key are not both 1 (the key is not unique in a source).
+func (s *Service) JoinPhase(targetSurvey SurveyID) error {
+	survey, err := s.getSurvey(targetSurvey)
+	if err != nil {
+		return err
+	}
+
+	join := survey.Query.Join
+	leftPos := attributePosition(survey.Query.Sum, join.Left.CountAttribute())
+	rightPos := attributePosition(survey.Query.Sum, join.Right.CountAttribute())
+
+	groups := make([]libunlynx.GroupingKey, 0)
+	counts := make(libunlynx.CipherVector, 0)
+	for k, v := range survey.GroupedDeterministicFilteredResponses {
+		groups = append(groups, k)
+		counts = append(counts, v.AggregatingAttributes[leftPos], v.AggregatingAttributes[rightPos])
+	}
+
+	matched := make([]libunlynx.GroupingKey, 0)
+	unmatched := make([]libunlynx.GroupingKey, 0)
+	if len(groups) > 0 {
+		zero, err := s.MembershipPhase(targetSurvey, counts, []int64{0})
+		if err != nil {
+			return err
+		}
+		matchedCounts := make(libunlynx.CipherVector, 0)
+		for i, v := range groups {
+			if !zero[2*i] && !zero[2*i+1] {
+				matched = append(matched, v)
+				matchedCounts = append(matchedCounts, counts[2*i], counts[2*i+1])
+			} else {
+				unmatched = append(unmatched, v)
+			}
+		}
+
+		// only the uniqueness of the matched keys is tested
+		if len(matched) > 0 {
+			one, err := s.MembershipPhase(targetSurvey, matchedCounts, []int64{1})
+			if err != nil {
+				return err
+			}
+			for _, v := range one {
+				if !v {
+					return errors.New("a matched join key is not unique in its source")
+				}
+			}
+		}
+	}
+
+	survey, err = s.getSurvey(targetSurvey)
+	if err != nil {
+		return err
+	}
+	survey.SuppressCothorityAggregatedFilteredResponses(unmatched, false)
+	survey.SuppressCothorityAggregatedFilteredResponses(matched, true)
+
+	merged, ok := survey.GroupedDeterministicFilteredResponses[libunlynxstore.MergedGroupingKey]
+	if !ok {
+		merged = libunlynx.FilteredResponse{GroupByEnc: libunlynx.CipherVector{}, AggregatingAttributes: libunlynx.IntArrayToCipherVector(make([]int64, len(survey.Query.Sum)))}
+	}
+	merged.AggregatingAttributes[attributePosition(survey.Query.Sum, JoinCountAttribute)] = libunlynx.IntToCipherText(int64(len(matched)))
+	survey.GroupedDeterministicFilteredResponses[libunlynxstore.MergedGroupingKey] = merged
+
+	log.Lvl1(s.ServerIdentity(), " matched ", len(matched), " out of ", len(groups), " join keys")
+
+	return s.putSurvey(targetSurvey, survey)
+}
+
+// SetCardinalityPhase replaces the aggregated identifiers by the cardinality of their union (the number of groups) or
+// intersection (the number of groups held by all the data providers).
+func (s *Service) SetCardinalityPhase(targetSurvey SurveyID) error {
+	survey, err := s.getSurvey(targetSurvey)
+	if err != nil {
+		return err
+	}
+
+	groups := make([]libunlynx.GroupingKey, 0)
+	counts := make(libunlynx.CipherVector, 0)
+	for k, v := range survey.GroupedDeterministicFilteredResponses {
+		groups = append(groups, k)
+		counts = append(counts, v.AggregatingAttributes[0])
+	}
+
+	cardinality := int64(len(groups))
+	if !survey.Query.SetCardinality.Union && len(groups) > 0 {
+		inAllSets, err := s.MembershipPhase(targetSurvey, counts, []int64{CountDPs(survey.Query.MapDPs)})
+		if err != nil {
+			return err
+		}
+		cardinality = 0
+		for _, v := range inAllSets {
+			if v {
+				cardinality++
+			}
+		}
+	}
+
+	survey, err = s.getSurvey(targetSurvey)
+	if err != nil {
+		return err
+	}
+	survey.SuppressCothorityAggregatedFilteredResponses(groups, false)
+	survey.GroupedDeterministicFilteredResponses[libunlynxstore.MergedGroupingKey] = libunlynx.FilteredResponse{GroupByEnc: libunlynx.CipherVector{}, AggregatingAttributes: libunlynx.IntArrayToCipherVector([]int64{cardinality})}
+
+	return s.putSurvey(targetSurvey, survey)
+}
+
+// ThresholdPhase drops (or merges) the aggregated groups whose count is below the minimum count of the query.
+func (s *Service) ThresholdPhase(targetSurvey SurveyID) error {
+	survey, err := s.getSurvey(targetSurvey)
+	if err != nil {
+		return err
+	}
+
+	countPos := attributePosition(survey.Query.Sum, "count")
+	groups := make([]libunlynx.GroupingKey, 0)
+	counts := make(libunlynx.CipherVector, 0)
+	for k, v := range survey.GroupedDeterministicFilteredResponses {
+		groups = append(groups, k)
+		counts = append(counts, v.AggregatingAttributes[countPos])
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	belowThreshold, err := s.MembershipPhase(targetSurvey, counts, libunlynxmembership.ThresholdSet(survey.Query.MinCount))
+	if err != nil {
+		return err
+	}
+
+	decisions := make([]ThresholdDecision, len(groups))
+	suppressed := make([]libunlynx.GroupingKey, 0)
+	for i, v := range groups {
+		decisions[i] = ThresholdDecision{Group: v, Suppressed: belowThreshold[i]}
+		if belowThreshold[i] {
+			suppressed = append(suppressed, v)
+		}
+	}
+
+	survey, err = s.getSurvey(targetSurvey)
+	if err != nil {
+		return err
+	}
+	survey.SuppressCothorityAggregatedFilteredResponses(suppressed, survey.Query.MergeBelowMinCount)
+
+	// the merged group is itself tested against the threshold
+	if survey.Query.MergeBelowMinCount && len(suppressed) > 0 {
+		merged := survey.GroupedDeterministicFilteredResponses[libunlynxstore.MergedGroupingKey]
+		mergedBelow, err := s.MembershipPhase(targetSurvey, libunlynx.CipherVector{merged.AggregatingAttributes[countPos]}, libunlynxmembership.ThresholdSet(survey.Query.MinCount))
+		if err != nil {
+			return err
+		}
+
+		survey, err = s.getSurvey(targetSurvey)
+		if err != nil {
+			return err
+		}
+		if mergedBelow[0] {
+			survey.SuppressCothorityAggregatedFilteredResponses([]libunlynx.GroupingKey{libunlynxstore.MergedGroupingKey}, false)
+		}
+		decisions = append(decisions, ThresholdDecision{Group: libunlynxstore.MergedGroupingKey, Suppressed: mergedBelow[0]})
+	}
+
+	log.Lvl1(s.ServerIdentity(), " suppressed ", len(suppressed), " out of ", len(groups), " groups (minimum count ", survey.Query.MinCount, ")")
+
+	survey.ThresholdDecisions = decisions
+	for _, td := range decisions {
+		s.audit(targetSurvey, libunlynxaudit.KindThresholdDecision, ThresholdDecisionDescription(td))
+	}
+	return s.putSurvey(targetSurvey, survey)
+}
+
+// TopKPhase keeps only the k aggregated groups with the largest counts. It searches for the largest threshold t (at
+// most the top-k bound of the query) such that at least k groups have a count >= t (exponential then binary search).
+// Each step is a membership test of all the counts in {0, ..., t-1}: the root learns which groups reach each tested
+// threshold (at most 2*log2(bound) thresholds) and the querier only gets the selected groups. It fails if more than k
+// groups have a count >= bound (their order is unknown).
+func (s *Service) TopKPhase(targetSurvey SurveyID) error {
+	survey, err := s.getSurvey(targetSurvey)
+	if err != nil {
+		return err
+	}
+
+	k := int(survey.Query.TopK)
+	bound := int64(MaxTopKBound)
+	if survey.Query.TopKBound > 0 {
+		bound = survey.Query.TopKBound
+	}
+	if len(survey.GroupedDeterministicFilteredResponses) <= k {
+		return nil
+	}
+
+	countPos := attributePosition(survey.Query.Sum, "count")
+	groups := make([]libunlynx.GroupingKey, 0)
+	counts := make(libunlynx.CipherVector, 0)
+	for key, v := range survey.GroupedDeterministicFilteredResponses {
+		groups = append(groups, key)
+		counts = append(counts, v.AggregatingAttributes[countPos])
+	}
+
+	// atLeast returns which groups have a count >= t and how many they are
+	atLeast := func(t int64) ([]bool, int, error) {
+		below, err := s.MembershipPhase(targetSurvey, counts, libunlynxmembership.ThresholdSet(t))
+		if err != nil {
+			return nil, 0, err
+		}
+		above := make([]bool, len(below))
+		nbr := 0
+		for i, v := range below {
+			above[i] = !v
+			if above[i] {
+				nbr++
+			}
+		}
+		return above, nbr, nil
+	}
+
+	// lo is a threshold with at least k groups above it, hi one with less than k groups above it
+	lo, hi := int64(0), int64(1)
+	aboveLo := make([]bool, len(groups))
+	for i := range aboveLo {
+		aboveLo[i] = true
+	}
+	var aboveHi []bool
+	for {
+		above, nbr, err := atLeast(hi)
+		if err != nil {
+			return err
+		}
+		if nbr < k {
+			aboveHi = above
+			break
+		}
+		lo, aboveLo = hi, above
+		if hi == bound {
+			// the counts >= bound are not compared: the selection is only possible if exactly k groups reach it
+			if nbr > k {
+				return errors.New(strconv.Itoa(nbr) + " groups have a count of at least the top-k bound " + strconv.FormatInt(bound, 10) +
+					": the " + strconv.Itoa(k) + " largest groups can not be selected")
+			}
+			aboveHi = make([]bool, len(groups))
+			break
+		}
+		hi = 2 * hi
+		if hi > bound {
+			hi = bound
+		}
+	}
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		above, nbr, err := atLeast(mid)
+		if err != nil {
+			return err
+		}
+		if nbr < k {
+			hi, aboveHi = mid, above
+		} else {
+			lo, aboveLo = mid, above
+		}
+	}
+
+	// groups above hi are all selected and the remaining ones are taken from the groups with a count equal to lo
+	selected := 0
+	keep := make([]bool, len(groups))
+	for i := range groups {
+		if aboveHi[i] {
+			keep[i] = true
+			selected++
+		}
+	}
+	for i := range groups {
+		if selected < k && aboveLo[i] && !keep[i] {
+			keep[i] = true
+			selected++
+		}
+	}
+
+	suppressed := make([]libunlynx.GroupingKey, 0)
+	for i, v := range groups {
+		if !keep[i] {
+			suppressed = append(suppressed, v)
+		}
+	}
+
+	survey, err = s.getSurvey(targetSurvey)
+	if err != nil {
+		return err
+	}
+	survey.SuppressCothorityAggregatedFilteredResponses(suppressed, false)
+	log.Lvl1(s.ServerIdentity(), " kept the ", selected, " largest groups out of ", len(groups))
+
+	return s.putSurvey(targetSurvey, survey)
+}
+
+// MembershipPhase collectively tests if each (encrypted) value belongs to a public set of values.
+func (s *Service) MembershipPhase(targetSurvey SurveyID, values libunlynx.CipherVector, set []int64) ([]bool, error) {
+	survey, err := s.getSurvey(targetSurvey)
+	if err != nil {
+		return nil, err
+	}
+	survey.MembershipTarget = libunlynxmembership.PrepareMembershipTest(values, set, survey.Query.Roster.Aggregate)
+	err = s.putSurvey(targetSurvey, survey)
+	if err != nil {
+		return nil, err
+	}
+
+	pi, err := s.StartProtocol(protocolsunlynx.MembershipProtocolName, targetSurvey)
+	if err != nil {
+		return nil, err
+	}
+	tags := <-pi.(*protocolsunlynx.ShufflingPlusDDTProtocol).FeedbackChannel
+
+	return libunlynxmembership.EvaluateMembershipTest(tags)
+}
+
 // DROPhase shuffles the list of noise values.
 func (s *Service) DROPhase(targetSurvey SurveyID) error {
 	pi, err := s.StartProtocol(protocolsunlynx.DROProtocolName, targetSurvey)
@@ -819,6 +2361,16 @@ func (s *Service) DROPhase(targetSurvey SurveyID) error {
 	shufflingResult := protocolsunlynx.MatrixCipherTextToProcessResponse(tmpShufflingResult, survey.Lengths)
 
 	survey.Noise = shufflingResult[0].AggregatingAttributes[0]
+	if survey.Query.Histogram != nil && survey.Query.Histogram.DRONoise {
+		// each bin gets its own noise value
+		if len(shufflingResult) < survey.Query.Histogram.NbrBins() {
+			return errors.New("not enough noise values for the " + strconv.Itoa(survey.Query.Histogram.NbrBins()) + " bins of the histogram")
+		}
+		survey.BinNoise = make(libunlynx.CipherVector, survey.Query.Histogram.NbrBins())
+		for i := range survey.BinNoise {
+			survey.BinNoise[i] = shufflingResult[i].AggregatingAttributes[0]
+		}
+	}
 	err = s.putSurvey(targetSurvey, survey)
 	return err
 }
@@ -883,6 +2435,97 @@ func FilterNone(responsesToFilter []libunlynx.ProcessResponseDet) []libunlynx.Fi
 	return result
 }
 
+// DeduplicateSetResponses keeps one (tagged) identifier per data provider in a set cardinality survey: the responses are
+// grouped by their identifier and their SetProviderAttribute, each group is kept once and then only grouped by its
+// identifier. tags are the tags of the responses of targetOfSwitch.
+func DeduplicateSetResponses(filteredResponses []libunlynx.FilteredResponseDet, tags libunlynx.DeterministCipherVector, targetOfSwitch []libunlynx.ProcessResponse) []libunlynx.FilteredResponseDet {
+	// the key of the identifier of each (identifier, data provider) group
+	identifierKeys := make(map[libunlynx.GroupingKey]libunlynx.GroupingKey)
+	pos := 0
+	for _, v := range targetOfSwitch {
+		pos += len(v.WhereEnc)
+		groupTags := tags[pos : pos+len(v.GroupByEnc)]
+		pos += len(v.GroupByEnc)
+		if len(groupTags) == 2 {
+			identifierTag := groupTags[:1]
+			identifierKeys[groupTags.Key()] = identifierTag.Key()
+		}
+	}
+
+	result := make([]libunlynx.FilteredResponseDet, 0, len(filteredResponses))
+	kept := make(map[libunlynx.GroupingKey]bool)
+	for _, v := range filteredResponses {
+		identifierKey, ok := identifierKeys[v.DetTagGroupBy]
+		if !ok || kept[v.DetTagGroupBy] {
+			continue
+		}
+		kept[v.DetTagGroupBy] = true
+		result = append(result, libunlynx.FilteredResponseDet{DetTagGroupBy: identifierKey, Fr: libunlynx.FilteredResponse{GroupByEnc: v.Fr.GroupByEnc[:1], AggregatingAttributes: v.Fr.AggregatingAttributes}})
+	}
+	return result
+}
+
+// AddHistogramBins appends the bins of the histogram to the list of aggregating attributes (if not already present)
+func AddHistogramBins(sum []string, histogram *libunlynx.Histogram) []string {
+	present := make(map[string]bool, len(sum))
+	for _, v := range sum {
+		present[v] = true
+	}
+	result := append([]string{}, sum...)
+	for _, v := range histogram.BinNames() {
+		if !present[v] {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// queryAttributes returns the attributes used in the statement of a query (i.e. before the attributes derived by the
+// query options, e.g. histogram bins, are added), which have to be declared in the dataset schema
+func (scq *SurveyCreationQuery) queryAttributes() (where, groupBy, sum []string) {
+	switch {
+	case scq.SetCardinality != nil:
+		return nil, []string{scq.SetCardinality.Identifier}, nil
+	case scq.Join != nil:
+		return nil, []string{scq.Join.Key}, append(append([]string{}, scq.Join.Left.Sum...), scq.Join.Right.Sum...)
+	}
+
+	for _, v := range scq.Where {
+		where = append(where, v.Name)
+	}
+	sum = append([]string{}, scq.Sum...)
+	if scq.Histogram != nil {
+		sum = append(sum, scq.Histogram.Attribute)
+	}
+	return where, scq.GroupBy, sum
+}
+
+// responseAttributes returns the attributes expected in a DP response to the (already created) survey. For a join,
+// they depend on the source of the response.
+func (scq *SurveyCreationQuery) responseAttributes(joinSource *JoinSource) (where, groupBy, sum []string) {
+	switch {
+	case scq.SetCardinality != nil:
+		return nil, []string{scq.SetCardinality.Identifier}, nil
+	case joinSource != nil:
+		return nil, scq.GroupBy, append(append([]string{}, joinSource.Sum...), joinSource.CountAttribute())
+	}
+
+	for _, v := range scq.Where {
+		where = append(where, v.Name)
+	}
+	return where, scq.GroupBy, scq.Sum
+}
+
+// attributePosition returns the position of an attribute in a list of attributes (-1 if it is not present)
+func attributePosition(attributes []string, name string) int {
+	for i, v := range attributes {
+		if v == name {
+			return i
+		}
+	}
+	return -1
+}
+
 // CountDPs counts the number of data providers targeted by a query/survey
 func CountDPs(m map[string]int64) int64 {
 	result := int64(0)
@@ -1,16 +1,28 @@
 package servicesunlynx_test
 
 import (
+	"fmt"
+	"github.com/fanliao/go-concurrentMap"
 	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/audit"
+	"github.com/ldsec/unlynx/lib/encryption_proof"
+	"github.com/ldsec/unlynx/lib/shuffle"
+	"github.com/ldsec/unlynx/protocols"
+	"github.com/ldsec/unlynx/protocols/utils"
 	"github.com/ldsec/unlynx/services"
 	"github.com/stretchr/testify/assert"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/util/key"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 )
 
 // numberGrpAttr is the number of group attributes.
@@ -1090,3 +1102,1494 @@ func TestFilteringFunc(t *testing.T) {
 	log.Lvl1(whereQueryValues)
 	log.Lvl1(servicesunlynx.FilterResponses(predicate, whereQueryValues, responsesToFilter))
 }
+
+// TEST BATCH 3 -> query options
+//______________________________________________________________________________________________________________________
+
+//______________________________________________________________________________________________________________________
+// Histogram of an attribute binned by the data providers (encrypted) or by the servers (clear)
+func TestServiceHistogram(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+
+	histogram := libunlynx.Histogram{Attribute: "age", Bounds: []int64{0, 18, 65, 120}}
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+		Roster:    *el,
+		MapDPs:    nbrDPs,
+		Proofs:    proofsService,
+		Histogram: &histogram,
+		GroupBy:   []string{"g1"},
+	})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+
+	ages := []int64{5, 17, 30, 70, 45, 200}
+	for i, server := range el.List {
+		dataHolder := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		grp := map[string]int64{"g1": 0}
+
+		// the first age is binned by the data provider, the second one by the server
+		responses := []libunlynx.DpClearResponse{
+			histogram.EncodeDpClearResponse(libunlynx.DpClearResponse{GroupByEnc: grp, AggregatingAttributesEnc: map[string]int64{"age": ages[2*i]}}),
+			{GroupByEnc: grp, AggregatingAttributesClear: map[string]int64{"age": ages[2*i+1]}},
+		}
+		err := dataHolder.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false)
+		assert.NoError(t, err)
+	}
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+
+	assert.Equal(t, [][]int64{{0}}, *grp)
+	assert.Equal(t, [][]int64{{2, 2, 1}}, *aggr)
+}
+
+//______________________________________________________________________________________________________________________
+// Groups with a count below the minimum count are dropped or merged
+func TestServiceMinCount(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	for _, merge := range []bool{false, true} {
+		client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+
+		nbrDPs := make(map[string]int64)
+		for _, server := range el.List {
+			nbrDPs[server.String()] = 1
+		}
+
+		surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+			Roster:             *el,
+			MapDPs:             nbrDPs,
+			Proofs:             proofsService,
+			Sum:                []string{"s1", "count"},
+			Count:              true,
+			GroupBy:            []string{"g1"},
+			MinCount:           3,
+			MergeBelowMinCount: merge,
+		})
+		if err != nil {
+			t.Fatal("Service did not start.", err)
+		}
+
+		// group 0 has 5 responses, group 1 has 1 and group 2 has 2
+		groups := [][]int64{{0, 0}, {0, 1}, {0, 2, 2, 0}}
+		for i, server := range el.List {
+			dataHolder := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+			responses := make([]libunlynx.DpClearResponse, 0)
+			for _, g := range groups[i] {
+				responses = append(responses, libunlynx.DpClearResponse{GroupByEnc: map[string]int64{"g1": g}, AggregatingAttributesEnc: map[string]int64{"s1": 10}})
+			}
+			err := dataHolder.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+			assert.NoError(t, err)
+		}
+
+		grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+		if err != nil {
+			t.Fatal("Service could not output the results.")
+		}
+
+		expectedResults := map[string][]int64{"[0]": {50, 5}}
+		if merge {
+			expectedResults["[]"] = []int64{30, 3}
+		}
+		assert.Equal(t, len(expectedResults), len(*grp))
+		for i := range *grp {
+			assert.Equal(t, expectedResults[fmt.Sprint((*grp)[i])], (*aggr)[i])
+		}
+	}
+
+	// the count attribute is required
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	_, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, Sum: []string{"s1"}, GroupBy: []string{"g1"}, MinCount: 3})
+	assert.Error(t, err)
+}
+
+//______________________________________________________________________________________________________________________
+// Only the k groups with the largest counts are returned
+func TestServiceTopK(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+		Roster:  *el,
+		MapDPs:  nbrDPs,
+		Proofs:  proofsService,
+		Sum:     []string{"count"},
+		Count:   true,
+		GroupBy: []string{"g1"},
+		TopK:    3,
+	})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+
+	// counts: group 0 -> 6, group 1 -> 1, group 2 -> 3, group 3 -> 3, group 4 -> 2
+	groups := [][]int64{{0, 0, 1, 2, 3}, {0, 0, 2, 4, 3}, {0, 0, 2, 3, 4}}
+	for i, server := range el.List {
+		dataHolder := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		responses := make([]libunlynx.DpClearResponse, 0)
+		for _, g := range groups[i] {
+			responses = append(responses, libunlynx.DpClearResponse{GroupByEnc: map[string]int64{"g1": g}})
+		}
+		err := dataHolder.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+		assert.NoError(t, err)
+	}
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+
+	expectedResults := map[int64]int64{0: 6, 2: 3, 3: 3}
+	assert.Equal(t, len(expectedResults), len(*grp))
+	for i := range *grp {
+		assert.Equal(t, expectedResults[(*grp)[i][0]], (*aggr)[i][0])
+	}
+
+	// the counts are only compared up to the bound: the selection works if exactly k groups reach it (3 groups have a
+	// count >= 3) and fails otherwise (4 groups have a count >= 2)
+	for _, bound := range []int64{3, 2} {
+		surveyID, err = client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Sum: []string{"count"}, Count: true, GroupBy: []string{"g1"}, TopK: 3, TopKBound: bound})
+		if err != nil {
+			t.Fatal("Service did not start.", err)
+		}
+		for i, server := range el.List {
+			dataHolder := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+			responses := make([]libunlynx.DpClearResponse, 0)
+			for _, g := range groups[i] {
+				responses = append(responses, libunlynx.DpClearResponse{GroupByEnc: map[string]int64{"g1": g}})
+			}
+			err := dataHolder.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+			assert.NoError(t, err)
+		}
+		grp, aggr, err = client.SendSurveyResultsQuery(*surveyID)
+		if bound == 2 {
+			assert.Error(t, err)
+			continue
+		}
+		if err != nil {
+			t.Fatal("Service could not output the results.")
+		}
+		assert.Equal(t, len(expectedResults), len(*grp))
+		for i := range *grp {
+			assert.Equal(t, expectedResults[(*grp)[i][0]], (*aggr)[i][0])
+		}
+	}
+
+	_, err = client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Sum: []string{"count"}, Count: true, GroupBy: []string{"g1"}, TopK: 3, TopKBound: servicesunlynx.MaxTopKBound + 1})
+	assert.Error(t, err)
+}
+
+//______________________________________________________________________________________________________________________
+// Join of two sources on an encrypted key
+func TestServiceJoin(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+
+	// the first server receives the responses of the ehr, the two others the ones of the registry
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	join := servicesunlynx.JoinQuery{
+		Key:   "patient",
+		Left:  servicesunlynx.JoinSource{Name: "ehr", Sum: []string{"age"}},
+		Right: servicesunlynx.JoinSource{Name: "registry", Sum: []string{"dose"}},
+	}
+	surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+		Roster: *el,
+		MapDPs: nbrDPs,
+		Proofs: proofsService,
+		Join:   &join,
+	})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+
+	// patients 2 and 3 are in both sources
+	ehr := []libunlynx.DpClearResponse{
+		{GroupByEnc: map[string]int64{"patient": 1}, AggregatingAttributesEnc: map[string]int64{"age": 30}},
+		{GroupByEnc: map[string]int64{"patient": 2}, AggregatingAttributesEnc: map[string]int64{"age": 40}},
+		{GroupByEnc: map[string]int64{"patient": 3}, AggregatingAttributesEnc: map[string]int64{"age": 50}},
+	}
+	err = servicesunlynx.NewUnLynxClient(el.List[0], "1").SendJoinResponseQuery(*surveyID, "ehr", ehr, el.Aggregate, 1)
+	assert.NoError(t, err)
+
+	registry := [][]libunlynx.DpClearResponse{
+		{{GroupByEnc: map[string]int64{"patient": 2}, AggregatingAttributesEnc: map[string]int64{"dose": 5}}},
+		{{GroupByEnc: map[string]int64{"patient": 3}, AggregatingAttributesEnc: map[string]int64{"dose": 7}},
+			{GroupByEnc: map[string]int64{"patient": 4}, AggregatingAttributesEnc: map[string]int64{"dose": 9}}},
+	}
+	for i, v := range registry {
+		err = servicesunlynx.NewUnLynxClient(el.List[i+1], strconv.Itoa(i+2)).SendJoinResponseQuery(*surveyID, "registry", v, el.Aggregate, 1)
+		assert.NoError(t, err)
+	}
+
+	// unknown sources are rejected
+	err = servicesunlynx.NewUnLynxClient(el.List[0], "4").SendJoinResponseQuery(*surveyID, "unknown", ehr, el.Aggregate, 1)
+	assert.Error(t, err)
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+
+	assert.Equal(t, [][]int64{{}}, *grp)
+	assert.Equal(t, [][]int64{{2, 2, 2, 90, 12}}, *aggr)
+
+	// a matched key appearing twice in a source makes the join fail
+	surveyID, err = client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Join: &join})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+	err = servicesunlynx.NewUnLynxClient(el.List[0], "1").SendJoinResponseQuery(*surveyID, "ehr", ehr, el.Aggregate, 1)
+	assert.NoError(t, err)
+	registry[1][1].GroupByEnc["patient"] = 2
+	for i, v := range registry {
+		err = servicesunlynx.NewUnLynxClient(el.List[i+1], strconv.Itoa(i+2)).SendJoinResponseQuery(*surveyID, "registry", v, el.Aggregate, 1)
+		assert.NoError(t, err)
+	}
+	_, _, err = client.SendSurveyResultsQuery(*surveyID)
+	assert.Error(t, err)
+
+	// the join defines the attributes of the survey
+	_, err = client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Join: &join, Sum: []string{"age"}})
+	assert.Error(t, err)
+	_, err = client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Join: &join, TopK: 1})
+	assert.Error(t, err)
+}
+
+//______________________________________________________________________________________________________________________
+// Cardinality of the intersection and union of the sets of identifiers of the data providers
+func TestServiceSetCardinality(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	sets := [][]int64{{1, 2, 3, 3}, {2, 3, 4}, {3, 2, 5}}
+
+	for _, union := range []bool{false, true} {
+		client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+		dps := make([]*servicesunlynx.API, len(el.List))
+		authorized := make([]servicesunlynx.AuthorizedDP, len(el.List))
+		for i, server := range el.List {
+			dps[i] = servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+			authorized[i] = dps[i].AuthorizedDP()
+		}
+		surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+			Roster:         *el,
+			MapDPs:         nbrDPs,
+			Proofs:         proofsService,
+			SetCardinality: &servicesunlynx.SetCardinalityQuery{Identifier: "id", Union: union},
+			DPRegistration: true,
+			AuthorizedDPs:  authorized,
+		})
+		if err != nil {
+			t.Fatal("Service did not start.", err)
+		}
+
+		for i, dp := range dps {
+			assert.NoError(t, dp.SendDPRegistrationQuery(*surveyID))
+			err := dp.SendSetResponseQuery(*surveyID, "id", sets[i], el.Aggregate)
+			assert.NoError(t, err)
+		}
+
+		grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+		if err != nil {
+			t.Fatal("Service could not output the results.")
+		}
+
+		assert.Equal(t, [][]int64{{}}, *grp)
+		if union {
+			assert.Equal(t, [][]int64{{5}}, *aggr)
+		} else {
+			assert.Equal(t, [][]int64{{2}}, *aggr)
+		}
+	}
+
+	// the servers deduplicate the identifiers of each data provider (the second server has two data providers)
+	nbrDPs[el.List[1].String()] = 2
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	duplicatedSets := [][]int64{{4, 4, 2}, {2, 4}, {2}, {2, 4}}
+	dps := make([]*servicesunlynx.API, len(duplicatedSets))
+	authorized := make([]servicesunlynx.AuthorizedDP, len(duplicatedSets))
+	for i := range duplicatedSets {
+		server := el.List[0]
+		if i > 0 {
+			server = el.List[(i+1)/2]
+		}
+		dps[i] = servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		authorized[i] = dps[i].AuthorizedDP()
+	}
+
+	// the data providers of a set cardinality survey have to be registered
+	_, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, SetCardinality: &servicesunlynx.SetCardinalityQuery{Identifier: "id"}})
+	assert.Error(t, err)
+	surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, SetCardinality: &servicesunlynx.SetCardinalityQuery{Identifier: "id"},
+		DPRegistration: true, AuthorizedDPs: authorized})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+	for i, set := range duplicatedSets {
+		responses := make([]libunlynx.DpClearResponse, len(set))
+		for j, id := range set {
+			responses[j] = libunlynx.DpClearResponse{GroupByEnc: map[string]int64{"id": id}}
+		}
+		assert.NoError(t, dps[i].SendDPRegistrationQuery(*surveyID))
+		err := dps[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false)
+		assert.NoError(t, err)
+		// a data provider can only send its set once
+		assert.Error(t, dps[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false))
+	}
+	_, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+	assert.Equal(t, [][]int64{{1}}, *aggr)
+}
+
+//______________________________________________________________________________________________________________________
+// Queries and responses are validated against the dataset schema of the roster
+func TestServiceSchema(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	servers, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	admin := servicesunlynx.NewUnLynxClient(el.List[0], "admin")
+	otherAdmin := servicesunlynx.NewUnLynxClient(el.List[1], "other admin")
+	for _, s := range local.GetServices(servers, onet.ServiceFactory.ServiceID(servicesunlynx.ServiceName)) {
+		s.(*servicesunlynx.Service).SetSchemaAdmins([]kyber.Point{admin.PublicKey(), otherAdmin.PublicKey()})
+	}
+	server := servicesunlynx.NewUnLynxClientWithKeys(el.List[2], "server", &key.Pair{Private: servers[2].ServerIdentity.GetPrivate(),
+		Public: servers[2].ServerIdentity.Public})
+	schema := libunlynx.DatasetSchema{Attributes: []libunlynx.AttributeSchema{
+		{Name: "g1", Kind: libunlynx.AttributeKindGroupBy, Type: libunlynx.AttributeTypeCategorical, Values: []int64{0, 1}},
+		{Name: "s1", Kind: libunlynx.AttributeKindAggregate, Type: libunlynx.AttributeTypeRange, Min: 0, Max: 100},
+	}}
+	otherSchema := libunlynx.DatasetSchema{Attributes: []libunlynx.AttributeSchema{
+		{Name: "g1", Kind: libunlynx.AttributeKindGroupBy, Type: libunlynx.AttributeTypeCategorical, Values: []int64{0, 1}},
+	}}
+
+	// only the admins and the servers of the roster can register a schema, and only them or the admin which registered
+	// it can replace it
+	assert.Error(t, client.SendSchemaRegistrationQuery(el, schema))
+	assert.Error(t, admin.SendSchemaRegistrationQuery(el, libunlynx.DatasetSchema{}))
+	assert.NoError(t, admin.SendSchemaRegistrationQuery(el, otherSchema))
+	assert.Error(t, otherAdmin.SendSchemaRegistrationQuery(el, schema))
+	assert.NoError(t, server.SendSchemaRegistrationQuery(el, schema))
+	assert.Error(t, admin.SendSchemaRegistrationQuery(el, otherSchema))
+
+	// the schemas are saved by the servers
+	for _, s := range local.GetServices(servers, onet.ServiceFactory.ServiceID(servicesunlynx.ServiceName)) {
+		s.(*servicesunlynx.Service).Schemas = concurrent.NewConcurrentMap()
+	}
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	query := servicesunlynx.SurveyCreationQuery{
+		Roster:  *el,
+		MapDPs:  nbrDPs,
+		Proofs:  proofsService,
+		Sum:     []string{"s2"},
+		GroupBy: []string{"g1"},
+	}
+
+	// s2 is not declared
+	_, err := client.SendSurveyQuery(query)
+	assert.Error(t, err)
+
+	query.Sum = []string{"s1"}
+	surveyID, err := client.SendSurveyQuery(query)
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+
+	// responses with a typo or a clear value outside of the domain are rejected
+	dataHolder := servicesunlynx.NewUnLynxClient(el.List[0], "1")
+	err = dataHolder.SendSurveyResponseQuery(*surveyID, []libunlynx.DpClearResponse{{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s2": 1}}}, el.Aggregate, 1, false)
+	assert.Error(t, err)
+	err = dataHolder.SendSurveyResponseQuery(*surveyID, []libunlynx.DpClearResponse{{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesClear: map[string]int64{"s1": 1000}}}, el.Aggregate, 1, false)
+	assert.Error(t, err)
+
+	for i, server := range el.List {
+		err := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1)).SendSurveyResponseQuery(*surveyID, []libunlynx.DpClearResponse{{GroupByEnc: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 10}}}, el.Aggregate, 1, false)
+		assert.NoError(t, err)
+	}
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+
+	assert.Equal(t, [][]int64{{1}}, *grp)
+	assert.Equal(t, [][]int64{{30}}, *aggr)
+}
+
+//______________________________________________________________________________________________________________________
+// Responses uploaded in several chunks are only counted once the upload is committed
+func TestServiceChunkedUpload(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	servers, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, []string{"s1"}, false, nil, "", []string{"g1"})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+
+	responses := make([]libunlynx.DpClearResponse, 5)
+	for i := range responses {
+		responses[i] = libunlynx.DpClearResponse{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": int64(i)}}
+	}
+
+	// chunks have to be sent in order and all of them before the commit
+	dataHolder := servicesunlynx.NewUnLynxClient(el.List[0], "1")
+	assert.Error(t, dataHolder.SendSurveyResponseChunk(&servicesunlynx.SurveyResponseChunk{SurveyID: *surveyID, UploadID: "test", Sequence: 1}))
+	assert.NoError(t, dataHolder.SendSurveyResponseChunk(&servicesunlynx.SurveyResponseChunk{SurveyID: *surveyID, UploadID: "test", Sequence: 0}))
+	// only the data provider which opened the upload can continue it
+	assert.Error(t, dataHolder.SendProtobuf(el.List[0], &servicesunlynx.SurveyResponseChunk{SurveyID: *surveyID, UploadID: "test", Sequence: 1, DPID: "other"}, &servicesunlynx.ServiceState{}))
+	assert.Error(t, dataHolder.SendProtobuf(el.List[0], &servicesunlynx.SurveyResponseCommit{SurveyID: *surveyID, UploadID: "test", NbrChunks: 1, DPID: "other"}, &servicesunlynx.ServiceState{}))
+	assert.Error(t, dataHolder.SendSurveyResponseCommit(&servicesunlynx.SurveyResponseCommit{SurveyID: *surveyID, UploadID: "test", NbrChunks: 2}))
+	assert.NoError(t, dataHolder.SendSurveyResponseCommit(&servicesunlynx.SurveyResponseCommit{SurveyID: *surveyID, UploadID: "test", NbrChunks: 1}))
+	assert.Error(t, dataHolder.SendSurveyResponseChunk(&servicesunlynx.SurveyResponseChunk{SurveyID: *surveyID, UploadID: "test", Sequence: 1}))
+
+	assert.Error(t, dataHolder.SendChunkedSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false, 0))
+
+	// only one of concurrent chunks with the same sequence number is accepted and the chunks of an upload which is not
+	// committed are not aggregated
+	resp, err := servicesunlynx.EncryptDataToSurvey("uncommitted", *surveyID, responses, el.Aggregate, 1, false)
+	assert.NoError(t, err)
+	uncommitted := servicesunlynx.NewUnLynxClient(el.List[1], "uncommitted")
+	accepted := make(chan bool, 4)
+	for i := 0; i < cap(accepted); i++ {
+		go func() {
+			accepted <- uncommitted.SendSurveyResponseChunk(&servicesunlynx.SurveyResponseChunk{SurveyID: *surveyID, UploadID: "uncommitted", Sequence: 0, Responses: resp.Responses}) == nil
+		}()
+	}
+	nbrAccepted := 0
+	for i := 0; i < cap(accepted); i++ {
+		if <-accepted {
+			nbrAccepted++
+		}
+	}
+	assert.Equal(t, 1, nbrAccepted)
+	// the ciphertexts of an (anonymous) upload can not be replayed in another upload
+	assert.Error(t, uncommitted.SendSurveyResponseChunk(&servicesunlynx.SurveyResponseChunk{SurveyID: *surveyID, UploadID: "replayed", Sequence: 0, Responses: resp.Responses}))
+
+	for i, server := range el.List[1:] {
+		err := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+2)).SendChunkedSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false, 2)
+		assert.NoError(t, err)
+	}
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+
+	assert.Equal(t, [][]int64{{0}}, *grp)
+	assert.Equal(t, [][]int64{{20}}, *aggr)
+
+	// the committed uploads and the uploads which are not committed at the end of the survey are forgotten
+	for _, s := range local.GetServices(servers, onet.ServiceFactory.ServiceID(servicesunlynx.ServiceName)) {
+		assert.Equal(t, int32(0), s.(*servicesunlynx.Service).Uploads.Size())
+	}
+}
+
+//______________________________________________________________________________________________________________________
+// Responses with clear groups pre-aggregated by the data providers give the same results
+func TestServicePreAggregation(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, []string{"s1", "count"}, true, nil, "", []string{"g1"})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+
+	responses := make([]libunlynx.DpClearResponse, 10)
+	for i := range responses {
+		responses[i] = libunlynx.DpClearResponse{GroupByClear: map[string]int64{"g1": int64(i % 2)}, AggregatingAttributesEnc: map[string]int64{"s1": int64(i)}}
+	}
+	for i, server := range el.List {
+		dataHolder := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		if i == 0 {
+			err = dataHolder.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+		} else {
+			err = dataHolder.SendPreAggregatedSurveyResponseQuery(*surveyID, responses, el.Aggregate, true)
+		}
+		assert.NoError(t, err)
+	}
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+
+	expectedResults := map[int64][]int64{0: {60, 15}, 1: {75, 15}}
+	assert.Equal(t, len(expectedResults), len(*grp))
+	for i, v := range *grp {
+		assert.Equal(t, expectedResults[v[0]], (*aggr)[i])
+	}
+}
+
+// staticDataSource is a data source giving the same responses to all servers
+type staticDataSource []libunlynx.DpClearResponse
+
+func (ds staticDataSource) Read(serverIndex int) ([]libunlynx.DpClearResponse, error) {
+	return ds, nil
+}
+
+//______________________________________________________________________________________________________________________
+// The servers answer the survey with their local data source
+func TestServiceDataSource(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	servers, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+	defer os.Remove("pre_compute_multiplications.gob")
+
+	responses := staticDataSource{
+		{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 2}},
+		{GroupByEnc: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 3}},
+	}
+	for _, s := range local.GetServices(servers, onet.ServiceFactory.ServiceID(servicesunlynx.ServiceName)) {
+		s.(*servicesunlynx.Service).SetDataSource(responses)
+	}
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, true, []string{"s1"}, false, nil, "", []string{"g1"})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+
+	expectedResults := map[int64][]int64{0: {6}, 1: {9}}
+	assert.Equal(t, len(expectedResults), len(*grp))
+	for i, v := range *grp {
+		assert.Equal(t, expectedResults[v[0]], (*aggr)[i])
+	}
+}
+
+//______________________________________________________________________________________________________________________
+// Only registered data providers can upload signed responses, once
+func TestServiceDPRegistration(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	dps := make([]*servicesunlynx.API, len(el.List))
+	authorized := make([]servicesunlynx.AuthorizedDP, len(el.List))
+	for i, server := range el.List {
+		dps[i] = servicesunlynx.NewUnLynxClient(server, "dp"+strconv.Itoa(i))
+		authorized[i] = dps[i].AuthorizedDP()
+	}
+	query := servicesunlynx.SurveyCreationQuery{
+		Roster:         *el,
+		MapDPs:         nbrDPs,
+		Proofs:         proofsService,
+		Sum:            []string{"s1"},
+		GroupBy:        []string{"g1"},
+		DPRegistration: true,
+	}
+
+	// the data providers must be authorized, at most MapDPs of them on each server
+	_, err := client.SendSurveyQuery(query)
+	assert.Error(t, err)
+	query.AuthorizedDPs = append(authorized, servicesunlynx.NewUnLynxClient(el.List[0], "dp3").AuthorizedDP())
+	_, err = client.SendSurveyQuery(query)
+	assert.Error(t, err)
+
+	query.AuthorizedDPs = authorized
+	surveyID, err := client.SendSurveyQuery(query)
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+
+	responses := []libunlynx.DpClearResponse{
+		{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 2}},
+		{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 3}},
+	}
+
+	// anonymous responses are rejected
+	dp := dps[0]
+	assert.Error(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false))
+
+	// an unauthorized client cannot register, even before the authorized one, nor register on another server
+	assert.Error(t, servicesunlynx.NewUnLynxClient(el.List[0], "dp0").SendDPRegistrationQuery(*surveyID))
+	assert.Error(t, servicesunlynx.NewUnLynxClient(el.List[0], "intruder").SendDPRegistrationQuery(*surveyID))
+	assert.Error(t, servicesunlynx.NewUnLynxClient(el.List[1], "dp0").SendDPRegistrationQuery(*surveyID))
+	assert.NoError(t, dp.SendDPRegistrationQuery(*surveyID))
+
+	status, err := dp.SendSurveyStatusQuery(*surveyID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), status.ExpectedDPs)
+	assert.Equal(t, 1, len(status.DataProviders))
+	assert.False(t, status.DataProviders[0].Uploaded)
+
+	// the responses are only counted once
+	assert.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false))
+	assert.Error(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false))
+
+	status, err = dp.SendSurveyStatusQuery(*surveyID)
+	assert.NoError(t, err)
+	assert.Equal(t, "dp0", status.DataProviders[0].DPID)
+	assert.True(t, status.DataProviders[0].Uploaded)
+	assert.Equal(t, int64(2), status.DataProviders[0].NbrResponses)
+
+	for _, dp := range dps[1:] {
+		assert.NoError(t, dp.SendDPRegistrationQuery(*surveyID))
+		assert.NoError(t, dp.SendChunkedSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false, 1))
+		assert.Error(t, dp.SendChunkedSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false, 1))
+	}
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+
+	assert.Equal(t, [][]int64{{0}}, *grp)
+	assert.Equal(t, [][]int64{{15}}, *aggr)
+}
+
+//______________________________________________________________________________________________________________________
+// Encrypted aggregating attributes with a range need a valid range proof
+func TestServiceRangeProofs(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	rangeBits := map[string]int64{"s1": 1, "count": 1}
+	surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+		Roster:    *el,
+		MapDPs:    nbrDPs,
+		Proofs:    proofsService,
+		Sum:       []string{"s1", "count"},
+		Count:     true,
+		GroupBy:   []string{"g1"},
+		RangeBits: rangeBits,
+	})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+
+	// a value out of the range without a proof or in clear is rejected
+	dataHolder := servicesunlynx.NewUnLynxClient(el.List[0], "1")
+	err = dataHolder.SendSurveyResponseQuery(*surveyID, []libunlynx.DpClearResponse{{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 1000000}}}, el.Aggregate, 1, true)
+	assert.Error(t, err)
+	err = dataHolder.SendSurveyResponseQuery(*surveyID, []libunlynx.DpClearResponse{{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesClear: map[string]int64{"s1": 2}}}, el.Aggregate, 1, false)
+	assert.Error(t, err)
+	err = dataHolder.SendSurveyResponseQueryWithRangeProofs(*surveyID, []libunlynx.DpClearResponse{{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 2}}}, el.Aggregate, true, rangeBits)
+	assert.Error(t, err)
+
+	responses := []libunlynx.DpClearResponse{
+		{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 1}},
+		{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 0}},
+	}
+	for i, server := range el.List {
+		err := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1)).SendSurveyResponseQueryWithRangeProofs(*surveyID, responses, el.Aggregate, true, rangeBits)
+		assert.NoError(t, err)
+	}
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+
+	assert.Equal(t, [][]int64{{0}}, *grp)
+	assert.Equal(t, [][]int64{{3, 6}}, *aggr)
+}
+
+//______________________________________________________________________________________________________________________
+// Encrypted attributes need a proof of correct encryption bound to the survey
+func TestServiceEncryptionProofs(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	dps := make([]*servicesunlynx.API, len(el.List))
+	authorized := make([]servicesunlynx.AuthorizedDP, len(el.List))
+	for i, server := range el.List {
+		nbrDPs[server.String()] = 1
+		dps[i] = servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		authorized[i] = dps[i].AuthorizedDP()
+	}
+	query := servicesunlynx.SurveyCreationQuery{
+		Roster:           *el,
+		MapDPs:           nbrDPs,
+		Proofs:           proofsService,
+		Sum:              []string{"s1", "count"},
+		Count:            true,
+		GroupBy:          []string{"g1"},
+		EncryptionProofs: true,
+	}
+
+	// the proofs are bound to registered data providers
+	_, err := client.SendSurveyQuery(query)
+	assert.Error(t, err)
+	query.DPRegistration = true
+	query.AuthorizedDPs = authorized
+	surveyID, err := client.SendSurveyQuery(query)
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+	for _, dp := range dps {
+		assert.NoError(t, dp.SendDPRegistrationQuery(*surveyID))
+	}
+
+	// responses without proofs or with the proofs of another survey are rejected
+	responses := []libunlynx.DpClearResponse{
+		{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 1}},
+		{GroupByEnc: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 2}},
+	}
+	dataHolder := dps[0]
+	err = dataHolder.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+	assert.Error(t, err)
+
+	replayed, err := servicesunlynx.EncryptDataToSurvey(dataHolder.String(), *surveyID, responses, el.Aggregate, 1, true)
+	assert.NoError(t, err)
+	for i := range replayed.Responses {
+		err := libunlynxencproof.AddEncryptionProofs(responses[i], &replayed.Responses[i], el.Aggregate, servicesunlynx.EncryptionProofContext("other_survey", "1"), nil)
+		assert.NoError(t, err)
+	}
+	assert.Error(t, dataHolder.SendEncryptedSurveyResponseQuery(replayed))
+
+	// nor with the proofs of another data provider
+	for i := range replayed.Responses {
+		err := libunlynxencproof.AddEncryptionProofs(responses[i], &replayed.Responses[i], el.Aggregate, servicesunlynx.EncryptionProofContext(*surveyID, "2"), nil)
+		assert.NoError(t, err)
+	}
+	assert.Error(t, dataHolder.SendEncryptedSurveyResponseQuery(replayed))
+
+	for _, dp := range dps {
+		assert.NoError(t, dp.SendSurveyResponseQueryWithEncryptionProofs(*surveyID, responses, el.Aggregate, true, nil))
+	}
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+
+	expected := map[int64][]int64{0: {3, 3}, 1: {6, 3}}
+	assert.Equal(t, len(expected), len(*grp))
+	for i, g := range *grp {
+		assert.Equal(t, expected[g[0]], (*aggr)[i])
+	}
+}
+
+//______________________________________________________________________________________________________________________
+// The proofs of all the servers are sent to the proof verifiers and their verification is attached to the results
+func TestServiceProofs(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	servers, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+		Roster:         *el,
+		MapDPs:         nbrDPs,
+		Proofs:         true,
+		ProofVerifiers: []*network.ServerIdentity{el.List[0], el.List[2]},
+		Sum:            []string{"s1", "count"},
+		Count:          true,
+		GroupBy:        []string{"g1"},
+	})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+
+	responses := []libunlynx.DpClearResponse{
+		{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 1}},
+		{GroupByEnc: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 2}},
+	}
+	for i, server := range el.List {
+		err := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1)).SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+		assert.NoError(t, err)
+	}
+
+	grp, aggr, proofs, err := client.SendSurveyResultsQueryWithProofs(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+
+	expected := map[int64][]int64{0: {3, 3}, 1: {6, 3}}
+	assert.Equal(t, len(expected), len(*grp))
+	for i, g := range *grp {
+		assert.Equal(t, expected[g[0]], (*aggr)[i])
+	}
+
+	// each verifier verified the proofs of each server
+	verified := make(map[string]int)
+	for _, pvr := range proofs {
+		assert.True(t, pvr.Verified(), "proofs of "+pvr.Server+" verified by "+pvr.Verifier, pvr.Results)
+		assert.Equal(t, protocolsunlynxutils.NbrResults, len(pvr.Results))
+		verified[pvr.Server]++
+	}
+	assert.Equal(t, len(el.List), len(verified))
+	for _, server := range el.List {
+		assert.Equal(t, 2, verified[server.String()])
+	}
+
+	// the root ignores duplicate or unexpected verification results
+	root := local.GetServices(servers[:1], onet.ServiceFactory.ServiceID(servicesunlynx.ServiceName))[0].(*servicesunlynx.Service)
+	_, err = root.HandleProofsVerificationResult(&proofs[0])
+	assert.Error(t, err)
+	forged := servicesunlynx.ProofsVerificationResult{SurveyID: *surveyID, Verifier: el.List[1].String(), Server: el.List[0].String(), Results: proofs[0].Results}
+	_, err = root.HandleProofsVerificationResult(&forged)
+	assert.Error(t, err)
+
+	// the proofs received by a verifier can be exported and verified offline
+	bundles, err := servicesunlynx.NewUnLynxClient(el.List[2], "exporter").SendProofsBundleQuery(*surveyID)
+	assert.NoError(t, err)
+	assert.Equal(t, len(el.List), len(bundles))
+	for _, pb := range bundles {
+		assert.Equal(t, el.List[2].String(), pb.Verifier)
+		assert.NotEmpty(t, pb.ResultsDigest)
+		results, err := pb.Verify(el, string(*surveyID), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{true, true, true, true, true, true}, results)
+		_, err = pb.Verify(el, "other survey", nil)
+		assert.Error(t, err)
+	}
+	_, err = servicesunlynx.NewUnLynxClient(el.List[1], "exporter").SendProofsBundleQuery(*surveyID)
+	assert.Error(t, err)
+
+	// a verifier has to be in the roster
+	_, outside, _ := local.GenTree(1, true)
+	_, err = client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+		Roster:         *el,
+		MapDPs:         nbrDPs,
+		Proofs:         true,
+		ProofVerifiers: []*network.ServerIdentity{outside.List[0]},
+		Sum:            []string{"s1"},
+	})
+	assert.Error(t, err)
+
+	// the root only waits for the verification results during the proofs timeout of the survey
+	query := servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Proofs: true, ProofVerifiers: []*network.ServerIdentity{el.List[0], el.List[2]},
+		Sum: []string{"s1", "count"}, Count: true, GroupBy: []string{"g1"}, ProofsTimeout: -time.Second}
+	_, err = client.SendSurveyQuery(query)
+	assert.Error(t, err)
+	query.ProofsTimeout = time.Nanosecond
+	surveyID, err = client.SendSurveyQuery(query)
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+	for i, server := range el.List {
+		err := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1)).SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+		assert.NoError(t, err)
+	}
+	_, aggr, proofs, err = client.SendSurveyResultsQueryWithProofs(*surveyID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(*aggr))
+	assert.True(t, len(proofs) < 2*len(el.List))
+}
+
+//______________________________________________________________________________________________________________________
+// The responses are shuffled in shards which go through the servers in parallel
+func TestServiceShardedShuffle(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	servers, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+		Roster:         *el,
+		MapDPs:         nbrDPs,
+		Proofs:         true,
+		ProofVerifiers: []*network.ServerIdentity{el.List[1]},
+		Sum:            []string{"s1", "count"},
+		Count:          true,
+		GroupBy:        []string{"g1"},
+		ShuffleShards:  2,
+	})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+
+	responses := []libunlynx.DpClearResponse{
+		{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 1}},
+		{GroupByEnc: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 2}},
+	}
+	for i, server := range el.List {
+		err := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1)).SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+		assert.NoError(t, err)
+	}
+
+	grp, aggr, proofs, err := client.SendSurveyResultsQueryWithProofs(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+
+	expected := map[int64][]int64{0: {3, 3}, 1: {6, 3}}
+	assert.Equal(t, len(expected), len(*grp))
+	for i, g := range *grp {
+		assert.Equal(t, expected[g[0]], (*aggr)[i])
+	}
+
+	// the proofs of the shuffle of each shard compose to a proof of the whole shuffle
+	assert.Equal(t, len(el.List), len(proofs))
+	for _, pvr := range proofs {
+		assert.True(t, pvr.Verified(), "proofs of "+pvr.Server+" verified by "+pvr.Verifier, pvr.Results)
+	}
+
+	// a server sends the lists of its sharded shuffle once
+	verifier := local.GetServices(servers[1:2], onet.ServiceFactory.ServiceID(servicesunlynx.ServiceName))[0].(*servicesunlynx.Service)
+	_, err = verifier.HandleProofsMessage(&servicesunlynx.ProofsMessage{SurveyID: *surveyID, Server: el.List[2].String(), ShardedShuffle: &servicesunlynx.ShardedShuffleBytes{}})
+	assert.Error(t, err)
+
+	// the number of shards is bounded
+	_, err = client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+		Roster:        *el,
+		MapDPs:        nbrDPs,
+		Sum:           []string{"s1"},
+		ShuffleShards: protocolsunlynx.MaxShardedShufflingShards + 1,
+	})
+	assert.Error(t, err)
+}
+
+//______________________________________________________________________________________________________________________
+// The responses are streamed through the servers in batches during the shuffling and the tagging
+func TestServiceBatches(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	// the results are the same as when the data is sent in one message
+	for _, batchSize := range []int64{0, 1, 2} {
+		surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+			Roster:    *el,
+			MapDPs:    nbrDPs,
+			Proofs:    true,
+			Sum:       []string{"s1"},
+			GroupBy:   []string{"g1"},
+			BatchSize: batchSize,
+		})
+		if err != nil {
+			t.Fatal("Service did not start.", err)
+		}
+
+		responses := []libunlynx.DpClearResponse{
+			{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 1}},
+			{GroupByEnc: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 2}},
+			{GroupByEnc: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 3}},
+			{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 4}},
+		}
+		// the responses are not aggregated by the servers so that they are shuffled in several batches
+		for i, server := range el.List {
+			err := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1)).SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false)
+			assert.NoError(t, err)
+		}
+
+		grp, aggr, proofs, err := client.SendSurveyResultsQueryWithProofs(*surveyID)
+		if err != nil {
+			t.Fatal("Service could not output the results.")
+		}
+
+		expected := map[int64][]int64{0: {15}, 1: {15}}
+		assert.Equal(t, len(expected), len(*grp))
+		for i, g := range *grp {
+			assert.Equal(t, expected[g[0]], (*aggr)[i])
+		}
+
+		// the proofs of the shuffle of each batch compose to a proof of the whole shuffle
+		assert.Equal(t, len(el.List), len(proofs))
+		for _, pvr := range proofs {
+			assert.True(t, pvr.Verified(), "proofs of "+pvr.Server+" verified by "+pvr.Verifier, pvr.Results)
+		}
+	}
+
+	_, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Sum: []string{"s1"}, BatchSize: -1})
+	assert.Error(t, err)
+}
+
+//______________________________________________________________________________________________________________________
+// The shuffles are proven with the Bayer-Groth argument
+func TestServiceBayerGrothShuffleProof(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+		Roster:         *el,
+		MapDPs:         nbrDPs,
+		Proofs:         true,
+		ProofVerifiers: []*network.ServerIdentity{el.List[1]},
+		Sum:            []string{"s1", "count"},
+		Count:          true,
+		GroupBy:        []string{"g1"},
+		ShuffleProof:   libunlynxshuffle.BayerGrothShuffleProof,
+	})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+
+	responses := []libunlynx.DpClearResponse{
+		{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 1}},
+		{GroupByEnc: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 2}},
+	}
+	for i, server := range el.List {
+		err := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1)).SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+		assert.NoError(t, err)
+	}
+
+	grp, aggr, proofs, err := client.SendSurveyResultsQueryWithProofs(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+
+	expected := map[int64][]int64{0: {3, 3}, 1: {6, 3}}
+	assert.Equal(t, len(expected), len(*grp))
+	for i, g := range *grp {
+		assert.Equal(t, expected[g[0]], (*aggr)[i])
+	}
+
+	assert.Equal(t, len(el.List), len(proofs))
+	for _, pvr := range proofs {
+		assert.True(t, pvr.Verified(), "proofs of "+pvr.Server+" verified by "+pvr.Verifier, pvr.Results)
+	}
+
+	_, err = client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Sum: []string{"s1"}, ShuffleProof: "unknown"})
+	assert.Error(t, err)
+}
+
+//______________________________________________________________________________________________________________________
+// The responses are shuffled and tagged in a single traversal of the servers
+func TestServiceShuffleAndTag(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	// the results are the same as with a shuffling phase followed by a tagging phase
+	var results [][][]int64
+	for _, shuffleAndTag := range []bool{false, true} {
+		surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+			Roster:         *el,
+			MapDPs:         nbrDPs,
+			Proofs:         true,
+			ProofVerifiers: []*network.ServerIdentity{el.List[1]},
+			Sum:            []string{"s1", "count"},
+			Count:          true,
+			Where:          []libunlynx.WhereQueryAttribute{{Name: "w1", Value: *libunlynx.EncryptInt(el.Aggregate, 1)}},
+			Predicate:      "v0 == v1",
+			GroupBy:        []string{"g1"},
+			ShuffleProof:   libunlynxshuffle.BayerGrothShuffleProof,
+			ShuffleAndTag:  shuffleAndTag,
+		})
+		if err != nil {
+			t.Fatal("Service did not start.", err)
+		}
+
+		responses := []libunlynx.DpClearResponse{
+			{WhereEnc: map[string]int64{"w1": 1}, GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 1}},
+			{WhereEnc: map[string]int64{"w1": 1}, GroupByEnc: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 2}},
+			{WhereEnc: map[string]int64{"w1": 0}, GroupByEnc: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 4}},
+		}
+		for i, server := range el.List {
+			err := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1)).SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+			assert.NoError(t, err)
+		}
+
+		grp, aggr, proofs, err := client.SendSurveyResultsQueryWithProofs(*surveyID)
+		if err != nil {
+			t.Fatal("Service could not output the results.")
+		}
+
+		expected := map[int64][]int64{0: {3, 3}, 1: {6, 3}}
+		assert.Equal(t, len(expected), len(*grp))
+		result := make([][]int64, len(expected))
+		for i, g := range *grp {
+			assert.Equal(t, expected[g[0]], (*aggr)[i])
+			result[g[0]] = (*aggr)[i]
+		}
+		results = append(results, result)
+
+		// the shuffle and tagging proofs are verified
+		assert.Equal(t, len(el.List), len(proofs))
+		for _, pvr := range proofs {
+			assert.True(t, pvr.Verified(), "proofs of "+pvr.Server+" verified by "+pvr.Verifier, pvr.Results)
+		}
+	}
+	assert.Equal(t, results[0], results[1])
+
+	// the responses can not be streamed and their proofs need the Bayer-Groth shuffle proofs
+	_, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Sum: []string{"s1"}, ShuffleAndTag: true, BatchSize: 1})
+	assert.Error(t, err)
+	_, err = client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Sum: []string{"s1"}, ShuffleAndTag: true, Proofs: true})
+	assert.Error(t, err)
+}
+
+//______________________________________________________________________________________________________________________
+// The collective aggregation runs over a tree with the branching factor of the survey and, with a timeout, leaves out the
+// servers which are late
+func TestServiceAggregationTimeout(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	servers, el, _ := local.GenTree(4, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	responses := []libunlynx.DpClearResponse{{AggregatingAttributesEnc: map[string]int64{"s1": 1}}}
+
+	// all the servers are children of the root
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Sum: []string{"s1", "count"}, Count: true, BranchingFactor: 3, AggregationTimeout: time.Minute})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+	for i, server := range el.List {
+		err := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1)).SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+		assert.NoError(t, err)
+	}
+	_, aggr, coverage, err := client.SendSurveyResultsQueryWithCoverage(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+	assert.Equal(t, [][]int64{{4, 4}}, *aggr)
+	assert.True(t, coverage.Complete())
+	assert.Equal(t, int64(len(el.List)), coverage.NbrServers)
+
+	// the last server waits for a second data provider and is left out of the aggregation
+	late := el.List[len(el.List)-1]
+	nbrDPs[late.String()] = 2
+	surveyID, err = client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Sum: []string{"s1", "count"}, Count: true, BranchingFactor: 3, AggregationTimeout: 2 * time.Second})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+	for i, server := range el.List {
+		err := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1)).SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+		assert.NoError(t, err)
+	}
+	_, aggr, coverage, err = client.SendSurveyResultsQueryWithCoverage(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+	assert.Equal(t, [][]int64{{3, 3}}, *aggr)
+	assert.False(t, coverage.Complete())
+	if assert.Len(t, coverage.Missing, 1) {
+		assert.True(t, coverage.Missing[0].ID.Equal(late.ID))
+	}
+
+	// the late server finishes the survey once it has all its data
+	err = servicesunlynx.NewUnLynxClient(late, strconv.Itoa(len(el.List)+1)).SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+	assert.NoError(t, err)
+	root := local.GetServices(servers[:1], onet.ServiceFactory.ServiceID(servicesunlynx.ServiceName))[0].(*servicesunlynx.Service)
+	survey, err := root.Survey.Get(string(*surveyID))
+	assert.NoError(t, err)
+	select {
+	case <-survey.(servicesunlynx.Survey).DDTChannel:
+	case <-time.After(time.Minute):
+		t.Fatal("The late server did not finish its tagging")
+	}
+
+	_, err = client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Sum: []string{"s1"}, BranchingFactor: -1})
+	assert.Error(t, err)
+}
+
+//______________________________________________________________________________________________________________________
+// The shuffles use (once) the values precomputed in the background by each server
+func TestServicePrecomputationPool(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	servers, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	pools := make([]*libunlynxshuffle.PrecomputationPool, len(servers))
+	for i, s := range local.GetServices(servers, onet.ServiceFactory.ServiceID(servicesunlynx.ServiceName)) {
+		pool, err := libunlynxshuffle.NewPrecomputationPool(filepath.Join(t.TempDir(), strconv.Itoa(i)))
+		assert.NoError(t, err)
+		pool.Size = 10
+		// only filled before the survey
+		pool.IdleDelay = time.Hour
+		s.(*servicesunlynx.Service).SetPrecomputationPool(pool)
+		defer pool.Stop()
+		pools[i] = pool
+	}
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+		Roster:  *el,
+		MapDPs:  nbrDPs,
+		Proofs:  proofsService,
+		Sum:     []string{"s1", "count"},
+		Count:   true,
+		GroupBy: []string{"g1"},
+	})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+
+	// line size: (2 aggregating attributes + 1 group-by attribute + count) * 2
+	for _, pool := range pools {
+		for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+			available, err := pool.Available(el.Aggregate, 8)
+			assert.NoError(t, err)
+			if available == pool.Size {
+				break
+			}
+			if time.Since(start) > 10*time.Second {
+				t.Fatal("the precomputation pool was not filled in time")
+			}
+		}
+	}
+
+	responses := []libunlynx.DpClearResponse{
+		{GroupByEnc: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 1}},
+		{GroupByEnc: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 2}},
+	}
+	for i, server := range el.List {
+		err := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1)).SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+		assert.NoError(t, err)
+	}
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+	expected := map[int64][]int64{0: {3, 3}, 1: {6, 3}}
+	assert.Equal(t, len(expected), len(*grp))
+	for i, g := range *grp {
+		assert.Equal(t, expected[g[0]], (*aggr)[i])
+	}
+
+	// the values used by the shuffle are not in the pools anymore
+	for _, pool := range pools {
+		available, err := pool.Available(el.Aggregate, 8)
+		assert.NoError(t, err)
+		assert.True(t, available < pool.Size)
+	}
+}
+
+//______________________________________________________________________________________________________________________
+// Each server keeps an audit log of the queries, proofs, threshold decisions and results of its surveys
+func TestServiceAuditLog(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	servers, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	auditor := servicesunlynx.NewUnLynxClient(el.List[1], "auditor")
+	for _, s := range local.GetServices(servers, onet.ServiceFactory.ServiceID(servicesunlynx.ServiceName)) {
+		s.(*servicesunlynx.Service).SetAuditors([]kyber.Point{client.PublicKey(), auditor.PublicKey()})
+	}
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	surveyID, err := client.SendSurveyQuery(servicesunlynx.SurveyCreationQuery{
+		Roster:   *el,
+		MapDPs:   nbrDPs,
+		Proofs:   true,
+		Sum:      []string{"s1", "count"},
+		Count:    true,
+		GroupBy:  []string{"g1"},
+		MinCount: 2,
+	})
+	if err != nil {
+		t.Fatal("Service did not start.", err)
+	}
+
+	for i, server := range el.List {
+		responses := []libunlynx.DpClearResponse{{GroupByEnc: map[string]int64{"g1": int64(i)}, AggregatingAttributesEnc: map[string]int64{"s1": 1}}}
+		if i == 0 {
+			responses = append(responses, responses[0])
+		}
+		err := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1)).SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true)
+		assert.NoError(t, err)
+	}
+	_, _, decisions, err := client.SendSurveyResultsQueryWithThresholdDecisions(*surveyID)
+	if err != nil {
+		t.Fatal("Service could not output the results.")
+	}
+
+	// the querier gets the threshold decisions (two groups have a single response)
+	assert.Equal(t, 3, len(decisions))
+	nbrSuppressed := 0
+	for _, td := range decisions {
+		if td.Suppressed {
+			nbrSuppressed++
+		}
+	}
+	assert.Equal(t, 2, nbrSuppressed)
+
+	kinds := func(entries []libunlynxaudit.Entry) map[string]int {
+		result := make(map[string]int)
+		for _, e := range entries {
+			assert.Equal(t, string(*surveyID), e.SurveyID)
+			result[e.Kind]++
+		}
+		return result
+	}
+
+	// the root verifies the proofs, decides which groups are suppressed and delivers the result
+	entries, err := client.SendAuditLogQuery()
+	assert.NoError(t, err)
+	assert.NoError(t, libunlynxaudit.Verify(entries))
+	assert.NoError(t, libunlynxaudit.VerifySignatures(entries, el.List[0].Public))
+	rootKinds := kinds(entries)
+	assert.Equal(t, 1, rootKinds[libunlynxaudit.KindQuery])
+	assert.Equal(t, 1, rootKinds[libunlynxaudit.KindRoster])
+	assert.True(t, rootKinds[libunlynxaudit.KindProofs] > 0)
+	assert.Equal(t, len(el.List), rootKinds[libunlynxaudit.KindProofsVerification])
+	assert.Equal(t, 3, rootKinds[libunlynxaudit.KindThresholdDecision])
+	for _, td := range decisions {
+		found := false
+		for _, e := range entries {
+			if e.Kind == libunlynxaudit.KindThresholdDecision && string(e.Data) == string(servicesunlynx.ThresholdDecisionDescription(td)) {
+				found = true
+			}
+		}
+		assert.True(t, found)
+	}
+	assert.Equal(t, 1, rootKinds[libunlynxaudit.KindResult])
+
+	entries, err = auditor.SendAuditLogQuery()
+	assert.NoError(t, err)
+	assert.NoError(t, libunlynxaudit.Verify(entries))
+	assert.NoError(t, libunlynxaudit.VerifySignatures(entries, el.List[1].Public))
+	assert.Error(t, libunlynxaudit.VerifySignatures(entries, el.List[0].Public))
+	otherKinds := kinds(entries)
+	assert.Equal(t, 1, otherKinds[libunlynxaudit.KindQuery])
+	assert.True(t, otherKinds[libunlynxaudit.KindProofs] > 0)
+	assert.Equal(t, 0, otherKinds[libunlynxaudit.KindResult])
+
+	// a modified entry is detected
+	entries[0].Data = entries[1].Data
+	assert.Error(t, libunlynxaudit.Verify(entries))
+
+	// only the auditors can export the audit log
+	_, err = servicesunlynx.NewUnLynxClient(el.List[1], "other").SendAuditLogQuery()
+	assert.Error(t, err)
+	err = servicesunlynx.NewUnLynxClient(el.List[1], "other").SendProtobuf(el.List[1], &servicesunlynx.AuditLogQuery{Auditor: auditor.PublicKey(), Time: time.Now().UnixNano()}, &servicesunlynx.AuditLogReply{})
+	assert.Error(t, err)
+}
@@ -24,6 +24,8 @@ type ShufflingSimulation struct {
 	NbrResponses       int
 	Proofs             bool
 	PreCompute         bool
+	// ShuffleProof is the backend of the shuffle proofs (libunlynxshuffle.NeffShuffleProof by default)
+	ShuffleProof string
 }
 
 // NewShufflingSimulation is a constructor for the simulation.
@@ -92,11 +94,25 @@ func NewShufflingSimul(tni *onet.TreeNodeInstance, sim *ShufflingSimulation) (on
 	protocol, err := protocolsunlynx.NewShufflingProtocol(tni)
 	pap := protocol.(*protocolsunlynx.ShufflingProtocol)
 	pap.Proofs = sim.Proofs
+	createProof, errBackend := libunlynxshuffle.ShuffleProofCreationFunction(sim.ShuffleProof)
+	if errBackend != nil {
+		return nil, errBackend
+	}
 	pap.ProofFunc = func(shuffleTarget, shuffledData []libunlynx.CipherVector, collectiveKey kyber.Point, beta [][]kyber.Scalar, pi []int) *libunlynxshuffle.PublishedShufflingProof {
-		proof, err := libunlynxshuffle.ShuffleProofCreation(shuffleTarget, shuffledData, libunlynx.SuiTe.Point().Base(), collectiveKey, beta, pi)
+		creation := libunlynx.StartTimer(tni.Name() + "_ShufflingProof(Creation)")
+		proof, err := createProof(shuffleTarget, shuffledData, libunlynx.SuiTe.Point().Base(), collectiveKey, beta, pi)
 		if err != nil {
 			log.Fatal(err)
 		}
+		libunlynx.EndTimer(creation)
+
+		// the verification time and the size of the proofs are what differ the most between the backends
+		verification := libunlynx.StartTimer(tni.Name() + "_ShufflingProof(Verification)")
+		if !libunlynxshuffle.ShuffleProofVerification(proof, collectiveKey) {
+			log.Fatal("invalid shuffle proof")
+		}
+		libunlynx.EndTimer(verification)
+		log.Lvl1(tni.Name(), "created a", proof.Backend, "shuffle proof of", len(proof.HashProof), "bytes for", len(shuffleTarget), "responses")
 		return &proof
 	}
 